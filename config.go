@@ -0,0 +1,152 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// configSkipFlags is the flags which are not read from nor written to the
+// config file.
+var configSkipFlags = map[string]bool{
+	"config":      true,
+	"init-config": true,
+}
+
+// setFlagsFromConfig sets the flags of fs which are not given on the command
+// line nor by the environment variables from the JSON config file at path,
+// whose keys are the flag names such as {"package": ["internal/goarch"]}. A
+// list sets the repeatable flag once per element, and an object sets the
+// old=new flag once per key. An unknown key is an error.
+func setFlagsFromConfig(fs *flag.FlagSet, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config: %w", err)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var config map[string]interface{}
+	if err := dec.Decode(&config); err != nil {
+		return fmt.Errorf("parse config %s: %w", path, err)
+	}
+
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	names := make([]string, 0, len(config))
+	for name := range config {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if fs.Lookup(name) == nil || configSkipFlags[name] {
+			return fmt.Errorf("%s: unknown key %q", path, name)
+		}
+		if set[name] {
+			continue
+		}
+		values, err := configValues(config[name])
+		if err != nil {
+			return fmt.Errorf("%s: invalid %q value: %w", path, name, err)
+		}
+		for _, value := range values {
+			if err := fs.Set(name, value); err != nil {
+				return fmt.Errorf("%s: invalid %q value %q: %w", path, name, value, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// configValues returns the flag values of the config value v.
+func configValues(v interface{}) ([]string, error) {
+	switch v := v.(type) {
+	case string:
+		return []string{v}, nil
+	case bool, json.Number:
+		return []string{fmt.Sprint(v)}, nil
+	case []interface{}:
+		var values []string
+		for _, elem := range v {
+			switch elem.(type) {
+			case string, bool, json.Number:
+				values = append(values, fmt.Sprint(elem))
+			default:
+				return nil, errors.New("list elements must be strings, booleans or numbers")
+			}
+		}
+		return values, nil
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		values := make([]string, 0, len(keys))
+		for _, key := range keys {
+			s, ok := v[key].(string)
+			if !ok {
+				return nil, errors.New("object values must be strings")
+			}
+			values = append(values, key+"="+s)
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("unsupported value %v", v)
+	}
+}
+
+// writeConfig writes the flags of fs given on the command line, by the
+// environment variables or by the config file to path as the config file
+// read by -config.
+func writeConfig(fs *flag.FlagSet, path string) error {
+	config := make(map[string]interface{})
+	fs.Visit(func(f *flag.Flag) {
+		if configSkipFlags[f.Name] {
+			return
+		}
+		config[f.Name] = configValue(f.Value)
+	})
+
+	data, err := json.MarshalIndent(config, "", "\t")
+	if err != nil {
+		return fmt.Errorf("marshal config: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("write config: %w", err)
+	}
+
+	return nil
+}
+
+// configValue returns the config value of the flag value v.
+func configValue(v flag.Value) interface{} {
+	switch v := v.(type) {
+	case *stringsFlag:
+		return []string(*v)
+	case *listFlag:
+		return []string(*v)
+	case mapFlag:
+		return map[string]string(v)
+	case flag.Getter:
+		switch g := v.Get().(type) {
+		case bool, int, int64, uint, uint64, float64, string:
+			return g
+		}
+	}
+
+	return strings.TrimSpace(v.String())
+}
@@ -0,0 +1,184 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// importedName returns the package name of the rewritten import path, which
+// is the name of the copied package if known, or the last path element.
+func (c *Copier) importedName(importPath string) string {
+	if pkg, ok := c.copiedPackages[importPath]; ok && pkg.Name != "" {
+		return pkg.Name
+	}
+
+	return path.Base(importPath)
+}
+
+// importedDecls returns the top-level names declared by the copied package of
+// the rewritten import path, or nil if unknown.
+func (c *Copier) importedDecls(importPath string) map[string]bool {
+	pkg, ok := c.copiedPackages[importPath]
+	if !ok {
+		return nil
+	}
+
+	names, err := c.topLevelNames(pkg.Dir, pkg.GoFiles)
+	if err != nil {
+		return nil
+	}
+
+	return names
+}
+
+// resolveImportCollisions aliases the imports of the Go source body whose
+// package names collide after the rewrite, and updates the references.
+//
+// The first import of the colliding name is kept, and the others are aliased
+// by prefixing their parent path element. A reference is moved to the
+// aliased import only if the selected name is declared by that package but
+// not by the first one; the ambiguous references are reported and left as is.
+func (c *Copier) resolveImportCollisions(filename, body string) (string, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, body, parser.ParseComments)
+	if err != nil {
+		return "", fmt.Errorf("parse %s: %w", filename, err)
+	}
+
+	type entry struct {
+		spec *ast.ImportSpec
+		path string
+	}
+	used := make(map[string]bool)
+	groups := make(map[string][]entry)
+	var order []string
+	for _, spec := range f.Imports {
+		p, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			return "", fmt.Errorf("unquote import path %s: %w", spec.Path.Value, err)
+		}
+
+		local := c.importedName(p)
+		if spec.Name != nil {
+			local = spec.Name.Name
+		}
+		if local == "_" || local == "." {
+			continue
+		}
+		used[local] = true
+
+		if len(groups[local]) == 0 {
+			order = append(order, local)
+		}
+		dup := false
+		for _, e := range groups[local] {
+			dup = dup || e.path == p
+		}
+		if !dup {
+			groups[local] = append(groups[local], entry{spec: spec, path: p})
+		}
+	}
+
+	// the aliases to apply, keyed by the colliding name
+	type alias struct {
+		name  string
+		decls map[string]bool
+	}
+	aliases := make(map[string][]alias)
+	for _, local := range order {
+		entries := groups[local]
+		if len(entries) < 2 {
+			continue
+		}
+		for _, e := range entries[1:] {
+			name := uniqueAlias(e.path, local, used)
+			used[name] = true
+			e.spec.Name = ast.NewIdent(name)
+			aliases[local] = append(aliases[local], alias{name: name, decls: c.importedDecls(e.path)})
+			c.infof("alias: %s imports %s as %s to resolve the %s collision", filename, e.path, name, local)
+		}
+	}
+	if len(aliases) == 0 {
+		return body, nil
+	}
+
+	firstDecls := make(map[string]map[string]bool)
+	for local := range aliases {
+		firstDecls[local] = c.importedDecls(groups[local][0].path)
+	}
+
+	ast.Inspect(f, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		x, ok := sel.X.(*ast.Ident)
+		if !ok || x.Obj != nil {
+			return true
+		}
+		candidates, ok := aliases[x.Name]
+		if !ok || firstDecls[x.Name][sel.Sel.Name] {
+			return true
+		}
+
+		var matched []string
+		for _, a := range candidates {
+			if a.decls[sel.Sel.Name] {
+				matched = append(matched, a.name)
+			}
+		}
+		switch len(matched) {
+		case 1:
+			x.Name = matched[0]
+		default:
+			c.warnf("%s: ambiguous reference %s.%s is left as is", fset.Position(sel.Pos()), x.Name, sel.Sel.Name)
+		}
+		return true
+	})
+
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, f); err != nil {
+		return "", fmt.Errorf("format %s: %w", filename, err)
+	}
+
+	return buf.String(), nil
+}
+
+// uniqueAlias returns the import alias of importPath for the colliding name,
+// which is not in used.
+func uniqueAlias(importPath, name string, used map[string]bool) string {
+	elems := strings.Split(importPath, "/")
+	alias := name
+	if len(elems) >= 2 {
+		alias = sanitizeIdent(elems[len(elems)-2]) + name
+	}
+	if !used[alias] {
+		return alias
+	}
+
+	for i := 2; ; i++ {
+		if candidate := alias + strconv.Itoa(i); !used[candidate] {
+			return candidate
+		}
+	}
+}
+
+// sanitizeIdent removes the characters which are invalid in a Go identifier.
+func sanitizeIdent(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9') {
+			return r
+		}
+		return -1
+	}, s)
+}
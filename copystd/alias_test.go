@@ -0,0 +1,67 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"go/parser"
+	"go/token"
+	"io"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveImportCollisions(t *testing.T) {
+	fsys := newMemFS()
+	for name, data := range map[string]string{
+		"/goroot/src/internal/x/sys/sys.go": "package sys\n\nfunc Foo() {}\n",
+		"/goroot/src/internal/y/sys/sys.go": "package sys\n\nfunc Bar() {}\n",
+	} {
+		if err := fsys.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := fsys.WriteFile(name, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := &Copier{Module: "example.com/m", FS: fsys, Stdout: io.Discard, Stderr: io.Discard}
+	c.init()
+	c.copiedPackages["example.com/m/x/sys"] = &Package{ImportPath: "internal/x/sys", Name: "sys", Dir: "/goroot/src/internal/x/sys", GoFiles: []string{"sys.go"}}
+	c.copiedPackages["example.com/m/y/sys"] = &Package{ImportPath: "internal/y/sys", Name: "sys", Dir: "/goroot/src/internal/y/sys", GoFiles: []string{"sys.go"}}
+
+	const body = `package foo
+
+import (
+	"example.com/m/x/sys"
+	"example.com/m/y/sys"
+)
+
+func Foo() {
+	sys.Foo()
+	sys.Bar()
+}
+`
+	got, err := c.resolveImportCollisions("foo.go", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const want = `package foo
+
+import (
+	"example.com/m/x/sys"
+	ysys "example.com/m/y/sys"
+)
+
+func Foo() {
+	sys.Foo()
+	ysys.Bar()
+}
+`
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "foo.go", got, 0); err != nil {
+		t.Errorf("the result does not parse: %v", err)
+	}
+}
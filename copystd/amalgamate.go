@@ -0,0 +1,208 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/build/constraint"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// isAmalgamated reports whether the file of pkg is concatenated into the
+// single file by -amalgamate.
+//
+// Only the non-test Go files without cgo are amalgamated.
+func isAmalgamated(pkg *Package, file string) bool {
+	return contains(pkg.GoFiles, filepath.Base(file))
+}
+
+// amalgamate concatenates the Go files of pkg into a single Go source.
+//
+// The import declarations of the files are merged into a single import
+// block with the duplicates removed. The package documentation is taken
+// from the first file which has it, and the build constraints of the files
+// are dropped since the files are the ones selected for the current build.
+func amalgamate(pkg *Package, files []*fileCopy) (string, error) {
+	// doc.go usually carries the package documentation, so put it first
+	sort.SliceStable(files, func(i, j int) bool {
+		return filepath.Base(files[i].src) == "doc.go" && filepath.Base(files[j].src) != "doc.go"
+	})
+
+	type importKey struct {
+		name string
+		path string
+	}
+	seen := make(map[importKey]bool)
+	locals := make(map[string]string)
+	var specs []importKey
+
+	var header, doc string
+	var decls bytes.Buffer
+	for i, fc := range files {
+		fset := token.NewFileSet()
+		f, err := parser.ParseFile(fset, fc.src, fc.body, parser.ParseComments)
+		if err != nil {
+			return "", fmt.Errorf("parse %s: %w", fc.src, err)
+		}
+		if f.Name.Name != pkg.Name {
+			return "", fmt.Errorf("%s: package %s does not match %s", fc.src, f.Name.Name, pkg.Name)
+		}
+		if i == 0 {
+			// keep the copyright header and the package documentation
+			header = stripBuildConstraints(fc.body[:fset.Position(f.Package).Offset])
+			if f.Doc != nil {
+				doc = header
+				header = ""
+			}
+		} else if doc == "" && f.Doc != nil {
+			doc = fc.body[fset.Position(f.Doc.Pos()).Offset:fset.Position(f.Doc.End()).Offset] + "\n"
+		}
+
+		for _, spec := range f.Imports {
+			path, err := strconv.Unquote(spec.Path.Value)
+			if err != nil {
+				return "", fmt.Errorf("unquote import path %s: %w", spec.Path.Value, err)
+			}
+			if path == "C" {
+				return "", fmt.Errorf("%s: cgo files cannot be amalgamated", fc.src)
+			}
+
+			key := importKey{path: path}
+			if spec.Name != nil {
+				key.name = spec.Name.Name
+			}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			local := key.name
+			if local == "" {
+				local = filepath.Base(path)
+			}
+			if local != "_" && local != "." {
+				if other, ok := locals[local]; ok && other != path {
+					return "", fmt.Errorf("%s: import %q collides with %q as %s", fc.src, path, other, local)
+				}
+				locals[local] = path
+			}
+			specs = append(specs, key)
+		}
+
+		// the declarations follow the package clause and the import declarations
+		start := f.Name.End()
+		for _, decl := range f.Decls {
+			if gen, ok := decl.(*ast.GenDecl); ok && gen.Tok == token.IMPORT {
+				start = gen.End()
+			}
+		}
+		fmt.Fprintf(&decls, "\n// Code from %s.\n", filepath.Base(fc.src))
+		decls.WriteString(fc.body[fset.Position(start).Offset:])
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(header)
+	if header != "" && doc != "" {
+		buf.WriteString("\n")
+	}
+	buf.WriteString(doc)
+	fmt.Fprintf(&buf, "package %s\n", pkg.Name)
+	if len(specs) > 0 {
+		buf.WriteString("\nimport (\n")
+		for _, spec := range specs {
+			if spec.name != "" {
+				buf.WriteString("\t" + spec.name + " ")
+			} else {
+				buf.WriteString("\t")
+			}
+			buf.WriteString(strconv.Quote(spec.path) + "\n")
+		}
+		buf.WriteString(")\n")
+	}
+	buf.Write(decls.Bytes())
+
+	data, err := format.Source(buf.Bytes())
+	if err != nil {
+		return "", fmt.Errorf("format amalgamated source: %w", err)
+	}
+
+	return string(data), nil
+}
+
+// duplicateDecls reports the top-level declarations of the same name in more
+// than one of the files to be amalgamated, such as the functions of the files
+// for the different platforms whose build constraints are dropped.
+func duplicateDecls(pkg *Package, files []*fileCopy) error {
+	declared := make(map[string]string) // source file name keyed by the declared name
+	var dups []string
+	add := func(name, file string) {
+		if name == "_" || name == "init" {
+			return
+		}
+		if other, ok := declared[name]; ok {
+			dups = append(dups, fmt.Sprintf("%s is declared in both %s and %s", name, other, file))
+			return
+		}
+		declared[name] = file
+	}
+
+	for _, fc := range files {
+		f, err := parser.ParseFile(token.NewFileSet(), fc.src, fc.body, 0)
+		if err != nil {
+			return fmt.Errorf("parse %s: %w", fc.src, err)
+		}
+		file := filepath.Base(fc.src)
+		for _, decl := range f.Decls {
+			switch decl := decl.(type) {
+			case *ast.FuncDecl:
+				if decl.Recv != nil && len(decl.Recv.List) > 0 {
+					add(receiverTypeName(decl.Recv.List[0].Type)+"."+decl.Name.Name, file)
+				} else {
+					add(decl.Name.Name, file)
+				}
+			case *ast.GenDecl:
+				for _, spec := range decl.Specs {
+					switch spec := spec.(type) {
+					case *ast.TypeSpec:
+						add(spec.Name.Name, file)
+					case *ast.ValueSpec:
+						for _, name := range spec.Names {
+							add(name.Name, file)
+						}
+					}
+				}
+			}
+		}
+	}
+
+	if len(dups) > 0 {
+		return fmt.Errorf("duplicate declarations in the amalgamated %s:\n\t%s", pkg.ImportPath, strings.Join(dups, "\n\t"))
+	}
+
+	return nil
+}
+
+// stripBuildConstraints removes the build constraint lines from the file
+// header src.
+func stripBuildConstraints(src string) string {
+	lines := strings.SplitAfter(src, "\n")
+	out := lines[:0]
+	for _, line := range lines {
+		text := strings.TrimSpace(line)
+		if constraint.IsGoBuild(text) || constraint.IsPlusBuild(text) {
+			continue
+		}
+		out = append(out, line)
+	}
+
+	return strings.Join(out, "")
+}
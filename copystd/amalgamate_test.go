@@ -0,0 +1,102 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"context"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestAmalgamate(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go": "// Package foo is foo.\npackage foo\n\nimport (\n\t\"fmt\"\n\t\"strings\"\n)\n\nfunc Foo() string { return fmt.Sprint(strings.ToUpper(\"foo\")) }\n",
+		"internal/foo/bar.go": "package foo\n\nimport (\n\t\"fmt\"\n\n\t\"internal/bar\"\n)\n\n// Bar is bar.\nfunc Bar() string { return fmt.Sprint(bar.Bar) }\n",
+		"internal/bar/bar.go": "package bar\n\nconst Bar = 1\n",
+	})
+	fsys := newMemFS()
+	c := testCopier(t, src, fsys, "internal/foo")
+	c.Amalgamate = true
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := fsys.paths(c.Dst), []string{"bar/bar.go", "foo/foo.go"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("copied files: got %q, want %q", got, want)
+	}
+
+	// type check the copies, with bar imported from its copy
+	fset := token.NewFileSet()
+	check := func(name string, imp types.Importer) (*ast.File, *types.Package) {
+		t.Helper()
+		data, _ := fsys.file(filepath.Join(c.Dst, filepath.FromSlash(name)))
+		f, err := parser.ParseFile(fset, name, data, parser.ParseComments)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conf := types.Config{Importer: imp}
+		pkg, err := conf.Check("example.com/m/"+f.Name.Name, fset, []*ast.File{f}, nil)
+		if err != nil {
+			t.Fatalf("%s does not compile: %v\n%s", name, err, data)
+		}
+		return f, pkg
+	}
+	_, bar := check("bar/bar.go", importer.Default())
+	foo, fooPkg := check("foo/foo.go", importerFunc(func(path string) (*types.Package, error) {
+		if path == bar.Path() {
+			return bar, nil
+		}
+		return importer.Default().Import(path)
+	}))
+
+	for _, name := range []string{"Foo", "Bar"} {
+		if fooPkg.Scope().Lookup(name) == nil {
+			t.Errorf("foo.go does not declare %s", name)
+		}
+	}
+	var imports []string
+	for _, spec := range foo.Imports {
+		path, _ := strconv.Unquote(spec.Path.Value)
+		imports = append(imports, path)
+	}
+	if want := []string{"fmt", "strings", "example.com/m/bar"}; !reflect.DeepEqual(imports, want) {
+		t.Errorf("got imports %q, want the merged %q", imports, want)
+	}
+	if gen, ok := foo.Decls[0].(*ast.GenDecl); !ok || gen.Tok != token.IMPORT || len(foo.Decls) != 3 {
+		t.Errorf("got %d declarations, want a single import block and the two functions", len(foo.Decls))
+	}
+}
+
+type importerFunc func(path string) (*types.Package, error)
+
+func (f importerFunc) Import(path string) (*types.Package, error) { return f(path) }
+
+func TestValidateNoDuplicateDecls(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go": "package foo\n\nfunc Foo() {}\n\nfunc init() {}\n\ntype T int\n\nfunc (T) String() string { return \"\" }\n",
+		"internal/foo/bar.go": "package foo\n\nfunc Foo() {}\n\nfunc init() {}\n\ntype U int\n\nfunc (U) String() string { return \"\" }\n",
+	})
+	fsys := newMemFS()
+	c := testCopier(t, src, fsys, "internal/foo")
+	c.Amalgamate = true
+	c.ValidateNoDuplicateDecls = true
+
+	err := c.Run(context.Background())
+	want := "duplicate declarations in the amalgamated internal/foo:\n\tFoo is declared in both bar.go and foo.go"
+	if err == nil || !strings.HasSuffix(err.Error(), want) {
+		t.Errorf("got error %v, want %q", err, want)
+	}
+	if paths := fsys.paths(c.Dst); len(paths) > 0 {
+		t.Errorf("files are written: %q", paths)
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// List of AsmIndent.
+const (
+	AsmIndentTab   = "tab"   // indent the assembly lines with tabs
+	AsmIndentSpace = "space" // indent the assembly lines with spaces
+)
+
+// asmTabWidth is the tab width the indentation columns are measured with.
+const asmTabWidth = 8
+
+// isAsmFile reports whether file is an assembly file.
+func isAsmFile(file string) bool {
+	return filepath.Ext(file) == ".s"
+}
+
+// canonicalAsmIndent normalizes the leading whitespace of each line of the
+// assembly source data to indent, either AsmIndentTab or AsmIndentSpace. The
+// rest of the lines, including the instruction operands, is left as is.
+//
+// The indentation is measured in columns with the tabs of asmTabWidth. With
+// AsmIndentTab it is rounded up to whole tabs, so that a line indented by a
+// few spaces is indented by a tab; with AsmIndentSpace the tabs are expanded.
+func canonicalAsmIndent(data, indent string) string {
+	lines := strings.SplitAfter(data, "\n")
+	for i, line := range lines {
+		body := strings.TrimLeft(line, " \t")
+		if len(body) == len(line) {
+			continue
+		}
+
+		col := 0
+		for _, r := range line[:len(line)-len(body)] {
+			if r == '\t' {
+				col += asmTabWidth - col%asmTabWidth
+			} else {
+				col++
+			}
+		}
+		switch {
+		case body == "" || body == "\n" || body == "\r\n":
+			// the trailing whitespace of a blank line is not an indentation
+			lines[i] = body
+		case indent == AsmIndentTab:
+			lines[i] = strings.Repeat("\t", (col+asmTabWidth-1)/asmTabWidth) + body
+		default:
+			lines[i] = strings.Repeat(" ", col) + body
+		}
+	}
+
+	return strings.Join(lines, "")
+}
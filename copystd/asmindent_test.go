@@ -0,0 +1,78 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestAsmIndent(t *testing.T) {
+	// mixed indentation, with the operands aligned by spaces and tabs
+	const asm = "#include \"textflag.h\"\n" +
+		"\n" +
+		"TEXT ·add(SB),NOSPLIT,$0-24\n" +
+		"    MOVQ  a+0(FP), AX\n" +
+		"\tMOVQ\tb+8(FP), BX\n" +
+		"  \t \n" +
+		"\t  ADDQ BX,   AX\n" +
+		"\tMOVQ AX, ret+16(FP)  // result\n" +
+		"\tRET\n"
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go":      "package foo\n\nfunc add(a, b int) int\n",
+		"internal/foo/foo_amd64.s": asm,
+		"internal/foo/foo_stub.go": "//go:build !amd64\n\npackage foo\n\nfunc add(a, b int) int { return a + b }\n",
+	})
+
+	tests := []struct {
+		indent string
+		want   string
+	}{
+		{
+			indent: "",
+			want:   asm,
+		},
+		{
+			indent: AsmIndentTab,
+			want: "#include \"textflag.h\"\n" +
+				"\n" +
+				"TEXT ·add(SB),NOSPLIT,$0-24\n" +
+				"\tMOVQ  a+0(FP), AX\n" +
+				"\tMOVQ\tb+8(FP), BX\n" +
+				"\n" +
+				"\t\tADDQ BX,   AX\n" +
+				"\tMOVQ AX, ret+16(FP)  // result\n" +
+				"\tRET\n",
+		},
+		{
+			indent: AsmIndentSpace,
+			want: "#include \"textflag.h\"\n" +
+				"\n" +
+				"TEXT ·add(SB),NOSPLIT,$0-24\n" +
+				"    MOVQ  a+0(FP), AX\n" +
+				"        MOVQ\tb+8(FP), BX\n" +
+				"\n" +
+				"          ADDQ BX,   AX\n" +
+				"        MOVQ AX, ret+16(FP)  // result\n" +
+				"        RET\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run("indent="+tt.indent, func(t *testing.T) {
+			fsys := newMemFS()
+			c := testCopier(t, src, fsys, "internal/foo")
+			c.AsmIndent = tt.indent
+			c.AllFiles = true
+
+			if err := c.Run(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			if got, _ := fsys.file(filepath.Join(c.Dst, "foo", "foo_amd64.s")); got != tt.want {
+				t.Errorf("got foo_amd64.s\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
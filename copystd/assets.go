@@ -0,0 +1,82 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+)
+
+// assetFiles returns the non-Go source files of pkg, such as the assembly and
+// C files, which are used verbatim.
+func assetFiles(pkg *Package) []string {
+	var files []string
+	for _, names := range [...][]string{
+		pkg.CFiles, pkg.CXXFiles, pkg.MFiles, pkg.HFiles, pkg.FFiles,
+		pkg.SFiles, pkg.SwigFiles, pkg.SwigCXXFiles, pkg.SysoFiles,
+	} {
+		for _, name := range names {
+			files = append(files, filepath.Join(pkg.Dir, name))
+		}
+	}
+
+	return files
+}
+
+// linkAssets symlinks the asset and embedded files of pkg from the destination
+// directory to the source, so that the edits of either side reflect to the
+// other.
+//
+// The existing destination files are replaced by the links.
+func (c *Copier) linkAssets(pkg *Package) error {
+	files := assetFiles(pkg)
+	embeds := embedFiles(pkg)
+	if len(files) == 0 && len(embeds) == 0 {
+		return nil
+	}
+
+	dir := c.packageDir(pkg)
+	if m := c.compacted[pkg.ImportPath]; m != nil {
+		dir = c.packageDir(m.into)
+	}
+
+	for _, src := range files {
+		if err := c.symlink(src, filepath.Join(dir, c.renameFile(src, filepath.Base(src)))); err != nil {
+			return err
+		}
+	}
+
+	// the embedded files are relocated along with their //go:embed patterns
+	for _, name := range embeds {
+		rel := relocateEmbedPath(filepath.ToSlash(name), c.RewriteEmbedPattern)
+		if err := c.symlink(filepath.Join(pkg.Dir, name), filepath.Join(dir, filepath.FromSlash(rel))); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// symlink links dst to the src file, replacing the existing dst file.
+func (c *Copier) symlink(src, dst string) error {
+	if c.script != nil {
+		c.script.link(src, dst)
+		return nil
+	}
+
+	if err := c.mkdirAll(filepath.Dir(dst)); err != nil {
+		return err
+	}
+	if err := c.FS.Remove(dst); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("remove %s file: %w", dst, err)
+	}
+	if err := c.FS.Symlink(src, dst); err != nil {
+		return fmt.Errorf("symlink %s: %w", dst, err)
+	}
+	c.infof("symlink: %s -> %s", dst, src)
+
+	return nil
+}
@@ -0,0 +1,45 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"context"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSymlinkAssets(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go":      "package foo\n\nimport (\n\t_ \"embed\"\n\n\t\"internal/bar\"\n)\n\n//go:embed data.txt\nvar data string\n\nfunc Foo() int { return bar.Bar }\n",
+		"internal/foo/data.txt":    "data\n",
+		"internal/foo/foo_amd64.s": "#include \"textflag.h\"\n",
+		"internal/bar/bar.go":      "package bar\n\nconst Bar = 1\n",
+	})
+	fsys := newMemFS()
+	c := testCopier(t, src, fsys, "internal/foo")
+	c.SymlinkAssets = true
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	srcDir := filepath.Join(src, "src", "internal", "foo")
+	for _, name := range []string{"data.txt", "foo_amd64.s"} {
+		f := fsys.files[memPath(filepath.Join(c.Dst, "foo", name))]
+		if f == nil || f.Mode&fs.ModeSymlink == 0 || string(f.Data) != filepath.Join(srcDir, name) {
+			t.Errorf("%s is not the symlink to the source: %+v", name, f)
+		}
+	}
+	for _, name := range []string{"foo/foo.go", "bar/bar.go"} {
+		f := fsys.files[memPath(filepath.Join(c.Dst, filepath.FromSlash(name)))]
+		if f == nil || !f.Mode.IsRegular() {
+			t.Errorf("%s is not the regular file: %+v", name, f)
+		}
+	}
+	if foo, _ := fsys.file(filepath.Join(c.Dst, "foo", "foo.go")); !strings.Contains(foo, `"example.com/m/bar"`) {
+		t.Errorf("foo.go is not the rewritten copy:\n%s", foo)
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// restrictedDirectiveRe matches the //go:linkname directive of any form and
+// the other compiler directives which fail or need care to build outside of
+// the std, such as //go:cgo_import_dynamic and //go:nosplit.
+var restrictedDirectiveRe = regexp.MustCompile(`(?m)^//go:(?:linkname|cgo_[a-z_]+|nosplit|systemstack|nowritebarrier|nowritebarrierrec|yeswritebarrierrec|norace|uintptrkeepalive)(?:[ \t].*)?$`)
+
+// auditReport maps the destination path of the copied Go file to the reasons
+// it is risky to vendor, reported by -audit.
+type auditReport map[string][]string
+
+// add records the reasons of the copied Go file whose source is body: the
+// unsafe import and each restricted compiler directive.
+func (r auditReport) add(file, body string) error {
+	f, err := parser.ParseFile(token.NewFileSet(), file, body, parser.ImportsOnly)
+	if err != nil {
+		return fmt.Errorf("parse %s: %w", file, err)
+	}
+
+	var reasons []string
+	for _, spec := range f.Imports {
+		if spec.Path.Value == `"unsafe"` {
+			reasons = append(reasons, "imports unsafe")
+			break
+		}
+	}
+	for _, directive := range restrictedDirectiveRe.FindAllString(body, -1) {
+		reasons = append(reasons, "uses "+strings.TrimSpace(directive))
+	}
+	if len(reasons) > 0 {
+		r[file] = reasons
+	}
+
+	return nil
+}
+
+// directiveFiles returns the number of the files using the restricted
+// compiler directives.
+func (r auditReport) directiveFiles() int {
+	n := 0
+	for _, reasons := range r {
+		for _, reason := range reasons {
+			if strings.HasPrefix(reason, "uses //go:") {
+				n++
+				break
+			}
+		}
+	}
+
+	return n
+}
+
+// print prints the files and their reasons to w.
+func (r auditReport) print(w io.Writer) {
+	files := make([]string, 0, len(r))
+	for file := range r {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	for _, file := range files {
+		fmt.Fprintln(w, file)
+		for _, reason := range r[file] {
+			fmt.Fprintf(w, "\t%s\n", reason)
+		}
+	}
+}
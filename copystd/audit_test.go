@@ -0,0 +1,42 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAudit(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/unsafe.go":   "package foo\n\nimport \"unsafe\"\n\nvar Size = unsafe.Sizeof(0)\n",
+		"internal/foo/linkname.go": "package foo\n\nimport _ \"unsafe\"\n\n//go:linkname nanotime runtime.nanotime\nfunc nanotime() int64\n",
+		"internal/foo/foo.go":      "package foo\n\nfunc Foo() {}\n",
+		"internal/foo/foo.s":       "",
+	})
+	c := testCopier(t, src, newMemFS(), "internal/foo")
+	c.Audit = true
+	var stdout strings.Builder
+	c.Stdout = &stdout
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	out := stdout.String()
+	dir := filepath.Join(c.Dst, "foo")
+	for _, want := range []string{
+		filepath.Join(dir, "linkname.go") + "\n\timports unsafe\n\tuses //go:linkname nanotime runtime.nanotime\n",
+		filepath.Join(dir, "unsafe.go") + "\n\timports unsafe\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("got\n%s\nwant\n%s", out, want)
+		}
+	}
+	if strings.Contains(out, filepath.Join(dir, "foo.go")) {
+		t.Errorf("foo.go is flagged:\n%s", out)
+	}
+}
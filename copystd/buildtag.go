@@ -0,0 +1,100 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"fmt"
+	"go/build/constraint"
+	"strings"
+)
+
+// replaceBuildTags replaces the build tags of the //go:build and // +build
+// constraint lines in body according to repl.
+//
+// Only the tag tokens of the constraint lines placed before the package
+// clause are touched, any other part of body including the import specs is
+// left as is.
+func replaceBuildTags(body string, repl map[string]string) (string, error) {
+	if len(repl) == 0 {
+		return body, nil
+	}
+
+	lines := strings.SplitAfter(body, "\n")
+	for i, line := range lines {
+		text := strings.TrimSpace(line)
+		if strings.HasPrefix(text, "package ") {
+			break
+		}
+		if !constraint.IsGoBuild(text) && !constraint.IsPlusBuild(text) {
+			continue
+		}
+
+		expr, err := constraint.Parse(text)
+		if err != nil {
+			return "", fmt.Errorf("parse build constraint %q: %w", text, err)
+		}
+		if !rewriteTags(expr, repl) {
+			continue
+		}
+
+		newline := ""
+		if strings.HasSuffix(line, "\n") {
+			newline = "\n"
+		}
+		if constraint.IsGoBuild(text) {
+			lines[i] = "//go:build " + expr.String() + newline
+			continue
+		}
+		plusLines, err := constraint.PlusBuildLines(expr)
+		if err != nil {
+			return "", fmt.Errorf("format +build constraint %q: %w", text, err)
+		}
+		lines[i] = strings.Join(plusLines, "\n") + newline
+	}
+
+	return strings.Join(lines, ""), nil
+}
+
+// rewriteTags rewrites the tags of x according to repl and reports whether
+// any tag was rewritten.
+func rewriteTags(x constraint.Expr, repl map[string]string) bool {
+	switch x := x.(type) {
+	case *constraint.TagExpr:
+		if tag, ok := repl[x.Tag]; ok {
+			x.Tag = tag
+			return true
+		}
+	case *constraint.NotExpr:
+		return rewriteTags(x.X, repl)
+	case *constraint.AndExpr:
+		// evaluate both sides
+		left := rewriteTags(x.X, repl)
+		return rewriteTags(x.Y, repl) || left
+	case *constraint.OrExpr:
+		left := rewriteTags(x.X, repl)
+		return rewriteTags(x.Y, repl) || left
+	}
+
+	return false
+}
+
+// validateBuildConstraints validates the syntax of the //go:build and
+// // +build constraint lines placed before the package clause of the Go
+// source body.
+func validateBuildConstraints(file, body string) error {
+	for i, line := range strings.Split(body, "\n") {
+		text := strings.TrimSpace(line)
+		if strings.HasPrefix(text, "package ") {
+			break
+		}
+		if !constraint.IsGoBuild(text) && !constraint.IsPlusBuild(text) {
+			continue
+		}
+		if _, err := constraint.Parse(text); err != nil {
+			return fmt.Errorf("%s:%d: invalid build constraint %q: %w", file, i+1, text, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,81 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReplaceBuildTagImports(t *testing.T) {
+	// the tags are the elements of the import path, which are replaced in the
+	// constraints only
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go": `//go:build !bar || internal
+// +build !bar internal
+
+package foo
+
+import "internal/bar"
+
+const tags = "bar internal"
+
+var _ = bar.Bar
+`,
+		"internal/bar/bar.go": "package bar\n\nconst Bar = 1\n",
+	})
+	fsys := newMemFS()
+	c := testCopier(t, src, fsys, "internal/foo")
+	c.ReplaceBuildTag = map[string]string{"bar": "foo_bar", "internal": "example"}
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	foo, _ := fsys.file(filepath.Join(c.Dst, "foo", "foo.go"))
+	want := `//go:build !foo_bar || example
+// +build !foo_bar example
+
+package foo
+
+import "example.com/m/bar"
+
+const tags = "bar internal"
+
+var _ = bar.Bar
+`
+	if foo != want {
+		t.Errorf("got foo.go\n%s\nwant\n%s", foo, want)
+	}
+}
+
+func TestValidateBuildTags(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go": "//go:build !plan9\n\npackage foo\n",
+	})
+
+	for _, validate := range []bool{false, true} {
+		fsys := newMemFS()
+		c := testCopier(t, src, fsys, "internal/foo")
+		c.ReplaceBuildTag = map[string]string{"plan9": "plan9 &&"}
+		c.ValidateBuildTags = validate
+
+		err := c.Run(context.Background())
+		if !validate {
+			if err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		want := filepath.Join(c.Dst, "foo", "foo.go") + `:1: invalid build constraint "//go:build !plan9 &&"`
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("got error %v, want %q", err, want)
+		}
+		if paths := fsys.paths(c.Dst); len(paths) > 0 {
+			t.Errorf("files are written: %q", paths)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+)
+
+// checkCaseCollision reports an error if the rewritten import path differs
+// only in case from another path copied by the run.
+//
+// Such paths are mapped to the same directory on a case-insensitive file
+// system, and the packages would be silently merged.
+func (c *Copier) checkCaseCollision(importPath string) error {
+	key := strings.ToLower(importPath)
+	if other, ok := c.foldedPaths[key]; ok && other != importPath {
+		return fmt.Errorf("import paths %s and %s differ only in case", other, importPath)
+	}
+	c.foldedPaths[key] = importPath
+
+	return nil
+}
+
+// dstSource is the source file which produced a destination file.
+type dstSource struct {
+	src string
+	sum [sha256.Size]byte
+}
+
+// claimDst records that the src file is copied to the dst file with body, and
+// reports an error if another source file is copied to the same dst with a
+// different content, such as cmd/internal/foo/foo.go and internal/foo/foo.go
+// which are both flattened to foo/foo.go.
+//
+// With AllowOverwrite the last writer wins as is.
+func (c *Copier) claimDst(src, dst, body string) error {
+	sum := sha256.Sum256([]byte(body))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if prev, ok := c.dstSources[dst]; ok && prev.src != src && prev.sum != sum && !c.AllowOverwrite {
+		return fmt.Errorf("%s and %s are both copied to %s with different contents; add a -rewrite rule to disambiguate, or use -allow-overwrite", prev.src, src, dst)
+	}
+	c.dstSources[dst] = &dstSource{src: src, sum: sum}
+
+	return nil
+}
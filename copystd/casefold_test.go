@@ -0,0 +1,34 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCaseCollision(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/bar/bar.go":   "package bar\n\nimport (\n\tupper \"internal/Foo\"\n\t\"internal/foo\"\n)\n\nvar _, _ = upper.Upper, foo.Lower\n",
+		"internal/Foo/upper.go": "package foo\n\nconst Upper = 1\n",
+		"internal/foo/lower.go": "package foo\n\nconst Lower = 1\n",
+	})
+	if _, err := os.Stat(filepath.Join(src, "src", "internal", "foo", "upper.go")); err == nil {
+		t.Skip("the file system is case-insensitive")
+	}
+	fsys := newMemFS()
+	c := testCopier(t, src, fsys, "internal/bar")
+
+	err := c.Run(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "differ only in case") ||
+		!strings.Contains(err.Error(), "example.com/m/Foo") || !strings.Contains(err.Error(), "example.com/m/foo") {
+		t.Errorf("got error %v, want the case collision of example.com/m/Foo and example.com/m/foo", err)
+	}
+	if paths := fsys.paths(c.Dst); len(paths) > 0 {
+		t.Errorf("files are written: %q", paths)
+	}
+}
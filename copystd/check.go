@@ -0,0 +1,223 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// FileChange is a destination file a copy would change.
+type FileChange struct {
+	Path    string // destination file path
+	Package string // import path of the source package, empty for the generated files such as go.mod
+	New     bool   // whether the file does not exist yet, that is, added upstream
+	Removed bool   // whether the Go file of a copied package is no longer copied, that is, removed upstream
+	Added   int    // number of the lines added
+	Deleted int    // number of the lines deleted
+}
+
+// recordFS wraps the FileSystem of the dry run to record the files written or
+// removed with their content before the run, for Check and Patch.
+type recordFS struct {
+	FileSystem
+
+	mu    sync.Mutex
+	paths []string              // the recorded paths in the order written
+	files map[string]*patchFile // keyed by the path, with the content before the run
+}
+
+var _ FileSystem = (*recordFS)(nil)
+
+func (f *recordFS) WriteFile(name string, data []byte, perm os.FileMode) error {
+	if err := f.record(name); err != nil {
+		return err
+	}
+
+	return f.FileSystem.WriteFile(name, data, perm)
+}
+
+func (f *recordFS) Remove(name string) error {
+	if err := f.record(name); err != nil {
+		return err
+	}
+
+	return f.FileSystem.Remove(name)
+}
+
+// record records the content of the file name before the run unless done.
+func (f *recordFS) record(name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.files[name] != nil {
+		return nil
+	}
+	old, err := f.FileSystem.ReadFile(name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if f.files == nil {
+		f.files = make(map[string]*patchFile)
+	}
+	f.files[name] = &patchFile{path: name, old: old, created: err != nil}
+	f.paths = append(f.paths, name)
+
+	return nil
+}
+
+// changed returns the recorded files which are changed by the run with the
+// content after it, including the existing ones removed, such as by Prune.
+func (f *recordFS) changed() ([]*patchFile, error) {
+	var files []*patchFile
+	for _, name := range f.paths {
+		pf := f.files[name]
+		data, err := f.FileSystem.ReadFile(name)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			if pf.created {
+				continue
+			}
+			pf.deleted = true
+		case err != nil:
+			return nil, err
+		case !pf.created && bytes.Equal(pf.old, data):
+			continue
+		}
+		pf.new = data
+		files = append(files, pf)
+	}
+
+	return files, nil
+}
+
+// recordChanges runs the copy without writing anything, and returns the files
+// it would change against the existing Dst sorted by the path, including the
+// Go files left in the directories of the copied packages which are no longer
+// copied. c is the copy of the Copier for the run, which is initialized.
+func (c *Copier) recordChanges(ctx context.Context) ([]*patchFile, error) {
+	c.DryRun = true
+	c.EmitScript = ""
+	c.init()
+	fsys := &recordFS{FileSystem: c.FS}
+	c.FS = fsys
+	c.checking = true
+
+	if err := c.run(ctx); err != nil {
+		return nil, err
+	}
+	files, err := fsys.changed()
+	if err != nil {
+		return nil, err
+	}
+	removed, err := c.removedFiles()
+	if err != nil {
+		return nil, err
+	}
+	files = append(files, removed...)
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].path < files[j].path
+	})
+
+	return files, nil
+}
+
+// Check computes the files a copy of the packages, or of Packages if nil,
+// would change against the existing Dst without writing anything, including
+// the Go files left in the directories of the copied packages which are no
+// longer copied. It reports whether any file would change along with the
+// changes sorted by the path.
+//
+// The steps skipped by DryRun, such as Manifest and Tidy, are skipped as well.
+func (c *Copier) Check(ctx context.Context, packages []string) (changed bool, diff []FileChange, err error) {
+	r := *c
+	if packages != nil {
+		r.Packages = packages
+	}
+	files, err := r.recordChanges(ctx)
+	if err != nil {
+		return false, nil, err
+	}
+
+	sources := make(map[string]string) // source import paths keyed by the absolute destination file path
+	for _, f := range r.copiedFiles {
+		if abs, err := filepath.Abs(f.Dest); err == nil {
+			sources[abs] = f.Package
+		}
+	}
+	dirs := make(map[string]string) // source import paths keyed by the absolute destination directory
+	for _, pkg := range r.copiedPackages {
+		if abs, err := filepath.Abs(r.packageDir(pkg)); err == nil && r.compacted[pkg.ImportPath] == nil {
+			dirs[abs] = pkg.ImportPath
+		}
+	}
+
+	changes := make([]FileChange, 0, len(files))
+	for _, f := range files {
+		change := FileChange{Path: f.path, New: f.created, Removed: f.deleted}
+		if abs, err := filepath.Abs(f.path); err == nil {
+			change.Package = sources[abs]
+			if f.deleted {
+				// the removed file is no longer of the copied files
+				change.Package = dirs[filepath.Dir(abs)]
+			}
+		}
+		for _, op := range diffLines(splitLines(f.old), splitLines(f.new)) {
+			switch op.kind {
+			case '+':
+				change.Added++
+			case '-':
+				change.Deleted++
+			}
+		}
+		changes = append(changes, change)
+	}
+
+	return len(changes) > 0, changes, nil
+}
+
+// removedFiles returns the Go files in the destination directories of the
+// copied packages which were not written by the run, as deleted.
+func (c *Copier) removedFiles() ([]*patchFile, error) {
+	var removed []*patchFile
+	for _, pkg := range c.copiedPackages {
+		if c.compacted[pkg.ImportPath] != nil {
+			continue
+		}
+		dir := c.packageDir(pkg)
+		entries, err := c.FS.ReadDir(dir)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read %s dir: %w", dir, err)
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || !isGoFile(entry.Name()) {
+				continue
+			}
+			file := filepath.Join(dir, entry.Name())
+			if abs, err := filepath.Abs(file); err == nil && c.writtenFiles[abs] {
+				continue
+			}
+			data, err := c.FS.ReadFile(file)
+			if errors.Is(err, fs.ErrNotExist) {
+				// removed by the run, which the FileSystem reports
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("read %s file: %w", file, err)
+			}
+			removed = append(removed, &patchFile{path: file, old: data, deleted: true})
+		}
+	}
+
+	return removed, nil
+}
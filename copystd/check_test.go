@@ -0,0 +1,66 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go": "package foo\n\nimport \"internal/bar\"\n\nfunc Foo() int { return bar.Bar }\n",
+		"internal/bar/bar.go": "package bar\n\nconst Bar = 1\n",
+		"internal/bar/old.go": "package bar\n\nconst Old = 1\n",
+	})
+	fsys := newMemFS()
+	c := testCopier(t, src, fsys, "internal/foo")
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	changed, diff, err := c.Check(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed || len(diff) > 0 {
+		t.Errorf("up to date: got changed %t, %+v", changed, diff)
+	}
+
+	// bar changes upstream
+	srcDir := filepath.Join(src, "src", "internal", "bar")
+	if err := os.WriteFile(filepath.Join(srcDir, "bar.go"), []byte("package bar\n\nconst Bar = 2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(srcDir, "new.go"), []byte("package bar\n\nconst New = 1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(srcDir, "old.go")); err != nil {
+		t.Fatal(err)
+	}
+	before := fsys.paths(c.Dst)
+
+	changed, diff, err = c.Check(context.Background(), []string{"internal/foo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dstDir := filepath.Join(c.Dst, "bar")
+	want := []FileChange{
+		{Path: filepath.Join(dstDir, "bar.go"), Package: "internal/bar", Added: 1, Deleted: 1},
+		{Path: filepath.Join(dstDir, "new.go"), Package: "internal/bar", New: true, Added: 3},
+		{Path: filepath.Join(dstDir, "old.go"), Package: "internal/bar", Removed: true, Deleted: 3},
+	}
+	if !changed || !reflect.DeepEqual(diff, want) {
+		t.Errorf("after the source edit: got changed %t\n%+v\nwant\n%+v", changed, diff, want)
+	}
+	if got := fsys.paths(c.Dst); !reflect.DeepEqual(got, before) {
+		t.Errorf("Check writes the files: got %q, want %q", got, before)
+	}
+	if bar, _ := fsys.file(filepath.Join(dstDir, "bar.go")); bar != "package bar\n\nconst Bar = 1\n" {
+		t.Errorf("Check writes bar.go:\n%s", bar)
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// cleanupEmptyDirs removes the empty directories under root, and the
+// directories which become empty by that. root itself is kept.
+//
+// A directory which has any file, including the files not written by
+// go-copystd, is never removed.
+func (c *Copier) cleanupEmptyDirs(root string) error {
+	_, err := c.removeEmptyDirs(root, true)
+	return err
+}
+
+// removeEmptyDirs removes the dir if it is empty after removing its empty
+// subdirectories, and reports whether dir was removed.
+func (c *Copier) removeEmptyDirs(dir string, isRoot bool) (bool, error) {
+	entries, err := c.FS.ReadDir(dir)
+	if err != nil {
+		return false, fmt.Errorf("read %s dir: %w", dir, err)
+	}
+
+	empty := true
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			empty = false
+			continue
+		}
+		removed, err := c.removeEmptyDirs(filepath.Join(dir, entry.Name()), false)
+		if err != nil {
+			return false, err
+		}
+		if !removed {
+			empty = false
+		}
+	}
+	if !empty || isRoot {
+		return false, nil
+	}
+
+	if err := c.FS.Remove(dir); err != nil {
+		return false, fmt.Errorf("remove %s dir: %w", dir, err)
+	}
+	c.infof("remove empty dir: %s", dir)
+
+	return true, nil
+}
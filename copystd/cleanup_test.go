@@ -0,0 +1,55 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"testing"
+)
+
+func TestCleanupEmpty(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go": "package foo\n\nfunc Foo() {}\n",
+		"internal/bar/bar.go": "package bar\n\nfunc Bar() {}\n",
+	})
+	fsys := newMemFS()
+	c := testCopier(t, src, fsys, "internal/foo", "internal/bar")
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// bar is emptied, and the user adds a file in a new directory
+	if err := fsys.Remove(filepath.Join(c.Dst, "bar", "bar.go")); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.MkdirAll(filepath.Join(c.Dst, "bar", "nested"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.MkdirAll(filepath.Join(c.Dst, "notes", "empty"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.WriteFile(filepath.Join(c.Dst, "notes", "TODO"), []byte("keep\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	c.Packages = []string{"internal/foo"}
+	c.CleanupEmpty = true
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dir := range []string{"bar", filepath.Join("notes", "empty")} {
+		if _, err := fsys.Stat(filepath.Join(c.Dst, dir)); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("the empty %s is not removed: %v", dir, err)
+		}
+	}
+	for _, name := range []string{c.Dst, filepath.Join(c.Dst, "foo", "foo.go"), filepath.Join(c.Dst, "notes", "TODO")} {
+		if _, err := fsys.Stat(name); err != nil {
+			t.Errorf("%s is removed: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// list of Copier.OnCollision policies.
+const (
+	OnCollisionError  = "error"
+	OnCollisionSuffix = "suffix"
+)
+
+// resolveCollision records the destination directory of the target package,
+// and reports an error if another copied package is flattened to the same
+// one, such as internal/trace and cmd/trace both to trace. With OnCollision
+// suffix, the one having the cmd or internal elements, or else the target, is
+// mapped to the directory suffixed by them instead, such as trace_cmd, so that
+// the imports of it follow.
+func (c *Copier) resolveCollision(target *Package) error {
+	dir := c.packageDir(target)
+	other, ok := c.dstDirs[dir]
+	if !ok || other.ImportPath == target.ImportPath {
+		c.dstDirs[dir] = target
+		return nil
+	}
+	if c.OnCollision != OnCollisionSuffix {
+		return fmt.Errorf("%s and %s are both copied to %s; map either with -map %s=<path>, or use -on-collision=suffix",
+			other.ImportPath, target.ImportPath, dir, target.ImportPath)
+	}
+
+	moved := target
+	if collisionSuffix(target.ImportPath) == "" && collisionSuffix(other.ImportPath) != "" {
+		moved = other
+		delete(c.copiedPackages, c.rewriteImportPath(other.ImportPath))
+		c.dstDirs[dir] = target
+	}
+	base := collisionSuffix(moved.ImportPath)
+	if base == "" {
+		base = "copy"
+	}
+	rel, err := filepath.Rel(c.Dst, dir)
+	if err != nil {
+		return fmt.Errorf("resolve %s: %w", dir, err)
+	}
+	for i := 1; ; i++ {
+		suffix := base
+		if i > 1 {
+			suffix += strconv.Itoa(i)
+		}
+		to := filepath.ToSlash(rel) + "_" + suffix
+		if rel == "." {
+			to = suffix
+		}
+		if _, ok := c.dstDirs[filepath.Join(c.Dst, filepath.FromSlash(to))]; !ok {
+			c.rewriteRules = append([]rewriteRule{{From: moved.ImportPath, To: to, Exact: true}}, c.rewriteRules...)
+			break
+		}
+	}
+	newDir := c.packageDir(moved)
+	if _, ok := c.dstDirs[newDir]; ok {
+		return fmt.Errorf("%s and %s are both copied to %s even with -on-collision=suffix; map either with -map", other.ImportPath, target.ImportPath, newDir)
+	}
+	c.dstDirs[newDir] = moved
+	if moved == other {
+		c.copiedPackages[c.rewriteImportPath(other.ImportPath)] = other
+	}
+	c.warnf("collision: %s and %s are both copied to %s, copy %s to %s instead", other.ImportPath, target.ImportPath, dir, moved.ImportPath, newDir)
+
+	return nil
+}
+
+// collisionSuffix returns the cmd and internal elements of importPath joined
+// by underscores.
+func collisionSuffix(importPath string) string {
+	var dropped []string
+	for _, elem := range strings.Split(importPath, "/") {
+		if elem == "cmd" || elem == "internal" {
+			dropped = append(dropped, elem)
+		}
+	}
+
+	return strings.Join(dropped, "_")
+}
@@ -0,0 +1,297 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// merge is the package merged into its importer by -compact-output.
+type merge struct {
+	pkg  *Package // merged package
+	into *Package // package pkg is merged into
+}
+
+// planCompaction decides which of the pkgs are merged into their importer by
+// -compact-output and records them to compacted.
+//
+// A package is merged if it is small enough, has no cgo or assembly files,
+// is imported by exactly one of the pkgs (not from its external tests), and
+// its top-level declarations do not collide with the importer's.
+func (c *Copier) planCompaction(pkgs []*Package) error {
+	byPath := make(map[string]*Package)
+	for _, pkg := range pkgs {
+		byPath[pkg.ImportPath] = pkg
+	}
+
+	importers := make(map[string][]*Package)
+	for _, pkg := range pkgs {
+		seen := make(map[string]bool)
+		for _, imps := range [...][]string{pkg.Imports, pkg.TestImports, pkg.XTestImports} {
+			for _, imp := range imps {
+				if _, ok := byPath[imp]; ok && !seen[imp] {
+					seen[imp] = true
+					importers[imp] = append(importers[imp], pkg)
+				}
+			}
+		}
+	}
+
+	candidates := make(map[string]*Package)
+	for _, pkg := range pkgs {
+		if len(importers[pkg.ImportPath]) != 1 || !c.isSmallPackage(pkg) {
+			continue
+		}
+		into := importers[pkg.ImportPath][0]
+		if !contains(into.Imports, pkg.ImportPath) || contains(into.XTestImports, pkg.ImportPath) {
+			continue
+		}
+		candidates[pkg.ImportPath] = into
+	}
+
+	paths := make([]string, 0, len(candidates))
+	for path := range candidates {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		into := candidates[path]
+		if _, ok := candidates[into.ImportPath]; ok {
+			// do not chain the merges
+			continue
+		}
+
+		collide, err := c.declsCollide(byPath[path], into)
+		if err != nil {
+			return err
+		}
+		if collide {
+			c.warnf("%s is not merged into %s: top-level declarations collide", path, into.ImportPath)
+			continue
+		}
+
+		c.infof("compact: %s -> %s", path, into.ImportPath)
+		c.compacted[path] = &merge{pkg: byPath[path], into: into}
+	}
+
+	return nil
+}
+
+// isSmallPackage reports whether the pkg is under the -compact-max-files and
+// -compact-max-bytes thresholds.
+func (c *Copier) isSmallPackage(pkg *Package) bool {
+	if pkg.Name == "main" || len(pkg.GoFiles) == 0 || len(pkg.GoFiles) > c.CompactMaxFiles ||
+		len(pkg.CgoFiles) > 0 || len(pkg.SFiles) > 0 {
+		return false
+	}
+
+	var size int64
+	for _, name := range pkg.GoFiles {
+		fi, err := c.FS.Stat(filepath.Join(pkg.Dir, name))
+		if err != nil {
+			return false
+		}
+		size += fi.Size()
+	}
+
+	return size <= int64(c.CompactMaxBytes)
+}
+
+// declsCollide reports whether the top-level declarations of the non-test
+// files of pkg collide with the declarations of the into package.
+func (c *Copier) declsCollide(pkg, into *Package) (bool, error) {
+	names, err := c.topLevelNames(pkg.Dir, pkg.GoFiles)
+	if err != nil {
+		return false, err
+	}
+	intoNames, err := c.topLevelNames(into.Dir, append(append([]string{}, into.GoFiles...), into.TestGoFiles...))
+	if err != nil {
+		return false, err
+	}
+
+	for name := range names {
+		if intoNames[name] {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// topLevelNames returns the package-level identifiers declared in the files
+// in dir, except methods, init functions and blank identifiers.
+func (c *Copier) topLevelNames(dir string, files []string) (map[string]bool, error) {
+	names := make(map[string]bool)
+	add := func(ident *ast.Ident) {
+		if ident.Name != "_" {
+			names[ident.Name] = true
+		}
+	}
+
+	fset := token.NewFileSet()
+	for _, name := range files {
+		src, err := c.FS.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("read %s file: %w", name, err)
+		}
+		f, err := parser.ParseFile(fset, filepath.Join(dir, name), src, 0)
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %w", name, err)
+		}
+
+		for _, decl := range f.Decls {
+			switch decl := decl.(type) {
+			case *ast.FuncDecl:
+				if decl.Recv == nil && decl.Name.Name != "init" {
+					add(decl.Name)
+				}
+			case *ast.GenDecl:
+				for _, spec := range decl.Specs {
+					switch spec := spec.(type) {
+					case *ast.TypeSpec:
+						add(spec.Name)
+					case *ast.ValueSpec:
+						for _, name := range spec.Names {
+							add(name)
+						}
+					}
+				}
+			}
+		}
+	}
+
+	return names, nil
+}
+
+// mergedInto returns the packages merged into pkg.
+func (c *Copier) mergedInto(pkg *Package) []*Package {
+	var merged []*Package
+	for _, m := range c.compacted {
+		if m.into.ImportPath == pkg.ImportPath {
+			merged = append(merged, m.pkg)
+		}
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].ImportPath < merged[j].ImportPath })
+
+	return merged
+}
+
+// renamePackage renames the package clause of the Go source body to name.
+func renamePackage(filename, body, name string) (string, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, body, parser.ParseComments)
+	if err != nil {
+		return "", fmt.Errorf("parse %s: %w", filename, err)
+	}
+	f.Name.Name = name
+
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, f); err != nil {
+		return "", fmt.Errorf("format %s: %w", filename, err)
+	}
+
+	return buf.String(), nil
+}
+
+// dropSelfImport drops the import of pkg itself from the rewritten Go source
+// body of the file and unqualifies the references to it.
+//
+// The self-import happens when two distinct import paths collapse to the
+// package's own path by the flattening, which is an import cycle otherwise.
+// The external test files legitimately import the package under test, so
+// they are left as is.
+func (c *Copier) dropSelfImport(pkg *Package, file, body string) (string, error) {
+	if contains(pkg.XTestGoFiles, filepath.Base(file)) {
+		return body, nil
+	}
+
+	self := c.rewriteImportPath(pkg.ImportPath)
+	if !strings.Contains(body, strconv.Quote(self)) {
+		return body, nil
+	}
+
+	data, err := c.inlineImports(file, body, []*Package{pkg})
+	if err != nil {
+		return "", err
+	}
+	if data != body {
+		c.warnf("%s imports its own package %s after the rewrite, drop the import", file, self)
+	}
+
+	return data, nil
+}
+
+// inlineImports removes the imports of the merged packages from the Go source
+// body, and unqualifies the references to them.
+func (c *Copier) inlineImports(filename, body string, merged []*Package) (string, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, body, parser.ParseComments)
+	if err != nil {
+		return "", fmt.Errorf("parse %s: %w", filename, err)
+	}
+
+	locals := make(map[string]bool)
+	for _, pkg := range merged {
+		path := c.rewriteImportPath(pkg.ImportPath)
+		for _, spec := range f.Imports {
+			imp, err := strconv.Unquote(spec.Path.Value)
+			if err != nil || imp != path {
+				continue
+			}
+
+			local := pkg.Name
+			if spec.Name != nil {
+				local = spec.Name.Name
+				astutil.DeleteNamedImport(fset, f, local, path)
+			} else {
+				astutil.DeleteImport(fset, f, path)
+			}
+			locals[local] = true
+			break
+		}
+	}
+	if len(locals) == 0 {
+		return body, nil
+	}
+
+	astutil.Apply(f, nil, func(c *astutil.Cursor) bool {
+		sel, ok := c.Node().(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		if x, ok := sel.X.(*ast.Ident); ok && x.Obj == nil && locals[x.Name] {
+			c.Replace(sel.Sel)
+		}
+		return true
+	})
+
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, f); err != nil {
+		return "", fmt.Errorf("format %s: %w", filename, err)
+	}
+
+	return buf.String(), nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,85 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"context"
+	"go/parser"
+	"go/token"
+	"io"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompactOutput(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go": "package foo\n\nimport (\n\tb \"internal/bar\"\n\t\"internal/qux\"\n)\n\nfunc Foo() int { return b.Bar + b.Baz() + qux.Foo() }\n",
+		"internal/bar/bar.go": "package bar\n\nconst Bar = 1\n\nfunc Baz() int { return Bar }\n",
+		"internal/qux/qux.go": "package qux\n\nfunc Foo() int { return 0 }\n",
+	})
+	fsys := newMemFS()
+	c := testCopier(t, src, fsys, "internal/foo")
+	c.CompactOutput = true
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// qux is not merged as its Foo collides
+	if got, want := fsys.paths(c.Dst), []string{"foo/bar_bar.go", "foo/foo.go", "qux/qux.go"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("copied files: got %q, want %q", got, want)
+	}
+	for file, want := range map[string]string{
+		"foo/bar_bar.go": "package foo\n\nconst Bar = 1\n\nfunc Baz() int { return Bar }\n",
+		"foo/foo.go":     "package foo\n\nimport (\n\t\"example.com/m/qux\"\n)\n\nfunc Foo() int { return Bar + Baz() + qux.Foo() }\n",
+	} {
+		if got, _ := fsys.file(filepath.Join(c.Dst, filepath.FromSlash(file))); got != want {
+			t.Errorf("got %s\n%s\nwant\n%s", file, got, want)
+		}
+	}
+}
+
+func TestDropSelfImport(t *testing.T) {
+	c := &Copier{Module: "example.com/m", Stderr: io.Discard}
+	c.init()
+	pkg := &Package{ImportPath: "internal/foo", Name: "foo", GoFiles: []string{"foo.go"}, XTestGoFiles: []string{"x_test.go"}}
+
+	// internal/foo/internal collapses to the path of internal/foo
+	const body = `package foo
+
+import (
+	"fmt"
+
+	"example.com/m/foo"
+)
+
+func Foo() string { return fmt.Sprint(foo.Bar) }
+`
+	got, err := c.dropSelfImport(pkg, "/goroot/src/internal/foo/foo.go", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const want = `package foo
+
+import (
+	"fmt"
+)
+
+func Foo() string { return fmt.Sprint(Bar) }
+`
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "foo.go", got, 0); err != nil {
+		t.Errorf("the result does not parse: %v", err)
+	}
+
+	// the external tests import the package under test
+	xtest := strings.Replace(body, "package foo", "package foo_test", 1)
+	if got, err := c.dropSelfImport(pkg, "/goroot/src/internal/foo/x_test.go", xtest); err != nil || got != xtest {
+		t.Errorf("x_test.go is rewritten: %v\n%s", err, got)
+	}
+}
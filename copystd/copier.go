@@ -0,0 +1,1191 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+// Package copystd copies Go stdlib internal package along with its dependency
+// packages into a module.
+package copystd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go/token"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/sync/errgroup"
+)
+
+// Copier copies the std packages and their cmd and internal dependencies into
+// the module.
+//
+// The zero value of the options is usable, and each Run starts afresh, so a
+// Copier can be run repeatedly and several Copiers can be used in a process.
+type Copier struct {
+	Packages       []string // std packages to copy
+	OnlyPackage    string   // package to re-copy alone without resolving its dependencies, instead of Packages
+	FromGoMod      bool     // also copy the packages the module in Dst imports
+	Module         string   // module import path
+	Src            string   // Go source tree, defaults to runtime.GOROOT()
+	SrcZip         string   // zip archive of the Go source tree used instead of Src
+	ModuleSource   string   // module in path@version form whose internal packages are copied instead of the std ones of Src
+	Dst            string   // destination directory, defaults to "."
+	Layout         string   // flatten (default) drops the leading cmd and the internal path elements of the destination, preserve keeps them
+	CopyMode       string   // rewrite (default), verbatim or both
+	VerbatimDst    string   // destination directory of the verbatim copy with CopyBoth
+	Env            []string // environment variables in KEY=VALUE form forwarded to go list
+	GoCache        string   // GOCACHE directory used by go list
+	Isolate        bool     // use a temporary GOCACHE unless GoCache is given
+	Test           bool     // resolve with go list -test -compiled to follow the dependencies of the test variants
+	DeepTestDeps   bool     // with Test, also follow the test imports of the dependencies transitively
+	NoTests        bool     // exclude TestGoFiles and XTestGoFiles and do not follow their imports
+	NoXTests       bool     // exclude XTestGoFiles and do not follow their imports
+	XTestDir       bool     // copy XTestGoFiles into the sibling directory of the package suffixed with _test
+	NoTestdata     bool     // do not copy the testdata directories, which NoTests implies
+	AllFiles       bool     // copy all the ignored Go files even if no target platform can build them
+	ResolveRoot    string   // source directory, relative to the source tree src unless absolute, the copied packages are limited to
+	Prefer         string   // implementation variant kept for the packages gated by the purego build tag: asm or pure
+	NoAsm          bool     // drop the assembly, C, header and cgo files to copy the pure Go subset
+	CopyVendor     bool     // copy the packages vendored by the source tree under Module/x instead of requiring their modules
+	FollowLinkname bool     // also copy the packages referenced by the //go:linkname directives of the copied packages
+	Platforms      []string // GOOS/GOARCH platforms whose union of the files is copied, instead of the host platform
+	GOOS           []string // GOOS values whose cross product with GOARCH is added to Platforms
+	GOARCH         []string // GOARCH values whose cross product with GOOS is added to Platforms
+	Timeout        time.Duration
+	Jobs           int // number of packages copied concurrently, defaults to runtime.NumCPU()
+
+	CopyDocGo           bool              // copy doc.go files even if filtered out, unless excluded by Skip
+	OnMissing           string            // policy for unresolved internal imports: error, stub or leave (default)
+	OnCollision         string            // policy for the packages flattened to the same directory: error (default) or suffix
+	RenameFile          map[string]string // destination file names keyed by the source base name or path
+	ReplaceBuildTag     map[string]string // build tags to replace in the build constraint lines
+	DirMode             os.FileMode       // permission bits of the created directories, defaults to 0755
+	AllowOverwrite      bool              // let the last source file win when two source files are copied to the same destination file
+	AllowDangerous      bool              // allow Dst to be within Src
+	ImportComment       string            // handling of the canonical import comments: keep (default), rewrite or strip
+	AsmIndent           string            // indentation of the assembly files to normalize to: tab or space, empty to keep
+	DstFileSuffix       string            // suffix appended to the base name of the copied Go files, before the _GOOS, _GOARCH and _test suffixes
+	AllowImport         []string          // non-std import paths or path/... patterns allowed to be left uncopied
+	IgnorePrefix        []string          // import paths or path/... patterns never copied nor rewritten, unless by ExcludeMap
+	ExcludeMap          map[string]string // import paths to rewrite the imports of IgnorePrefix to, keyed by the path or the path prefix
+	StrictImports       bool              // abort on the imports which are neither std, copied, AllowImport nor IgnorePrefix
+	Strict              bool              // abort instead of warning on the incomplete packages and the failed checks
+	SkipContent         *regexp.Regexp    // skip the files whose content matches
+	Skip                []string          // glob patterns of the files to skip, matched against the base name, or the slash separated path relative to the source root if with a slash, where ** matches any directories
+	SkipGenerated       bool              // skip the files having the generated code header before the package clause
+	MaxFileSize         int64             // skip the files larger than the bytes, 0 means no limit
+	StripDirective      []string          // directive families such as go:debug to remove
+	StripLinkname       bool              // remove the //go:linkname directives and the forward declarations they pull
+	Prune               bool              // remove the top-level declarations unreachable from the exported ones of Packages, or from KeepSymbols
+	KeepSymbols         []string          // roots of Prune in import-path.Name form, such as internal/bytealg.IndexByte
+	RenameReceiver      map[string]string // method receiver names keyed by the type name
+	RenameMap           string            // file of the package renames in old-path=new-name form per line
+	RewriteXTestName    map[string]string // external test package names without the _test suffix keyed by the import path, overriding RenameMap
+	Map                 []string          // destinations of the packages in import-path=path form, path relative to Module, winning over Rewrite
+	Rewrite             []string          // ordered import path prefix rewrites in from=to form, to relative to Module
+	RewriteFile         string            // JSON file of the rewrite rules applied after Rewrite
+	RewriteEmbedPattern map[string]string // relocations of the embedded files, old to new
+	SymlinkAssets       bool              // symlink the non-Go source files to the source instead of copying them
+
+	NormalizeImportsOrder    bool // sort imports into std, external and local groups
+	PreserveImportComments   bool // keep the comments of the import blocks not attached to an import with NormalizeImportsOrder
+	MarkGenerated            bool // mark the copied Go files as generated code
+	GeneratedMarker          string
+	VerifyGenerated          bool // verify every copied Go file has GeneratedMarker
+	VerifyGofmt              bool // verify every copied Go file is gofmt-ed
+	CompactOutput            bool // merge small packages imported by a single package into the importer
+	CompactMaxFiles          int  // defaults to 2
+	CompactMaxBytes          int  // defaults to 8192
+	Amalgamate               bool // concatenate the non-test Go files of each package into a single file
+	ValidateNoDuplicateDecls bool // fail before writing the amalgamated file whose top-level declarations collide
+	ResolveAliasCollisions   bool // alias the imports whose package names collide after the rewrite
+	RewriteTestdataPaths     bool // rewrite the import paths of the copied packages in the test strings
+	VersionDir               bool // copy under Dst/<goversion> and import as Module/<goversion>
+	StampVersion             bool // generate version.go declaring the source Go version
+	GoMod                    bool // generate go.mod of Module in Dst
+	InitModule               bool // generate go.mod of Module in Dst with the Go version of the go command unless exists
+	Force                    bool // overwrite the existing go.mod with InitModule, doc.go with Init and the locally modified files with Update
+	Update                   bool // skip the unchanged files and the ones modified locally since Manifest was written
+	Init                     bool // create Dst as a module skeleton: go.mod as InitModule unless GoMod, and doc.go of the module root
+	Tidy                     bool // run go mod tidy in Dst after copying
+	WriteGoMod               bool // add the requirements of the vendored modules imported by the copied files to the go.mod governing Dst
+	CheckLicenseHeaders      bool
+	License                  string // file of the license header template prepended to each Go file
+	ValidateBuildTags        bool
+	VerifyNoTestOnlyDepsLeak bool
+	VerifyBuild              bool   // run go build ./... in Dst after copying
+	VerifyVet                bool   // also run go vet ./... with VerifyBuild
+	AllowedStd               string // file of the 'go list std' output of the target Go
+	DowngradeTo              string // target Go version to report the newer language features against
+	RequireGoVersion         string // Go version prefix such as 1.22 the source tree must be of
+
+	// GoModPostProcess, if non-nil, is called with the go.mod generated by
+	// GoMod before it is written, so that the require, replace and exclude
+	// directives can be added.
+	GoModPostProcess func(*modfile.File) error
+
+	// GenerateCommand, if non-empty, is the command line reproducing the copy
+	// when run in Dst, such as go-copystd -module example.com/m, which is
+	// written to gen.go of Dst as a go:generate directive.
+	GenerateCommand []string
+
+	Progress             io.Writer // receives newline delimited JSON progress events if non-nil
+	EmitScript           string    // write the shell script of the planned operations instead of copying
+	ProvenanceJSON       string    // write the provenance of each copied file
+	GitProvenance        bool      // record the last git commit of each source file in ProvenanceJSON
+	Manifest             string    // write the manifest of the copied files, reporting the changes since the previous one
+	PackageAlias         string    // write the JSON of the recommended import aliases of the copied packages
+	Overlay              string    // write the go build -overlay JSON replacing the source files with the copied files
+	ManifestFormat       string    // json (default) or csv
+	HashAlgo             string    // digest algorithm of Manifest: sha256 (default), sha384 or sha512
+	Sizes                bool      // report the number of files and bytes of each copied package
+	SummaryTable         bool      // print the copied packages as a table of the files, bytes and status at the end
+	MeasureRewriteImpact bool      // report the number of the import lines, the linknames and the comments changed by the rewrite
+	TagsReport           bool      // report the build constraints and the supported ports
+	Audit                bool      // report the copied Go files importing unsafe or using //go:linkname and the other restricted directives
+	FailOnLinkname       bool      // report as Audit and fail if any copied Go file uses the restricted directives
+	Orphans              bool      // report the Go files under Dst not written by the run
+	CleanupEmpty         bool      // remove the empty directories under Dst after copying
+	DryRun               bool      // print the planned writes and their totals instead of writing anything
+	ListExternalDeps     bool      // print the imports of the resolved packages outside of them instead of copying anything
+	KeepGoing            bool      // continue past the errors of each package and report them at the end
+
+	LogLevel  LogLevel  // minimum level of the printed messages, LogInfo by default
+	LogFormat string    // format of the messages: text (default) or json
+	Stdout    io.Writer // receives the messages and the reports, defaults to os.Stdout
+	Stderr    io.Writer // receives the warnings and the errors with LogText, defaults to os.Stderr
+
+	// FS is the FileSystem to read and write the files, defaults to the host
+	// file system.
+	FS FileSystem
+
+	// the state of the run, written under mu while the packages are copied
+	// concurrently
+	mu              *sync.Mutex
+	gorootSrc       string
+	srcModule       string              // module path of ModuleSource
+	moduleWork      string              // temporary module requiring ModuleSource
+	unbuilt         bool                // whether Src has no compiler built
+	copiedPackages  map[string]*Package // keyed by the rewritten import path
+	compacted       map[string]*merge   // keyed by the import path of the merged package
+	stubbed         map[string]bool     // import paths stubbed by OnMissingStub
+	stubs           []*missingStub      // stubs of OnMissingStub to be written by copyTargets
+	vendored        map[string]string   // vendor import paths copied by CopyVendor keyed by the canonical one
+	sizes           sizeReport
+	failed          map[string]bool // packages whose copy failed under KeepGoing
+	updates         updateReport
+	vendorMods      map[string]map[string]string
+	recorded        map[string]*manifestEntry // entries of the previous Manifest with Update, keyed by the path
+	vendorRequires  map[string]*vendorRequire // modules of the vendored packages keyed by the path
+	excludedRefs    map[string][]string       // files importing the unmapped IgnorePrefix packages keyed by the import path
+	externalImports map[string]bool           // non-std imports left in the rewritten files
+	impact          *rewriteImpact
+	progress        *progressReporter
+	script          *copyScript
+	writtenFiles    map[string]bool
+	copiedFiles     []*copiedFile
+	createdDirs     map[string]bool
+	foldedPaths     map[string]string     // keyed by the lower-cased rewritten import path
+	dstSources      map[string]*dstSource // keyed by the destination file path
+	dstDirs         map[string]*Package   // copied packages keyed by the destination directory
+	ports           []string              // GOOS/GOARCH ports of the go command
+	doublePrefixed  map[string]bool       // import paths warned by trimModulePrefix
+	resolveRoot     string                // absolute ResolveRoot
+	rootDst         string                // Dst before VersionDir
+	rootModule      string                // Module before VersionDir
+	realSrc         string                // absolute source root with the symbolic links resolved
+	checking        bool                  // whether run by Check
+	buildTags       tagsReport
+	audit           auditReport
+	platforms       platformReport
+	platformEnv     []string // GOOS and GOARCH of the platform being listed
+	errs            []error  // errors collected by keepGoing
+	allowedStd      map[string]bool
+	licenseHeader   string            // comment lines of License
+	renames         map[string]string // new package names of RenameMap keyed by the import path
+	rewriteRules    []rewriteRule     // rules of Rewrite and RewriteFile
+	downgradeTarget int
+	downgradeDecls  map[string]map[string]bool
+	header          *template.Template // parsed GeneratedMarker
+	srcGoVersion    string
+	started         time.Time
+	written         int      // number of the files written
+	unchanged       int      // number of the files left as is, having the same content
+	skipped         []string // files skipped by addSkipped
+	skipReasons     map[string]int
+	warnings        []string // under logMu
+	logMu           *sync.Mutex
+}
+
+// Run copies the packages.
+//
+// The options of c are not modified, and the state of the run is discarded
+// after the run.
+func (c *Copier) Run(ctx context.Context) error {
+	r := *c
+	r.init()
+
+	return r.run(ctx)
+}
+
+// init fills the defaults of the options and initializes the state of the run.
+func (c *Copier) init() {
+	if c.Src == "" {
+		c.Src = runtime.GOROOT()
+	} else if abs, err := filepath.Abs(c.Src); err == nil {
+		// the go command runs in Src, where a relative GOROOT would not
+		// resolve
+		c.Src = abs
+	}
+	if c.Dst == "" {
+		c.Dst = "."
+	}
+	if c.OnMissing == "" {
+		c.OnMissing = OnMissingLeave
+	}
+	if c.OnCollision == "" {
+		c.OnCollision = OnCollisionError
+	}
+	if c.CopyMode == "" {
+		c.CopyMode = CopyRewrite
+	}
+	if c.ImportComment == "" {
+		c.ImportComment = ImportCommentKeep
+	}
+	if c.Layout == "" {
+		c.Layout = LayoutFlatten
+	}
+	if c.LogFormat == "" {
+		c.LogFormat = LogText
+	}
+	if c.ManifestFormat == "" {
+		c.ManifestFormat = ManifestJSON
+	}
+	if c.HashAlgo == "" {
+		c.HashAlgo = HashSHA256
+	}
+	if c.GeneratedMarker == "" {
+		c.GeneratedMarker = DefaultHeader
+	}
+	if c.DirMode == 0 {
+		c.DirMode = 0o755
+	}
+	if c.CompactMaxFiles == 0 {
+		c.CompactMaxFiles = 2
+	}
+	if c.CompactMaxBytes == 0 {
+		c.CompactMaxBytes = 8192
+	}
+	if c.FS == nil {
+		c.FS = osFS{}
+	}
+	if c.Init && !c.GoMod {
+		c.InitModule = true
+	}
+	if c.Stdout == nil {
+		c.Stdout = os.Stdout
+	}
+	if c.Stderr == nil {
+		c.Stderr = os.Stderr
+	}
+	// shared by both so that the lines are not interleaved even if they are
+	// the same writer
+	c.logMu = new(sync.Mutex)
+	c.Stdout = &syncWriter{mu: c.logMu, w: c.Stdout}
+	c.Stderr = &syncWriter{mu: c.logMu, w: c.Stderr}
+	if c.DryRun {
+		c.FS = newDryRunFS(c.FS)
+	}
+
+	if c.Jobs <= 0 {
+		c.Jobs = runtime.NumCPU()
+	}
+
+	c.mu = new(sync.Mutex)
+	c.gorootSrc = filepath.Join(c.Src, "src")
+	c.srcModule = ""
+	c.moduleWork = ""
+	c.unbuilt = false
+	c.copiedPackages = make(map[string]*Package)
+	c.compacted = make(map[string]*merge)
+	c.stubbed = make(map[string]bool)
+	c.stubs = nil
+	c.vendored = make(map[string]string)
+	c.vendorRequires = make(map[string]*vendorRequire)
+	c.excludedRefs = make(map[string][]string)
+	c.externalImports = make(map[string]bool)
+	c.vendorMods = make(map[string]map[string]string)
+	c.sizes = make(sizeReport)
+	c.failed = make(map[string]bool)
+	c.recorded = make(map[string]*manifestEntry)
+	c.updates = make(updateReport)
+	c.impact = new(rewriteImpact)
+	c.progress = nil
+	c.script = nil
+	c.writtenFiles = make(map[string]bool)
+	c.copiedFiles = nil
+	c.createdDirs = make(map[string]bool)
+	c.foldedPaths = make(map[string]string)
+	c.dstSources = make(map[string]*dstSource)
+	c.dstDirs = make(map[string]*Package)
+	c.ports = nil
+	c.doublePrefixed = make(map[string]bool)
+	c.resolveRoot = ""
+	c.realSrc = ""
+	c.buildTags = make(tagsReport)
+	c.audit = make(auditReport)
+	c.platforms = make(platformReport)
+	c.platformEnv = nil
+	c.errs = nil
+	c.allowedStd = nil
+	c.licenseHeader = ""
+	c.renames = nil
+	c.rewriteRules = nil
+	c.downgradeDecls = make(map[string]map[string]bool)
+	c.header = nil
+	c.srcGoVersion = ""
+	c.started = time.Now()
+	c.written = 0
+	c.unchanged = 0
+	c.skipped = nil
+	c.skipReasons = make(map[string]int)
+	c.warnings = nil
+}
+
+func (c *Copier) run(ctx context.Context) error {
+	if c.MarkGenerated || c.VerifyGenerated {
+		if err := c.parseHeader(); err != nil {
+			return err
+		}
+	}
+
+	if len(c.Packages) == 0 && c.OnlyPackage == "" && !c.FromGoMod {
+		return errors.New("no package to copy: give -package, -only-package or -from-gomod")
+	}
+	if c.FromGoMod && c.OnlyPackage != "" {
+		return errors.New("-from-gomod cannot be used with -only-package")
+	}
+
+	for _, env := range c.Env {
+		if i := strings.Index(env, "="); i <= 0 {
+			return fmt.Errorf("invalid -env value %q: must be KEY=VALUE form", env)
+		}
+		if key, value, _ := strings.Cut(env, "="); key == "GO111MODULE" && value != "on" {
+			return fmt.Errorf("invalid -env value %q: go list always runs in module mode", env)
+		}
+	}
+
+	platforms := append([]string{}, c.Platforms...)
+	for _, platform := range platformMatrix(c.GOOS, c.GOARCH) {
+		if !contains(platforms, platform) {
+			platforms = append(platforms, platform)
+		}
+	}
+	c.Platforms = platforms
+	for _, platform := range c.Platforms {
+		if _, _, err := parsePlatform(platform); err != nil {
+			return fmt.Errorf("invalid -platforms value: %w", err)
+		}
+	}
+
+	switch c.ImportComment {
+	case ImportCommentKeep, ImportCommentRewrite, ImportCommentStrip:
+	default:
+		return fmt.Errorf("invalid -import-comment value: %q", c.ImportComment)
+	}
+
+	switch c.Layout {
+	case LayoutFlatten, LayoutPreserve:
+	default:
+		return fmt.Errorf("invalid -layout value: %q", c.Layout)
+	}
+
+	if err := c.validateSkip(); err != nil {
+		return err
+	}
+
+	switch c.LogFormat {
+	case LogText, LogJSON:
+	default:
+		return fmt.Errorf("invalid -log value: %q", c.LogFormat)
+	}
+
+	switch c.Prefer {
+	case "", PreferAsm, PreferPure:
+	default:
+		return fmt.Errorf("invalid -prefer value: %q", c.Prefer)
+	}
+	if c.NoAsm && c.Prefer == PreferAsm {
+		return errors.New("-no-asm cannot be used with -prefer asm")
+	}
+
+	switch c.CopyMode {
+	case CopyRewrite, CopyVerbatim:
+		if c.VerbatimDst != "" {
+			return errors.New("-verbatim-dst requires -copy-mode both")
+		}
+	case CopyBoth:
+		if c.VerbatimDst == "" {
+			return errors.New("-copy-mode both requires -verbatim-dst")
+		}
+	default:
+		return fmt.Errorf("invalid -copy-mode value: %q", c.CopyMode)
+	}
+	if c.CopyMode == CopyVerbatim && (c.Amalgamate || c.CompactOutput) {
+		return errors.New("-copy-mode verbatim cannot be used with -amalgamate nor -compact-output, which rewrite the files")
+	}
+
+	if strings.ContainsAny(c.DstFileSuffix, `/\.`) {
+		return fmt.Errorf("invalid -dst-file-suffix value %q: must not contain a path separator nor a dot", c.DstFileSuffix)
+	}
+
+	switch c.AsmIndent {
+	case "", AsmIndentTab, AsmIndentSpace:
+	default:
+		return fmt.Errorf("invalid -canonicalize-whitespace-in-asm value: %q", c.AsmIndent)
+	}
+
+	if c.AllowedStd != "" {
+		std, err := c.loadStdList(c.AllowedStd)
+		if err != nil {
+			return fmt.Errorf("load -allowed-std: %w", err)
+		}
+		c.allowedStd = std
+	}
+
+	for _, s := range c.Map {
+		rule, err := parseRewriteRule(s)
+		if err != nil {
+			return fmt.Errorf("invalid -map value: %w", err)
+		}
+		rule.Exact = true
+		c.rewriteRules = append(c.rewriteRules, rule)
+	}
+	for _, s := range c.Rewrite {
+		rule, err := parseRewriteRule(s)
+		if err != nil {
+			return err
+		}
+		c.rewriteRules = append(c.rewriteRules, rule)
+	}
+	if c.RewriteFile != "" {
+		rules, err := c.loadRewriteFile(c.RewriteFile)
+		if err != nil {
+			return fmt.Errorf("load -rewrite-file: %w", err)
+		}
+		c.rewriteRules = append(c.rewriteRules, rules...)
+	}
+
+	for importPath, name := range c.RewriteXTestName {
+		if !token.IsIdentifier(name) || strings.HasSuffix(name, "_test") {
+			return fmt.Errorf("invalid -rewrite-xtest-name value %s=%s: must be a package name without the _test suffix", importPath, name)
+		}
+	}
+
+	if c.RenameMap != "" {
+		renames, err := c.loadRenameMap(c.RenameMap)
+		if err != nil {
+			return fmt.Errorf("load -rename-map: %w", err)
+		}
+		c.renames = renames
+	}
+
+	if c.License != "" {
+		data, err := c.FS.ReadFile(c.License)
+		if err != nil {
+			return fmt.Errorf("read -license: %w", err)
+		}
+		c.licenseHeader = licenseComment(string(data))
+	}
+
+	if c.DowngradeTo != "" {
+		target, err := parseMinorVersion(c.DowngradeTo)
+		if err != nil {
+			return fmt.Errorf("invalid -downgrade-to value: %w", err)
+		}
+		c.downgradeTarget = target
+	}
+
+	if c.Overlay != "" && c.SrcZip != "" {
+		return errors.New("-overlay cannot be used with -src-zip, whose extracted tree is removed after the run")
+	}
+	if c.Overlay != "" && c.Amalgamate {
+		return errors.New("-overlay cannot be used with -amalgamate, whose source files are replaced by a single file")
+	}
+
+	if c.ValidateNoDuplicateDecls && !c.Amalgamate {
+		return errors.New("-validate-no-duplicate-decls requires -amalgamate")
+	}
+
+	if c.VerifyVet && !c.VerifyBuild {
+		return errors.New("-verify-vet requires -verify")
+	}
+
+	if c.XTestDir && c.NoXTests {
+		return errors.New("-xtest-dir cannot be used with -no-xtests, which excludes the external test files")
+	}
+
+	if c.DeepTestDeps && !c.Test {
+		return errors.New("-deep-test-deps requires -test")
+	}
+
+	if c.InitModule && c.GoMod {
+		return errors.New("-init-module cannot be used with -gomod, which always writes go.mod")
+	}
+
+	if c.ModuleSource != "" && c.SrcZip != "" {
+		return errors.New("-module-source cannot be used with -src-zip")
+	}
+
+	if c.DryRun && c.EmitScript != "" {
+		return errors.New("-dry-run cannot be used with -emit-script, which writes the plan as a script")
+	}
+
+	if c.SymlinkAssets && c.SrcZip != "" {
+		return errors.New("-symlink-assets cannot be used with -src-zip, whose extracted tree is removed after the run")
+	}
+
+	if c.RequireGoVersion != "" && c.ModuleSource != "" {
+		return errors.New("-require-go-version cannot be used with -module-source, which is not a Go source tree")
+	}
+
+	if c.SymlinkAssets && c.AsmIndent != "" {
+		return errors.New("-canonicalize-whitespace-in-asm cannot be used with -symlink-assets, which links the assembly files as is")
+	}
+
+	if c.Update && c.Manifest == "" {
+		return errors.New("-update requires -manifest to detect the local modifications")
+	}
+
+	switch c.ManifestFormat {
+	case ManifestJSON, ManifestCSV:
+	default:
+		return fmt.Errorf("invalid -manifest-format value: %q", c.ManifestFormat)
+	}
+
+	switch c.HashAlgo {
+	case HashSHA256, HashSHA384, HashSHA512:
+	default:
+		return fmt.Errorf("invalid -hash-algo value: %q", c.HashAlgo)
+	}
+	if c.Update {
+		if err := c.loadUpdateManifest(); err != nil {
+			return fmt.Errorf("-update: %w", err)
+		}
+	}
+
+	switch c.OnMissing {
+	case OnMissingError, OnMissingStub, OnMissingLeave:
+	default:
+		return fmt.Errorf("invalid -on-missing value: %q", c.OnMissing)
+	}
+	switch c.OnCollision {
+	case OnCollisionError, OnCollisionSuffix:
+	default:
+		return fmt.Errorf("invalid -on-collision value: %q", c.OnCollision)
+	}
+
+	zipBuilt := false
+	if c.SrcZip != "" {
+		root, built, cleanup, err := extractZip(c.SrcZip)
+		if err != nil {
+			return fmt.Errorf("extract src zip: %w", err)
+		}
+		defer cleanup()
+
+		c.Src = root
+		c.gorootSrc = filepath.Join(root, "src")
+		zipBuilt = built
+	}
+
+	if c.ModuleSource == "" {
+		// the std packages are listed from the src directory of the tree,
+		// which go list would otherwise report as confusing errors
+		if fi, err := c.FS.Stat(c.gorootSrc); err != nil || !fi.IsDir() {
+			return fmt.Errorf("%s is not a Go source tree: no src directory (give the root of the tree, not its src directory, to -src)", c.Src)
+		}
+		if c.SrcZip != "" {
+			c.unbuilt = !zipBuilt
+		} else {
+			c.unbuilt = !isBuiltTree(c.Src)
+		}
+		if c.unbuilt && c.Test {
+			return fmt.Errorf("-test requires %s to be built, whose compiler go list -compiled runs (run src/make.bash of the tree)", c.Src)
+		}
+	}
+
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	if c.RequireGoVersion != "" {
+		version, err := c.sourceGoVersion(ctx)
+		if err != nil {
+			return fmt.Errorf("discover source Go version: %w", err)
+		}
+		if !matchGoVersion(version, c.RequireGoVersion) {
+			return fmt.Errorf("source %s is %s, not of -require-go-version %s", c.Src, version, c.RequireGoVersion)
+		}
+	}
+
+	if c.MarkGenerated || c.VerifyGenerated {
+		version, err := c.sourceGoVersion(ctx)
+		if err != nil {
+			return fmt.Errorf("discover source Go version: %w", err)
+		}
+		c.srcGoVersion = version
+	}
+
+	if c.ModuleSource != "" {
+		mod, dir, err := c.prepareModuleSource(ctx, c.ModuleSource)
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+
+		c.Src = mod.Dir
+		c.gorootSrc = mod.Dir
+		c.srcModule = mod.Path
+		c.moduleWork = dir
+	}
+
+	if c.ResolveRoot != "" {
+		c.resolveRoot = c.ResolveRoot
+		if !filepath.IsAbs(c.resolveRoot) {
+			c.resolveRoot = filepath.Join(c.gorootSrc, c.resolveRoot)
+		}
+	}
+	realSrc, err := resolvePath(c.gorootSrc)
+	if err != nil {
+		return err
+	}
+	c.realSrc = realSrc
+
+	c.rootDst, c.rootModule = c.Dst, c.Module
+	if c.VersionDir {
+		version, err := c.sourceGoVersion(ctx)
+		if err != nil {
+			return fmt.Errorf("discover source Go version: %w", err)
+		}
+		c.Dst = filepath.Join(c.Dst, version)
+		c.Module = path.Join(c.Module, version)
+	}
+
+	if !c.AllowDangerous {
+		inside, err := isWithin(c.Src, c.Dst)
+		if err != nil {
+			return err
+		}
+		if inside {
+			return fmt.Errorf("refusing to write into the source tree: -dst %s is within -src %s (use -allow-dangerous to override)", c.Dst, c.Src)
+		}
+	}
+
+	if c.Isolate && c.GoCache == "" {
+		cacheDir, err := os.MkdirTemp("", "go-copystd-gocache-")
+		if err != nil {
+			return fmt.Errorf("create temp GOCACHE: %w", err)
+		}
+		defer os.RemoveAll(cacheDir)
+
+		c.GoCache = cacheDir
+	}
+
+	if c.EmitScript != "" {
+		c.script = newCopyScript()
+	}
+	if c.Progress != nil {
+		c.progress = newProgressReporter(c.Progress)
+	}
+
+	roots := append([]string{}, c.Packages...)
+	if c.OnlyPackage != "" {
+		roots = []string{c.OnlyPackage}
+	}
+	if c.FromGoMod {
+		imported, err := c.goModRoots(ctx)
+		if err != nil {
+			return fmt.Errorf("-from-gomod: %w", err)
+		}
+		if len(imported) == 0 && len(roots) == 0 {
+			return fmt.Errorf("-from-gomod: %s imports no package to copy", c.Dst)
+		}
+		for _, pkg := range imported {
+			if !contains(roots, pkg) {
+				roots = append(roots, pkg)
+			}
+		}
+	}
+
+	if !c.AllFiles || c.DstFileSuffix != "" {
+		ports, err := distPorts(ctx)
+		if err != nil {
+			return err
+		}
+		c.ports = ports
+	}
+
+	visited := make(map[string]bool)
+	platformVisited := make(map[string]map[string]bool)
+	seen := make(map[string]bool)
+	var rootTargets [][]*Package
+	for _, pkg := range roots {
+		var packages []*Package
+		var err error
+		if len(c.Platforms) > 0 {
+			packages, err = c.listPlatforms(ctx, pkg, platformVisited)
+		} else {
+			packages, err = c.listRoot(ctx, pkg, visited)
+		}
+		if err != nil {
+			if err := c.keepGoing(&copyError{Package: pkg, Err: err}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		var targets []*Package
+		for _, p := range packages {
+			if seen[p.ImportPath] {
+				// already copied by the previous -package of the run
+				continue
+			}
+			seen[p.ImportPath] = true
+			if err := c.checkIncomplete(p); err != nil {
+				if err := c.keepGoing(err); err != nil {
+					return err
+				}
+				continue
+			}
+			if c.Prefer != "" {
+				if err := c.selectVariant(p); err != nil {
+					if err := c.keepGoing(err); err != nil {
+						return err
+					}
+					continue
+				}
+			}
+			if c.NoAsm {
+				if err := c.dropAsm(p); err != nil {
+					if err := c.keepGoing(err); err != nil {
+						return err
+					}
+					continue
+				}
+			}
+			if !c.AllFiles {
+				if err := c.filterIgnored(p); err != nil {
+					if err := c.keepGoing(err); err != nil {
+						return err
+					}
+					continue
+				}
+			}
+			targets = append(targets, p)
+		}
+
+		for _, target := range targets {
+			if _, err := c.srcRel(target.Dir); err != nil {
+				return fmt.Errorf("copy %s: %w", target.ImportPath, err)
+			}
+			if err := c.resolveCollision(target); err != nil {
+				return err
+			}
+			importPath := c.rewriteImportPath(target.ImportPath)
+			if err := c.checkCaseCollision(importPath); err != nil {
+				return err
+			}
+			c.copiedPackages[importPath] = target
+			if canonical, ok := vendorPath(target.ImportPath); ok && c.CopyVendor {
+				c.vendored[canonical] = target.ImportPath
+			}
+		}
+		rootTargets = append(rootTargets, targets)
+	}
+
+	// the destinations of all the roots are resolved before any file is
+	// written, so that a collision aborts the run without a partial copy
+	for _, targets := range rootTargets {
+		if c.ListExternalDeps {
+			break
+		}
+
+		if c.CompactOutput {
+			if err := c.planCompaction(targets); err != nil {
+				return fmt.Errorf("plan compaction: %w", err)
+			}
+		}
+
+		c.progress.start(targets, c.copyFiles)
+		if err := c.copyTargets(ctx, targets); err != nil {
+			return err
+		}
+
+		if c.VerifyNoTestOnlyDepsLeak {
+			if err := c.verifyNoTestOnlyDepsLeak(targets); err != nil {
+				if err := c.keepGoing(err); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if !c.checking {
+		c.reportVendorRequires()
+		c.reportUnresolvedImports()
+		c.reportExcludedRefs()
+		c.reportUnusedMaps()
+	}
+
+	if c.ListExternalDeps {
+		c.printExternalDeps(c.Stdout)
+		return c.collectedErr()
+	}
+
+	if c.Prune && c.script == nil {
+		if err := c.prune(); err != nil {
+			return fmt.Errorf("prune: %w", err)
+		}
+	}
+
+	if c.GoMod {
+		version, err := c.sourceGoVersion(ctx)
+		if err != nil {
+			return fmt.Errorf("discover source Go version: %w", err)
+		}
+		data, err := c.generateGoMod(c.Module, version)
+		if err != nil {
+			return fmt.Errorf("generate go.mod: %w", err)
+		}
+		if c.script != nil {
+			c.script.generate(filepath.Join(c.Dst, "go.mod"), "go.mod")
+		} else {
+			if err := c.mkdirAll(c.Dst); err != nil {
+				return err
+			}
+			if _, err := c.writeIfChanged(filepath.Join(c.Dst, "go.mod"), data); err != nil {
+				return fmt.Errorf("write go.mod: %w", err)
+			}
+		}
+	}
+
+	if c.InitModule {
+		if err := c.initModule(ctx, c.Dst); err != nil {
+			return err
+		}
+	}
+
+	if c.WriteGoMod && !c.DryRun && c.script == nil {
+		if err := c.writeGoModRequires(); err != nil {
+			return err
+		}
+	}
+
+	if c.Init {
+		if err := c.writeRootDoc(ctx); err != nil {
+			return err
+		}
+	}
+
+	if len(c.GenerateCommand) > 0 {
+		if err := c.writeGenerate(); err != nil {
+			return err
+		}
+	}
+
+	if c.StampVersion {
+		version, err := c.sourceGoVersion(ctx)
+		if err != nil {
+			return fmt.Errorf("discover source Go version: %w", err)
+		}
+		body := stampSource(stampPackageName(c.Module), version, c.stampTime(version))
+		if c.script != nil {
+			c.script.generate(filepath.Join(c.Dst, "version.go"), "version stamp")
+		} else if _, err := c.writeFile(c.Dst, "version.go", body); err != nil {
+			return fmt.Errorf("write version stamp: %w", err)
+		}
+	}
+
+	if c.script != nil {
+		if err := c.script.write(c.FS, c.EmitScript); err != nil {
+			return err
+		}
+		return c.collectedErr()
+	}
+
+	if c.ProvenanceJSON != "" {
+		if c.GitProvenance {
+			if err := c.fillGitCommits(ctx, c.Src, c.copiedFiles); err != nil {
+				return fmt.Errorf("git provenance: %w", err)
+			}
+		}
+		if err := c.writeProvenance(c.ProvenanceJSON, c.copiedFiles); err != nil {
+			return err
+		}
+	}
+
+	// the manifest is built from the written files
+	if c.Manifest != "" && !c.DryRun {
+		entries, err := c.buildManifest(c.Dst, c.copiedFiles)
+		if err != nil {
+			return fmt.Errorf("build manifest: %w", err)
+		}
+		source, version, err := c.manifestSource(ctx)
+		if err != nil {
+			return fmt.Errorf("build manifest: %w", err)
+		}
+		c.reportManifestChanges(c.Manifest, c.ManifestFormat, entries)
+		if c.Update {
+			c.keepConflicted(entries)
+		}
+		if err := c.writeManifest(c.Manifest, c.ManifestFormat, &manifest{GoVersion: version, Source: source, Files: entries}); err != nil {
+			return err
+		}
+	}
+
+	if c.Overlay != "" && !c.DryRun {
+		if err := c.writeOverlay(c.Overlay, c.copiedFiles); err != nil {
+			return err
+		}
+	}
+
+	if c.PackageAlias != "" && !c.DryRun {
+		if err := c.writePackageAliases(c.PackageAlias); err != nil {
+			return err
+		}
+	}
+
+	if c.Orphans {
+		orphans, err := c.findOrphans(c.Dst)
+		if err != nil {
+			return fmt.Errorf("find orphans: %w", err)
+		}
+		for _, orphan := range orphans {
+			fmt.Fprintf(c.Stdout, "orphan: %s\n", orphan)
+		}
+	}
+
+	if c.CleanupEmpty && !c.DryRun {
+		if err := c.cleanupEmptyDirs(c.Dst); err != nil {
+			return fmt.Errorf("cleanup empty dirs: %w", err)
+		}
+	}
+
+	if c.Tidy && !c.DryRun {
+		if err := c.tidyModule(ctx, c.Dst); err != nil {
+			return err
+		}
+	}
+
+	if c.VerifyGenerated && !c.DryRun {
+		if err := c.verifyGenerated(); err != nil {
+			return err
+		}
+	}
+
+	if c.VerifyGofmt && !c.DryRun {
+		if err := c.verifyGofmt(); err != nil {
+			return err
+		}
+	}
+
+	if c.VerifyBuild && !c.DryRun {
+		if err := c.verifyBuild(ctx, c.Dst); err != nil {
+			return err
+		}
+	}
+
+	if c.DryRun && !c.checking {
+		var files, bytes int
+		for _, size := range c.sizes {
+			files += size.Files
+			bytes += size.Bytes
+		}
+		c.infof("dry-run: %d packages, %d files, %d bytes", len(c.sizes), files, bytes)
+		if files == 0 {
+			return errors.New("dry-run: the plan copies no file")
+		}
+	}
+
+	if c.Sizes {
+		c.sizes.print(c.Stdout)
+	}
+
+	if c.MeasureRewriteImpact {
+		c.impact.print(c.Stdout)
+	}
+
+	if len(c.Platforms) > 0 {
+		c.platforms.print(c.Stdout)
+	}
+
+	if c.TagsReport {
+		list, err := distPorts(ctx)
+		if err != nil {
+			return err
+		}
+		c.buildTags.print(c.Stdout, list)
+	}
+
+	if c.Audit || c.FailOnLinkname {
+		c.audit.print(c.Stdout)
+	} else if n := c.audit.directiveFiles(); n > 0 && !c.checking {
+		c.warnf("%d copied files use //go:linkname or the other compiler directives restricted to the std, see -audit", n)
+	}
+
+	if c.SummaryTable {
+		if err := c.printSummaryTable(c.Stdout); err != nil {
+			return fmt.Errorf("print summary table: %w", err)
+		}
+	}
+
+	if !c.DryRun && c.script == nil && !c.checking {
+		c.printSummary()
+	}
+
+	if c.Update && !c.checking {
+		if err := c.conflictErr(); err != nil {
+			return errors.Join(err, c.collectedErr())
+		}
+	}
+
+	if n := c.audit.directiveFiles(); c.FailOnLinkname && n > 0 {
+		return errors.Join(fmt.Errorf("-fail-on-linkname: %d copied files use //go:linkname or the other compiler directives restricted to the std", n), c.collectedErr())
+	}
+
+	return c.collectedErr()
+}
+
+// copyTargets copies the targets concurrently by Jobs packages at most. The
+// first error cancels the copy of the rest unless KeepGoing is given.
+func (c *Copier) copyTargets(ctx context.Context, targets []*Package) error {
+	// copy in the order of the import paths rather than the one resolved, so
+	// that the runs print the messages in the same order with -jobs 1
+	targets = append([]*Package(nil), targets...)
+	sort.Slice(targets, func(i, j int) bool { return targets[i].ImportPath < targets[j].ImportPath })
+
+	if err := c.writeStubs(); err != nil {
+		return err
+	}
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(c.Jobs)
+	for _, target := range targets {
+		target := target
+		g.Go(func() error {
+			if err := gctx.Err(); err != nil {
+				return fmt.Errorf("abort the copy of %s: %w", target.ImportPath, err)
+			}
+			if err := c.copyInternal(target); err != nil {
+				c.markFailed(target.ImportPath)
+				return c.keepGoing(&copyError{Package: target.ImportPath, Err: err})
+			}
+			return nil
+		})
+	}
+
+	return g.Wait()
+}
+
+// keepGoing returns err as is unless KeepGoing is given, in which case err is
+// collected to be reported at the end of the run and nil is returned.
+func (c *Copier) keepGoing(err error) error {
+	if !c.KeepGoing {
+		return err
+	}
+	c.errorf("%v", err)
+	c.mu.Lock()
+	c.errs = append(c.errs, err)
+	c.mu.Unlock()
+
+	return nil
+}
+
+// collectedErr returns the errors collected by keepGoing as an error, or nil.
+// The errors are summarized as a table on Stderr as well with LogText.
+func (c *Copier) collectedErr() error {
+	if len(c.errs) == 0 {
+		return nil
+	}
+	if c.LogFormat == LogText {
+		if err := c.printErrorSummary(c.Stderr); err != nil {
+			return fmt.Errorf("print error summary: %w", err)
+		}
+	}
+
+	return fmt.Errorf("%d errors occurred:\n%w", len(c.errs), errors.Join(c.errs...))
+}
+
+// listRoot lists the root package and, unless OnlyPackage is given, resolves
+// its dependencies to be copied. visited is shared by the roots of the run.
+func (c *Copier) listRoot(ctx context.Context, root string, visited map[string]bool) ([]*Package, error) {
+	listPkgs, err := c.listPackages(ctx, c.Src, root)
+	if err != nil {
+		return nil, fmt.Errorf("list packages: %w", err)
+	}
+
+	var packages, resolve []*Package
+	for _, listPkg := range listPkgs {
+		if isPseudoPackage(listPkg) {
+			continue
+		}
+		if _, err := c.FS.Stat(listPkg.Dir); errors.Is(err, fs.ErrNotExist) {
+			if listPkg.Dir != "" {
+				c.warnf("%s is not exists, continue", listPkg.Dir)
+			} else {
+				c.warnf("%s has no directory, continue", listPkg.ImportPath)
+			}
+			continue
+		}
+
+		if strings.HasSuffix(listPkg.ImportPath, ".test") {
+			// the synthesized test main package of -test
+			continue
+		}
+		if c.outsideResolveRoot(listPkg) {
+			c.warnf("%s is outside -resolve-root, continue", listPkg.ImportPath)
+			continue
+		}
+		if !isTestVariant(listPkg) {
+			packages = append(packages, listPkg)
+		}
+		if !c.isExcludedTest(listPkg) {
+			resolve = append(resolve, listPkg)
+		}
+	}
+	if !c.AllFiles && !hasBuildable(packages) {
+		goos, goarch := c.listedPlatform()
+		return nil, &emptyResolutionError{GOOS: goos, GOARCH: goarch}
+	}
+
+	if c.OnlyPackage == "" {
+		deps, err := c.resolveDeps(ctx, resolve, visited)
+		if err != nil {
+			return nil, err
+		}
+		packages = append(packages, deps...)
+
+		if c.FollowLinkname {
+			linked, err := c.followLinknames(ctx, packages, visited)
+			if err != nil {
+				return nil, err
+			}
+			packages = append(packages, linked...)
+		}
+	}
+
+	return packages, nil
+}
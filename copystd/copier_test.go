@@ -0,0 +1,312 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testGoVersion is the Go version of the source trees of testGoroot.
+const testGoVersion = "go1.21.3"
+
+// testGoroot creates a Go source tree for the tests, and returns its root. It
+// has the files keyed by the slash separated path relative to its src
+// directory, and the std packages of the host linked in the other
+// directories, so that the files can import them. The tree is not built.
+func testGoroot(t *testing.T, files map[string]string) string {
+	t.Helper()
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command not found")
+	}
+
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "VERSION"), []byte(testGoVersion+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the directories of the packages have the files only, and the others
+	// the host ones linked as well
+	pkgDirs := make(map[string]bool)
+	dirs := map[string]bool{".": true}
+	for name := range files {
+		pkgDirs[path.Dir(name)] = true
+		for dir := path.Dir(path.Dir(name)); !dirs[dir]; dir = path.Dir(dir) {
+			dirs[dir] = true
+		}
+	}
+	host := filepath.Join(runtime.GOROOT(), "src")
+	for dir := range dirs {
+		if pkgDirs[dir] {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Join(root, "src", dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		entries, err := os.ReadDir(filepath.Join(host, dir))
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name := path.Join(dir, entry.Name())
+			if dirs[name] || pkgDirs[name] || files[name] != "" {
+				continue
+			}
+			if err := os.Symlink(filepath.Join(host, name), filepath.Join(root, "src", name)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	for name, data := range files {
+		filename := filepath.Join(root, "src", filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filename, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return root
+}
+
+// buildTestGoroot makes the source tree of testGoroot built, which -test
+// requires, by linking the pkg directory of the host.
+func buildTestGoroot(t *testing.T, root string) {
+	t.Helper()
+	if err := os.Symlink(filepath.Join(runtime.GOROOT(), "pkg"), filepath.Join(root, "pkg")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testCopier returns the Copier of the packages of the source tree src to
+// the module example.com/m, which writes to fsys in a directory not existing
+// on the host. The messages are discarded.
+func testCopier(t *testing.T, src string, fsys FileSystem, packages ...string) *Copier {
+	t.Helper()
+
+	return &Copier{
+		Packages: packages,
+		Module:   "example.com/m",
+		Src:      src,
+		Dst:      filepath.Join(t.TempDir(), "dst"),
+		FS:       fsys,
+		Jobs:     1,
+		Stdout:   io.Discard,
+		Stderr:   io.Discard,
+	}
+}
+
+// wrapGo puts a go command running the shell script before the host one in
+// front of PATH for the test.
+func wrapGo(t *testing.T, script string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the go command wrapper is a shell script")
+	}
+	goCmd, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go command not found")
+	}
+
+	dir := t.TempDir()
+	data := fmt.Sprintf("#!/bin/sh\n%sexec %q \"$@\"\n", script, goCmd)
+	if err := os.WriteFile(filepath.Join(dir, "go"), []byte(data), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+// recordGoListEnv records the environment variables in names of go list run
+// in the test, and returns the function returning the recorded values, one
+// NAME=value line per variable and invocation of go list.
+func recordGoListEnv(t *testing.T, names ...string) func() []string {
+	t.Helper()
+
+	record := filepath.Join(t.TempDir(), "env")
+	var script strings.Builder
+	script.WriteString("if [ \"$1\" = list ]; then\n")
+	for _, name := range names {
+		fmt.Fprintf(&script, "\techo \"%s=$%s\" >> %q\n", name, name, record)
+	}
+	script.WriteString("fi\n")
+	wrapGo(t, script.String())
+
+	return func() []string {
+		data, err := os.ReadFile(record)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	}
+}
+
+func TestOnlyPackage(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go": "package foo\n\nimport \"internal/bar\"\n\nfunc Foo() int { return bar.Bar }\n",
+		"internal/bar/bar.go": "package bar\n\nconst Bar = 1\n",
+	})
+	fsys := newMemFS()
+	c := testCopier(t, src, fsys, "internal/foo")
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// both packages change upstream, but bar alone is re-copied
+	for name, data := range map[string]string{
+		"foo/foo.go": "package foo\n\nimport \"internal/bar\"\n\nfunc Foo() int { return bar.Bar + 1 }\n",
+		"bar/bar.go": "package bar\n\nconst Bar = 2\n",
+	} {
+		filename := filepath.Join(src, "src", "internal", filepath.FromSlash(name))
+		if err := os.WriteFile(filename, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.Packages = nil
+	c.OnlyPackage = "internal/bar"
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := fsys.paths(c.Dst), []string{"bar/bar.go", "foo/foo.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("copied files: got %q, want %q", got, want)
+	}
+	for name, want := range map[string]string{
+		"foo/foo.go": "package foo\n\nimport \"example.com/m/bar\"\n\nfunc Foo() int { return bar.Bar }\n",
+		"bar/bar.go": "package bar\n\nconst Bar = 2\n",
+	} {
+		if got, _ := fsys.file(filepath.Join(c.Dst, filepath.FromSlash(name))); got != want {
+			t.Errorf("got %s\n%s\nwant\n%s", name, got, want)
+		}
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go": "package foo\n\nfunc Foo() {}\n",
+	})
+	// go list never finishes
+	wrapGo(t, "if [ \"$1\" = list ]; then\n\texec sleep 60\nfi\n")
+	fsys := newMemFS()
+	c := testCopier(t, src, fsys, "internal/foo")
+	c.Timeout = 100 * time.Millisecond
+
+	start := time.Now()
+	err := c.Run(context.Background())
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got error %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > 30*time.Second {
+		t.Errorf("the run is aborted after %v", elapsed)
+	}
+	if paths := fsys.paths(c.Dst); len(paths) > 0 {
+		t.Errorf("files are written: %q", paths)
+	}
+}
+
+func TestPseudoPackage(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go": "package foo\n\nfunc Foo() {}\n",
+	})
+	// go list reports a standard package without a directory ahead of foo
+	wrapGo(t, "if [ \"$1\" = list ]; then\n\techo '{\"ImportPath\":\"unsafe\",\"Standard\":true}'\nfi\n")
+	fsys := newMemFS()
+	c := testCopier(t, src, fsys, "internal/foo")
+	var stderr strings.Builder
+	c.Stderr = &stderr
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := fsys.paths(c.Dst), []string{"foo/foo.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("copied files: got %q, want %q", got, want)
+	}
+	if strings.Contains(stderr.String(), "unsafe") {
+		t.Errorf("the pseudo package is warned of:\n%s", stderr.String())
+	}
+}
+
+func TestOnlyPackageFind(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go":       "package foo\n\nimport \"internal/bar\"\n\nfunc Foo() int { return bar.Bar }\n",
+		"internal/foo/foo_plan9.go": "package foo\n",
+		"internal/foo/foo.s":        "",
+		"internal/bar/bar.go":       "package bar\n\nconst Bar = 1\n",
+	})
+	record := filepath.Join(t.TempDir(), "args")
+	wrapGo(t, fmt.Sprintf("if [ \"$1\" = list ]; then\n\techo \"$*\" >> %q\nfi\n", record))
+	fsys := newMemFS()
+	c := testCopier(t, src, fsys, "internal/foo")
+	c.OnlyPackage = "internal/foo"
+	c.Packages = nil
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		if !strings.Contains(" "+args+" ", " -find ") {
+			t.Errorf("go list is run without -find: %s", args)
+		}
+	}
+	// the files of the package alone, without the dependencies
+	if got, want := fsys.paths(c.Dst), []string{"foo/foo.go", "foo/foo.s"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("copied files: got %q, want %q", got, want)
+	}
+}
+
+func TestJobs(t *testing.T) {
+	for jobs, want := range map[int]int{
+		0:  runtime.NumCPU(),
+		-1: runtime.NumCPU(),
+		1:  1,
+		3:  3,
+	} {
+		c := &Copier{Jobs: jobs, Stdout: io.Discard, Stderr: io.Discard}
+		c.init()
+		if c.Jobs != want {
+			t.Errorf("Jobs %d: got %d, want %d", jobs, c.Jobs, want)
+		}
+	}
+}
+
+func TestPackagePattern(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/a/a.go": "package a\n\nimport \"internal/dep\"\n\nvar A = dep.Dep\n",
+		"internal/foo/b/b.go": "package b\n\nimport \"internal/dep\"\n\nvar B = dep.Dep + 1\n",
+		"internal/dep/dep.go": "package dep\n\nconst Dep = 1\n",
+	})
+
+	// each package of the pattern is a root resolving its dependencies
+	fsys := newMemFS()
+	c := testCopier(t, src, fsys, "internal/foo/...")
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fsys.paths(c.Dst), []string{"dep/dep.go", "foo/a/a.go", "foo/b/b.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("copied files: got %q, want %q", got, want)
+	}
+
+	c = testCopier(t, src, newMemFS())
+	if err := c.Run(context.Background()); err == nil || !strings.Contains(err.Error(), "no package to copy") {
+		t.Errorf("got error %v of no package, want no package to copy", err)
+	}
+}
@@ -0,0 +1,913 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/scanner"
+	"go/token"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/tools/imports"
+)
+
+// unbuiltListFields is the comma separated -json fields of go list for the
+// never built source tree, all of Package but the staleness which go list
+// computes with the compiler of the tree.
+var unbuiltListFields = func() string {
+	var fields []string
+	t := reflect.TypeOf(Package{})
+	for i := 0; i < t.NumField(); i++ {
+		if name := t.Field(i).Name; name != "Stale" && name != "StaleReason" {
+			fields = append(fields, name)
+		}
+	}
+
+	return strings.Join(fields, ",")
+}()
+
+// listPackages is a wrapper for 'go list -json -e', which can take arbitrary
+// environment variables and arguments as input. The working directory can be
+// fed by adding $PWD to env; otherwise, it will default to the current
+// directory.
+//
+// Since -e is used, the returned error will only be non-nil if a JSON result
+// could not be obtained. Such examples are if the Go command is not installed,
+// or if invalid flags are used as arguments.
+//
+// Errors encountered when loading packages will be returned for each package,
+// in the form of PackageError. See 'go help list'.
+func (c *Copier) listPackages(ctx context.Context, src string, args ...string) (pkgs []*Package, finalErr error) {
+	goArgs := []string{"list", "-json", "-e"}
+	if c.unbuilt {
+		goArgs[1] = "-json=" + unbuiltListFields
+	}
+	if c.Test {
+		goArgs = append(goArgs, "-test", "-compiled")
+	} else if c.OnlyPackage != "" {
+		// only the file lists are needed without resolving the dependencies,
+		// so skip the dependency analysis; -find cannot be used with -test
+		goArgs = append(goArgs, "-find")
+	}
+	if c.Prefer == PreferPure {
+		goArgs = append(goArgs, "-tags="+puregoTag)
+	}
+	goArgs = append(goArgs, args...)
+	cmd := exec.CommandContext(ctx, "go", goArgs...)
+	if c.srcModule != "" {
+		// resolved from the module cache in the module requiring -module-source
+		src = c.moduleWork
+		cmd.Env = append(os.Environ(), "PWD="+src, "GOFLAGS=-mod=mod")
+	} else {
+		// GOTOOLCHAIN=local keeps the go command from switching to the
+		// toolchain of the go.mod of the tree, which lists it as is
+		cmd.Env = append(os.Environ(), []string{"PWD=" + src, "GOROOT=" + src, "GOTOOLCHAIN=local"}...)
+	}
+	// the import paths are resolved in module mode regardless of the
+	// GO111MODULE of the environment, which could select the GOPATH mode
+	cmd.Env = append(cmd.Env, "GO111MODULE=on")
+	if c.GoCache != "" {
+		cmd.Env = append(cmd.Env, "GOCACHE="+c.GoCache)
+	}
+	// the values are forwarded verbatim so that a multi-valued variable such
+	// as GOFLAGS="-mod=mod -tags=foo" reaches go list intact
+	cmd.Env = append(cmd.Env, c.Env...)
+	cmd.Env = append(cmd.Env, c.platformEnv...)
+	cmd.Dir = src
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("create StdoutPipe: %w", err)
+	}
+	var stderrBuf bytes.Buffer
+	cmd.Stderr = &stderrBuf
+	defer func() {
+		if finalErr != nil && stderrBuf.Len() > 0 {
+			// TODO: wrap? but the format is backwards, given that
+			// stderr is likely multi-line
+			finalErr = fmt.Errorf("%w\n%s", finalErr, stderrBuf.Bytes())
+		}
+	}()
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start cmd: %w", err)
+	}
+
+	dec := json.NewDecoder(stdout)
+	for dec.More() {
+		var pkg Package
+		if err := dec.Decode(&pkg); err != nil {
+			return nil, fmt.Errorf("decode json: %w", err)
+		}
+		pkgs = append(pkgs, &pkg)
+	}
+
+	if err := cmd.Wait(); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, fmt.Errorf("wait cmd: %w", ctxErr)
+		}
+		return nil, fmt.Errorf("wait cmd: %w", err)
+	}
+
+	return pkgs, nil
+}
+
+func (c *Copier) copyInternal(pkg *Package) error {
+	var amalgam []*fileCopy
+	for _, file := range c.copyFiles(pkg) {
+		fc, err := c.copyFile(pkg, file)
+		if err != nil {
+			if !c.KeepGoing {
+				return err
+			}
+			// the rest of the files are still copied
+			c.markFailed(pkg.ImportPath)
+			c.keepGoing(&copyError{Package: pkg.ImportPath, File: file, Err: err})
+			continue
+		}
+		if fc != nil {
+			amalgam = append(amalgam, fc)
+		}
+	}
+
+	if c.SymlinkAssets {
+		if err := c.linkAssets(pkg); err != nil {
+			return fmt.Errorf("link assets: %w", err)
+		}
+	}
+	if err := c.copyPackageAssets(pkg); err != nil {
+		return err
+	}
+
+	if len(amalgam) > 0 {
+		if c.ValidateNoDuplicateDecls {
+			if err := duplicateDecls(pkg, amalgam); err != nil {
+				return err
+			}
+		}
+		data, err := amalgamate(pkg, amalgam)
+		if err != nil {
+			return fmt.Errorf("amalgamate %s: %w", pkg.ImportPath, err)
+		}
+		name := pkg.Name + ".go"
+		if c.DstFileSuffix != "" {
+			name = suffixedName(name, c.DstFileSuffix, c.ports)
+		}
+		if c.CheckLicenseHeaders {
+			if err := c.checkLicenseHeader(filepath.Join(pkg.Dir, name), data); err != nil {
+				return err
+			}
+		}
+
+		if err := c.claimDst(pkg.Dir, filepath.Join(amalgam[0].dir, name), data); err != nil {
+			return err
+		}
+
+		if c.script != nil {
+			c.script.generate(filepath.Join(amalgam[0].dir, name), "amalgamated "+pkg.ImportPath)
+			for _, fc := range amalgam {
+				c.progress.fileDone(pkg, fc.src)
+			}
+			return nil
+		}
+
+		start := time.Now()
+		n, err := c.writeFile(amalgam[0].dir, name, data)
+		if err != nil {
+			return fmt.Errorf("write file: %w", err)
+		}
+		c.addSize(pkg.ImportPath, n)
+		for _, fc := range amalgam {
+			if c.MeasureRewriteImpact {
+				c.addImpact(fc.raw, fc.body)
+			}
+			c.recordCopied(pkg, fc.src, filepath.Join(amalgam[0].dir, name))
+			c.printDryRun(fc.src, filepath.Join(amalgam[0].dir, name))
+			c.logCopy(fc.src, filepath.Join(amalgam[0].dir, name), time.Since(start))
+			c.progress.fileDone(pkg, fc.src)
+		}
+	}
+
+	return nil
+}
+
+// copyFile copies the source file of pkg, or returns it transformed to be
+// amalgamated with Amalgamate.
+func (c *Copier) copyFile(pkg *Package, file string) (*fileCopy, error) {
+	start := time.Now()
+	fc, err := c.transformFile(pkg, file)
+	if err != nil {
+		return nil, err
+	}
+	if fc == nil {
+		c.progress.fileSkipped(pkg, file)
+		return nil, nil
+	}
+
+	if c.CheckLicenseHeaders {
+		if err := c.checkLicenseHeader(file, fc.body); err != nil {
+			return nil, err
+		}
+	}
+	if c.allowedStd != nil && isGoFile(file) {
+		if err := c.checkAllowedStd(file, fc.body, c.allowedStd); err != nil {
+			return nil, err
+		}
+	}
+	if c.DowngradeTo != "" && isGoFile(file) {
+		if err := c.checkDowngrade(pkg, file, fc.body, c.downgradeTarget); err != nil {
+			return nil, err
+		}
+	}
+	if c.TagsReport {
+		c.mu.Lock()
+		err := c.buildTags.add(pkg, filepath.Join(fc.dir, fc.name), fc.body)
+		c.mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if isGoFile(file) {
+		c.mu.Lock()
+		err := c.audit.add(filepath.Join(fc.dir, fc.name), fc.body)
+		c.mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if c.CopyMode == CopyBoth {
+		if err := c.writeVerbatimCopy(fc); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.Amalgamate && isAmalgamated(pkg, file) {
+		return fc, nil
+	}
+
+	if err := c.claimDst(file, filepath.Join(fc.dir, fc.name), fc.body); err != nil {
+		return nil, err
+	}
+
+	if c.script != nil {
+		c.script.copyFile(file, filepath.Join(fc.dir, fc.name), fc.verbatim)
+		c.progress.fileDone(pkg, file)
+		return nil, nil
+	}
+
+	write := c.writeFile
+	if !isGoFile(file) || c.CopyMode == CopyVerbatim {
+		// goimports cannot process the assembly, C and header files
+		write = c.writeVerbatim
+	}
+	n, err := write(fc.dir, fc.name, fc.body)
+	if err != nil {
+		return nil, fmt.Errorf("write file: %w", err)
+	}
+	c.addSize(pkg.ImportPath, n)
+	if c.MeasureRewriteImpact && isGoFile(file) {
+		c.addImpact(fc.raw, fc.body)
+	}
+	c.recordCopied(pkg, file, filepath.Join(fc.dir, fc.name))
+	c.printDryRun(file, filepath.Join(fc.dir, fc.name))
+	c.logCopy(file, filepath.Join(fc.dir, fc.name), time.Since(start))
+	c.progress.fileDone(pkg, file)
+
+	return nil, nil
+}
+
+// fileCopy is the source file transformed to be written to the destination.
+type fileCopy struct {
+	src  string // source file path
+	dir  string // destination directory
+	name string // destination file name
+	body string // transformed content
+
+	raw      string // source content
+	verbatim bool   // whether the transformation left the content as is
+}
+
+// transformFile reads the source file of pkg and transforms it for the copy.
+// It returns nil if the file is skipped.
+func (c *Copier) transformFile(pkg *Package, file string) (*fileCopy, error) {
+	m := c.compacted[pkg.ImportPath]
+
+	_, filename := filepath.Split(file)
+	filename = c.renameFile(file, filename)
+	if c.DstFileSuffix != "" && isGoFile(filename) {
+		filename = suffixedName(filename, c.DstFileSuffix, c.ports)
+	}
+	dstPath := c.packageDir(pkg)
+	if m != nil {
+		filename = pkg.Name + "_" + filename
+		dstPath = c.packageDir(m.into)
+	} else if c.XTestDir && contains(pkg.XTestGoFiles, filepath.Base(file)) {
+		// the external test package imports the package under test by its
+		// import path, so it builds from the sibling directory as well
+		dstPath += "_test"
+	}
+	c.debugf("dstPath: %s", dstPath)
+
+	data, err := c.readFile(file)
+	if err != nil {
+		return nil, err
+	}
+	raw := data
+
+	if c.MaxFileSize > 0 && int64(len(data)) > c.MaxFileSize && !c.isDocGo(file) {
+		if c.Strict {
+			return nil, fmt.Errorf("%s is %d bytes, larger than -max-file-size %d", file, len(data), c.MaxFileSize)
+		}
+		c.warnf("skip %s: %d bytes is larger than -max-file-size %d", file, len(data), c.MaxFileSize)
+		c.addSkipped(file, "-max-file-size")
+		return nil, nil
+	}
+
+	if c.SkipContent != nil && !c.isDocGo(file) && c.SkipContent.MatchString(data) {
+		c.infof("skip: %s matches -skip-content", file)
+		c.addSkipped(file, "-skip-content")
+		return nil, nil
+	}
+
+	// an explicit -skip of doc.go wins over -copy-doc-go
+	if reason := c.skipReason(file, data); reason != "" && (reason == "-skip" || !c.isDocGo(file)) {
+		c.infof("skip: %s by %s", file, reason)
+		c.addSkipped(file, reason)
+		return nil, nil
+	}
+
+	if c.CopyMode == CopyVerbatim {
+		return &fileCopy{src: file, dir: dstPath, name: filename, body: data, raw: raw, verbatim: true}, nil
+	}
+
+	// the non-Go files are copied verbatim, except for the indentation of
+	// the assembly files with AsmIndent
+	if !isGoFile(file) {
+		if c.AsmIndent != "" && isAsmFile(file) {
+			data = canonicalAsmIndent(data, c.AsmIndent)
+		}
+		return &fileCopy{src: file, dir: dstPath, name: filename, body: data, raw: raw, verbatim: data == raw}, nil
+	}
+
+	data, err = c.rewriteImports(file, data)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err = c.dropSelfImport(pkg, file, data)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err = c.rewriteXTestImport(pkg, file, data)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.RewriteTestdataPaths && isTestFile(file) {
+		data, err = c.rewriteTestStrings(file, data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if c.ResolveAliasCollisions {
+		data, err = c.resolveImportCollisions(file, data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if m != nil {
+		data, err = renamePackage(file, data, m.into.Name)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if name, ok := c.packageRename(pkg, file); ok && m == nil {
+		data, err = renamePackage(file, data, name)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if merged := c.mergedInto(pkg); len(merged) > 0 {
+		data, err = c.inlineImports(file, data, merged)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(c.RenameReceiver) > 0 {
+		data, err = c.renameReceivers(file, data, c.RenameReceiver)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if c.FollowLinkname {
+		data = c.rewriteLinknames(data)
+	}
+
+	data = c.canonicalImportComment(data, c.ImportComment)
+	data = stripDirectives(data, c.StripDirective)
+	if c.StripLinkname {
+		data, err = c.stripLinknames(pkg, file, data)
+		if err != nil {
+			return nil, err
+		}
+	}
+	data = rewriteEmbedPatterns(data, c.RewriteEmbedPattern)
+
+	data, err = replaceBuildTags(data, c.ReplaceBuildTag)
+	if err != nil {
+		return nil, fmt.Errorf("replace build tags of %s: %w", file, err)
+	}
+
+	if c.ValidateBuildTags {
+		if err := validateBuildConstraints(filepath.Join(dstPath, filename), data); err != nil {
+			return nil, err
+		}
+	}
+
+	return &fileCopy{src: file, dir: dstPath, name: filename, body: data, raw: raw, verbatim: data == raw}, nil
+}
+
+// isWithin reports whether the path is the root directory or within it.
+//
+// The symbolic links are resolved as far as the paths exist.
+func isWithin(root, path string) (bool, error) {
+	root, err := resolvePath(root)
+	if err != nil {
+		return false, err
+	}
+	path, err = resolvePath(path)
+	if err != nil {
+		return false, err
+	}
+
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false, nil
+	}
+
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)), nil
+}
+
+// resolvePath returns the absolute path of path with the symbolic links of its
+// longest existing ancestor resolved.
+func resolvePath(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("resolve %s: %w", path, err)
+	}
+
+	var rest []string
+	for dir := path; ; dir = filepath.Dir(dir) {
+		if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+			return filepath.Join(append([]string{resolved}, rest...)...), nil
+		}
+		if dir == filepath.Dir(dir) {
+			return path, nil
+		}
+		rest = append([]string{filepath.Base(dir)}, rest...)
+	}
+}
+
+// isInternalImport reports whether the imp is a cmd or internal import which
+// needs to be copied, that is, its first path element is cmd or any of them
+// is internal. The elements merely containing them, such as cmdflag, are not.
+func isInternalImport(imp string) bool {
+	elems := strings.Split(imp, "/")
+	if elems[0] == "cmd" {
+		return true
+	}
+	for _, elem := range elems {
+		if elem == "internal" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isPseudoPackage reports whether the listed pkg is a standard package without
+// a directory, such as "C", which has nothing to copy.
+func isPseudoPackage(pkg *Package) bool {
+	return pkg.Dir == "" && (pkg.Standard || pkg.ImportPath == "C")
+}
+
+// needsCopy reports whether the listed pkg is a standard package which cannot
+// be imported from outside of GOROOT, that is, a cmd package or a package
+// under an internal directory, or with -module-source, an internal package of
+// the module.
+func (c *Copier) needsCopy(pkg *Package) bool {
+	if c.srcModule != "" {
+		return c.isModuleInternal(pkg.ImportPath)
+	}
+	if !pkg.Standard {
+		return false
+	}
+	if _, ok := vendorPath(pkg.ImportPath); ok {
+		return c.CopyVendor
+	}
+
+	return isInternalImport(pkg.ImportPath)
+}
+
+// checkIncomplete reports the errors of the incomplete pkg, which is a
+// warning or, if -strict is given, an error.
+func (c *Copier) checkIncomplete(pkg *Package) error {
+	if !pkg.Incomplete {
+		return nil
+	}
+
+	var reasons []string
+	if pkg.Error != nil {
+		reasons = append(reasons, pkg.Error.Err)
+	}
+	for _, depErr := range pkg.DepsErrors {
+		reasons = append(reasons, depErr.Err)
+	}
+	if len(reasons) == 0 {
+		reasons = append(reasons, "unknown error")
+	}
+
+	msg := fmt.Sprintf("%s is incomplete: %s", pkg.ImportPath, strings.Join(reasons, "; "))
+	if c.Strict {
+		return errors.New(msg)
+	}
+	c.warnf("%s", msg)
+	if c.DryRun && !c.checking {
+		// the plan is still printed in full, but fails as a pre-flight check
+		c.mu.Lock()
+		c.errs = append(c.errs, errors.New(msg))
+		c.mu.Unlock()
+	}
+
+	return nil
+}
+
+// isTestVariant reports whether pkg is a test variant of a package, such as
+// the external test package "foo_test [foo.test]" or the test binary "foo.test".
+//
+// The external test package files share the directory with the package
+// under test and are listed in its XTestGoFiles, so the variants must not be
+// copied as a separate package.
+func isTestVariant(pkg *Package) bool {
+	return pkg.ForTest != "" || strings.HasSuffix(pkg.ImportPath, ".test")
+}
+
+// isExcludedTest reports whether pkg is the test variant of the package under
+// test whose files are excluded by NoTests or NoXTests, so that the imports of
+// the excluded files are not followed.
+func (c *Copier) isExcludedTest(pkg *Package) bool {
+	if pkg.ForTest == "" {
+		return false
+	}
+
+	switch trimTestVariant(pkg.ImportPath) {
+	case pkg.ForTest + "_test":
+		return c.NoTests || c.NoXTests
+	case pkg.ForTest:
+		return c.NoTests
+	}
+
+	return false
+}
+
+// isExcludedTestFile reports whether the file of pkg is excluded by NoTests
+// or NoXTests.
+func (c *Copier) isExcludedTestFile(pkg *Package, file string) bool {
+	name := filepath.Base(file)
+	if c.NoTests && contains(pkg.TestGoFiles, name) {
+		return true
+	}
+
+	return (c.NoTests || c.NoXTests) && contains(pkg.XTestGoFiles, name)
+}
+
+// trimTestVariant trims the test variant suffix such as " [foo.test]" from
+// the import path listed by -test.
+func trimTestVariant(path string) string {
+	if i := strings.Index(path, " ["); i >= 0 {
+		return path[:i]
+	}
+
+	return path
+}
+
+// dstDir returns the destination directory of the source directory dir.
+//
+// The path elements of dir relative to the source root are laid out by Layout
+// as rewriteImportPath does, so that with LayoutFlatten a directory such as
+// cmd/go/internal/cmdflag keeps the cmd within its element name, and the
+// destination is a clean path under Dst.
+func (c *Copier) dstDir(dir string) string {
+	rel, err := c.srcRel(dir)
+	if err != nil {
+		// not under the source root, so that nothing but the base name is safe
+		rel = filepath.Base(dir)
+	}
+
+	kept := []string{c.Dst}
+	for _, elem := range c.layoutElems(strings.Split(filepath.ToSlash(rel), "/")) {
+		if elem != "." && elem != "" {
+			kept = append(kept, elem)
+		}
+	}
+
+	return filepath.Join(kept...)
+}
+
+// srcRel returns the path of the source file or directory name relative to
+// the source root. They are compared with the symbolic links resolved as well,
+// since go list reports the resolved directories of a GOROOT reached through
+// a link, such as the one of Homebrew, and Src could be relative.
+func (c *Copier) srcRel(name string) (string, error) {
+	name = filepath.Clean(name)
+	for _, root := range [...]string{c.gorootSrc, c.realSrc} {
+		if rel, ok := relWithin(root, name); ok {
+			return rel, nil
+		}
+	}
+	resolved, err := resolvePath(name)
+	if err != nil {
+		return "", err
+	}
+	if rel, ok := relWithin(c.realSrc, resolved); ok {
+		return rel, nil
+	}
+
+	return "", fmt.Errorf("%s is not under the source tree %s", name, c.gorootSrc)
+}
+
+// relWithin returns the path of path relative to root, and reports whether
+// path is root or under it.
+func relWithin(root, path string) (string, bool) {
+	if root == "" {
+		return "", false
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+
+	return rel, true
+}
+
+// packageDir returns the destination directory of pkg, rewritten by the first
+// matching rewrite rule and renamed by the rename map if given.
+func (c *Copier) packageDir(pkg *Package) string {
+	dir := c.dstDir(pkg.Dir)
+	if canonical, ok := vendorPath(pkg.ImportPath); ok && c.srcModule == "" {
+		dir = filepath.Join(c.Dst, filepath.FromSlash(vendorDstPath(canonical)))
+	}
+	if rel, ok := c.matchRewrite(pkg.ImportPath); ok {
+		dir = filepath.Join(c.Dst, filepath.FromSlash(rel))
+	}
+	if name, ok := c.renames[pkg.ImportPath]; ok {
+		dir = filepath.Join(filepath.Dir(dir), name)
+	}
+
+	return dir
+}
+
+// renameFile returns the destination file name of the source file, renamed
+// by the -rename-file mapping which is keyed by either the base name or the
+// source path relative to the source root.
+func (c *Copier) renameFile(file, name string) string {
+	if rel, err := c.srcRel(file); err == nil {
+		if newName, ok := c.RenameFile[filepath.ToSlash(rel)]; ok {
+			return newName
+		}
+	}
+	if newName, ok := c.RenameFile[name]; ok {
+		return newName
+	}
+
+	return name
+}
+
+// copyFiles returns the source files of pkg to be copied.
+func (c *Copier) copyFiles(pkg *Package) (files []string) {
+	candidates := sourceFiles(pkg)
+	if _, ok := c.compacted[pkg.ImportPath]; ok {
+		// the tests of the merged package are dropped
+		candidates = nil
+		for _, name := range pkg.GoFiles {
+			candidates = append(candidates, filepath.Join(pkg.Dir, name))
+		}
+	} else if c.Amalgamate {
+		// the ignored files would conflict with the amalgamated file
+		candidates = candidates[:0:0]
+		for _, file := range sourceFiles(pkg) {
+			if !contains(pkg.IgnoredGoFiles, filepath.Base(file)) {
+				candidates = append(candidates, file)
+			}
+		}
+	}
+
+	for _, file := range candidates {
+		if c.SymlinkAssets && !isGoFile(file) {
+			// linked by linkAssets instead
+			continue
+		}
+		if c.isExcludedTestFile(pkg, file) {
+			continue
+		}
+		if !c.skipFile(file) {
+			files = append(files, file)
+		}
+	}
+
+	return files
+}
+
+// isDocGo reports whether the file is doc.go which is retained by -copy-doc-go
+// against the implicit filters such as -skip-content and -max-file-size, but
+// not against an explicit -skip pattern.
+func (c *Copier) isDocGo(file string) bool {
+	return c.CopyDocGo && filepath.Base(file) == "doc.go"
+}
+
+// skipFile reports whether the file should be excluded from the copy.
+//
+// doc.go carries the package documentation, so it is always retained unless
+// the -copy-doc-go=false is given or it is excluded by -skip.
+func (c *Copier) skipFile(file string) bool {
+	if c.isDocGo(file) {
+		return false
+	}
+
+	switch filepath.Base(file) {
+	case "zbootstrap.go": // zbootstrap.go is created by bootstrap
+		return true
+	}
+
+	return false
+}
+
+func sourceFiles(pkg *Package) (files []string) {
+	fileLists := [...][]string{
+		pkg.GoFiles,
+		pkg.CgoFiles,
+		pkg.TestGoFiles,
+		pkg.XTestGoFiles,
+		pkg.IgnoredGoFiles,
+		pkg.SFiles,
+		pkg.HFiles,
+		pkg.CFiles,
+	}
+
+	for _, fileList := range fileLists {
+		for _, file := range fileList {
+			files = append(files, filepath.Join(pkg.Dir, file))
+		}
+	}
+	sort.Strings(files)
+
+	return files
+}
+
+// printDryRun prints the planned write of the src file to dst with -dry-run.
+func (c *Copier) printDryRun(src, dst string) {
+	if !c.DryRun || c.checking {
+		return
+	}
+
+	// Stat passes through the dry run overlay, so the file written just
+	// before is not reported as an overwrite.
+	state := "overwrite"
+	if _, err := c.FS.Stat(dst); errors.Is(err, fs.ErrNotExist) {
+		state = "new"
+	}
+	c.infof("dry-run: %s -> %s (%s)", src, dst, state)
+}
+
+// isGoFile reports whether the file is a Go source file.
+func isGoFile(file string) bool {
+	return filepath.Ext(file) == ".go"
+}
+
+func (c *Copier) readFile(path string) (string, error) {
+	data, err := c.FS.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("read %s file: %w", path, err)
+	}
+
+	return string(data), nil
+}
+
+// errorSnippet returns the line of the Go source body at the position of the
+// parse error err, indented on a new line, or "" if err has no position.
+func errorSnippet(err error, body string) string {
+	var pos token.Position
+	var list scanner.ErrorList
+	var e *scanner.Error
+	switch {
+	case errors.As(err, &list) && len(list) > 0:
+		pos = list[0].Pos
+	case errors.As(err, &e):
+		pos = e.Pos
+	default:
+		return ""
+	}
+
+	lines := strings.Split(body, "\n")
+	if pos.Line < 1 || pos.Line > len(lines) {
+		return ""
+	}
+
+	return fmt.Sprintf("\n\t%d: %s", pos.Line, strings.TrimRight(lines[pos.Line-1], "\r"))
+}
+
+// writeFile processes the Go source body with goimports and writes it to the
+// name file in dir. It returns the number of bytes written.
+func (c *Copier) writeFile(dir, name, body string) (int, error) {
+	data, err := imports.Process(name, []byte(body), &imports.Options{
+		TabWidth:  8,
+		TabIndent: true,
+		Comments:  true,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("process goimports %s: %w%s", filepath.Join(dir, name), err, errorSnippet(err, body))
+	}
+	data = groupLocalImports(data, c.Module)
+
+	if c.licenseHeader != "" {
+		data = injectLicense(data, c.licenseHeader)
+	}
+
+	if c.MarkGenerated {
+		marker, err := c.markerOf(filepath.Join(dir, name))
+		if err != nil {
+			return 0, err
+		}
+		data = markGenerated(data, marker)
+	}
+
+	if c.NormalizeImportsOrder {
+		data, err = normalizeImports(name, data, c.Module, c.PreserveImportComments)
+		if err != nil {
+			return 0, fmt.Errorf("normalize imports order: %w", err)
+		}
+	}
+
+	return c.writeVerbatim(dir, name, string(data))
+}
+
+// writeVerbatim writes body to the name file in dir as is. It returns the
+// number of bytes written.
+func (c *Copier) writeVerbatim(dir, name, body string) (int, error) {
+	filename, err := checkPathLen(filepath.Join(dir, name))
+	if err != nil {
+		return 0, err
+	}
+	if abs, err := filepath.Abs(filename); err == nil {
+		c.mu.Lock()
+		c.writtenFiles[abs] = true
+		c.mu.Unlock()
+	}
+
+	if c.Update {
+		state, err := c.updateState(filename, []byte(body))
+		if err != nil {
+			return 0, err
+		}
+		c.addUpdate(state, filename)
+		switch state {
+		case updateSkipped:
+			c.addSkipped(filename, "unchanged")
+			return len(body), nil
+		case updateConflicted:
+			c.warnf("conflict: %s is modified locally since %s, skip (use -force to overwrite)", filename, c.Manifest)
+			c.addSkipped(filename, "modified locally")
+			return len(body), nil
+		}
+	}
+
+	if err := c.mkdirAll(filepath.Dir(filename)); err != nil {
+		return 0, err
+	}
+	written, err := c.writeIfChanged(filename, []byte(body))
+	if err != nil {
+		return 0, fmt.Errorf("write %s file: %w", filename, err)
+	}
+	c.countWritten(written)
+
+	return len(body), nil
+}
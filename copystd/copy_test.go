@@ -0,0 +1,547 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestCopyDocGo(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/doc.go": "// Package foo does nothing.\npackage foo\n",
+		"internal/foo/foo.go": "package foo\n\nfunc Foo() {}\n",
+	})
+
+	tests := []struct {
+		name      string
+		copyDocGo bool
+		setup     func(c *Copier)
+		want      bool // whether doc.go is copied
+	}{
+		{
+			name:      "skip-content",
+			copyDocGo: true,
+			setup:     func(c *Copier) { c.SkipContent = regexp.MustCompile(`package foo`) },
+			want:      true,
+		},
+		{
+			name:      "max-file-size",
+			copyDocGo: true,
+			setup:     func(c *Copier) { c.MaxFileSize = 1 },
+			want:      true,
+		},
+		{
+			name:      "explicit skip",
+			copyDocGo: true,
+			setup:     func(c *Copier) { c.Skip = []string{"doc.go"} },
+			want:      false,
+		},
+		{
+			name:      "explicit skip pattern",
+			copyDocGo: true,
+			setup:     func(c *Copier) { c.Skip = []string{"internal/foo/*.go"} },
+			want:      false,
+		},
+		{
+			name:      "opt out",
+			copyDocGo: false,
+			setup:     func(c *Copier) { c.SkipContent = regexp.MustCompile(`package foo`) },
+			want:      false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys := newMemFS()
+			c := testCopier(t, src, fsys, "internal/foo")
+			c.CopyDocGo = tt.copyDocGo
+			tt.setup(c)
+
+			if err := c.Run(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, got := fsys.file(filepath.Join(c.Dst, "foo", "doc.go")); got != tt.want {
+				t.Errorf("doc.go copied: got %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExternalTestPackage(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go":      "package foo\n\nfunc Foo() int { return 1 }\n",
+		"internal/foo/foo_test.go": "package foo\n\nimport \"testing\"\n\nfunc TestFoo(t *testing.T) { Foo() }\n",
+		"internal/foo/x_test.go":   "package foo_test\n\nimport (\n\t\"internal/foo\"\n\t\"testing\"\n)\n\nfunc TestX(t *testing.T) { foo.Foo() }\n",
+	})
+	// the test variants are listed by -test
+	buildTestGoroot(t, src)
+	fsys := newMemFS()
+	c := testCopier(t, src, fsys, "internal/foo")
+	c.Test = true
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := fsys.paths(c.Dst), []string{"foo/foo.go", "foo/foo_test.go", "foo/x_test.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("copied files: got %q, want %q", got, want)
+	}
+	x, _ := fsys.file(filepath.Join(c.Dst, "foo", "x_test.go"))
+	if !strings.Contains(x, "package foo_test") || !strings.Contains(x, `"example.com/m/foo"`) {
+		t.Errorf("x_test.go is not the external test of the copied foo:\n%s", x)
+	}
+}
+
+func TestRenameFile(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go": "package foo\n\nimport \"internal/bar\"\n\nvar _ = bar.Bar\n",
+		"internal/foo/doc.go": "// Package foo is a test package.\npackage foo\n",
+		"internal/bar/bar.go": "package bar\n\nconst Bar = 1\n",
+		"internal/bar/doc.go": "// Package bar is a test package.\npackage bar\n",
+	})
+	fsys := newMemFS()
+	c := testCopier(t, src, fsys, "internal/foo")
+	c.RenameFile = map[string]string{
+		"doc.go":              "package.go", // by the base name
+		"internal/foo/foo.go": "impl.go",    // by the source path
+	}
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"bar/bar.go", "bar/package.go", "foo/impl.go", "foo/package.go"}
+	if got := fsys.paths(c.Dst); !reflect.DeepEqual(got, want) {
+		t.Errorf("copied files: got %q, want %q", got, want)
+	}
+}
+
+func TestGoCache(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go": "package foo\n\nfunc Foo() {}\n",
+	})
+
+	t.Run("gocache", func(t *testing.T) {
+		recorded := recordGoListEnv(t, "GOCACHE")
+		cache := t.TempDir()
+		c := testCopier(t, src, newMemFS(), "internal/foo")
+		c.GoCache = cache
+
+		if err := c.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, env := range recorded() {
+			if env != "GOCACHE="+cache {
+				t.Errorf("go list run with %s, want GOCACHE=%s", env, cache)
+			}
+		}
+	})
+
+	t.Run("isolate", func(t *testing.T) {
+		recorded := recordGoListEnv(t, "GOCACHE")
+		c := testCopier(t, src, newMemFS(), "internal/foo")
+		c.Isolate = true
+
+		if err := c.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		prefix := "GOCACHE=" + filepath.Join(os.TempDir(), "go-copystd-gocache-")
+		for _, env := range recorded() {
+			if !strings.HasPrefix(env, prefix) {
+				t.Errorf("go list run with %s, want the temporary %s*", env, prefix)
+			}
+		}
+		if _, err := os.Stat(c.GoCache); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("the temporary GOCACHE %s is not removed: %v", c.GoCache, err)
+		}
+	})
+}
+
+func TestDstWithinSrc(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go": "package foo\n\nfunc Foo() {}\n",
+	})
+	link := filepath.Join(t.TempDir(), "goroot")
+	if err := os.Symlink(src, link); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name           string
+		dst            string
+		allowDangerous bool
+		wantErr        bool
+	}{
+		{name: "src", dst: src, wantErr: true},
+		{name: "within", dst: filepath.Join(src, "src", "vendored"), wantErr: true},
+		{name: "symlink", dst: filepath.Join(link, "vendored"), wantErr: true},
+		{name: "sibling", dst: src + "-copy"},
+		{name: "allow-dangerous", dst: filepath.Join(src, "vendored"), allowDangerous: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys := newMemFS()
+			c := testCopier(t, src, fsys, "internal/foo")
+			c.Dst = tt.dst
+			c.AllowDangerous = tt.allowDangerous
+
+			err := c.Run(context.Background())
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "refusing to write into the source tree") {
+					t.Errorf("got error %v, want the refusal", err)
+				}
+				if paths := fsys.paths(tt.dst); len(paths) > 0 {
+					t.Errorf("files are written: %q", paths)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := fsys.file(filepath.Join(tt.dst, "foo", "foo.go")); !ok {
+				t.Errorf("foo.go is not copied to %s", tt.dst)
+			}
+		})
+	}
+}
+
+func TestCheckIncomplete(t *testing.T) {
+	incomplete := &Package{
+		ImportPath: "internal/foo",
+		Incomplete: true,
+		DepsErrors: []*PackageError{{Err: "cannot find package example.org/ext"}},
+	}
+	const want = "internal/foo is incomplete: cannot find package example.org/ext"
+
+	tests := []struct {
+		name     string
+		pkg      *Package
+		strict   bool
+		dryRun   bool
+		wantErr  bool
+		wantWarn bool
+		wantErrs int
+	}{
+		{name: "complete", pkg: &Package{ImportPath: "internal/foo"}},
+		{name: "warn", pkg: incomplete, wantWarn: true},
+		{name: "strict", pkg: incomplete, strict: true, wantErr: true},
+		{name: "dry-run", pkg: incomplete, dryRun: true, wantWarn: true, wantErrs: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stderr strings.Builder
+			c := &Copier{Strict: tt.strict, DryRun: tt.dryRun, Stderr: &stderr}
+			c.init()
+
+			err := c.checkIncomplete(tt.pkg)
+			if got := err != nil; got != tt.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tt.wantErr)
+			}
+			if err != nil && err.Error() != want {
+				t.Errorf("got error %q, want %q", err, want)
+			}
+			if got := strings.Contains(stderr.String(), want); got != tt.wantWarn {
+				t.Errorf("warned: got %t, want %t\n%s", got, tt.wantWarn, stderr.String())
+			}
+			if len(c.errs) != tt.wantErrs {
+				t.Errorf("got %d errors of the run, want %d", len(c.errs), tt.wantErrs)
+			}
+		})
+	}
+}
+
+func TestSkipContent(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go":     "package foo\n\nfunc Foo() {}\n",
+		"internal/foo/legacy.go":  "package foo\n\n// Deprecated: use Foo.\nfunc Legacy() { Foo() }\n",
+		"internal/foo/foo_asm.s":  "// Deprecated: assembly\n",
+		"internal/foo/foo_gen.go": "// Code generated by hand.\n\npackage foo\n\nconst Gen = 1\n",
+	})
+	fsys := newMemFS()
+	c := testCopier(t, src, fsys, "internal/foo")
+	c.SkipContent = regexp.MustCompile(`(?m)^// Deprecated:`)
+
+	res, err := c.Copy(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := fsys.paths(c.Dst), []string{"foo/foo.go", "foo/foo_gen.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("copied files: got %q, want %q", got, want)
+	}
+	want := []string{filepath.Join(src, "src", "internal", "foo", "foo_asm.s"), filepath.Join(src, "src", "internal", "foo", "legacy.go")}
+	if !reflect.DeepEqual(res.Skipped, want) {
+		t.Errorf("skipped files: got %q, want %q", res.Skipped, want)
+	}
+}
+
+func TestEnvGoFlags(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go": "package foo\n\nfunc Foo() {}\n",
+	})
+	recorded := recordGoListEnv(t, "GOFLAGS")
+	const goflags = "GOFLAGS=-tags=foo,bar  -trimpath"
+	c := testCopier(t, src, newMemFS(), "internal/foo")
+	c.Env = []string{goflags}
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, env := range recorded() {
+		if env != goflags {
+			t.Errorf("go list run with %q, want %q", env, goflags)
+		}
+	}
+}
+
+func TestMaxFileSize(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go":    "package foo\n\nfunc Foo() {}\n",
+		"internal/foo/tables.go": "package foo\n\nvar table = [...]string{" + strings.Repeat(`"entry", `, 100) + "}\n",
+	})
+	tables := filepath.Join(src, "src", "internal", "foo", "tables.go")
+
+	t.Run("warn", func(t *testing.T) {
+		fsys := newMemFS()
+		c := testCopier(t, src, fsys, "internal/foo")
+		c.MaxFileSize = 512
+
+		res, err := c.Copy(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got, want := fsys.paths(c.Dst), []string{"foo/foo.go"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("copied files: got %q, want %q", got, want)
+		}
+		if want := "skip " + tables + ": "; len(res.Warnings) != 1 || !strings.HasPrefix(res.Warnings[0], want) {
+			t.Errorf("got warnings %q, want %q", res.Warnings, want)
+		}
+	})
+
+	t.Run("strict", func(t *testing.T) {
+		c := testCopier(t, src, newMemFS(), "internal/foo")
+		c.MaxFileSize = 512
+		c.Strict = true
+
+		err := c.Run(context.Background())
+		if want := tables + " is "; err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("got error %v, want %q", err, want)
+		}
+	})
+}
+
+func TestNeedsCopy(t *testing.T) {
+	tests := []struct {
+		pkg  Package
+		want bool
+	}{
+		{pkg: Package{ImportPath: "internal/foo", Standard: true}, want: true},
+		{pkg: Package{ImportPath: "internal/foo", Standard: true, DepOnly: true}, want: true},
+		{pkg: Package{ImportPath: "crypto/internal/boring", Standard: true}, want: true},
+		{pkg: Package{ImportPath: "cmd/go", Standard: true}, want: true},
+		{pkg: Package{ImportPath: "fmt", Standard: true}, want: false},
+		{pkg: Package{ImportPath: "fmt", Standard: true, DepOnly: true}, want: false},
+		{pkg: Package{ImportPath: "internals/foo", Standard: true}, want: false},
+		{pkg: Package{ImportPath: "vendor/golang.org/x/net/internal/socks", Standard: true}, want: false},
+		// not std regardless of the path
+		{pkg: Package{ImportPath: "example.org/internal/foo"}, want: false},
+		{pkg: Package{ImportPath: "internal/foo"}, want: false},
+		{pkg: Package{ImportPath: "cmd/go", DepOnly: true}, want: false},
+	}
+	c := &Copier{}
+	c.init()
+	for _, tt := range tests {
+		if got := c.needsCopy(&tt.pkg); got != tt.want {
+			t.Errorf("needsCopy(%s, Standard: %t, DepOnly: %t) = %t, want %t", tt.pkg.ImportPath, tt.pkg.Standard, tt.pkg.DepOnly, got, tt.want)
+		}
+	}
+}
+
+func TestIsInternalImport(t *testing.T) {
+	for imp, want := range map[string]bool{
+		"cmd/go/internal/cmdflag": true,
+		"cmd/internal/obj/x86":    true,
+		"cmd":                     true,
+		"internal/internaltest":   true,
+		"crypto/internal/boring":  true,
+		"fmt":                     false,
+		"cmdflag":                 false,
+		"cmdline/foo":             false,
+		"internals/foo":           false,
+		"foo/internaltest":        false,
+		"foo/cmd":                 false,
+	} {
+		if got := isInternalImport(imp); got != want {
+			t.Errorf("isInternalImport(%q) = %t, want %t", imp, got, want)
+		}
+	}
+}
+
+func TestSubstringPaths(t *testing.T) {
+	// the elements merely containing cmd and internal survive the flattening
+	src := testGoroot(t, map[string]string{
+		"internal/internaltest/internaltest.go": "package internaltest\n\nimport \"internal/cmdtest\"\n\nvar _ = cmdtest.Cmd\n",
+		"internal/cmdtest/cmdtest.go":           "package cmdtest\n\nconst Cmd = 1\n",
+	})
+	fsys := newMemFS()
+	c := testCopier(t, src, fsys, "internal/internaltest")
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := fsys.paths(c.Dst), []string{"cmdtest/cmdtest.go", "internaltest/internaltest.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("copied files: got %q, want %q", got, want)
+	}
+	data, _ := fsys.file(filepath.Join(c.Dst, "internaltest", "internaltest.go"))
+	if !strings.Contains(data, `import "example.com/m/cmdtest"`) {
+		t.Errorf("internaltest.go does not import the copied cmdtest:\n%s", data)
+	}
+
+	c.init()
+	gorootSrc := filepath.Join(src, "src")
+	for imp, want := range map[string]string{
+		"cmd/go/internal/cmdflag": "go/cmdflag",
+		"cmd/internal/obj/x86":    "obj/x86",
+		"internal/internaltest":   "internaltest",
+	} {
+		if got := c.rewriteImportPath(imp); got != "example.com/m/"+want {
+			t.Errorf("rewriteImportPath(%q): got %q, want %q", imp, got, "example.com/m/"+want)
+		}
+		dir := filepath.Join(gorootSrc, filepath.FromSlash(imp))
+		if got := c.dstDir(dir); got != filepath.Join(c.Dst, filepath.FromSlash(want)) {
+			t.Errorf("dstDir(%s): got %s, want %s", dir, got, filepath.Join(c.Dst, filepath.FromSlash(want)))
+		}
+	}
+}
+
+func TestGoimportsErrorSnippet(t *testing.T) {
+	// go list reads the imports alone, which goimports fails to process
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go": "package foo\n\nimport \"internal/bar\"\n\nfunc Foo() int { return bar.Bar + ) }\n",
+		"internal/bar/bar.go": "package bar\n\nconst Bar = 1\n",
+	})
+	fsys := newMemFS()
+	c := testCopier(t, src, fsys, "internal/foo")
+
+	err := c.Run(context.Background())
+	if err == nil {
+		t.Fatal("no error")
+	}
+	// the error quotes the offending line of the copied file
+	for _, want := range []string{
+		"process goimports " + filepath.Join(c.Dst, "foo", "foo.go") + ": foo.go:5:",
+		"\n\t5: func Foo() int { return bar.Bar + ) }",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("got error %v, want %q", err, want)
+		}
+	}
+	if _, ok := fsys.file(filepath.Join(c.Dst, "foo", "foo.go")); ok {
+		t.Error("foo.go is written")
+	}
+}
+
+func TestGO111MODULE(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go": "package foo\n\nimport \"internal/bar\"\n\nfunc Foo() int { return bar.Bar }\n",
+		"internal/bar/bar.go": "package bar\n\nconst Bar = 1\n",
+	})
+
+	// the GOPATH mode and the auto detection of the environment are not used
+	for _, mode := range []string{"off", "auto", ""} {
+		t.Run("GO111MODULE="+mode, func(t *testing.T) {
+			t.Setenv("GO111MODULE", mode)
+			recorded := recordGoListEnv(t, "GO111MODULE")
+			fsys := newMemFS()
+			c := testCopier(t, src, fsys, "internal/foo")
+
+			if err := c.Run(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, env := range recorded() {
+				if env != "GO111MODULE=on" {
+					t.Errorf("go list run with %s, want GO111MODULE=on", env)
+				}
+			}
+			if got, want := fsys.paths(c.Dst), []string{"bar/bar.go", "foo/foo.go"}; !reflect.DeepEqual(got, want) {
+				t.Errorf("copied files: got %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestDstDirClean(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go": "package foo\n",
+	})
+	dst := t.TempDir()
+	c := testCopier(t, src, newMemFS())
+	// the separators doubled and trailing after the flags
+	c.Dst = dst + "//std/"
+	c.init()
+
+	gorootSrc := filepath.Join(src, "src")
+	for dir, want := range map[string]string{
+		gorootSrc + "/internal/foo/":          "foo",
+		gorootSrc + "//internal//foo":         "foo",
+		gorootSrc + "/internal/./foo/bar/../": "foo",
+		gorootSrc + "/cmd/compile/internal/":  "compile",
+		gorootSrc + "/cmd/internal//obj/x86/": "obj/x86",
+		gorootSrc + "/internal/":              "",
+	} {
+		want = filepath.Join(dst, "std", filepath.FromSlash(want))
+		if got := c.dstDir(dir); got != want {
+			t.Errorf("%s: got %s, want %s", dir, got, want)
+		}
+	}
+}
+
+func TestNoTests(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go":        "package foo\n\nfunc Foo() int { return 1 }\n",
+		"internal/foo/foo_test.go":   "package foo\n\nimport (\n\t\"internal/bar\"\n\t\"testing\"\n)\n\nfunc TestFoo(t *testing.T) { bar.Bar() }\n",
+		"internal/foo/x_test.go":     "package foo_test\n\nimport (\n\t\"internal/baz\"\n\t\"testing\"\n)\n\nfunc TestX(t *testing.T) { baz.Baz() }\n",
+		"internal/bar/bar.go":        "package bar\n\nfunc Bar() {}\n",
+		"internal/baz/baz.go":        "package baz\n\nfunc Baz() {}\n",
+		"internal/foo/testdata/a.go": "package a\n",
+	})
+	buildTestGoroot(t, src)
+
+	tests := []struct {
+		noTests bool
+		want    []string
+	}{
+		{noTests: false, want: []string{"bar/bar.go", "baz/baz.go", "foo/foo.go", "foo/foo_test.go", "foo/testdata/a.go", "foo/x_test.go"}},
+		// the packages imported only by the tests are not copied either
+		{noTests: true, want: []string{"foo/foo.go"}},
+	}
+	for _, tt := range tests {
+		fsys := newMemFS()
+		c := testCopier(t, src, fsys, "internal/foo")
+		c.Test = true // to follow the imports of the tests
+		c.NoTests = tt.noTests
+
+		if err := c.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := fsys.paths(c.Dst); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("NoTests %t: got copied files %q, want %q", tt.noTests, got, tt.want)
+		}
+	}
+}
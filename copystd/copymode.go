@@ -0,0 +1,36 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// List of CopyMode.
+const (
+	CopyRewrite  = "rewrite"  // rewrite the imports and the other transformations into Dst
+	CopyVerbatim = "verbatim" // copy the files as is into Dst, for archival
+	CopyBoth     = "both"     // rewrite into Dst, and copy as is into VerbatimDst
+)
+
+// writeVerbatimCopy writes the source content of fc as is under VerbatimDst
+// at the path relative to Dst fc is written to, with CopyBoth.
+func (c *Copier) writeVerbatimCopy(fc *fileCopy) error {
+	rel, err := filepath.Rel(c.Dst, fc.dir)
+	if err != nil {
+		return fmt.Errorf("relative path of %s: %w", fc.dir, err)
+	}
+	dir := filepath.Join(c.VerbatimDst, rel)
+
+	if c.script != nil {
+		c.script.copyFile(fc.src, filepath.Join(dir, fc.name), true)
+		return nil
+	}
+	if _, err := c.writeVerbatim(dir, fc.name, fc.raw); err != nil {
+		return fmt.Errorf("write verbatim copy: %w", err)
+	}
+
+	return nil
+}
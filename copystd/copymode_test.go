@@ -0,0 +1,64 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCopyMode(t *testing.T) {
+	const (
+		foo          = "package foo\n\nimport \"internal/bar\"\n\nfunc Foo() int { return bar.Bar }\n"
+		rewrittenFoo = "package foo\n\nimport \"example.com/m/bar\"\n\nfunc Foo() int { return bar.Bar }\n"
+		bar          = "package bar\n\nconst Bar = 1\n"
+	)
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go": foo,
+		"internal/bar/bar.go": bar,
+	})
+
+	tests := []struct {
+		mode         string
+		wantDst      string // foo.go in Dst
+		wantVerbatim string // foo.go in VerbatimDst
+	}{
+		{mode: CopyRewrite, wantDst: rewrittenFoo},
+		{mode: CopyVerbatim, wantDst: foo},
+		{mode: CopyBoth, wantDst: rewrittenFoo, wantVerbatim: foo},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			fsys := newMemFS()
+			c := testCopier(t, src, fsys, "internal/foo")
+			c.CopyMode = tt.mode
+			if tt.mode == CopyBoth {
+				c.VerbatimDst = filepath.Join(t.TempDir(), "verbatim")
+			}
+
+			if err := c.Run(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			want := []string{"bar/bar.go", "foo/foo.go"}
+			if got := fsys.paths(c.Dst); !reflect.DeepEqual(got, want) {
+				t.Errorf("copied files: got %q, want %q", got, want)
+			}
+			if got, _ := fsys.file(filepath.Join(c.Dst, "foo", "foo.go")); got != tt.wantDst {
+				t.Errorf("got foo.go\n%s\nwant\n%s", got, tt.wantDst)
+			}
+			if tt.wantVerbatim == "" {
+				return
+			}
+			if got := fsys.paths(c.VerbatimDst); !reflect.DeepEqual(got, want) {
+				t.Errorf("verbatim files: got %q, want %q", got, want)
+			}
+			if got, _ := fsys.file(filepath.Join(c.VerbatimDst, "foo", "foo.go")); got != tt.wantVerbatim {
+				t.Errorf("got verbatim foo.go\n%s\nwant\n%s", got, tt.wantVerbatim)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import "strings"
+
+// stripDirectives removes the directive comment lines of the names, such as
+// "go:debug" or "go:linkname", from the Go source body.
+//
+// A name without a colon is taken as the go: directive, so "debug" is the
+// same as "go:debug".
+func stripDirectives(body string, names []string) string {
+	if len(names) == 0 {
+		return body
+	}
+
+	lines := strings.SplitAfter(body, "\n")
+	out := lines[:0]
+	for _, line := range lines {
+		if isDirectiveOf(strings.TrimSpace(line), names) {
+			continue
+		}
+		out = append(out, line)
+	}
+
+	return strings.Join(out, "")
+}
+
+// isDirectiveOf reports whether the line is the directive comment of any of
+// the names.
+func isDirectiveOf(line string, names []string) bool {
+	if !strings.HasPrefix(line, "//") {
+		return false
+	}
+	text := line[len("//"):]
+
+	for _, name := range names {
+		if !strings.Contains(name, ":") {
+			name = "go:" + name
+		}
+		if rest := strings.TrimPrefix(text, name); rest != text && (rest == "" || rest[0] == ' ' || rest[0] == '\t') {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,42 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestStripDirective(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go": "//go:build !plan9\n\npackage foo\n\n//go:noinline\nfunc Foo() {}\n",
+		"internal/foo/foo_test.go": `//go:debug panicnil=1
+//go:debug madvdontneed=1
+
+package foo
+
+import "testing"
+
+//go:debugger is not a go:debug directive
+func TestFoo(t *testing.T) { Foo() }
+`,
+	})
+	fsys := newMemFS()
+	c := testCopier(t, src, fsys, "internal/foo")
+	c.StripDirective = []string{"go:debug"}
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]string{
+		"foo.go":      "//go:build !plan9\n\npackage foo\n\n//go:noinline\nfunc Foo() {}\n",
+		"foo_test.go": "package foo\n\nimport \"testing\"\n\n//go:debugger is not a go:debug directive\nfunc TestFoo(t *testing.T) { Foo() }\n",
+	} {
+		if got, _ := fsys.file(filepath.Join(c.Dst, "foo", name)); got != want {
+			t.Errorf("got %s\n%s\nwant\n%s", name, got, want)
+		}
+	}
+}
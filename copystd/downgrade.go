@@ -0,0 +1,129 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"strings"
+)
+
+// newerBuiltins maps the builtin function to the Go minor version introducing it.
+var newerBuiltins = map[string]int{
+	"clear": 21,
+	"max":   21,
+	"min":   21,
+}
+
+// langFeature is a use of the language feature introduced by a Go version.
+type langFeature struct {
+	pos     token.Position
+	name    string
+	version int // minor version of Go 1 introducing the feature
+}
+
+// parseMinorVersion parses the Go version such as "1.20" or "go1.20" into the
+// minor version.
+func parseMinorVersion(version string) (int, error) {
+	v := strings.TrimPrefix(version, "go")
+	minor, err := strconv.Atoi(strings.TrimPrefix(goLangVersion(v), "1."))
+	if err != nil || !strings.HasPrefix(v, "1.") {
+		return 0, fmt.Errorf("invalid Go version %q", version)
+	}
+
+	return minor, nil
+}
+
+// newerFeatures returns the uses of the language features in the Go source body
+// which are newer than the target minor version of Go 1.
+//
+// The detection is syntactic and best-effort: the builtins are detected
+// unless the names are declared by the package (decls) or in the file, and
+// the range over integer only for the integer literals and len calls.
+func newerFeatures(filename, body string, target int, decls map[string]bool) ([]*langFeature, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, body, 0)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", filename, err)
+	}
+
+	var features []*langFeature
+	add := func(pos token.Pos, name string, version int) {
+		if version > target {
+			features = append(features, &langFeature{pos: fset.Position(pos), name: name, version: version})
+		}
+	}
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.CallExpr:
+			ident, ok := n.Fun.(*ast.Ident)
+			if !ok || ident.Obj != nil || decls[ident.Name] {
+				break
+			}
+			if version, ok := newerBuiltins[ident.Name]; ok {
+				add(ident.Pos(), ident.Name+" builtin", version)
+			}
+
+		case *ast.RangeStmt:
+			switch x := n.X.(type) {
+			case *ast.BasicLit:
+				if x.Kind == token.INT {
+					add(n.For, "range over integer", 22)
+				}
+			case *ast.CallExpr:
+				if ident, ok := x.Fun.(*ast.Ident); ok && ident.Name == "len" && ident.Obj == nil && !decls["len"] {
+					add(n.For, "range over integer", 22)
+				}
+			case *ast.FuncLit:
+				add(n.For, "range over function", 23)
+			}
+		}
+		return true
+	})
+
+	return features, nil
+}
+
+// checkDowngrade reports the language features of the copied Go file of pkg
+// newer than the -downgrade-to target, which is a warning or, if -strict is
+// given, an error.
+func (c *Copier) checkDowngrade(pkg *Package, file, body string, target int) error {
+	c.mu.Lock()
+	decls, ok := c.downgradeDecls[pkg.ImportPath]
+	c.mu.Unlock()
+	if !ok {
+		var err error
+		decls, err = c.topLevelNames(pkg.Dir, append(append([]string{}, pkg.GoFiles...), pkg.TestGoFiles...))
+		if err != nil {
+			return err
+		}
+		c.mu.Lock()
+		c.downgradeDecls[pkg.ImportPath] = decls
+		c.mu.Unlock()
+	}
+
+	features, err := newerFeatures(file, body, target, decls)
+	if err != nil {
+		return err
+	}
+	if len(features) == 0 {
+		return nil
+	}
+
+	msgs := make([]string, len(features))
+	for i, feat := range features {
+		msgs[i] = fmt.Sprintf("%s: %s requires go1.%d", feat.pos, feat.name, feat.version)
+	}
+	msg := fmt.Sprintf("%s uses the features newer than go1.%d:\n\t%s", file, target, strings.Join(msgs, "\n\t"))
+	if c.Strict {
+		return errors.New(msg)
+	}
+	c.warnf("%s", msg)
+
+	return nil
+}
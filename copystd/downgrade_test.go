@@ -0,0 +1,69 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDowngradeTo(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go": "package foo\n\nfunc Foo(a, b int) int { return min(a, b) }\n",
+		// the package declares its own max
+		"internal/foo/max.go": "package foo\n\nfunc max(a, b int) int { return a }\n\nvar _ = max(1, 2)\n",
+	})
+	fooFile := filepath.Join(src, "src", "internal", "foo", "foo.go")
+
+	t.Run("warn", func(t *testing.T) {
+		c := testCopier(t, src, newMemFS(), "internal/foo")
+		c.DowngradeTo = "1.20"
+		var stderr bytes.Buffer
+		c.Stderr = &stderr
+
+		if err := c.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		out := stderr.String()
+		if want := fooFile + " uses the features newer than go1.20"; !strings.Contains(out, want) {
+			t.Errorf("got warnings\n%s\nwant %q", out, want)
+		}
+		if want := "min builtin requires go1.21"; !strings.Contains(out, want) {
+			t.Errorf("got warnings\n%s\nwant %q", out, want)
+		}
+		if strings.Contains(out, "max") {
+			t.Errorf("the declared max is reported:\n%s", out)
+		}
+	})
+
+	t.Run("target", func(t *testing.T) {
+		c := testCopier(t, src, newMemFS(), "internal/foo")
+		c.DowngradeTo = "1.21"
+		var stderr bytes.Buffer
+		c.Stderr = &stderr
+
+		if err := c.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(stderr.String(), "newer than") {
+			t.Errorf("the features of the target are reported:\n%s", &stderr)
+		}
+	})
+
+	t.Run("strict", func(t *testing.T) {
+		fsys := newMemFS()
+		c := testCopier(t, src, fsys, "internal/foo")
+		c.DowngradeTo = "1.20"
+		c.Strict = true
+
+		err := c.Run(context.Background())
+		if err == nil || !strings.Contains(err.Error(), "min builtin requires go1.21") {
+			t.Errorf("got error %v, want the use of min", err)
+		}
+	})
+}
@@ -0,0 +1,92 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDryRun(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go": "package foo\n\nimport \"internal/bar\"\n\nfunc Foo() int { return bar.Bar }\n",
+		"internal/bar/bar.go": "package bar\n\nconst Bar = 1\n",
+	})
+	fsys := newMemFS()
+	c := testCopier(t, src, fsys, "internal/foo")
+	c.DryRun = true
+	var stdout strings.Builder
+	c.Stdout = &stdout
+
+	// foo.go is already copied, bar.go is not
+	foo := filepath.Join(c.Dst, "foo", "foo.go")
+	if err := fsys.MkdirAll(filepath.Dir(foo), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.WriteFile(foo, []byte("package foo\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		filepath.Join("internal", "foo", "foo.go") + " -> " + foo + " (overwrite)",
+		filepath.Join("internal", "bar", "bar.go") + " -> " + filepath.Join(c.Dst, "bar", "bar.go") + " (new)",
+	} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Errorf("got output\n%s\nwant %q", &stdout, want)
+		}
+	}
+	if got, want := fsys.paths(c.Dst), []string{"foo/foo.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("files after the dry run: got %q, want %q", got, want)
+	}
+	if got, _ := fsys.file(foo); got != "package foo\n" {
+		t.Errorf("foo.go is overwritten:\n%s", got)
+	}
+}
+
+func TestDryRunPlan(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go":        "package foo\n\nimport \"internal/bar\"\n\nfunc Foo() int { return bar.Bar }\n",
+		"internal/bar/bar.go":        "package bar\n\nconst Bar = 1\n",
+		"internal/baz/zbootstrap.go": "package baz\n",
+	})
+
+	t.Run("plan", func(t *testing.T) {
+		fsys := newMemFS()
+		c := testCopier(t, src, fsys, "internal/foo")
+		c.DryRun = true
+		var stdout strings.Builder
+		c.Stdout = &stdout
+
+		if err := c.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, want := range []string{
+			filepath.Join(c.Dst, "foo", "foo.go") + " (new)",
+			filepath.Join(c.Dst, "bar", "bar.go") + " (new)",
+			"dry-run: 2 packages, 2 files, 102 bytes",
+		} {
+			if !strings.Contains(stdout.String(), want) {
+				t.Errorf("got output\n%s\nwant %q", &stdout, want)
+			}
+		}
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		// zbootstrap.go is never copied
+		c := testCopier(t, src, newMemFS(), "internal/baz")
+		c.DryRun = true
+
+		if err := c.Run(context.Background()); err == nil || !strings.Contains(err.Error(), "the plan copies no file") {
+			t.Errorf("got error %v, want the empty plan", err)
+		}
+	})
+}
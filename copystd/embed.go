@@ -0,0 +1,111 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"path"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// embedFiles returns the files of pkg matched by the //go:embed patterns,
+// relative to the package directory.
+func embedFiles(pkg *Package) []string {
+	var files []string
+	for _, names := range [...][]string{pkg.EmbedFiles, pkg.TestEmbedFiles, pkg.XTestEmbedFiles} {
+		for _, name := range names {
+			if !contains(files, name) {
+				files = append(files, name)
+			}
+		}
+	}
+
+	return files
+}
+
+// relocateEmbedPath relocates the slash separated path p relative to the
+// package directory by the longest old=new prefix of repl, where a prefix
+// matches whole path elements.
+func relocateEmbedPath(p string, repl map[string]string) string {
+	best := ""
+	for old := range repl {
+		if (p == old || strings.HasPrefix(p, old+"/")) && len(old) > len(best) {
+			best = old
+		}
+	}
+	if best == "" {
+		return p
+	}
+
+	return path.Join(repl[best], strings.TrimPrefix(p, best))
+}
+
+// rewriteEmbedPatterns rewrites the patterns of the //go:embed directives in
+// the Go source body by relocateEmbedPath.
+func rewriteEmbedPatterns(body string, repl map[string]string) string {
+	if len(repl) == 0 || !strings.Contains(body, "//go:embed") {
+		return body
+	}
+
+	lines := strings.SplitAfter(body, "\n")
+	for i, line := range lines {
+		text := strings.TrimSpace(line)
+		args := strings.TrimPrefix(text, "//go:embed")
+		if args == text || (args != "" && !unicode.IsSpace(rune(args[0]))) {
+			continue
+		}
+
+		patterns := splitEmbedPatterns(args)
+		for j, pattern := range patterns {
+			patterns[j] = rewriteEmbedPattern(pattern, repl)
+		}
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		newline := line[len(strings.TrimRight(line, "\r\n")):]
+		lines[i] = indent + "//go:embed " + strings.Join(patterns, " ") + newline
+	}
+
+	return strings.Join(lines, "")
+}
+
+// rewriteEmbedPattern rewrites the single, possibly quoted, pattern.
+func rewriteEmbedPattern(pattern string, repl map[string]string) string {
+	quoted := false
+	if s, err := strconv.Unquote(pattern); err == nil {
+		pattern, quoted = s, true
+	}
+
+	prefix := ""
+	if strings.HasPrefix(pattern, "all:") {
+		prefix, pattern = "all:", strings.TrimPrefix(pattern, "all:")
+	}
+	pattern = prefix + relocateEmbedPath(pattern, repl)
+
+	if quoted || strings.ContainsAny(pattern, " \t") {
+		return strconv.Quote(pattern)
+	}
+
+	return pattern
+}
+
+// splitEmbedPatterns splits the arguments of a //go:embed directive into the
+// patterns, keeping the quoted ones as is.
+func splitEmbedPatterns(args string) []string {
+	var patterns []string
+	for args = strings.TrimSpace(args); args != ""; args = strings.TrimSpace(args) {
+		end := strings.IndexFunc(args, unicode.IsSpace)
+		if args[0] == '"' || args[0] == '`' {
+			if q, err := strconv.QuotedPrefix(args); err == nil {
+				end = len(q)
+			}
+		}
+		if end < 0 {
+			end = len(args)
+		}
+		patterns = append(patterns, args[:end])
+		args = args[end:]
+	}
+
+	return patterns
+}
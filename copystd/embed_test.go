@@ -0,0 +1,35 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRewriteEmbedPattern(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go":             "package foo\n\nimport \"embed\"\n\n//go:embed templates/*\nvar templates embed.FS\n",
+		"internal/foo/templates/a.tmpl":   "a\n",
+		"internal/foo/templates/b/b.tmpl": "b\n",
+	})
+	fsys := newMemFS()
+	c := testCopier(t, src, fsys, "internal/foo")
+	c.RewriteEmbedPattern = map[string]string{"templates": "assets/tmpl"}
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"foo/assets/tmpl/a.tmpl", "foo/assets/tmpl/b/b.tmpl", "foo/foo.go"}
+	if got := fsys.paths(c.Dst); !reflect.DeepEqual(got, want) {
+		t.Errorf("copied files: got %q, want %q", got, want)
+	}
+	foo, _ := fsys.file(filepath.Join(c.Dst, "foo", "foo.go"))
+	if want := "package foo\n\nimport \"embed\"\n\n//go:embed assets/tmpl/*\nvar templates embed.FS\n"; foo != want {
+		t.Errorf("got foo.go\n%s\nwant\n%s", foo, want)
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"sort"
+	"strings"
+)
+
+// mapExcluded reports whether the import path would be copied but is excluded
+// by IgnorePrefix, and returns the path ExcludeMap rewrites it to by the
+// longest matching key, or importPath as is if no key matches.
+func (c *Copier) mapExcluded(importPath string) (string, bool) {
+	if !c.isCopiedPath(importPath) || !matchAny(c.IgnorePrefix, importPath) {
+		return importPath, false
+	}
+
+	old := ""
+	for p := range c.ExcludeMap {
+		if (importPath == p || strings.HasPrefix(importPath, p+"/")) && len(p) > len(old) {
+			old = p
+		}
+	}
+	if old == "" {
+		return importPath, true
+	}
+
+	return c.ExcludeMap[old] + strings.TrimPrefix(importPath, old), true
+}
+
+// addExcludedRef records the file importing the excluded importPath, which is
+// left as is.
+func (c *Copier) addExcludedRef(importPath, filename string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !contains(c.excludedRefs[importPath], filename) {
+		c.excludedRefs[importPath] = append(c.excludedRefs[importPath], filename)
+	}
+}
+
+// reportExcludedRefs warns of the files which still import the excluded
+// packages unmapped by ExcludeMap, to be stubbed out or mapped.
+func (c *Copier) reportExcludedRefs() {
+	imps := make([]string, 0, len(c.excludedRefs))
+	for imp := range c.excludedRefs {
+		imps = append(imps, imp)
+	}
+	sort.Strings(imps)
+
+	for _, imp := range imps {
+		files := c.excludedRefs[imp]
+		sort.Strings(files)
+		c.warnf("%s is excluded but still imported by (map it with -exclude-map):\n\t%s", imp, strings.Join(files, "\n\t"))
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// externalDeps returns the sorted imports of the copied packages outside of
+// the copied set, that is, the std packages importable as is, the non-std
+// packages, and the unresolved cmd and internal ones. The imports of the test
+// files excluded by NoTests or NoXTests are not counted.
+func (c *Copier) externalDeps() []string {
+	seen := make(map[string]bool)
+	var deps []string
+	for _, pkg := range c.copiedPackages {
+		imports := [][]string{pkg.Imports}
+		if !c.NoTests {
+			imports = append(imports, pkg.TestImports)
+			if !c.NoXTests {
+				imports = append(imports, pkg.XTestImports)
+			}
+		}
+
+		for _, imps := range imports {
+			for _, imp := range imps {
+				imp = trimTestVariant(imp)
+				if imp == "C" || seen[imp] {
+					continue
+				}
+				seen[imp] = true
+				if _, ok := c.copiedPackages[c.rewriteImportPath(imp)]; ok {
+					continue
+				}
+				deps = append(deps, imp)
+			}
+		}
+	}
+	sort.Strings(deps)
+
+	return deps
+}
+
+// printExternalDeps prints the external dependencies of the copied packages
+// to w, one per line.
+func (c *Copier) printExternalDeps(w io.Writer) {
+	for _, dep := range c.externalDeps() {
+		fmt.Fprintln(w, dep)
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestListExternalDeps(t *testing.T) {
+	// the closure is three levels deep, each level adding its own deps
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go":      "package foo\n\nimport (\n\t\"fmt\"\n\n\t\"internal/bar\"\n)\n\nvar _ = fmt.Sprint(bar.Bar)\n",
+		"internal/bar/bar.go":      "package bar\n\nimport (\n\t\"strings\"\n\n\t\"internal/baz\"\n)\n\nvar Bar = strings.Repeat(baz.Baz, 2)\n",
+		"internal/bar/bar_test.go": "package bar\n\nimport \"testing\"\n\nfunc TestBar(t *testing.T) {}\n",
+		"internal/baz/baz.go":      "package baz\n\nimport \"os\"\n\nvar Baz = os.Getenv(\"BAZ\")\n",
+	})
+
+	for _, noTests := range []bool{false, true} {
+		fsys := newMemFS()
+		c := testCopier(t, src, fsys, "internal/foo")
+		c.ListExternalDeps = true
+		c.NoTests = noTests
+		// the ignored imports are not printed among the deps
+		c.LogLevel = LogWarn
+		var stdout strings.Builder
+		c.Stdout = &stdout
+
+		if err := c.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		want := "fmt\nos\nstrings\ntesting\n"
+		if noTests {
+			want = "fmt\nos\nstrings\n"
+		}
+		if got := stdout.String(); got != want {
+			t.Errorf("NoTests %t: got deps\n%s\nwant\n%s", noTests, got, want)
+		}
+		if paths := fsys.paths(c.Dst); len(paths) > 0 {
+			t.Errorf("files are written: %q", paths)
+		}
+	}
+}
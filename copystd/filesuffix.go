@@ -0,0 +1,31 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import "strings"
+
+// suffixedName inserts suffix into the Go file name before the _GOOS, _GOARCH
+// and _test suffixes of the name, which go/build gives meaning to, such that
+// foo_linux_test.go is foo_v121_linux_test.go with the _v121 suffix.
+func suffixedName(name, suffix string, ports []string) string {
+	stem := strings.TrimSuffix(name, ".go")
+	tail := ".go"
+	if s := strings.TrimSuffix(stem, "_test"); s != stem {
+		stem, tail = s, "_test"+tail
+	}
+
+	elems := strings.Split(stem, "_")
+	keep := 0
+	if n := len(elems); n >= 3 && knownOS(elems[n-2], ports) && knownArch(elems[n-1], ports) {
+		keep = 2
+	} else if n >= 2 && (knownOS(elems[n-1], ports) || knownArch(elems[n-1], ports)) {
+		keep = 1
+	}
+	if keep > 0 {
+		tail = "_" + strings.Join(elems[len(elems)-keep:], "_") + tail
+		stem = strings.Join(elems[:len(elems)-keep], "_")
+	}
+
+	return stem + suffix + tail
+}
@@ -0,0 +1,49 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDstFileSuffix(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go":            "package foo\n\nconst Foo = 1\n",
+		"internal/foo/foo_linux.go":      "package foo\n",
+		"internal/foo/foo_linux_test.go": "package foo\n",
+		"internal/foo/foo_amd64.s":       "",
+		"internal/foo/export_test.go":    "package foo_test\n",
+	})
+	fsys := newMemFS()
+	c := testCopier(t, src, fsys, "internal/foo")
+	c.DstFileSuffix = "_v121"
+	c.AllFiles = true
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// the non-Go files are not renamed
+	want := []string{
+		"foo/export_v121_test.go",
+		"foo/foo_amd64.s",
+		"foo/foo_v121.go",
+		"foo/foo_v121_linux.go",
+		"foo/foo_v121_linux_test.go",
+	}
+	if got := fsys.paths(c.Dst); !reflect.DeepEqual(got, want) {
+		t.Errorf("copied files: got %q, want %q", got, want)
+	}
+	for name, want := range map[string]string{
+		"foo_v121.go":         "package foo\n\nconst Foo = 1\n",
+		"export_v121_test.go": "package foo_test\n",
+	} {
+		if got, _ := fsys.file(filepath.Join(c.Dst, "foo", name)); got != want {
+			t.Errorf("got %s\n%s\nwant\n%s", name, got, want)
+		}
+	}
+}
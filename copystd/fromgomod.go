@@ -0,0 +1,85 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// dstImportsFormat prints the imports of each package, including its tests,
+// one per line.
+const dstImportsFormat = `{{range .Imports}}{{.}}
+{{end}}{{range .TestImports}}{{.}}
+{{end}}{{range .XTestImports}}{{.}}
+{{end}}`
+
+// dstImports lists the import paths of the packages of the module in Dst.
+func (c *Copier) dstImports(ctx context.Context) ([]string, error) {
+	cmd := exec.CommandContext(ctx, "go", "list", "-e", "-f", dstImportsFormat, "./...")
+	cmd.Env = append(os.Environ(), "PWD="+c.Dst, "GO111MODULE=on")
+	cmd.Env = append(cmd.Env, c.Env...)
+	cmd.Dir = c.Dst
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("list imports of %s: %w\n%s", c.Dst, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	var imports []string
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		if imp := strings.TrimSpace(sc.Text()); imp != "" {
+			imports = append(imports, imp)
+		}
+	}
+
+	return imports, nil
+}
+
+// goModRoots returns the source packages the module in Dst imports with
+// FromGoMod, either by their own import paths or by the import paths they
+// are rewritten to within Module.
+func (c *Copier) goModRoots(ctx context.Context) ([]string, error) {
+	imports, err := c.dstImports(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	patterns := []string{"std", "cmd"}
+	if c.srcModule != "" {
+		patterns = []string{c.srcModule + "/..."}
+	}
+	pkgs, err := c.listPackages(ctx, c.Src, patterns...)
+	if err != nil {
+		return nil, fmt.Errorf("list source packages: %w", err)
+	}
+	sources := make(map[string]string)
+	for _, pkg := range pkgs {
+		if isTestVariant(pkg) || !c.needsCopy(pkg) {
+			continue
+		}
+		sources[pkg.ImportPath] = pkg.ImportPath
+		sources[c.rewriteImportPath(pkg.ImportPath)] = pkg.ImportPath
+	}
+
+	seen := make(map[string]bool)
+	var roots []string
+	for _, imp := range imports {
+		if src, ok := sources[imp]; ok && !seen[src] {
+			seen[src] = true
+			roots = append(roots, src)
+		}
+	}
+	sort.Strings(roots)
+
+	return roots, nil
+}
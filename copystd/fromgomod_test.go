@@ -0,0 +1,42 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFromGoMod(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go": "package foo\n\nimport \"internal/bar\"\n\nfunc Foo() int { return bar.Bar }\n",
+		"internal/bar/bar.go": "package bar\n\nconst Bar = 1\n",
+		"internal/baz/baz.go": "package baz\n\nconst Baz = 1\n",
+	})
+	// the module imports foo by the path it is copied to
+	dst := t.TempDir()
+	for name, data := range map[string]string{
+		"go.mod":  "module example.com/m\n\ngo 1.21\n",
+		"main.go": "package main\n\nimport \"example.com/m/foo\"\n\nfunc main() { foo.Foo() }\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dst, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fsys := newMemFS()
+	c := testCopier(t, src, fsys)
+	c.Dst = dst
+	c.FromGoMod = true
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := fsys.paths(dst), []string{"bar/bar.go", "foo/foo.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("copied files: got %q, want %q", got, want)
+	}
+}
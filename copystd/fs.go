@@ -0,0 +1,138 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// FileSystem is the minimal set of file system operations used to read the
+// source files and write the copied files.
+//
+// It allows an in-memory or overlay file system to be used in place of the
+// host file system.
+type FileSystem interface {
+	ReadFile(name string) ([]byte, error)
+	WriteFile(name string, data []byte, perm os.FileMode) error
+	MkdirAll(path string, perm os.FileMode) error
+	ReadDir(name string) ([]os.DirEntry, error)
+	Stat(name string) (os.FileInfo, error)
+	Remove(name string) error
+	Symlink(oldname, newname string) error
+}
+
+// osFS implements FileSystem using the os package.
+type osFS struct{}
+
+var _ FileSystem = osFS{}
+
+func (osFS) ReadFile(name string) ([]byte, error) { return os.ReadFile(name) }
+
+func (osFS) WriteFile(name string, data []byte, perm os.FileMode) error {
+	return os.WriteFile(name, data, perm)
+}
+
+func (osFS) MkdirAll(path string, perm os.FileMode) error { return os.MkdirAll(path, perm) }
+
+func (osFS) ReadDir(name string) ([]os.DirEntry, error) { return os.ReadDir(name) }
+
+func (osFS) Stat(name string) (os.FileInfo, error) { return os.Stat(name) }
+
+func (osFS) Remove(name string) error { return os.Remove(name) }
+
+func (osFS) Symlink(oldname, newname string) error { return os.Symlink(oldname, newname) }
+
+// dryRunFS wraps a FileSystem to read from it but discard the writes, for
+// -dry-run. The written files are kept in memory and read back instead, so
+// that the steps run on the copy, such as Prune, see the copy. Stat and
+// ReadDir are not overlaid and report the FileSystem as before the run.
+type dryRunFS struct {
+	FileSystem
+
+	mu    sync.Mutex
+	files map[string][]byte // written content keyed by the absolute path, nil if removed
+}
+
+var _ FileSystem = (*dryRunFS)(nil)
+
+func newDryRunFS(fsys FileSystem) *dryRunFS {
+	return &dryRunFS{FileSystem: fsys, files: make(map[string][]byte)}
+}
+
+func (f *dryRunFS) ReadFile(name string) ([]byte, error) {
+	f.mu.Lock()
+	data, ok := f.files[absPath(name)]
+	f.mu.Unlock()
+	switch {
+	case !ok:
+		return f.FileSystem.ReadFile(name)
+	case data == nil:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	return data, nil
+}
+
+func (f *dryRunFS) WriteFile(name string, data []byte, perm os.FileMode) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.files[absPath(name)] = append([]byte{}, data...)
+
+	return nil
+}
+
+func (*dryRunFS) MkdirAll(path string, perm os.FileMode) error { return nil }
+
+func (f *dryRunFS) Remove(name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.files[absPath(name)] = nil
+
+	return nil
+}
+
+func (*dryRunFS) Symlink(oldname, newname string) error { return nil }
+
+// absPath returns the absolute path of name, or name itself if unresolvable.
+func absPath(name string) string {
+	if abs, err := filepath.Abs(name); err == nil {
+		return abs
+	}
+
+	return name
+}
+
+// mkdirAll creates the destination directory dir with -dir-mode, calling
+// MkdirAll only once per directory however many files are written to it.
+func (c *Copier) mkdirAll(dir string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.createdDirs[dir] {
+		return nil
+	}
+	if err := c.FS.MkdirAll(dir, os.FileMode(c.DirMode)); err != nil {
+		return err
+	}
+	c.createdDirs[dir] = true
+
+	return nil
+}
+
+// writeIfChanged writes data to filename unless the file has the same content
+// already, so that its modification time is left alone, and reports whether
+// it was written. The permission bits of an existing file are kept as is.
+func (c *Copier) writeIfChanged(filename string, data []byte) (bool, error) {
+	if old, err := c.FS.ReadFile(filename); err == nil && bytes.Equal(old, data) {
+		return false, nil
+	}
+	if err := c.FS.WriteFile(filename, data, 0o644); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
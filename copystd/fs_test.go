@@ -0,0 +1,298 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"testing/fstest"
+)
+
+// memFS is an in-memory FileSystem for the tests. The files it does not
+// have, such as the ones of the source tree, are read from the host, which is
+// never written.
+type memFS struct {
+	mu    sync.Mutex
+	files fstest.MapFS // keyed by the slash separated path without the leading slash
+}
+
+var _ FileSystem = (*memFS)(nil)
+
+func newMemFS() *memFS {
+	return &memFS{files: make(fstest.MapFS)}
+}
+
+// memPath returns the key of the file name in memFS.files.
+func memPath(name string) string {
+	p := strings.TrimPrefix(filepath.ToSlash(filepath.Clean(name)), "/")
+	if p == "" {
+		return "."
+	}
+
+	return p
+}
+
+func (m *memFS) ReadFile(name string) ([]byte, error) {
+	m.mu.Lock()
+	f, ok := m.files[memPath(name)]
+	m.mu.Unlock()
+	switch {
+	case !ok:
+		return os.ReadFile(name)
+	case f.Mode.IsDir():
+		return nil, &fs.PathError{Op: "read", Path: name, Err: syscall.EISDIR}
+	case f.Mode&fs.ModeSymlink != 0:
+		target := string(f.Data)
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(name), target)
+		}
+		return m.ReadFile(target)
+	}
+
+	return append([]byte(nil), f.Data...), nil
+}
+
+func (m *memFS) WriteFile(name string, data []byte, perm os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.isDir(path.Dir(memPath(name))) {
+		return &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	m.files[memPath(name)] = &fstest.MapFile{Data: append([]byte(nil), data...), Mode: perm}
+
+	return nil
+}
+
+func (m *memFS) MkdirAll(name string, perm os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for p := memPath(name); p != "."; p = path.Dir(p) {
+		f, ok := m.files[p]
+		if ok && !f.Mode.IsDir() {
+			return &fs.PathError{Op: "mkdir", Path: name, Err: syscall.ENOTDIR}
+		}
+		if !ok {
+			m.files[p] = &fstest.MapFile{Mode: fs.ModeDir | perm}
+		}
+	}
+
+	return nil
+}
+
+func (m *memFS) ReadDir(name string) ([]os.DirEntry, error) {
+	m.mu.Lock()
+	memEntries, memErr := fs.ReadDir(m.files, memPath(name))
+	m.mu.Unlock()
+	hostEntries, hostErr := os.ReadDir(name)
+	if memErr != nil && hostErr != nil {
+		return nil, hostErr
+	}
+
+	entries := make(map[string]os.DirEntry)
+	for _, entry := range hostEntries {
+		entries[entry.Name()] = entry
+	}
+	for _, entry := range memEntries {
+		entries[entry.Name()] = entry
+	}
+	list := make([]os.DirEntry, 0, len(entries))
+	for _, entry := range entries {
+		list = append(list, entry)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name() < list[j].Name() })
+
+	return list, nil
+}
+
+func (m *memFS) Stat(name string) (os.FileInfo, error) {
+	m.mu.Lock()
+	fi, err := fs.Stat(m.files, memPath(name))
+	m.mu.Unlock()
+	if err != nil {
+		return os.Stat(name)
+	}
+
+	return fi, nil
+}
+
+func (m *memFS) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p := memPath(name)
+	f, ok := m.files[p]
+	if !ok {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	if f.Mode.IsDir() {
+		for other := range m.files {
+			if strings.HasPrefix(other, p+"/") {
+				return &fs.PathError{Op: "remove", Path: name, Err: syscall.ENOTEMPTY}
+			}
+		}
+	}
+	delete(m.files, p)
+
+	return nil
+}
+
+func (m *memFS) Symlink(oldname, newname string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.files[memPath(newname)] = &fstest.MapFile{Data: []byte(oldname), Mode: fs.ModeSymlink | 0o777}
+
+	return nil
+}
+
+// isDir reports whether the directory p of memPath exists in m, or on the
+// host unless m has a file of the path. m.mu must be held.
+func (m *memFS) isDir(p string) bool {
+	if p == "." {
+		return true
+	}
+	if fi, err := fs.Stat(m.files, p); err == nil {
+		return fi.IsDir()
+	}
+	fi, err := os.Stat("/" + p)
+
+	return err == nil && fi.IsDir()
+}
+
+// file returns the content of the file name written to m, and reports whether
+// it exists.
+func (m *memFS) file(name string) (string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, ok := m.files[memPath(name)]
+	if !ok || f.Mode.IsDir() {
+		return "", false
+	}
+
+	return string(f.Data), true
+}
+
+// paths returns the slash separated paths of the files written to m under
+// dir relative to dir, sorted.
+func (m *memFS) paths(dir string) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	prefix := memPath(dir) + "/"
+	var paths []string
+	for p, f := range m.files {
+		if strings.HasPrefix(p, prefix) && !f.Mode.IsDir() {
+			paths = append(paths, strings.TrimPrefix(p, prefix))
+		}
+	}
+	sort.Strings(paths)
+
+	return paths
+}
+
+func TestRunInMemory(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go": "package foo\n\nimport \"internal/bar\"\n\nfunc Foo() int { return bar.Bar }\n",
+		"internal/bar/bar.go": "package bar\n\nconst Bar = 1\n",
+	})
+	fsys := newMemFS()
+	c := testCopier(t, src, fsys, "internal/foo")
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := fsys.paths(c.Dst), []string{"bar/bar.go", "foo/foo.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("copied files: got %q, want %q", got, want)
+	}
+	foo, _ := fsys.file(filepath.Join(c.Dst, "foo", "foo.go"))
+	if !strings.Contains(foo, `import "example.com/m/bar"`) {
+		t.Errorf("foo.go does not import the copied bar:\n%s", foo)
+	}
+	if _, err := os.Stat(c.Dst); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("%s is created on the host: %v", c.Dst, err)
+	}
+}
+
+func TestDirMode(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go": "package foo\n\nimport \"internal/bar\"\n\nfunc Foo() int { return bar.Bar }\n",
+		"internal/bar/bar.go": "package bar\n\nconst Bar = 1\n",
+	})
+
+	for _, mode := range []os.FileMode{0, 0o700} {
+		want := mode
+		if want == 0 {
+			want = 0o755
+		}
+		t.Run(want.String(), func(t *testing.T) {
+			fsys := newMemFS()
+			c := testCopier(t, src, fsys, "internal/foo")
+			c.DirMode = mode
+
+			if err := c.Run(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, dir := range []string{c.Dst, filepath.Join(c.Dst, "foo"), filepath.Join(c.Dst, "bar")} {
+				fi, err := fsys.Stat(dir)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := fi.Mode(); got != fs.ModeDir|want {
+					t.Errorf("%s: got mode %v, want %v", dir, got, fs.ModeDir|want)
+				}
+			}
+		})
+	}
+}
+
+// mkdirCountFS is a memFS counting the MkdirAll calls per directory.
+type mkdirCountFS struct {
+	*memFS
+	mkdirs map[string]int
+}
+
+func (m *mkdirCountFS) MkdirAll(name string, perm os.FileMode) error {
+	m.mu.Lock()
+	m.mkdirs[memPath(name)]++
+	m.mu.Unlock()
+
+	return m.memFS.MkdirAll(name, perm)
+}
+
+func TestMkdirAllOnce(t *testing.T) {
+	files := map[string]string{
+		"internal/foo/foo.go": "package foo\n\nimport \"internal/bar\"\n\nfunc Foo() int { return bar.Bar }\n",
+	}
+	for i := 0; i < 10; i++ {
+		files[fmt.Sprintf("internal/bar/bar%d.go", i)] = fmt.Sprintf("package bar\n\nconst Bar%d = %d\n", i, i)
+	}
+	files["internal/bar/bar.go"] = "package bar\n\nconst Bar = 1\n"
+	src := testGoroot(t, files)
+	fsys := &mkdirCountFS{memFS: newMemFS(), mkdirs: make(map[string]int)}
+	c := testCopier(t, src, fsys, "internal/foo")
+	c.Jobs = 4
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(fsys.paths(filepath.Join(c.Dst, "bar"))); n != 11 {
+		t.Fatalf("got %d files in bar, want 11", n)
+	}
+	for dir, n := range fsys.mkdirs {
+		if n != 1 {
+			t.Errorf("MkdirAll of %s is called %d times", dir, n)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// generateSource generates gen.go of the package name with the go:generate
+// directive running the command args.
+func generateSource(name string, args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg == "" || strings.ContainsAny(arg, " \t\"\\") {
+			arg = strconv.Quote(arg)
+		}
+		quoted[i] = arg
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n\n", DefaultGeneratedMarker)
+	fmt.Fprintf(&b, "package %s\n\n", name)
+	fmt.Fprintf(&b, "//go:generate %s\n", strings.Join(quoted, " "))
+
+	return b.String()
+}
+
+// writeGenerate writes gen.go to Dst with the go:generate directive of
+// GenerateCommand, so that go generate in Dst reproduces the copy. With
+// VersionDir, it is written to the Dst given rather than the version
+// directory, where the command copies into. The existing gen.go lacking the
+// generated marker is left as is unless -force is given.
+func (c *Copier) writeGenerate() error {
+	path := filepath.Join(c.rootDst, "gen.go")
+	if !c.Force {
+		data, err := c.FS.ReadFile(path)
+		switch {
+		case err == nil && !hasGeneratedMarker(data, DefaultGeneratedMarker):
+			c.warnf("%s exists and is not generated, skip the gen.go of -emit-generate (use -force to overwrite)", path)
+			return nil
+		case err != nil && !errors.Is(err, fs.ErrNotExist):
+			return fmt.Errorf("read gen.go: %w", err)
+		}
+	}
+
+	if c.script != nil {
+		c.script.generate(path, "go:generate directive")
+		return nil
+	}
+	if _, err := c.writeFile(c.rootDst, "gen.go", generateSource(stampPackageName(c.rootModule), c.GenerateCommand)); err != nil {
+		return fmt.Errorf("write gen.go: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,29 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestEmitGenerate(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go": "package foo\n",
+	})
+	fsys := newMemFS()
+	c := testCopier(t, src, fsys, "internal/foo")
+	c.GenerateCommand = []string{"go-copystd", "-module", "example.com/m", "-src", src, "-package", "internal/foo, internal/bar"}
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	gen, _ := fsys.file(filepath.Join(c.Dst, "gen.go"))
+	want := DefaultGeneratedMarker + "\n\npackage m\n\n//go:generate go-copystd -module example.com/m -src " + src + " -package \"internal/foo, internal/bar\"\n"
+	if gen != want {
+		t.Errorf("got gen.go\n%s\nwant\n%s", gen, want)
+	}
+}
@@ -0,0 +1,219 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// DefaultGeneratedMarker is the marker line of the files generated by the run
+// rather than copied.
+const DefaultGeneratedMarker = "// Code generated by go-copystd. DO NOT EDIT."
+
+// DefaultHeader is the default Copier.GeneratedMarker, which is a
+// text/template of the marker line with the fields of headerData.
+const DefaultHeader = "// Code generated by go-copystd from {{.SrcPath}} ({{.GoVersion}}); DO NOT EDIT."
+
+// generatedRe is the generated code convention described in
+// https://golang.org/s/generatedcode.
+var generatedRe = regexp.MustCompile(`^// Code generated .* DO NOT EDIT\.$`)
+
+// copystdGeneratedRe is the marker lines written by go-copystd, which are
+// replaced when the copied files are copied again.
+var copystdGeneratedRe = regexp.MustCompile(`^// Code generated by go-copystd\b.* DO NOT EDIT\.$`)
+
+// headerData is the fields of the GeneratedMarker template.
+type headerData struct {
+	SrcPath   string // source file path such as $GOROOT/src/internal/goarch/goarch.go
+	GoVersion string // Go version of Src such as go1.21.0
+	Module    string
+}
+
+// parseHeader parses the GeneratedMarker template and validates it renders
+// the generated code convention.
+func (c *Copier) parseHeader() error {
+	tmpl, err := template.New("header").Option("missingkey=error").Parse(c.GeneratedMarker)
+	if err != nil {
+		return fmt.Errorf("invalid -generated-marker value: %w", err)
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, headerData{SrcPath: "$GOROOT/src/internal/foo/foo.go", GoVersion: "go1.0", Module: c.Module}); err != nil {
+		return fmt.Errorf("invalid -generated-marker value: %w", err)
+	}
+	if marker := generatedMarker(b.String()); !generatedRe.MatchString(marker) {
+		c.warnf("-generated-marker %q does not match the %q convention", marker, generatedRe)
+	}
+	c.header = tmpl
+
+	return nil
+}
+
+// markerOf returns the marker line of the dst file copied from the src file,
+// which has DefaultGeneratedMarker instead if generated by the run rather than
+// copied and the marker refers to the source.
+func (c *Copier) markerOf(dst string) (string, error) {
+	c.mu.Lock()
+	source := c.dstSources[dst]
+	c.mu.Unlock()
+	if source == nil && strings.Contains(c.GeneratedMarker, "{{") {
+		return DefaultGeneratedMarker, nil
+	}
+
+	data := headerData{GoVersion: c.srcGoVersion, Module: c.Module}
+	if source != nil {
+		data.SrcPath = c.headerSrcPath(source.src)
+	}
+	var b strings.Builder
+	if err := c.header.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("execute -header: %w", err)
+	}
+
+	return generatedMarker(b.String()), nil
+}
+
+// headerSrcPath returns the src path of the marker line, relative to $GOROOT
+// or to the module path of ModuleSource.
+func (c *Copier) headerSrcPath(src string) string {
+	rel, err := c.srcRel(src)
+	if err != nil {
+		return src
+	}
+	if c.srcModule != "" {
+		return c.srcModule + "/" + filepath.ToSlash(rel)
+	}
+
+	return "$GOROOT/src/" + filepath.ToSlash(rel)
+}
+
+// generatedMarker returns the marker line of text, which is commented out if
+// text is not a line comment yet.
+func generatedMarker(text string) string {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "//") {
+		text = "// " + text
+	}
+
+	return text
+}
+
+// markGenerated inserts the marker line into the Go source data after the
+// leading comment block, such as the copyright notice, or else at the top of
+// the file, so that it precedes the package clause and the build
+// constraints. The marker lines written by go-copystd before, such as the ones
+// of the source copied from a copy, are replaced, and data is returned as is
+// if it already has the marker line.
+func markGenerated(data []byte, marker string) []byte {
+	if hasGeneratedMarker(data, marker) {
+		return data
+	}
+	lines := dropGeneratedMarkers(bytes.SplitAfter(data, []byte("\n")))
+
+	end := 0
+	for end < len(lines) && isCommentLine(lines[end]) {
+		end++
+	}
+	if end == 0 || end == len(lines) || len(bytes.TrimSpace(lines[end])) != 0 {
+		// no leading comment block separated by a blank line
+		end = -1
+	}
+
+	buf := make([]byte, 0, len(marker)+2+len(data))
+	for _, line := range lines[:end+1] {
+		buf = append(buf, line...)
+	}
+	buf = append(buf, marker...)
+	buf = append(buf, "\n\n"...)
+	for _, line := range lines[end+1:] {
+		buf = append(buf, line...)
+	}
+
+	return buf
+}
+
+// dropGeneratedMarkers drops the marker lines written by go-copystd before the
+// package clause along with the blank line following each.
+func dropGeneratedMarkers(lines [][]byte) [][]byte {
+	kept := make([][]byte, 0, len(lines))
+	for i := 0; i < len(lines); i++ {
+		text := bytes.TrimSpace(lines[i])
+		if bytes.HasPrefix(text, []byte("package ")) {
+			return append(kept, lines[i:]...)
+		}
+		if !copystdGeneratedRe.Match(text) {
+			kept = append(kept, lines[i])
+			continue
+		}
+		if i+1 < len(lines) && len(bytes.TrimSpace(lines[i+1])) == 0 {
+			i++
+		}
+	}
+
+	return kept
+}
+
+// isCommentLine reports whether the line is a line comment other than the
+// build constraints, which must stay directly before their blank line.
+func isCommentLine(line []byte) bool {
+	text := bytes.TrimSpace(line)
+
+	return bytes.HasPrefix(text, []byte("//")) && !bytes.HasPrefix(text, []byte("//go:build")) && !bytes.HasPrefix(text, []byte("// +build"))
+}
+
+// hasGeneratedMarker reports whether the Go source data has the marker line
+// before the package clause.
+func hasGeneratedMarker(data []byte, marker string) bool {
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		text := string(bytes.TrimSpace(line))
+		if text == marker {
+			return true
+		}
+		if strings.HasPrefix(text, "package ") {
+			break
+		}
+	}
+
+	return false
+}
+
+// verifyGenerated verifies that every Go file written by the run has the
+// generated marker line. The non-Go files are exempt.
+func (c *Copier) verifyGenerated() error {
+	dsts := make(map[string]string) // destination file paths keyed by the absolute one
+	for dst := range c.dstSources {
+		if abs, err := filepath.Abs(dst); err == nil {
+			dsts[abs] = dst
+		}
+	}
+
+	var missing []string
+	for file := range c.writtenFiles {
+		if !strings.HasSuffix(file, ".go") {
+			continue
+		}
+		data, err := c.FS.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("read %s file: %w", file, err)
+		}
+		marker, err := c.markerOf(dsts[file])
+		if err != nil {
+			return err
+		}
+		if !hasGeneratedMarker(data, marker) {
+			missing = append(missing, fmt.Sprintf("%s: %s", file, marker))
+		}
+	}
+
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("copied Go files lack the generated marker:\n\t%s", strings.Join(missing, "\n\t"))
+	}
+
+	return nil
+}
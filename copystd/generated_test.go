@@ -0,0 +1,122 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func TestGeneratedMarker(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go": "// Copyright notice.\n\npackage foo\n",
+	})
+
+	tests := []struct {
+		marker   string
+		want     string
+		wantWarn bool
+	}{
+		{
+			marker: "",
+			want:   "// Code generated by go-copystd from $GOROOT/src/internal/foo/foo.go (" + testGoVersion + "); DO NOT EDIT.",
+		},
+		{
+			marker: "Code generated by mytool for {{.Module}}. DO NOT EDIT.",
+			want:   "// Code generated by mytool for example.com/m. DO NOT EDIT.",
+		},
+		{
+			marker:   "// vendored by mytool",
+			want:     "// vendored by mytool",
+			wantWarn: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			fsys := newMemFS()
+			c := testCopier(t, src, fsys, "internal/foo")
+			c.MarkGenerated = true
+			c.GeneratedMarker = tt.marker
+			var stderr bytes.Buffer
+			c.Stderr = &stderr
+
+			if err := c.Run(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			foo, _ := fsys.file(filepath.Join(c.Dst, "foo", "foo.go"))
+			if want := "// Copyright notice.\n\n" + tt.want + "\n\npackage foo\n"; foo != want {
+				t.Errorf("got foo.go\n%s\nwant\n%s", foo, want)
+			}
+			if got := generatedRe.MatchString(tt.want); got == tt.wantWarn {
+				t.Errorf("%q matches the convention: got %t", tt.want, got)
+			}
+			if warned := strings.Contains(stderr.String(), "does not match"); warned != tt.wantWarn {
+				t.Errorf("warned of the convention: got %t, want %t\n%s", warned, tt.wantWarn, &stderr)
+			}
+		})
+	}
+}
+
+// unmarkFS is a memFS which writes the file named unmark without the
+// generated marker of go-copystd.
+type unmarkFS struct {
+	*memFS
+	unmark string
+}
+
+func (m *unmarkFS) WriteFile(name string, data []byte, perm os.FileMode) error {
+	if filepath.Base(name) == m.unmark {
+		data = regexp.MustCompile(`(?m)^// Code generated by go-copystd .*\n\n`).ReplaceAll(data, nil)
+	}
+
+	return m.memFS.WriteFile(name, data, perm)
+}
+
+func TestVerifyGenerated(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go": "package foo\n\nimport \"internal/bar\"\n\nfunc Foo() int { return bar.Bar }\n",
+		"internal/bar/bar.go": "package bar\n\nconst Bar = 1\n",
+		"internal/bar/bar.s":  "// not Go\n",
+	})
+
+	for _, unmark := range []string{"", "bar.go"} {
+		fsys := &unmarkFS{memFS: newMemFS(), unmark: unmark}
+		c := testCopier(t, src, fsys, "internal/foo")
+		c.MarkGenerated = true
+		c.VerifyGenerated = true
+
+		err := c.Run(context.Background())
+		if unmark == "" {
+			if err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		want := "copied Go files lack the generated marker:\n\t" + filepath.Join(c.Dst, "bar", "bar.go") + ": "
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("got error %v, want %q", err, want)
+		}
+		if strings.Contains(err.Error(), "foo.go") || strings.Contains(err.Error(), "bar.s") {
+			t.Errorf("the marked or non-Go file is reported: %v", err)
+		}
+	}
+}
+
+func TestMarkerOfError(t *testing.T) {
+	c := &Copier{GeneratedMarker: "// Code generated by go-copystd. DO NOT EDIT."}
+	c.init()
+	// the template failing only on the data of the run
+	c.header = template.Must(template.New("header").Parse("{{.Missing}}"))
+
+	if _, err := c.markerOf("foo.go"); err == nil {
+		t.Error("got no error of the malformed marker")
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+)
+
+// generateGoMod generates the go.mod of the module, whose go directive is the
+// language version of the source Go version such as "go1.17.2".
+func (c *Copier) generateGoMod(module, goVersion string) ([]byte, error) {
+	f := new(modfile.File)
+	if err := f.AddModuleStmt(module); err != nil {
+		return nil, fmt.Errorf("add module directive: %w", err)
+	}
+	if err := f.AddGoStmt(goLangVersion(goVersion)); err != nil {
+		return nil, fmt.Errorf("add go directive: %w", err)
+	}
+	for _, req := range c.sortedVendorRequires() {
+		if err := f.AddRequire(req.Path, req.Version); err != nil {
+			return nil, fmt.Errorf("add require directive: %w", err)
+		}
+	}
+
+	if c.GoModPostProcess != nil {
+		if err := c.GoModPostProcess(f); err != nil {
+			return nil, fmt.Errorf("post-process go.mod: %w", err)
+		}
+	}
+	f.Cleanup()
+
+	return f.Format()
+}
+
+// goLangVersion returns the language version of the Go version, such as
+// "1.17" for "go1.17.2" or "go1.18beta1".
+func goLangVersion(version string) string {
+	version = strings.TrimPrefix(version, "go")
+	if i := strings.IndexFunc(version, func(r rune) bool { return r != '.' && (r < '0' || r > '9') }); i >= 0 {
+		version = version[:i]
+	}
+	if elems := strings.Split(version, "."); len(elems) > 2 {
+		version = elems[0] + "." + elems[1]
+	}
+
+	return version
+}
+
+// toolchainGoVersion returns the version of the go command used for go list,
+// such as "go1.17.2".
+func (c *Copier) toolchainGoVersion(ctx context.Context) (string, error) {
+	cmd := exec.CommandContext(ctx, "go", "env", "GOVERSION")
+	cmd.Env = append(os.Environ(), c.Env...)
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("go env GOVERSION: %w", err)
+	}
+	version := strings.TrimSpace(string(out))
+	if version == "" {
+		return "", errors.New("could not discover the Go version of the go command")
+	}
+
+	return version, nil
+}
+
+// initModule writes the go.mod of the module to dir whose go directive is the
+// language version of the go command. The existing go.mod is left as is unless
+// -force is given.
+func (c *Copier) initModule(ctx context.Context, dir string) error {
+	path := filepath.Join(dir, "go.mod")
+	if !c.Force {
+		if _, err := c.FS.ReadFile(path); err == nil {
+			c.warnf("%s exists, skip -init-module (use -force to overwrite)", path)
+			return nil
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("read go.mod: %w", err)
+		}
+	}
+
+	version, err := c.toolchainGoVersion(ctx)
+	if err != nil {
+		return err
+	}
+	data, err := c.generateGoMod(c.Module, version)
+	if err != nil {
+		return fmt.Errorf("generate go.mod: %w", err)
+	}
+	if c.script != nil {
+		c.script.generate(path, "go.mod")
+		return nil
+	}
+	if err := c.mkdirAll(dir); err != nil {
+		return err
+	}
+	if _, err := c.writeIfChanged(path, data); err != nil {
+		return fmt.Errorf("write go.mod: %w", err)
+	}
+
+	return nil
+}
+
+// tidyModule runs 'go mod tidy' in the module directory dir.
+func (c *Copier) tidyModule(ctx context.Context, dir string) error {
+	cmd := exec.CommandContext(ctx, "go", "mod", "tidy")
+	cmd.Env = append(os.Environ(), c.Env...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("go mod tidy: %w\n%s", err, stderr.Bytes())
+	}
+
+	return nil
+}
@@ -0,0 +1,53 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/mod/modfile"
+)
+
+func TestGoModPostProcess(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go": "package foo\n\nfunc Foo() {}\n",
+	})
+
+	t.Run("require", func(t *testing.T) {
+		fsys := newMemFS()
+		c := testCopier(t, src, fsys, "internal/foo")
+		c.GoMod = true
+		c.GoModPostProcess = func(f *modfile.File) error {
+			return f.AddRequire("example.org/dep", "v1.2.3")
+		}
+
+		if err := c.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		gomod, _ := fsys.file(filepath.Join(c.Dst, "go.mod"))
+		want := "module example.com/m\n\ngo 1.21\n\nrequire example.org/dep v1.2.3\n"
+		if gomod != want {
+			t.Errorf("got go.mod\n%s\nwant\n%s", gomod, want)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		errPostProcess := errors.New("post-process error")
+		fsys := newMemFS()
+		c := testCopier(t, src, fsys, "internal/foo")
+		c.GoMod = true
+		c.GoModPostProcess = func(*modfile.File) error { return errPostProcess }
+
+		if err := c.Run(context.Background()); !errors.Is(err, errPostProcess) {
+			t.Errorf("got error %v, want %v", err, errPostProcess)
+		}
+		if _, ok := fsys.file(filepath.Join(c.Dst, "go.mod")); ok {
+			t.Error("go.mod is written")
+		}
+	})
+}
@@ -0,0 +1,75 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// targetPlatforms returns the platforms the copy is built for, that is,
+// Platforms, or else the GOOS and GOARCH of Env defaulting to the host ones.
+func (c *Copier) targetPlatforms() []string {
+	if len(c.Platforms) > 0 {
+		return c.Platforms
+	}
+	goos, goarch := c.listedPlatform()
+
+	return []string{goos + "/" + goarch}
+}
+
+// listedPlatform returns the GOOS and GOARCH go list is run with, that is,
+// the platform being listed for Platforms, or else the ones of Env
+// defaulting to the host ones.
+func (c *Copier) listedPlatform() (goos, goarch string) {
+	goos, goarch = runtime.GOOS, runtime.GOARCH
+	for _, env := range append(c.Env[:len(c.Env):len(c.Env)], c.platformEnv...) {
+		switch key, value, _ := strings.Cut(env, "="); key {
+		case "GOOS":
+			goos = value
+		case "GOARCH":
+			goarch = value
+		}
+	}
+
+	return goos, goarch
+}
+
+// filterIgnored drops the ignored Go files of pkg whose build constraint can
+// be satisfied by none of the target platforms, so that they do not break the
+// build of the copy on the platforms.
+func (c *Copier) filterIgnored(pkg *Package) error {
+	platforms := c.targetPlatforms()
+
+	var ignored []string
+	for _, name := range pkg.IgnoredGoFiles {
+		file := filepath.Join(pkg.Dir, name)
+		data, err := c.readFile(file)
+		if err != nil {
+			return err
+		}
+		ft, err := parseFileTags(file, data)
+		if err != nil {
+			return err
+		}
+
+		built := false
+		for _, platform := range platforms {
+			goos, goarch, _ := strings.Cut(platform, "/")
+			if mayMatchPort(ft, goos, goarch, c.ports) {
+				built = true
+				break
+			}
+		}
+		if !built {
+			c.debugf("skip: %s is not built for %s", file, strings.Join(platforms, " "))
+			continue
+		}
+		ignored = append(ignored, name)
+	}
+	pkg.IgnoredGoFiles = ignored
+
+	return nil
+}
@@ -0,0 +1,108 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// importLineRe matches the import spec line or the single line import
+// declaration.
+var importLineRe = regexp.MustCompile(`^(?:import\s+)?(?:[\w.]+\s+)?"[^"]*"\s*(?://.*)?$`)
+
+// lineKind is the kind of the changed line counted by rewriteImpact.
+type lineKind int
+
+const (
+	codeLine lineKind = iota
+	importLine
+	linknameLine
+	commentLine
+)
+
+// kindOf returns the kind of the trimmed line.
+func kindOf(line string) lineKind {
+	switch {
+	case strings.HasPrefix(line, "//go:linkname"):
+		return linknameLine
+	case strings.HasPrefix(line, "//"), strings.HasPrefix(line, "/*"):
+		return commentLine
+	case importLineRe.MatchString(line):
+		return importLine
+	}
+
+	return codeLine
+}
+
+// rewriteImpact counts the changes of the copied Go files by the rewrite.
+type rewriteImpact struct {
+	Files     int // copied Go files
+	Unchanged int // files unchanged beyond formatting
+	Imports   int // rewritten import lines
+	Linknames int // rewritten //go:linkname directives
+	Comments  int // touched comment lines other than the directives above
+}
+
+// add counts the changes from the source src to the rewritten dst.
+//
+// The lines are compared as the multisets of the trimmed non-blank lines, so
+// that the whitespace and the order of the lines are not counted. A changed
+// line is counted once whether it is removed, added or replaced.
+func (r *rewriteImpact) add(src, dst string) {
+	lines := make(map[string]int)
+	for _, line := range strings.Split(src, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines[line]++
+		}
+	}
+	for _, line := range strings.Split(dst, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines[line]--
+		}
+	}
+
+	var removed, added [commentLine + 1]int
+	for line, n := range lines {
+		switch kind := kindOf(line); {
+		case n > 0:
+			removed[kind] += n
+		case n < 0:
+			added[kind] -= n
+		}
+	}
+
+	r.Files++
+	if removed == [commentLine + 1]int{} && added == [commentLine + 1]int{} {
+		r.Unchanged++
+	}
+	changed := func(kind lineKind) int {
+		if removed[kind] > added[kind] {
+			return removed[kind]
+		}
+		return added[kind]
+	}
+	r.Imports += changed(importLine)
+	r.Linknames += changed(linknameLine)
+	r.Comments += changed(commentLine)
+}
+
+// addImpact counts the changes of the rewritten Go file to the rewrite impact
+// of the run.
+func (c *Copier) addImpact(src, dst string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.impact.add(src, dst)
+}
+
+// print prints the rewrite impact to w.
+func (r *rewriteImpact) print(w io.Writer) {
+	fmt.Fprintf(w, "%6d files copied\n", r.Files)
+	fmt.Fprintf(w, "%6d files unchanged beyond formatting\n", r.Unchanged)
+	fmt.Fprintf(w, "%6d import lines rewritten\n", r.Imports)
+	fmt.Fprintf(w, "%6d linknames rewritten\n", r.Linknames)
+	fmt.Fprintf(w, "%6d comment lines touched\n", r.Comments)
+}
@@ -0,0 +1,52 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestMeasureRewriteImpact(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go": `package foo
+
+import (
+	"internal/bar"
+	"internal/baz"
+	_ "unsafe"
+)
+
+var _ = bar.Bar
+
+//go:linkname qux internal/baz.qux
+func qux() int
+
+func Baz() int { return baz.Baz }
+`,
+		"internal/foo/foo.s":  "",
+		"internal/bar/bar.go": "package bar\n\nconst Bar = 1\n",
+		"internal/baz/baz.go": "package baz\n\nconst Baz = 1\n\nfunc qux() int { return Baz }\n",
+	})
+	c := testCopier(t, src, newMemFS(), "internal/foo")
+	c.MeasureRewriteImpact = true
+	c.FollowLinkname = true
+	var stdout strings.Builder
+	c.Stdout = &stdout
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `     3 files copied
+     2 files unchanged beyond formatting
+     2 import lines rewritten
+     1 linknames rewritten
+     0 comment lines touched
+`
+	if got := stdout.String(); !strings.Contains(got, want) {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import "regexp"
+
+// list of Copier.ImportComment modes.
+const (
+	ImportCommentKeep    = "keep"
+	ImportCommentRewrite = "rewrite"
+	ImportCommentStrip   = "strip"
+)
+
+// importCommentRe matches the package clause with the canonical import
+// comment, such as:
+//
+//	package foo // import "internal/foo"
+//	package foo /* import "internal/foo" */
+var importCommentRe = regexp.MustCompile(`(?m)^(package\s+\w+)(\s*(?://\s*import\s+"([^"]*)"|/\*\s*import\s+"([^"]*)"\s*\*/))[ \t]*$`)
+
+// canonicalImportComment rewrites or strips the canonical import comment of
+// the package clause in body according to mode.
+func (c *Copier) canonicalImportComment(body, mode string) string {
+	if mode != ImportCommentRewrite && mode != ImportCommentStrip {
+		return body
+	}
+
+	loc := importCommentRe.FindStringSubmatchIndex(body)
+	if loc == nil {
+		return body
+	}
+
+	clause := body[loc[2]:loc[3]]
+	if mode == ImportCommentStrip {
+		return body[:loc[0]] + clause + body[loc[1]:]
+	}
+
+	start, end := loc[6], loc[7]
+	if start < 0 {
+		start, end = loc[8], loc[9]
+	}
+	imp := body[start:end]
+	if vendored, ok := c.vendored[imp]; ok {
+		imp = vendored
+	}
+	return body[:start] + c.rewriteImportPath(imp) + body[end:]
+}
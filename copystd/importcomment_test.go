@@ -0,0 +1,58 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestImportComment(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go": "package foo // import \"internal/foo\"\n\nfunc Foo() {}\n",
+		"internal/bar/bar.go": "package bar /* import \"internal/bar\" */\n\nimport _ \"internal/foo\"\n",
+	})
+
+	tests := []struct {
+		mode    string
+		wantFoo string
+		wantBar string
+	}{
+		{
+			mode:    ImportCommentKeep,
+			wantFoo: `package foo // import "internal/foo"`,
+			wantBar: `package bar /* import "internal/bar" */`,
+		},
+		{
+			mode:    ImportCommentRewrite,
+			wantFoo: `package foo // import "example.com/m/foo"`,
+			wantBar: `package bar /* import "example.com/m/bar" */`,
+		},
+		{
+			mode:    ImportCommentStrip,
+			wantFoo: "package foo",
+			wantBar: "package bar",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			fsys := newMemFS()
+			c := testCopier(t, src, fsys, "internal/bar")
+			c.ImportComment = tt.mode
+
+			if err := c.Run(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			for file, want := range map[string]string{"foo/foo.go": tt.wantFoo, "bar/bar.go": tt.wantBar} {
+				got, _ := fsys.file(filepath.Join(c.Dst, filepath.FromSlash(file)))
+				if clause, _, _ := strings.Cut(got, "\n"); clause != want {
+					t.Errorf("%s: got package clause %q, want %q", file, clause, want)
+				}
+			}
+		})
+	}
+}
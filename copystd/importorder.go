@@ -0,0 +1,317 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// import groups, in the canonical order.
+const (
+	importGroupStd = iota
+	importGroupExternal
+	importGroupLocal
+)
+
+// importGroup classifies path as a standard library, external or local import.
+func importGroup(path, localPrefix string) int {
+	switch {
+	case localPrefix != "" && (path == localPrefix || strings.HasPrefix(path, localPrefix+"/")):
+		return importGroupLocal
+	case isStdImport(path):
+		return importGroupStd
+	default:
+		return importGroupExternal
+	}
+}
+
+// normalizeImports rewrites the import declarations of src into a single
+// import block grouped as std, external and local imports, each group sorted
+// by import path.
+//
+// The result does not depend on the goimports version used to produce src.
+// The cgo pseudo import "C" is kept as is.
+//
+// The comments in the import blocks which are not attached to an import, such
+// as the group heading comments followed by a blank line, are dropped unless
+// keepComments is true, in which case they are re-attached to the following
+// import, or kept at the end of the block if no import follows. The comments
+// between the merged declarations, such as their doc comments, are kept as
+// the doc comment of the merged declaration then.
+func normalizeImports(filename string, src []byte, localPrefix string, keepComments bool) ([]byte, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, src, parser.ParseComments|parser.ImportsOnly)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", filename, err)
+	}
+
+	var decls []*ast.GenDecl
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.IMPORT {
+			continue
+		}
+		if len(gen.Specs) == 1 && gen.Specs[0].(*ast.ImportSpec).Path.Value == `"C"` {
+			if len(decls) > 0 {
+				// the import "C" is placed between the other imports, leave it
+				return src, nil
+			}
+			continue
+		}
+		decls = append(decls, gen)
+	}
+	if len(decls) == 0 {
+		return src, nil
+	}
+
+	var floating map[*ast.ImportSpec][]*ast.CommentGroup
+	var trailing, docs []*ast.CommentGroup
+	if keepComments {
+		floating, trailing = floatingImportComments(f, decls)
+		docs = interDeclComments(f, decls)
+	}
+
+	type importLine struct {
+		path string
+		text string
+	}
+	var groups [importGroupLocal + 1][]importLine
+	for _, decl := range decls {
+		for _, spec := range decl.Specs {
+			spec := spec.(*ast.ImportSpec)
+			path, err := strconv.Unquote(spec.Path.Value)
+			if err != nil {
+				return nil, fmt.Errorf("unquote import path %s: %w", spec.Path.Value, err)
+			}
+
+			var buf bytes.Buffer
+			for _, cg := range floating[spec] {
+				for _, c := range cg.List {
+					buf.WriteString("\t" + c.Text + "\n")
+				}
+			}
+			if spec.Doc != nil {
+				for _, c := range spec.Doc.List {
+					buf.WriteString("\t" + c.Text + "\n")
+				}
+			}
+			buf.WriteByte('\t')
+			if spec.Name != nil {
+				buf.WriteString(spec.Name.Name + " ")
+			}
+			buf.WriteString(spec.Path.Value)
+			if spec.Comment != nil {
+				for _, c := range spec.Comment.List {
+					buf.WriteString(" " + c.Text)
+				}
+			}
+			buf.WriteByte('\n')
+
+			group := importGroup(path, localPrefix)
+			groups[group] = append(groups[group], importLine{path: path, text: buf.String()})
+		}
+	}
+
+	var block bytes.Buffer
+	for _, cg := range docs {
+		for _, c := range cg.List {
+			block.WriteString(c.Text + "\n")
+		}
+	}
+	block.WriteString("import (\n")
+	first := true
+	for _, lines := range groups {
+		if len(lines) == 0 {
+			continue
+		}
+		sort.SliceStable(lines, func(i, j int) bool { return lines[i].path < lines[j].path })
+		if !first {
+			block.WriteByte('\n')
+		}
+		first = false
+		for _, line := range lines {
+			block.WriteString(line.text)
+		}
+	}
+	if len(trailing) > 0 {
+		block.WriteByte('\n')
+		for _, cg := range trailing {
+			for _, c := range cg.List {
+				block.WriteString("\t" + c.Text + "\n")
+			}
+		}
+	}
+	block.WriteString(")")
+
+	start := fset.Position(decls[0].Pos()).Offset
+	end := fset.Position(decls[len(decls)-1].End()).Offset
+
+	var out bytes.Buffer
+	out.Write(src[:start])
+	out.Write(block.Bytes())
+	out.Write(src[end:])
+
+	data, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format %s: %w", filename, err)
+	}
+
+	return data, nil
+}
+
+// floatingImportComments returns the comment groups in the import decls of f
+// which are not attached to an import, keyed by the import following them.
+// The ones following the last import are returned as trailing.
+func floatingImportComments(f *ast.File, decls []*ast.GenDecl) (floating map[*ast.ImportSpec][]*ast.CommentGroup, trailing []*ast.CommentGroup) {
+	attached := make(map[*ast.CommentGroup]bool)
+	var specs []*ast.ImportSpec
+	for _, decl := range decls {
+		for _, spec := range decl.Specs {
+			spec := spec.(*ast.ImportSpec)
+			attached[spec.Doc] = true
+			attached[spec.Comment] = true
+			specs = append(specs, spec)
+		}
+	}
+
+	floating = make(map[*ast.ImportSpec][]*ast.CommentGroup)
+	for _, cg := range f.Comments {
+		if attached[cg] {
+			continue
+		}
+		inDecl := false
+		for _, decl := range decls {
+			if decl.Lparen.IsValid() && decl.Lparen < cg.Pos() && cg.End() <= decl.Rparen {
+				inDecl = true
+				break
+			}
+		}
+		if !inDecl {
+			continue
+		}
+
+		i := sort.Search(len(specs), func(i int) bool { return specs[i].Pos() > cg.End() })
+		if i == len(specs) {
+			trailing = append(trailing, cg)
+			continue
+		}
+		floating[specs[i]] = append(floating[specs[i]], cg)
+	}
+
+	return floating, trailing
+}
+
+// interDeclComments returns the comment groups between the first and the last
+// import decls of f outside of their parentheses, such as the doc comments of
+// the decls but the first, which merging the decls would drop.
+func interDeclComments(f *ast.File, decls []*ast.GenDecl) []*ast.CommentGroup {
+	attached := make(map[*ast.CommentGroup]bool)
+	for _, decl := range decls {
+		for _, spec := range decl.Specs {
+			attached[spec.(*ast.ImportSpec).Comment] = true
+		}
+	}
+
+	var comments []*ast.CommentGroup
+	for _, cg := range f.Comments {
+		if attached[cg] || cg.Pos() < decls[0].End() || decls[len(decls)-1].End() < cg.End() {
+			continue
+		}
+		inDecl := false
+		for _, decl := range decls {
+			if decl.Lparen.IsValid() && decl.Lparen < cg.Pos() && cg.End() <= decl.Rparen {
+				inDecl = true
+				break
+			}
+		}
+		if !inDecl {
+			comments = append(comments, cg)
+		}
+	}
+
+	return comments
+}
+
+// importPathRe matches the import path of an import spec line.
+var importPathRe = regexp.MustCompile(`^\s*(?:[\w.]+\s+)?"([^"]+)"`)
+
+// groupLocalImports moves the local imports of localPrefix in each group of
+// the parenthesized import declarations of the goimports output src into a
+// group following the group, as goimports does with its LocalPrefix.
+//
+// It stands in for imports.LocalPrefix, which is a package global and cannot
+// be set per run.
+func groupLocalImports(src []byte, localPrefix string) []byte {
+	if localPrefix == "" {
+		return src
+	}
+
+	lines := strings.SplitAfter(string(src), "\n")
+	var out strings.Builder
+	for i := 0; i < len(lines); i++ {
+		out.WriteString(lines[i])
+		if strings.TrimSpace(lines[i]) != "import (" {
+			continue
+		}
+
+		// the groups of the block, separated by the blank lines
+		var group []string
+		for i++; i < len(lines); i++ {
+			text := strings.TrimSpace(lines[i])
+			if text == "" || text == ")" {
+				out.WriteString(splitLocalGroup(group, localPrefix))
+				group = nil
+				out.WriteString(lines[i])
+				if text == ")" {
+					break
+				}
+				continue
+			}
+			group = append(group, lines[i])
+		}
+	}
+
+	return []byte(out.String())
+}
+
+// splitLocalGroup returns the lines of the sorted import group with the local
+// imports moved into a following group. The group is returned as is if it
+// has a line other than an import spec or a line comment.
+func splitLocalGroup(group []string, localPrefix string) string {
+	var other, local []string
+	var doc []string // the comment lines attached to the next spec
+	for _, line := range group {
+		text := strings.TrimSpace(line)
+		if strings.HasPrefix(text, "//") {
+			doc = append(doc, line)
+			continue
+		}
+		m := importPathRe.FindStringSubmatch(line)
+		if m == nil {
+			return strings.Join(group, "")
+		}
+		if importGroup(m[1], localPrefix) == importGroupLocal {
+			local = append(local, doc...)
+			local = append(local, line)
+		} else {
+			other = append(other, doc...)
+			other = append(other, line)
+		}
+		doc = nil
+	}
+	if len(doc) > 0 || len(other) == 0 || len(local) == 0 {
+		return strings.Join(group, "")
+	}
+
+	return strings.Join(other, "") + "\n" + strings.Join(local, "")
+}
@@ -0,0 +1,180 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeImportsOrder(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go": `package foo
+
+import (
+	"internal/bar"
+	"strings"
+
+	"golang.org/x/net/dns/dnsmessage"
+	"fmt"
+)
+
+var _ = dnsmessage.TypeA
+
+func Foo() string { return fmt.Sprint(strings.ToUpper(bar.Bar)) }
+`,
+		"internal/bar/bar.go": "package bar\n\nconst Bar = \"bar\"\n",
+	})
+	fsys := newMemFS()
+	c := testCopier(t, src, fsys, "internal/foo")
+	c.NormalizeImportsOrder = true
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	got, _ := fsys.file(filepath.Join(c.Dst, "foo", "foo.go"))
+	want := `import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"example.com/m/bar"
+)
+`
+	if !strings.Contains(got, want) {
+		t.Errorf("imports are not in the canonical order, want\n%s\ngot\n%s", want, got)
+	}
+}
+
+func TestNormalizeImportsDeclComments(t *testing.T) {
+	src := `package foo
+
+// the std imports
+import "strings"
+
+// the local imports,
+// which are copied
+import (
+	"example.com/m/bar"
+
+	// the formatting
+	"fmt"
+)
+
+var _ = strings.ToUpper(fmt.Sprint(bar.Bar))
+`
+
+	tests := []struct {
+		keepComments bool
+		want         string
+	}{
+		{
+			keepComments: true,
+			want: `package foo
+
+// the std imports
+// the local imports,
+// which are copied
+import (
+	// the formatting
+	"fmt"
+	"strings"
+
+	"example.com/m/bar"
+)
+`,
+		},
+		{
+			keepComments: false,
+			want: `package foo
+
+// the std imports
+import (
+	// the formatting
+	"fmt"
+	"strings"
+
+	"example.com/m/bar"
+)
+`,
+		},
+	}
+	for _, tt := range tests {
+		got, err := normalizeImports("foo.go", []byte(src), "example.com/m", tt.keepComments)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(string(got), tt.want) {
+			t.Errorf("keepComments %t: want the prefix\n%s\ngot\n%s", tt.keepComments, tt.want, got)
+		}
+	}
+}
+
+func TestPreserveImportComments(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go": `package foo
+
+import (
+	// the copied packages
+	"internal/bar" // rewritten
+
+	// the formatting
+	"fmt"
+
+	// end of the imports
+)
+
+var _ = fmt.Sprint(bar.Bar)
+`,
+		"internal/bar/bar.go": "package bar\n\nconst Bar = 1\n",
+	})
+
+	tests := []struct {
+		preserve bool
+		want     string
+	}{
+		{
+			preserve: true,
+			want: `import (
+	// the formatting
+	"fmt"
+
+	// the copied packages
+	"example.com/m/bar" // rewritten
+	// end of the imports
+)
+`,
+		},
+		{
+			preserve: false,
+			want: `import (
+	// the formatting
+	"fmt"
+
+	// the copied packages
+	"example.com/m/bar" // rewritten
+)
+`,
+		},
+	}
+	for _, tt := range tests {
+		fsys := newMemFS()
+		c := testCopier(t, src, fsys, "internal/foo")
+		c.NormalizeImportsOrder = true
+		c.PreserveImportComments = tt.preserve
+
+		if err := c.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		got, _ := fsys.file(filepath.Join(c.Dst, "foo", "foo.go"))
+		if !strings.Contains(got, tt.want) {
+			t.Errorf("preserve %t: want\n%s\ngot\n%s", tt.preserve, tt.want, got)
+		}
+	}
+}
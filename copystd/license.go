@@ -0,0 +1,129 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"fmt"
+	"go/build/constraint"
+	"strings"
+)
+
+// hasLicenseHeader reports whether the Go source body begins with a license
+// header, that is a comment block which has both a copyright notice and a
+// license reference, such as the BSD-style header of the Go stdlib.
+//
+// The generated code marker and the build constraints preceding the header
+// are skipped.
+func hasLicenseHeader(body string) bool {
+	var block []string
+	inBlock := false
+	for _, line := range strings.Split(body, "\n") {
+		text := strings.TrimSpace(line)
+		switch {
+		case inBlock:
+			block = append(block, text)
+			if strings.Contains(text, "*/") {
+				return isLicense(block)
+			}
+			continue
+		case text == "", constraint.IsGoBuild(text), constraint.IsPlusBuild(text), generatedRe.MatchString(text):
+			if len(block) > 0 {
+				return isLicense(block)
+			}
+			continue
+		case strings.HasPrefix(text, "//"):
+			block = append(block, text)
+			continue
+		case strings.HasPrefix(text, "/*"):
+			block = append(block, text)
+			if strings.Contains(text, "*/") {
+				return isLicense(block)
+			}
+			inBlock = true
+			continue
+		}
+		break
+	}
+
+	return isLicense(block)
+}
+
+func isLicense(block []string) bool {
+	text := strings.ToLower(strings.Join(block, "\n"))
+	return strings.Contains(text, "copyright") && (strings.Contains(text, "license") || strings.Contains(text, "spdx-license-identifier"))
+}
+
+// checkLicenseHeader reports the Go file without the license header, which is
+// a warning or, if -strict is given, an error.
+func (c *Copier) checkLicenseHeader(file, body string) error {
+	if hasLicenseHeader(body) {
+		return nil
+	}
+
+	if c.Strict {
+		return fmt.Errorf("%s has no license header", file)
+	}
+	c.warnf("%s has no license header", file)
+
+	return nil
+}
+
+// licenseComment returns the license header template as comment lines. The
+// lines of the template which are not line comments yet are commented out.
+func licenseComment(template string) string {
+	lines := strings.Split(strings.TrimRight(template, "\n"), "\n")
+	for i, line := range lines {
+		line = strings.TrimRight(line, " \t")
+		switch {
+		case strings.HasPrefix(line, "//"):
+		case line == "":
+			line = "//"
+		default:
+			line = "// " + line
+		}
+		lines[i] = line
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// injectLicense inserts the license header into the Go source data after the
+// build constraint lines, or at the top of the file if it has none, keeping
+// the original copyright notice. data is returned as is if it already has
+// the header, so that the re-runs do not duplicate it.
+func injectLicense(data []byte, header string) []byte {
+	if strings.Contains(string(data), header) {
+		return data
+	}
+
+	// the end of the last build constraint line preceding the package clause
+	offset := 0
+	for pos := 0; pos < len(data); {
+		end := strings.IndexByte(string(data[pos:]), '\n')
+		if end < 0 {
+			end = len(data) - pos
+		} else {
+			end++
+		}
+		text := strings.TrimSpace(string(data[pos : pos+end]))
+		if strings.HasPrefix(text, "package ") {
+			break
+		}
+		if constraint.IsGoBuild(text) || constraint.IsPlusBuild(text) {
+			offset = pos + end
+		}
+		pos += end
+	}
+
+	var buf strings.Builder
+	buf.Write(data[:offset])
+	if offset > 0 {
+		buf.WriteString("\n")
+	}
+	buf.WriteString(header)
+	buf.WriteString("\n\n")
+	buf.WriteString(strings.TrimLeft(string(data[offset:]), "\n"))
+
+	return []byte(buf.String())
+}
@@ -0,0 +1,50 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestCheckLicenseHeaders(t *testing.T) {
+	const header = "// Copyright 2021 The Go Authors. All rights reserved.\n// Use of this source code is governed by a BSD-style\n// license that can be found in the LICENSE file.\n\n"
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go":       header + "package foo\n\nfunc Foo() {}\n",
+		"internal/foo/tagged.go":    "//go:build !js\n\n" + header + "package foo\n\nconst Tagged = 1\n",
+		"internal/foo/nolicense.go": "// Package foo has no license.\npackage foo\n\nconst NoLicense = 1\n",
+	})
+
+	t.Run("warn", func(t *testing.T) {
+		c := testCopier(t, src, newMemFS(), "internal/foo")
+		c.CheckLicenseHeaders = true
+
+		res, err := c.Copy(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var warned []string
+		for _, warning := range res.Warnings {
+			if strings.Contains(warning, "has no license header") {
+				warned = append(warned, warning)
+			}
+		}
+		if len(warned) != 1 || !strings.Contains(warned[0], "nolicense.go") {
+			t.Errorf("got warnings %q, want the one of nolicense.go", warned)
+		}
+	})
+
+	t.Run("strict", func(t *testing.T) {
+		c := testCopier(t, src, newMemFS(), "internal/foo")
+		c.CheckLicenseHeaders = true
+		c.Strict = true
+
+		err := c.Run(context.Background())
+		if err == nil || !strings.Contains(err.Error(), "nolicense.go has no license header") {
+			t.Errorf("got error %v, want the one of nolicense.go", err)
+		}
+	})
+}
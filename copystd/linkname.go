@@ -0,0 +1,218 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// linknameRe matches the //go:linkname directive which names the target
+// symbol.
+var linknameRe = regexp.MustCompile(`(?m)^//go:linkname[ \t]+\S+[ \t]+(\S+)`)
+
+// linknamePath returns the import path of the //go:linkname target such as
+// internal/poll.runtime_pollOpen or runtime.(*m).nextp, or "" if the target
+// has no import path.
+func linknamePath(target string) string {
+	slash := strings.LastIndex(target, "/")
+	dot := strings.Index(target[slash+1:], ".")
+	if dot < 0 {
+		return ""
+	}
+
+	return target[:slash+1+dot]
+}
+
+// linknamePackages returns the sorted import paths of the copied packages
+// which are referenced by the //go:linkname directives of the Go files of
+// pkgs.
+func (c *Copier) linknamePackages(pkgs []*Package) ([]string, error) {
+	seen := make(map[string]bool)
+	for _, pkg := range pkgs {
+		for _, name := range append(append([]string{}, pkg.GoFiles...), pkg.CgoFiles...) {
+			data, err := c.readFile(filepath.Join(pkg.Dir, name))
+			if err != nil {
+				return nil, err
+			}
+			for _, m := range linknameRe.FindAllStringSubmatch(data, -1) {
+				if path := linknamePath(m[1]); path != "" && path != pkg.ImportPath && c.isCopiedPath(path) {
+					seen[path] = true
+				}
+			}
+		}
+	}
+
+	paths := make([]string, 0, len(seen))
+	for path := range seen {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	return paths, nil
+}
+
+// rewriteLinknames rewrites the import paths of the //go:linkname targets in
+// body to the copied packages.
+func (c *Copier) rewriteLinknames(body string) string {
+	return linknameRe.ReplaceAllStringFunc(body, func(directive string) string {
+		m := linknameRe.FindStringSubmatchIndex(directive)
+		target := directive[m[2]:m[3]]
+		path := linknamePath(target)
+		if path == "" || !c.isCopiedPath(path) {
+			return directive
+		}
+
+		return directive[:m[2]] + c.rewriteImportPath(path) + target[len(path):]
+	})
+}
+
+// followLinknames returns the packages to copy which are not imported by pkgs
+// but referenced by their //go:linkname directives, along with the
+// dependencies of them, until no new package is referenced.
+//
+// visited is the one given to resolveDeps.
+func (c *Copier) followLinknames(ctx context.Context, pkgs []*Package, visited map[string]bool) ([]*Package, error) {
+	var linked []*Package
+	for scan := pkgs; len(scan) > 0; {
+		paths, err := c.linknamePackages(scan)
+		if err != nil {
+			return nil, err
+		}
+
+		var list []string
+		for _, path := range paths {
+			if !visited[path] && !matchAny(c.IgnorePrefix, path) {
+				visited[path] = true
+				list = append(list, path)
+			}
+		}
+		if len(list) == 0 {
+			break
+		}
+
+		listed, err := c.listPackages(ctx, c.Src, list...)
+		if err != nil {
+			return nil, fmt.Errorf("list linkname targets: %w", err)
+		}
+		var roots []*Package
+		for _, pkg := range listed {
+			switch {
+			case isPseudoPackage(pkg):
+			case isMissing(pkg):
+				if err := c.handleMissing(pkg); err != nil {
+					return nil, err
+				}
+			case c.needsCopy(pkg) && c.outsideResolveRoot(pkg):
+				c.ignoref(pkg.ImportPath, "%s is outside -resolve-root", pkg.ImportPath)
+			case c.needsCopy(pkg):
+				c.infof("linkname: %s", pkg.ImportPath)
+				roots = append(roots, pkg)
+			}
+		}
+
+		deps, err := c.resolveDeps(ctx, roots, visited)
+		if err != nil {
+			return nil, err
+		}
+		scan = append(roots, deps...)
+		linked = append(linked, scan...)
+	}
+
+	return linked, nil
+}
+
+// stripLinknames removes the //go:linkname directives of the Go source body
+// of the file of pkg, along with the forward declarations they pull, that is,
+// the functions declared without body which the directives name. A removed
+// function which no other file of pkg declares with body, such as the pure Go
+// fallback for the other build tags, is reported as the references to it no
+// longer build.
+func (c *Copier) stripLinknames(pkg *Package, file, body string) (string, error) {
+	if !strings.Contains(body, "//go:linkname") {
+		return body, nil
+	}
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, file, body, parser.ParseComments|parser.SkipObjectResolution)
+	if err != nil {
+		return "", fmt.Errorf("parse %s: %w", file, err)
+	}
+
+	pulled := make(map[string]bool)
+	for _, cg := range f.Comments {
+		for _, comment := range cg.List {
+			if fields := strings.Fields(comment.Text); len(fields) >= 2 && fields[0] == "//go:linkname" {
+				pulled[fields[1]] = true
+			}
+		}
+	}
+
+	type span struct{ start, end int }
+	var spans []span
+	for _, decl := range f.Decls {
+		fd, ok := decl.(*ast.FuncDecl)
+		if !ok || fd.Body != nil || fd.Recv != nil || !pulled[fd.Name.Name] {
+			continue
+		}
+
+		start, end := fset.Position(fd.Pos()).Offset, fset.Position(fd.End()).Offset
+		if fd.Doc != nil {
+			start = fset.Position(fd.Doc.Pos()).Offset
+		}
+		if end < len(body) && body[end] == '\n' {
+			end++
+		}
+		spans = append(spans, span{start, end})
+
+		fallback, err := c.hasFuncBody(pkg, file, fd.Name.Name)
+		if err != nil {
+			return "", err
+		}
+		if !fallback {
+			c.warnf("%s: strip %s pulled by //go:linkname, which the package has no fallback of", file, fd.Name.Name)
+		}
+	}
+
+	for i := len(spans) - 1; i >= 0; i-- {
+		body = body[:spans[i].start] + body[spans[i].end:]
+	}
+
+	return stripDirectives(body, []string{"go:linkname"}), nil
+}
+
+// hasFuncBody reports whether any Go file of pkg but the file declares the
+// function name with body.
+func (c *Copier) hasFuncBody(pkg *Package, file, name string) (bool, error) {
+	for _, names := range [...][]string{pkg.GoFiles, pkg.CgoFiles, pkg.IgnoredGoFiles} {
+		for _, base := range names {
+			other := filepath.Join(pkg.Dir, base)
+			if other == file {
+				continue
+			}
+			data, err := c.readFile(other)
+			if err != nil {
+				return false, err
+			}
+			f, err := parser.ParseFile(token.NewFileSet(), other, data, parser.SkipObjectResolution)
+			if err != nil {
+				return false, fmt.Errorf("parse %s: %w", other, err)
+			}
+			for _, decl := range f.Decls {
+				if fd, ok := decl.(*ast.FuncDecl); ok && fd.Recv == nil && fd.Body != nil && fd.Name.Name == name {
+					return true, nil
+				}
+			}
+		}
+	}
+
+	return false, nil
+}
@@ -0,0 +1,47 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFollowLinkname(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go": "package foo\n\nimport _ \"unsafe\"\n\n//go:linkname bar internal/bar.bar\nfunc bar() int\n",
+		"internal/foo/foo.s":  "",
+		"internal/bar/bar.go": "package bar\n\nimport \"internal/baz\"\n\nfunc bar() int { return baz.Baz }\n",
+		"internal/baz/baz.go": "package baz\n\nconst Baz = 1\n",
+	})
+
+	for _, follow := range []bool{false, true} {
+		fsys := newMemFS()
+		c := testCopier(t, src, fsys, "internal/foo")
+		c.FollowLinkname = follow
+
+		if err := c.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		want := []string{"foo/foo.go", "foo/foo.s"}
+		if follow {
+			// along with the dependency of the linked package
+			want = []string{"bar/bar.go", "baz/baz.go", "foo/foo.go", "foo/foo.s"}
+		}
+		if got := fsys.paths(c.Dst); !reflect.DeepEqual(got, want) {
+			t.Errorf("follow %t: copied files: got %q, want %q", follow, got, want)
+		}
+		if !follow {
+			continue
+		}
+		foo, _ := fsys.file(filepath.Join(c.Dst, "foo", "foo.go"))
+		if !strings.Contains(foo, "//go:linkname bar example.com/m/bar.bar\n") {
+			t.Errorf("the linkname target is not rewritten:\n%s", foo)
+		}
+	}
+}
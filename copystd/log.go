@@ -0,0 +1,179 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LogLevel is the minimum level of the messages printed by Copier.
+type LogLevel int
+
+// List of LogLevel.
+const (
+	LogDebug LogLevel = iota - 1 // print all the messages including the debug ones and the time to copy each file
+	LogInfo                      // print the messages other than the debug ones
+	LogWarn                      // print only the warnings and the errors
+	LogError                     // print only the errors
+)
+
+// list of Copier.LogFormat values.
+const (
+	LogText = "text" // human readable lines, the warnings and the errors to Stderr
+	LogJSON = "json" // a JSON object per event to Stdout
+)
+
+// logEvent is an event printed with LogJSON.
+type logEvent struct {
+	Action  string `json:"action"` // copy, ignore, debug, info, warn or error
+	Src     string `json:"src,omitempty"`
+	Dst     string `json:"dst,omitempty"`
+	Import  string `json:"import,omitempty"`
+	Msg     string `json:"msg,omitempty"`
+	Elapsed string `json:"elapsed,omitempty"` // time to copy the file, with LogDebug
+}
+
+// emit prints the event to Stdout as a JSON line.
+func (c *Copier) emit(e logEvent) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	c.Stdout.Write(append(data, '\n'))
+}
+
+// logf prints the message of the action to w, or to Stdout as the event with
+// LogJSON.
+func (c *Copier) logf(w io.Writer, action, prefix, format string, args ...interface{}) {
+	if c.LogFormat == LogJSON {
+		c.emit(logEvent{Action: action, Msg: fmt.Sprintf(format, args...)})
+		return
+	}
+	fmt.Fprintf(w, prefix+format+"\n", args...)
+}
+
+// debugf prints the debug message to Stdout.
+func (c *Copier) debugf(format string, args ...interface{}) {
+	if c.LogLevel <= LogDebug {
+		c.logf(c.Stdout, "debug", "", format, args...)
+	}
+}
+
+// infof prints the message to Stdout.
+func (c *Copier) infof(format string, args ...interface{}) {
+	if c.LogLevel <= LogInfo {
+		c.logf(c.Stdout, "info", "", format, args...)
+	}
+}
+
+// warnf prints the warning to Stderr, and records it for Result.
+func (c *Copier) warnf(format string, args ...interface{}) {
+	c.logMu.Lock()
+	c.warnings = append(c.warnings, fmt.Sprintf(format, args...))
+	c.logMu.Unlock()
+
+	if c.LogLevel <= LogWarn {
+		c.logf(c.Stderr, "warn", "[WARN]: ", format, args...)
+	}
+}
+
+// errorf prints the error to Stderr, which is never suppressed.
+func (c *Copier) errorf(format string, args ...interface{}) {
+	c.logf(c.Stderr, "error", "[ERROR]: ", format, args...)
+}
+
+// ignoref prints the message of the import path imp not being copied.
+func (c *Copier) ignoref(imp, format string, args ...interface{}) {
+	if c.LogLevel > LogInfo {
+		return
+	}
+	if c.LogFormat == LogJSON {
+		c.emit(logEvent{Action: "ignore", Import: imp, Msg: fmt.Sprintf(format, args...)})
+		return
+	}
+	fmt.Fprintf(c.Stdout, "ignore: "+format+"\n", args...)
+}
+
+// logCopy prints the copy of the src file to dst, which took elapsed. The copy
+// is printed at the debug level, or as the event with LogJSON.
+func (c *Copier) logCopy(src, dst string, elapsed time.Duration) {
+	if c.checking {
+		return
+	}
+	switch {
+	case c.LogFormat == LogJSON && c.LogLevel <= LogDebug:
+		c.emit(logEvent{Action: "copy", Src: src, Dst: dst, Elapsed: elapsed.String()})
+	case c.LogFormat == LogJSON && c.LogLevel <= LogInfo:
+		c.emit(logEvent{Action: "copy", Src: src, Dst: dst})
+	default:
+		c.debugf("copy: %s -> %s (%s)", src, dst, elapsed)
+	}
+}
+
+// printSummary prints the number of the copied packages, the platforms whose
+// files are copied, the written and the skipped files by the reason, and the
+// elapsed time of the run.
+func (c *Copier) printSummary() {
+	if c.LogFormat == LogJSON {
+		return
+	}
+	platforms := strings.Join(c.targetPlatforms(), ",")
+	if c.AllFiles {
+		platforms = "all platforms"
+	}
+
+	reasons := make([]string, 0, len(c.skipReasons))
+	for reason, n := range c.skipReasons {
+		reasons = append(reasons, fmt.Sprintf("%s: %d", reason, n))
+	}
+	sort.Strings(reasons)
+	skipped := fmt.Sprintf("%d files", len(c.skipped))
+	if len(reasons) > 0 {
+		skipped += " (" + strings.Join(reasons, ", ") + ")"
+	}
+
+	c.infof("copied %d packages for %s, wrote %d files, left %d unchanged, skipped %s in %s",
+		len(c.sizes), platforms, c.written, c.unchanged, skipped, time.Since(c.started).Round(time.Millisecond))
+}
+
+// countWritten counts a written file, or an unchanged one left as is.
+func (c *Copier) countWritten(written bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if written {
+		c.written++
+	} else {
+		c.unchanged++
+	}
+}
+
+// addSkipped records the skipped file for the reason, that is, the source
+// file skipped by the options or the destination file left as is by Update.
+func (c *Copier) addSkipped(file, reason string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.skipped = append(c.skipped, file)
+	c.skipReasons[reason]++
+}
+
+// syncWriter serializes the writes to w, so that the messages written by the
+// packages copied concurrently are not interleaved. Each message is written
+// by a single Write call.
+type syncWriter struct {
+	mu *sync.Mutex
+	w  io.Writer
+}
+
+func (w *syncWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.w.Write(p)
+}
@@ -0,0 +1,82 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// byteWriter writes a byte at a time yielding the processor in between, so
+// that the concurrent writes interleave unless serialized by the caller.
+type byteWriter struct {
+	data []byte
+}
+
+func (w *byteWriter) Write(p []byte) (int, error) {
+	for _, b := range p {
+		w.data = append(w.data, b)
+		runtime.Gosched()
+	}
+
+	return len(p), nil
+}
+
+func TestParallelLog(t *testing.T) {
+	files := make(map[string]string)
+	var imports []string
+	for i := 0; i < 16; i++ {
+		files[fmt.Sprintf("internal/pkg%d/pkg.go", i)] = fmt.Sprintf("package pkg%d\n\nimport \"fmt\"\n\nvar _ = fmt.Sprint\n", i)
+		imports = append(imports, fmt.Sprintf("_ \"internal/pkg%d\"", i))
+	}
+	files["internal/foo/foo.go"] = "package foo\n\nimport (\n\t" + strings.Join(imports, "\n\t") + "\n)\n"
+	src := testGoroot(t, files)
+
+	for _, format := range []string{LogText, LogJSON} {
+		t.Run(format, func(t *testing.T) {
+			var stdout byteWriter
+			c := testCopier(t, src, newMemFS(), "internal/foo")
+			c.Jobs = 8
+			c.LogLevel = LogDebug
+			c.LogFormat = format
+			c.Stdout = &stdout
+
+			if err := c.Run(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			lines := strings.Split(strings.TrimSuffix(string(stdout.data), "\n"), "\n")
+			copies := 0
+			for _, line := range lines {
+				if format == LogJSON {
+					var event logEvent
+					if err := json.Unmarshal([]byte(line), &event); err != nil {
+						t.Errorf("interleaved line %q: %v", line, err)
+					}
+					if event.Action == "copy" {
+						copies++
+					}
+					continue
+				}
+				if strings.HasPrefix(line, "copy: ") {
+					if !copyLineRe.MatchString(line) {
+						t.Errorf("interleaved line %q", line)
+					}
+					copies++
+				}
+			}
+			if copies != 17 {
+				t.Errorf("got %d copy lines, want 17:\n%s", copies, stdout.data)
+			}
+		})
+	}
+}
+
+// copyLineRe matches the line of logCopy in the text format.
+var copyLineRe = regexp.MustCompile(`^copy: /\S+\.go -> /\S+\.go \([0-9.]+[µnm]?s\)$`)
@@ -0,0 +1,263 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// DefaultManifest is the file name of the manifest the command writes in the
+// destination unless told otherwise.
+const DefaultManifest = "copystd.lock"
+
+// list of Copier.ManifestFormat values.
+const (
+	ManifestJSON = "json"
+	ManifestCSV  = "csv"
+)
+
+// list of Copier.HashAlgo values.
+const (
+	HashSHA256 = "sha256"
+	HashSHA384 = "sha384"
+	HashSHA512 = "sha512"
+)
+
+// newHash returns the hash.Hash of the algo, or nil if unknown.
+func newHash(algo string) hash.Hash {
+	switch algo {
+	case HashSHA256:
+		return sha256.New()
+	case HashSHA384:
+		return sha512.New384()
+	case HashSHA512:
+		return sha512.New()
+	}
+
+	return nil
+}
+
+// manifestEntry is the entry of a file written by the run in the manifest.
+type manifestEntry struct {
+	Path   string `json:"path"`             // destination path relative to -dst
+	Size   int    `json:"size"`             // size in bytes
+	SHA256 string `json:"sha256,omitempty"` // hex encoded SHA-256 digest of the content
+	SHA384 string `json:"sha384,omitempty"` // hex encoded SHA-384 digest of the content
+	SHA512 string `json:"sha512,omitempty"` // hex encoded SHA-512 digest of the content
+	Source string `json:"source"`           // source file path
+}
+
+// digest returns the digest of the algo.
+func (e *manifestEntry) digest(algo string) string {
+	switch algo {
+	case HashSHA384:
+		return e.SHA384
+	case HashSHA512:
+		return e.SHA512
+	}
+
+	return e.SHA256
+}
+
+// setDigest sets the digest of the algo.
+func (e *manifestEntry) setDigest(algo, sum string) {
+	switch algo {
+	case HashSHA384:
+		e.SHA384 = sum
+	case HashSHA512:
+		e.SHA512 = sum
+	default:
+		e.SHA256 = sum
+	}
+}
+
+// manifest is the JSON manifest of the copied files.
+type manifest struct {
+	GoVersion string           `json:"go_version,omitempty"` // Go version of the source tree, except with -module-source
+	Source    string           `json:"source"`               // source tree, -src-zip archive or -module-source module
+	Files     []*manifestEntry `json:"files"`
+}
+
+// manifestSource returns the source of the copy recorded by the manifest.
+func (c *Copier) manifestSource(ctx context.Context) (source, version string, err error) {
+	switch {
+	case c.ModuleSource != "":
+		return c.ModuleSource, "", nil
+	case c.SrcZip != "":
+		source = c.SrcZip
+	default:
+		source = c.Src
+	}
+	version, err = c.sourceGoVersion(ctx)
+	if err != nil {
+		return "", "", fmt.Errorf("discover source Go version: %w", err)
+	}
+
+	return source, version, nil
+}
+
+// buildManifest returns the manifest entries of the copied files under root.
+func (c *Copier) buildManifest(root string, files []*copiedFile) ([]*manifestEntry, error) {
+	entries := make([]*manifestEntry, 0, len(files))
+	for _, f := range files {
+		data, err := c.FS.ReadFile(f.Dest)
+		if err != nil {
+			return nil, fmt.Errorf("read %s file: %w", f.Dest, err)
+		}
+		rel, err := filepath.Rel(root, f.Dest)
+		if err != nil {
+			return nil, fmt.Errorf("relative path of %s: %w", f.Dest, err)
+		}
+
+		h := newHash(c.HashAlgo)
+		h.Write(data)
+		entry := &manifestEntry{
+			Path:   filepath.ToSlash(rel),
+			Size:   len(data),
+			Source: f.Source,
+		}
+		entry.setDigest(c.HashAlgo, hex.EncodeToString(h.Sum(nil)))
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// writeManifest writes the manifest to the file at path in the format. The
+// CSV format records the entries alone.
+func (c *Copier) writeManifest(path, format string, m *manifest) error {
+	entries := m.Files
+	var data []byte
+	switch format {
+	case ManifestJSON:
+		var err error
+		data, err = json.MarshalIndent(m, "", "\t")
+		if err != nil {
+			return fmt.Errorf("marshal manifest: %w", err)
+		}
+		data = append(data, '\n')
+
+	case ManifestCSV:
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		records := [][]string{{"path", "size", c.HashAlgo, "source"}}
+		for _, e := range entries {
+			records = append(records, []string{e.Path, strconv.Itoa(e.Size), e.digest(c.HashAlgo), e.Source})
+		}
+		if err := w.WriteAll(records); err != nil {
+			return fmt.Errorf("write manifest csv: %w", err)
+		}
+		data = buf.Bytes()
+
+	default:
+		return fmt.Errorf("unknown manifest format %q", format)
+	}
+
+	if _, err := c.writeIfChanged(path, data); err != nil {
+		return fmt.Errorf("write %s file: %w", path, err)
+	}
+
+	return nil
+}
+
+// readManifest reads the manifest entries of the file at path in the format.
+func (c *Copier) readManifest(path, format string) ([]*manifestEntry, error) {
+	data, err := c.FS.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read %s file: %w", path, err)
+	}
+
+	var entries []*manifestEntry
+	switch format {
+	case ManifestJSON:
+		var m manifest
+		if err := json.Unmarshal(data, &m); err != nil {
+			return nil, fmt.Errorf("decode %s: %w", path, err)
+		}
+		entries = m.Files
+
+	case ManifestCSV:
+		records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("decode %s: %w", path, err)
+		}
+		if len(records) == 0 || len(records[0]) != 4 || newHash(records[0][2]) == nil {
+			return nil, fmt.Errorf("decode %s: invalid header", path)
+		}
+		algo := records[0][2]
+		for _, record := range records[1:] {
+			size, err := strconv.Atoi(record[1])
+			if err != nil {
+				return nil, fmt.Errorf("decode %s: invalid size of %s: %w", path, record[0], err)
+			}
+			entry := &manifestEntry{Path: record[0], Size: size, Source: record[3]}
+			entry.setDigest(algo, record[2])
+			entries = append(entries, entry)
+		}
+
+	default:
+		return nil, fmt.Errorf("unknown manifest format %q", format)
+	}
+
+	return entries, nil
+}
+
+// reportManifestChanges reports the entries which are new, changed or removed
+// since the previous manifest at path, if any. The entries without the digest
+// of HashAlgo are compared by the size.
+func (c *Copier) reportManifestChanges(path, format string, entries []*manifestEntry) {
+	prev, err := c.readManifest(path, format)
+	if errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		c.warnf("skip the changes since the previous manifest: %v", err)
+		return
+	}
+
+	recorded := make(map[string]*manifestEntry, len(prev))
+	for _, e := range prev {
+		recorded[e.Path] = e
+	}
+
+	var added, changed, removed []string
+	for _, e := range entries {
+		old, ok := recorded[e.Path]
+		delete(recorded, e.Path)
+		switch {
+		case !ok:
+			added = append(added, e.Path)
+		case old.digest(c.HashAlgo) == "" && old.Size != e.Size,
+			old.digest(c.HashAlgo) != "" && old.digest(c.HashAlgo) != e.digest(c.HashAlgo):
+			changed = append(changed, e.Path)
+		}
+	}
+	for p := range recorded {
+		removed = append(removed, p)
+	}
+
+	for _, list := range [...]struct {
+		state string
+		paths []string
+	}{{"new", added}, {"changed", changed}, {"removed", removed}} {
+		sort.Strings(list.paths)
+		for _, p := range list.paths {
+			c.infof("manifest: %s %s", list.state, p)
+		}
+	}
+	c.infof("manifest: %d new, %d changed, %d removed since the previous manifest", len(added), len(changed), len(removed))
+}
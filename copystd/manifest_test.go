@@ -0,0 +1,95 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestManifestCSV(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go": "package foo\n\nimport \"internal/bar\"\n\nfunc Foo() int { return bar.Bar }\n",
+		"internal/bar/bar.go": "package bar\n\nconst Bar = 1\n",
+	})
+	fsys := newMemFS()
+	c := testCopier(t, src, fsys, "internal/foo")
+	c.Manifest = filepath.Join(t.TempDir(), "manifest.csv")
+	c.ManifestFormat = ManifestCSV
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	data, ok := fsys.file(c.Manifest)
+	if !ok {
+		t.Fatal("the manifest is not written")
+	}
+	records, err := csv.NewReader(strings.NewReader(data)).ReadAll()
+	if err != nil {
+		t.Fatalf("invalid CSV manifest: %v\n%s", err, data)
+	}
+
+	want := [][]string{{"path", "size", "sha256", "source"}}
+	for _, name := range fsys.paths(c.Dst) {
+		body, _ := fsys.file(filepath.Join(c.Dst, filepath.FromSlash(name)))
+		sum := sha256.Sum256([]byte(body))
+		source := filepath.Join(src, "src", "internal", filepath.FromSlash(name))
+		want = append(want, []string{name, strconv.Itoa(len(body)), hex.EncodeToString(sum[:]), source})
+	}
+	if len(want) != 3 {
+		t.Fatalf("copied files: %q", fsys.paths(c.Dst))
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("got manifest\n%q\nwant\n%q", records, want)
+	}
+}
+
+func TestManifestHashAlgo(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go": "package foo\n\nimport \"internal/bar\"\n\nfunc Foo() int { return bar.Bar }\n",
+		"internal/bar/bar.go": "package bar\n\nconst Bar = 1\n",
+	})
+	fsys := newMemFS()
+	c := testCopier(t, src, fsys, "internal/foo")
+	c.Manifest = filepath.Join(t.TempDir(), "manifest.json")
+	c.HashAlgo = HashSHA512
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	data, ok := fsys.file(c.Manifest)
+	if !ok {
+		t.Fatal("the manifest is not written")
+	}
+	var m manifest
+	if err := json.Unmarshal([]byte(data), &m); err != nil {
+		t.Fatalf("invalid JSON manifest: %v\n%s", err, data)
+	}
+	if len(m.Files) != 2 {
+		t.Fatalf("got %d entries, want 2\n%s", len(m.Files), data)
+	}
+	for _, e := range m.Files {
+		if e.SHA256 != "" || e.SHA384 != "" {
+			t.Errorf("%s has the digests of the other algorithms", e.Path)
+		}
+		if len(e.SHA512) != 128 {
+			t.Errorf("%s: got %d hex chars, want 128", e.Path, len(e.SHA512))
+		}
+		body, _ := fsys.file(filepath.Join(c.Dst, filepath.FromSlash(e.Path)))
+		if sum := sha512.Sum512([]byte(body)); e.SHA512 != hex.EncodeToString(sum[:]) {
+			t.Errorf("%s: got sha512 %s, want %x", e.Path, e.SHA512, sum)
+		}
+	}
+}
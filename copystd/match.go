@@ -0,0 +1,48 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import "strings"
+
+// matchPattern reports whether the import path matches the pattern.
+//
+// The pattern is either an exact import path or an import path followed by
+// "/..." which matches the path itself and any path under it.
+func matchPattern(pattern, path string) bool {
+	if prefix := strings.TrimSuffix(pattern, "/..."); prefix != pattern {
+		return path == prefix || strings.HasPrefix(path, prefix+"/")
+	}
+
+	return path == pattern
+}
+
+// matchAny reports whether the import path matches any of the patterns.
+func matchAny(patterns []string, path string) bool {
+	for _, pattern := range patterns {
+		if matchPattern(pattern, path) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isStdImport reports whether the import path is a standard library package,
+// that is, the first path element has no dot.
+func isStdImport(path string) bool {
+	return !strings.Contains(strings.SplitN(path, "/", 2)[0], ".")
+}
+
+// isMetaPackage reports whether the import path is the name of a go list
+// meta-package pattern such as "cmd", which denotes a set of packages rather
+// than a package, so that a bare import of it is neither resolved as the
+// pattern nor rewritten into the module root.
+func isMetaPackage(path string) bool {
+	switch path {
+	case "all", "cmd", "std", "tool", "work":
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,97 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// moduleWorkGoMod is the go.mod of the temporary module in which go list
+// resolves the packages of -module-source.
+const moduleWorkGoMod = "module go-copystd.local/work\n\ngo 1.17\n"
+
+// prepareModuleSource creates the temporary module requiring the module of
+// -module-source in path@version form, and returns the module resolved from
+// the module cache along with the directory of the temporary module.
+//
+// The caller removes the directory after the run.
+func (c *Copier) prepareModuleSource(ctx context.Context, source string) (mod *Module, dir string, err error) {
+	modPath, version, ok := strings.Cut(source, "@")
+	if !ok || modPath == "" || version == "" {
+		return nil, "", fmt.Errorf("invalid -module-source %q: must be path@version form", source)
+	}
+
+	dir, err = os.MkdirTemp("", "go-copystd-mod-")
+	if err != nil {
+		return nil, "", fmt.Errorf("create temp module: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			os.RemoveAll(dir)
+		}
+	}()
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte(moduleWorkGoMod), 0o644); err != nil {
+		return nil, "", fmt.Errorf("write temp go.mod: %w", err)
+	}
+
+	if _, err := c.goModCommand(ctx, dir, "get", "-d", modPath+"@"+version); err != nil {
+		return nil, "", err
+	}
+	out, err := c.goModCommand(ctx, dir, "list", "-m", "-json", modPath)
+	if err != nil {
+		return nil, "", err
+	}
+	mod = new(Module)
+	if err := json.Unmarshal(out, mod); err != nil {
+		return nil, "", fmt.Errorf("decode module: %w", err)
+	}
+	if mod.Error != nil {
+		return nil, "", fmt.Errorf("resolve %s: %s", source, mod.Error.Err)
+	}
+	if mod.Dir == "" {
+		return nil, "", fmt.Errorf("resolve %s: no module directory", source)
+	}
+
+	return mod, dir, nil
+}
+
+// goModCommand runs the go command with args in the temporary module dir and
+// returns the output.
+func (c *Copier) goModCommand(ctx context.Context, dir string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "go", args...)
+	cmd.Env = append(os.Environ(), "PWD="+dir, "GOFLAGS=-mod=mod")
+	cmd.Env = append(cmd.Env, c.Env...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("go %s: %w\n%s", strings.Join(args, " "), err, stderr.Bytes())
+	}
+
+	return out, nil
+}
+
+// isModuleInternal reports whether the import path is a package of the
+// -module-source module under an internal directory, which is copied.
+func (c *Copier) isModuleInternal(importPath string) bool {
+	rest := strings.TrimPrefix(importPath, c.srcModule+"/")
+	if rest == importPath {
+		return false
+	}
+	for _, elem := range strings.Split(rest, "/") {
+		if elem == "internal" {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,98 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testModuleProxy serves the versions of the module modPath, each of which
+// has the files keyed by the slash separated path relative to the module
+// root, by a file:// GOPROXY with an empty module cache for the test.
+func testModuleProxy(t *testing.T, modPath string, versions map[string]map[string]string) {
+	t.Helper()
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command not found")
+	}
+
+	proxy := filepath.Join(t.TempDir(), filepath.FromSlash(modPath), "@v")
+	if err := os.MkdirAll(proxy, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	var list []string
+	for version, files := range versions {
+		list = append(list, version)
+		gomod := "module " + modPath + "\n\ngo 1.17\n"
+		zipFiles := map[string]string{modPath + "@" + version + "/go.mod": gomod}
+		for name, data := range files {
+			zipFiles[modPath+"@"+version+"/"+name] = data
+		}
+		for name, data := range map[string]string{
+			version + ".mod":  gomod,
+			version + ".info": `{"Version":"` + version + `"}`,
+		} {
+			if err := os.WriteFile(filepath.Join(proxy, name), []byte(data), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := os.Rename(testZip(t, zipFiles), filepath.Join(proxy, version+".zip")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(proxy, "list"), []byte(strings.Join(list, "\n")+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the directories of the module cache are read-only, which TempDir
+	// cannot remove
+	modCache := t.TempDir()
+	t.Cleanup(func() {
+		filepath.WalkDir(modCache, func(path string, d fs.DirEntry, err error) error {
+			if err == nil && d.IsDir() {
+				os.Chmod(path, 0o755)
+			}
+			return nil
+		})
+	})
+	t.Setenv("GOMODCACHE", modCache)
+	t.Setenv("GOPROXY", "file://"+filepath.ToSlash(strings.TrimSuffix(proxy, filepath.FromSlash("/"+modPath+"/@v"))))
+	t.Setenv("GOSUMDB", "off")
+	t.Setenv("GOFLAGS", "")
+}
+
+func TestModuleSource(t *testing.T) {
+	testModuleProxy(t, "example.org/lib", map[string]map[string]string{
+		"v1.0.0": {
+			"lib.go":              "package lib\n",
+			"internal/foo/foo.go": "package foo\n\nimport \"example.org/lib/internal/bar\"\n\nconst Foo = bar.Bar\n",
+			"internal/bar/bar.go": "package bar\n\nconst Bar = 1\n",
+		},
+		"v1.1.0": {
+			"lib.go":              "package lib\n",
+			"internal/foo/foo.go": "package foo\n\nconst Foo = 2\n",
+		},
+	})
+	fsys := newMemFS()
+	c := testCopier(t, "", fsys, "example.org/lib/internal/foo")
+	c.ModuleSource = "example.org/lib@v1.0.0"
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// resolved from the pinned version, which has bar
+	if got, want := fsys.paths(c.Dst), []string{"bar/bar.go", "foo/foo.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("copied files: got %q, want %q", got, want)
+	}
+	foo, _ := fsys.file(filepath.Join(c.Dst, "foo", "foo.go"))
+	if want := "package foo\n\nimport \"example.com/m/bar\"\n\nconst Foo = bar.Bar\n"; foo != want {
+		t.Errorf("got foo.go\n%s\nwant\n%s", foo, want)
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// findOrphans returns the Go files under root which were not written by the
+// run, such as the leftovers of the previous runs or the manual additions.
+func (c *Copier) findOrphans(root string) ([]string, error) {
+	var orphans []string
+	if err := c.walkGoFiles(root, func(path string) {
+		abs, err := filepath.Abs(path)
+		if err != nil || !c.writtenFiles[abs] {
+			orphans = append(orphans, path)
+		}
+	}); err != nil {
+		if errors.Is(err, fs.ErrNotExist) && c.DryRun {
+			// root is not created by the dry run
+			return nil, nil
+		}
+		return nil, err
+	}
+	sort.Strings(orphans)
+
+	return orphans, nil
+}
+
+// walkGoFiles calls fn with the path of each Go file under dir.
+func (c *Copier) walkGoFiles(dir string, fn func(path string)) error {
+	entries, err := c.FS.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("read %s dir: %w", dir, err)
+	}
+
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		switch {
+		case entry.IsDir():
+			if err := c.walkGoFiles(path, fn); err != nil {
+				return err
+			}
+		case strings.HasSuffix(entry.Name(), ".go"):
+			fn(path)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,57 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestOrphans(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go": "package foo\n\nimport \"internal/bar\"\n\nfunc Foo() int { return bar.Bar }\n",
+		"internal/bar/bar.go": "package bar\n\nconst Bar = 1\n",
+	})
+	fsys := newMemFS()
+	c := testCopier(t, src, fsys, "internal/foo")
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// the stray files, along with the files left unchanged by the next run
+	for name, data := range map[string]string{
+		"foo/stray.go": "package foo\n",
+		"old/old.go":   "package old\n",
+		"old/README":   "not a Go file\n",
+	} {
+		filename := filepath.Join(c.Dst, filepath.FromSlash(name))
+		if err := fsys.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := fsys.WriteFile(filename, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.Orphans = true
+	var stdout bytes.Buffer
+	c.Stdout = &stdout
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	var orphans []string
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		if orphan := strings.TrimPrefix(line, "orphan: "); orphan != line {
+			orphans = append(orphans, orphan)
+		}
+	}
+	want := []string{filepath.Join(c.Dst, "foo", "stray.go"), filepath.Join(c.Dst, "old", "old.go")}
+	if !reflect.DeepEqual(orphans, want) {
+		t.Errorf("got orphans %q, want %q", orphans, want)
+	}
+}
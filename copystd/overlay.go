@@ -0,0 +1,45 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+)
+
+// overlay is the JSON of the go build -overlay flag.
+type overlay struct {
+	Replace map[string]string
+}
+
+// writeOverlay writes the go build -overlay JSON replacing the source file of
+// each of the copied files with the written file to the file at path. The
+// paths are absolute so that the overlay is usable from any directory.
+func (c *Copier) writeOverlay(path string, files []*copiedFile) error {
+	o := overlay{Replace: make(map[string]string, len(files))}
+	for _, f := range files {
+		src, err := filepath.Abs(f.Source)
+		if err != nil {
+			return fmt.Errorf("absolute path of %s: %w", f.Source, err)
+		}
+		dst, err := filepath.Abs(f.Dest)
+		if err != nil {
+			return fmt.Errorf("absolute path of %s: %w", f.Dest, err)
+		}
+		o.Replace[src] = dst
+	}
+
+	data, err := json.MarshalIndent(o, "", "\t")
+	if err != nil {
+		return fmt.Errorf("marshal overlay: %w", err)
+	}
+	data = append(data, '\n')
+
+	if _, err := c.writeIfChanged(path, data); err != nil {
+		return fmt.Errorf("write %s file: %w", path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,43 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestOverlay(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go": "package foo\n\nimport \"internal/bar\"\n\nfunc Foo() int { return bar.Bar }\n",
+		"internal/bar/bar.go": "package bar\n\nconst Bar = 1\n",
+		"internal/bar/bar.s":  "",
+	})
+	fsys := newMemFS()
+	c := testCopier(t, src, fsys, "internal/foo")
+	c.Overlay = filepath.Join(filepath.Dir(c.Dst), "overlay.json")
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	data, ok := fsys.file(c.Overlay)
+	if !ok {
+		t.Fatal("overlay is not written")
+	}
+	var got overlay
+	if err := json.Unmarshal([]byte(data), &got); err != nil {
+		t.Fatalf("invalid overlay %s: %v", data, err)
+	}
+	want := make(map[string]string)
+	for _, name := range []string{"foo/foo.go", "bar/bar.go", "bar/bar.s"} {
+		want[filepath.Join(src, "src", "internal", filepath.FromSlash(name))] = filepath.Join(c.Dst, filepath.FromSlash(name))
+	}
+	if !reflect.DeepEqual(got.Replace, want) {
+		t.Errorf("got overlay %q, want %q", got.Replace, want)
+	}
+}
@@ -0,0 +1,289 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// patchContext is the number of the context lines of a hunk.
+const patchContext = 3
+
+// patchFile is a destination file a copy would change.
+type patchFile struct {
+	path     string
+	old, new []byte
+	created  bool
+	deleted  bool
+}
+
+// Patch writes the changes a copy of the packages, or of Packages if nil,
+// would make to the existing Dst as a unified diff to w, without writing
+// anything. The paths are relative to Dst with the a/ and b/ prefixes, so the
+// diff applies with git apply --directory=<Dst>, deleting the Go files left in
+// the directories of the copied packages which are no longer copied as Check
+// reports them removed. It reports whether any file would change. The
+// messages are printed to Stderr instead of Stdout, which w usually is.
+//
+// The steps skipped by DryRun, such as Manifest and Tidy, are skipped as well.
+func (c *Copier) Patch(ctx context.Context, w io.Writer, packages []string) (changed bool, err error) {
+	r := *c
+	if packages != nil {
+		r.Packages = packages
+	}
+	if r.Stderr == nil {
+		r.Stderr = os.Stderr
+	}
+	r.Stdout = r.Stderr
+	files, err := r.recordChanges(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	for _, f := range files {
+		if err := r.writePatch(w, f); err != nil {
+			return false, fmt.Errorf("write patch of %s: %w", f.path, err)
+		}
+	}
+
+	return len(files) > 0, nil
+}
+
+// writePatch writes the git style diff of the file f to w. A binary file,
+// having a NUL byte in the first 8000 bytes as git detects, is only listed.
+func (c *Copier) writePatch(w io.Writer, f *patchFile) error {
+	name := filepath.ToSlash(f.path)
+	if rel, err := filepath.Rel(c.Dst, f.path); err == nil && !strings.HasPrefix(rel, "..") {
+		name = filepath.ToSlash(rel)
+	}
+	oldName, newName := "a/"+name, "b/"+name
+	if f.created {
+		oldName = "/dev/null"
+	}
+	if f.deleted {
+		newName = "/dev/null"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "diff --git a/%s b/%s\n", name, name)
+	switch {
+	case f.created:
+		b.WriteString("new file mode 100644\n")
+	case f.deleted:
+		b.WriteString("deleted file mode 100644\n")
+	}
+	if isBinary(f.old) || isBinary(f.new) {
+		fmt.Fprintf(&b, "Binary files %s and %s differ\n", oldName, newName)
+		_, err := io.WriteString(w, b.String())
+		return err
+	}
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", oldName, newName)
+	writeHunks(&b, diffLines(splitLines(f.old), splitLines(f.new)))
+	_, err := io.WriteString(w, b.String())
+
+	return err
+}
+
+// isBinary reports whether data has a NUL byte in the first 8000 bytes.
+func isBinary(data []byte) bool {
+	if len(data) > 8000 {
+		data = data[:8000]
+	}
+
+	return bytes.IndexByte(data, 0) >= 0
+}
+
+// splitLines splits data into the lines including the newlines. The last line
+// has no newline if data does not end with one.
+func splitLines(data []byte) []string {
+	if len(data) == 0 {
+		return nil
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	return lines
+}
+
+// diffOp is a line of an edit script: kept (' '), deleted ('-') or inserted
+// ('+').
+type diffOp struct {
+	kind byte
+	line string
+}
+
+// diffLines returns the shortest edit script from a to b.
+func diffLines(a, b []string) []diffOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var ops []diffOp
+	for _, line := range a[:prefix] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	ops = append(ops, myersDiff(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{' ', line})
+	}
+
+	return ops
+}
+
+// myersDiff returns the shortest edit script from a to b by the Myers
+// algorithm.
+func myersDiff(a, b []string) []diffOp {
+	if len(a) == 0 || len(b) == 0 {
+		var ops []diffOp
+		for _, line := range a {
+			ops = append(ops, diffOp{'-', line})
+		}
+		for _, line := range b {
+			ops = append(ops, diffOp{'+', line})
+		}
+		return ops
+	}
+
+	n, m := len(a), len(b)
+	off := n + m
+	v := make([]int, 2*off+2)
+	var trace [][]int
+	for d := 0; d <= off; d++ {
+		trace = append(trace, append([]int(nil), v...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[off+k-1] < v[off+k+1]) {
+				x = v[off+k+1]
+			} else {
+				x = v[off+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[off+k] = x
+			if x >= n && y >= m {
+				return backtrack(a, b, trace, off)
+			}
+		}
+	}
+
+	return nil
+}
+
+// backtrack returns the edit script of the trace of myersDiff, the state of
+// each step before it is taken.
+func backtrack(a, b []string, trace [][]int, off int) []diffOp {
+	var ops []diffOp
+	x, y := len(a), len(b)
+	for d := len(trace) - 1; d > 0; d-- {
+		v := trace[d]
+		k := x - y
+		prevK := k - 1
+		if k == -d || (k != d && v[off+k-1] < v[off+k+1]) {
+			prevK = k + 1
+		}
+		prevX := v[off+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			ops = append(ops, diffOp{' ', a[x-1]})
+			x--
+			y--
+		}
+		if x == prevX {
+			ops = append(ops, diffOp{'+', b[y-1]})
+		} else {
+			ops = append(ops, diffOp{'-', a[x-1]})
+		}
+		x, y = prevX, prevY
+	}
+	for x > 0 && y > 0 {
+		ops = append(ops, diffOp{' ', a[x-1]})
+		x--
+		y--
+	}
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+
+	return ops
+}
+
+// writeHunks writes the hunks of the edit script ops with patchContext lines
+// of context to b.
+func writeHunks(b *strings.Builder, ops []diffOp) {
+	// the 0-based lines of a and b before each op
+	aPos, bPos := make([]int, len(ops)+1), make([]int, len(ops)+1)
+	for i, op := range ops {
+		aPos[i+1], bPos[i+1] = aPos[i], bPos[i]
+		if op.kind != '+' {
+			aPos[i+1]++
+		}
+		if op.kind != '-' {
+			bPos[i+1]++
+		}
+	}
+
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+		start := i - patchContext
+		if start < 0 {
+			start = 0
+		}
+		// extend the hunk over the changes separated by up to twice the
+		// context lines
+		end, kept := i, 0
+		for j := i; j < len(ops) && kept <= 2*patchContext; j++ {
+			if ops[j].kind == ' ' {
+				kept++
+				continue
+			}
+			end, kept = j+1, 0
+		}
+		last := end + patchContext
+		if last > len(ops) {
+			last = len(ops)
+		}
+
+		fmt.Fprintf(b, "@@ -%s +%s @@\n", hunkRange(aPos[start], aPos[last]-aPos[start]), hunkRange(bPos[start], bPos[last]-bPos[start]))
+		for _, op := range ops[start:last] {
+			b.WriteByte(op.kind)
+			b.WriteString(op.line)
+			if !strings.HasSuffix(op.line, "\n") {
+				b.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		i = last
+	}
+}
+
+// hunkRange returns the range of the hunk header of the lines from the 0-based
+// start.
+func hunkRange(start, n int) string {
+	switch n {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return fmt.Sprint(start + 1)
+	default:
+		return fmt.Sprintf("%d,%d", start+1, n)
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPatch(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go": "package foo\n\nimport \"internal/bar\"\n\nfunc Foo() int { return bar.Bar }\n",
+		"internal/bar/bar.go": "package bar\n\nconst Bar = 1\n",
+		"internal/bar/old.go": "package bar\n\nconst Old = 1\n",
+	})
+	fsys := newMemFS()
+	c := testCopier(t, src, fsys, "internal/foo")
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	var patch strings.Builder
+	if changed, err := c.Patch(context.Background(), &patch, nil); err != nil || changed || patch.Len() > 0 {
+		t.Fatalf("up to date: got changed %t, error %v and patch\n%s", changed, err, &patch)
+	}
+
+	// bar is changed, old.go is removed and new.go is added upstream
+	dir := filepath.Join(src, "src", "internal", "bar")
+	if err := os.WriteFile(filepath.Join(dir, "bar.go"), []byte("package bar\n\nconst Bar = 2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, "old.go")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "new.go"), []byte("package bar\n\nconst New = 1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	patch.Reset()
+	changed, err := c.Patch(context.Background(), &patch, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `diff --git a/bar/bar.go b/bar/bar.go
+--- a/bar/bar.go
++++ b/bar/bar.go
+@@ -1,3 +1,3 @@
+ package bar
+ 
+-const Bar = 1
++const Bar = 2
+diff --git a/bar/new.go b/bar/new.go
+new file mode 100644
+--- /dev/null
++++ b/bar/new.go
+@@ -0,0 +1,3 @@
++package bar
++
++const New = 1
+diff --git a/bar/old.go b/bar/old.go
+deleted file mode 100644
+--- a/bar/old.go
++++ /dev/null
+@@ -1,3 +0,0 @@
+-package bar
+-
+-const Old = 1
+`
+	if !changed || patch.String() != want {
+		t.Errorf("got changed %t and patch\n%s\nwant\n%s", changed, &patch, want)
+	}
+	if paths := fsys.paths(c.Dst); len(paths) != 3 {
+		t.Errorf("files are written: %q", paths)
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// maxElemLen is the maximum length of a path element in bytes on the
+// supported file systems.
+const maxElemLen = 255
+
+// maxPathLen returns the maximum length of a path in bytes on goos.
+func maxPathLen(goos string) int {
+	switch goos {
+	case "windows":
+		return 260 // MAX_PATH
+	case "linux", "android":
+		return 4096 // PATH_MAX
+	}
+
+	return 1024
+}
+
+// checkPathLen reports an error if the destination file path exceeds the path
+// length limits of the host OS, and returns the path to write.
+//
+// On Windows the path longer than MAX_PATH is made absolute, which the os
+// package writes with the \\?\ extended-length prefix.
+func checkPathLen(filename string) (string, error) {
+	for _, elem := range strings.Split(filepath.ToSlash(filename), "/") {
+		if len(elem) > maxElemLen {
+			return "", fmt.Errorf("destination path %s has the element %s longer than %d bytes", filename, elem, maxElemLen)
+		}
+	}
+
+	limit := maxPathLen(runtime.GOOS)
+	if len(filename) < limit {
+		return filename, nil
+	}
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return "", fmt.Errorf("absolute path of %s: %w", filename, err)
+	}
+	if runtime.GOOS == "windows" {
+		return abs, nil
+	}
+	if len(abs) >= limit {
+		return "", fmt.Errorf("destination path %s is %d bytes, longer than the %d bytes limit of %s; shorten -dst or the package paths with -rewrite", abs, len(abs), limit-1, runtime.GOOS)
+	}
+
+	return filename, nil
+}
@@ -0,0 +1,71 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"context"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestLongPath(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the long paths are written with the extended-length prefix on windows")
+	}
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go": "package foo\n",
+	})
+
+	tests := []struct {
+		name    string
+		dst     func(root string) string
+		wantErr string
+	}{
+		{
+			name: "path",
+			dst: func(root string) string {
+				elems := []string{root}
+				for n := len(root); n < maxPathLen(runtime.GOOS); n += 201 {
+					elems = append(elems, strings.Repeat("d", 200))
+				}
+				return filepath.Join(elems...)
+			},
+			wantErr: "bytes limit of " + runtime.GOOS + "; shorten -dst or the package paths with -rewrite",
+		},
+		{
+			name: "element",
+			dst: func(root string) string {
+				return filepath.Join(root, strings.Repeat("d", maxElemLen+1))
+			},
+			wantErr: "longer than 255 bytes",
+		},
+		{
+			name: "short",
+			dst:  func(root string) string { return filepath.Join(root, strings.Repeat("d", 200)) },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys := newMemFS()
+			c := testCopier(t, src, fsys, "internal/foo")
+			c.Dst = tt.dst(t.TempDir())
+
+			err := c.Run(context.Background())
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got error %v, want %q", err, tt.wantErr)
+			}
+			if paths := fsys.paths(c.Dst); len(paths) > 0 {
+				t.Errorf("files are written: %q", paths)
+			}
+		})
+	}
+}
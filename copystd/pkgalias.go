@@ -0,0 +1,60 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// packageAliases returns the recommended import aliases of the copied
+// packages keyed by the rewritten import path. A package whose name is not
+// shared with the other copied packages is aliased by its name, and the ones
+// sharing a name are aliased by prefixing their parent path element.
+func (c *Copier) packageAliases() map[string]string {
+	importPaths := make([]string, 0, len(c.copiedPackages))
+	for importPath := range c.copiedPackages {
+		importPaths = append(importPaths, importPath)
+	}
+	sort.Strings(importPaths)
+
+	byName := make(map[string][]string)
+	used := make(map[string]bool)
+	for _, importPath := range importPaths {
+		name := c.importedName(importPath)
+		byName[name] = append(byName[name], importPath)
+		used[name] = true
+	}
+
+	aliases := make(map[string]string, len(importPaths))
+	for _, importPath := range importPaths {
+		name := c.importedName(importPath)
+		if len(byName[name]) == 1 {
+			aliases[importPath] = name
+			continue
+		}
+		alias := uniqueAlias(importPath, name, used)
+		used[alias] = true
+		aliases[importPath] = alias
+	}
+
+	return aliases
+}
+
+// writePackageAliases writes the recommended import aliases of the copied
+// packages to the JSON file at path.
+func (c *Copier) writePackageAliases(path string) error {
+	data, err := json.MarshalIndent(c.packageAliases(), "", "\t")
+	if err != nil {
+		return fmt.Errorf("marshal package aliases: %w", err)
+	}
+	data = append(data, '\n')
+
+	if _, err := c.writeIfChanged(path, data); err != nil {
+		return fmt.Errorf("write %s file: %w", path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,46 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPackageAlias(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go":   "package foo\n\nimport (\n\t\"internal/x/sys\"\n\t\"internal/xsys\"\n\tysys \"internal/y/sys\"\n)\n\nvar _, _, _ = sys.X, xsys.X, ysys.Y\n",
+		"internal/xsys/xsys.go": "package xsys\n\nconst X = 1\n",
+		"internal/x/sys/sys.go": "package sys\n\nconst X = 1\n",
+		"internal/y/sys/sys.go": "package sys\n\nconst Y = 1\n",
+	})
+	fsys := newMemFS()
+	c := testCopier(t, src, fsys, "internal/foo")
+	c.PackageAlias = filepath.Join(t.TempDir(), "aliases.json")
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	data, ok := fsys.file(c.PackageAlias)
+	if !ok {
+		t.Fatal("the aliases are not written")
+	}
+	var aliases map[string]string
+	if err := json.Unmarshal([]byte(data), &aliases); err != nil {
+		t.Fatalf("invalid JSON aliases: %v\n%s", err, data)
+	}
+	want := map[string]string{
+		"example.com/m/foo":   "foo",
+		"example.com/m/x/sys": "xsys2", // xsys is taken
+		"example.com/m/xsys":  "xsys",
+		"example.com/m/y/sys": "ysys",
+	}
+	if !reflect.DeepEqual(aliases, want) {
+		t.Errorf("got aliases %v, want %v", aliases, want)
+	}
+}
@@ -0,0 +1,204 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// parsePlatform parses the platform in goos/goarch form.
+func parsePlatform(platform string) (goos, goarch string, err error) {
+	goos, goarch, ok := strings.Cut(platform, "/")
+	if !ok || goos == "" || goarch == "" || strings.Contains(goarch, "/") {
+		return "", "", fmt.Errorf("invalid platform %q: must be GOOS/GOARCH form", platform)
+	}
+
+	return goos, goarch, nil
+}
+
+// platformMatrix returns the platforms of the cross product of goos and
+// goarch. The host GOOS or GOARCH is used for the empty one.
+func platformMatrix(goos, goarch []string) []string {
+	if len(goos) == 0 && len(goarch) == 0 {
+		return nil
+	}
+	if len(goos) == 0 {
+		goos = []string{runtime.GOOS}
+	}
+	if len(goarch) == 0 {
+		goarch = []string{runtime.GOARCH}
+	}
+
+	var platforms []string
+	for _, system := range goos {
+		for _, arch := range goarch {
+			platforms = append(platforms, system+"/"+arch)
+		}
+	}
+
+	return platforms
+}
+
+// listPlatforms lists the root package and its dependencies for each of the
+// Platforms and returns the union of them, so that the copy builds on all of
+// the platforms. visited is keyed by the platform and shared by the roots of
+// the run.
+func (c *Copier) listPlatforms(ctx context.Context, root string, visited map[string]map[string]bool) ([]*Package, error) {
+	defer func() { c.platformEnv = nil }()
+
+	var union []*Package
+	var empty []string // platforms root resolves to no package for
+	byPath := make(map[string]*Package)
+	for _, platform := range c.Platforms {
+		goos, goarch, err := parsePlatform(platform)
+		if err != nil {
+			return nil, err
+		}
+		if visited[platform] == nil {
+			visited[platform] = make(map[string]bool)
+		}
+
+		// appended after Env so that the platform wins over a GOOS or GOARCH of Env
+		c.platformEnv = []string{"GOOS=" + goos, "GOARCH=" + goarch}
+		pkgs, err := c.listRoot(ctx, root, visited[platform])
+		var emptyErr *emptyResolutionError
+		if errors.As(err, &emptyErr) {
+			// built on the other platforms
+			c.infof("skip: %s %v", root, err)
+			empty = append(empty, platform)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("list %s: %w", platform, err)
+		}
+
+		for _, pkg := range pkgs {
+			c.platforms.add(platform, pkg)
+			if p, ok := byPath[pkg.ImportPath]; ok {
+				mergePackage(p, pkg)
+				continue
+			}
+			byPath[pkg.ImportPath] = pkg
+			union = append(union, pkg)
+		}
+	}
+	if len(empty) == len(c.Platforms) {
+		return nil, fmt.Errorf("resolves to no buildable package for any of the platforms %s", strings.Join(empty, " "))
+	}
+
+	return union, nil
+}
+
+// mergePackage merges the files and the imports of src, the same package
+// listed for another platform, into dst.
+//
+// A file built on any of the platforms is no longer ignored.
+func mergePackage(dst, src *Package) {
+	dst.GoFiles = union(dst.GoFiles, src.GoFiles)
+	dst.CgoFiles = union(dst.CgoFiles, src.CgoFiles)
+	dst.TestGoFiles = union(dst.TestGoFiles, src.TestGoFiles)
+	dst.XTestGoFiles = union(dst.XTestGoFiles, src.XTestGoFiles)
+	dst.SFiles = union(dst.SFiles, src.SFiles)
+	dst.HFiles = union(dst.HFiles, src.HFiles)
+	dst.CFiles = union(dst.CFiles, src.CFiles)
+	dst.EmbedFiles = union(dst.EmbedFiles, src.EmbedFiles)
+	dst.TestEmbedFiles = union(dst.TestEmbedFiles, src.TestEmbedFiles)
+	dst.XTestEmbedFiles = union(dst.XTestEmbedFiles, src.XTestEmbedFiles)
+	dst.Imports = union(dst.Imports, src.Imports)
+	dst.Deps = union(dst.Deps, src.Deps)
+
+	var ignored []string
+	for _, name := range union(dst.IgnoredGoFiles, src.IgnoredGoFiles) {
+		if !contains(dst.GoFiles, name) && !contains(dst.CgoFiles, name) &&
+			!contains(dst.TestGoFiles, name) && !contains(dst.XTestGoFiles, name) {
+			ignored = append(ignored, name)
+		}
+	}
+	dst.IgnoredGoFiles = ignored
+}
+
+// union returns list with the elements of other not in list appended.
+func union(list, other []string) []string {
+	for _, s := range other {
+		if !contains(list, s) {
+			list = append(list, s)
+		}
+	}
+
+	return list
+}
+
+// platformReport records the platforms building each file of the copied
+// packages, keyed by the import path and the file name.
+type platformReport map[string]map[string][]string
+
+// add records the files of pkg built on the platform.
+func (r platformReport) add(platform string, pkg *Package) {
+	files, ok := r[pkg.ImportPath]
+	if !ok {
+		files = make(map[string][]string)
+		r[pkg.ImportPath] = files
+	}
+
+	for _, names := range [...][]string{
+		pkg.GoFiles, pkg.CgoFiles, pkg.TestGoFiles, pkg.XTestGoFiles,
+		pkg.SFiles, pkg.HFiles, pkg.CFiles,
+	} {
+		for _, name := range names {
+			files[name] = append(files[name], platform)
+		}
+	}
+}
+
+// print prints the platforms of each file to w.
+func (r platformReport) print(w io.Writer) {
+	paths := make([]string, 0, len(r))
+	for path := range r {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		fmt.Fprintln(w, path)
+		files := r[path]
+		names := make([]string, 0, len(files))
+		for name := range files {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(w, "\t%s: %s\n", name, strings.Join(files[name], " "))
+		}
+	}
+}
+
+// emptyResolutionError is the error of the package pattern which resolves to
+// no package buildable for the platform go list is run with, such as a
+// Windows only package listed for GOOS=linux.
+type emptyResolutionError struct {
+	GOOS   string
+	GOARCH string
+}
+
+func (e *emptyResolutionError) Error() string {
+	return fmt.Sprintf("resolves to no buildable package for GOOS=%s GOARCH=%s", e.GOOS, e.GOARCH)
+}
+
+// hasBuildable reports whether any of pkgs has a Go file built for the
+// platform it is listed for.
+func hasBuildable(pkgs []*Package) bool {
+	for _, pkg := range pkgs {
+		if len(pkg.GoFiles) > 0 || len(pkg.CgoFiles) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
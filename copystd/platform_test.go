@@ -0,0 +1,97 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPlatforms(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go":         "package foo\n\nfunc Foo() int { return foo() }\n",
+		"internal/foo/foo_linux.go":   "package foo\n\nfunc foo() int { return 1 }\n",
+		"internal/foo/foo_windows.go": "package foo\n\nimport \"internal/bar\"\n\nfunc foo() int { return bar.Bar }\n",
+		"internal/foo/foo_darwin.go":  "package foo\n\nfunc foo() int { return 2 }\n",
+		"internal/bar/bar.go":         "package bar\n\nconst Bar = 3\n",
+	})
+	fsys := newMemFS()
+	c := testCopier(t, src, fsys, "internal/foo")
+	c.Platforms = []string{"linux/amd64", "windows/amd64"}
+	var stdout strings.Builder
+	c.Stdout = &stdout
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// the windows only dependency is copied as well
+	want := []string{"bar/bar.go", "foo/foo.go", "foo/foo_linux.go", "foo/foo_windows.go"}
+	if got := fsys.paths(c.Dst); !reflect.DeepEqual(got, want) {
+		t.Errorf("copied files: got %q, want %q", got, want)
+	}
+	out := stdout.String()
+	for _, line := range []string{
+		"\tfoo.go: linux/amd64 windows/amd64\n",
+		"\tfoo_linux.go: linux/amd64\n",
+		"\tfoo_windows.go: windows/amd64\n",
+		"internal/bar\n\tbar.go: windows/amd64\n",
+	} {
+		if !strings.Contains(out, line) {
+			t.Errorf("the platforms %q are not reported:\n%s", line, out)
+		}
+	}
+}
+
+func TestEmptyResolution(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/win/win_windows.go": "package win\n\nconst Win = 1\n",
+	})
+
+	tests := []struct {
+		name      string
+		env       []string
+		platforms []string
+		wantErr   string
+	}{
+		{
+			name:    "env",
+			env:     []string{"GOOS=linux", "GOARCH=amd64"},
+			wantErr: "internal/win: resolves to no buildable package for GOOS=linux GOARCH=amd64",
+		},
+		{
+			name:      "platforms",
+			platforms: []string{"linux/amd64", "darwin/arm64"},
+			wantErr:   "internal/win: resolves to no buildable package for any of the platforms linux/amd64 darwin/arm64",
+		},
+		{
+			name:      "built on any",
+			platforms: []string{"linux/amd64", "windows/amd64"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys := newMemFS()
+			c := testCopier(t, src, fsys, "internal/win")
+			c.Env = tt.env
+			c.Platforms = tt.platforms
+
+			err := c.Run(context.Background())
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got, want := fsys.paths(c.Dst), []string{"win/win_windows.go"}; !reflect.DeepEqual(got, want) {
+					t.Errorf("copied files: got %q, want %q", got, want)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("got error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// progressEvent is a progress event emitted by -progress-json.
+type progressEvent struct {
+	Package string `json:"package"` // import path of the package being copied
+	File    string `json:"file"`    // source file just copied
+	Done    int    `json:"done"`    // number of files copied
+	Total   int    `json:"total"`   // number of files to copy
+	Skipped bool   `json:"skipped,omitempty"`
+}
+
+// progressReporter reports the copy progress as newline delimited JSON.
+//
+// A nil *progressReporter reports nothing.
+type progressReporter struct {
+	mu    sync.Mutex
+	enc   *json.Encoder
+	done  int
+	total int
+}
+
+func newProgressReporter(w io.Writer) *progressReporter {
+	return &progressReporter{
+		enc: json.NewEncoder(w),
+	}
+}
+
+// start adds the files of pkgs listed by files to the total number of files to copy.
+func (p *progressReporter) start(pkgs []*Package, files func(*Package) []string) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, pkg := range pkgs {
+		p.total += len(files(pkg))
+	}
+}
+
+// fileDone emits the progress event for the copied file of pkg.
+func (p *progressReporter) fileDone(pkg *Package, file string) {
+	p.emit(pkg, file, false)
+}
+
+// fileSkipped emits the progress event for the skipped file of pkg.
+func (p *progressReporter) fileSkipped(pkg *Package, file string) {
+	p.emit(pkg, file, true)
+}
+
+func (p *progressReporter) emit(pkg *Package, file string, skipped bool) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done++
+	p.enc.Encode(progressEvent{
+		Package: pkg.ImportPath,
+		File:    file,
+		Done:    p.done,
+		Total:   p.total,
+		Skipped: skipped,
+	})
+}
@@ -0,0 +1,50 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestProgressJSON(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go": "package foo\n\nimport (\n\t\"internal/bar\"\n\t\"internal/baz\"\n)\n\nvar _, _ = bar.Bar, baz.Baz\n",
+		"internal/bar/bar.go": "package bar\n\nconst Bar = 1\n",
+		"internal/bar/doc.go": "// Package bar is a test package.\npackage bar\n",
+		"internal/baz/baz.go": "package baz\n\nconst Baz = 1\n",
+	})
+	var progress bytes.Buffer
+	c := testCopier(t, src, newMemFS(), "internal/foo")
+	c.Progress = &progress
+	c.Jobs = 4
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	var events []progressEvent
+	sc := bufio.NewScanner(&progress)
+	for sc.Scan() {
+		var event progressEvent
+		if err := json.Unmarshal(sc.Bytes(), &event); err != nil {
+			t.Fatalf("invalid NDJSON line %q: %v", sc.Text(), err)
+		}
+		events = append(events, event)
+	}
+	if len(events) != 4 {
+		t.Fatalf("got %d events, want one per file: %+v", len(events), events)
+	}
+	for i, event := range events {
+		if event.Done != i+1 || event.Total != 4 {
+			t.Errorf("event %d: got done %d of %d, want %d of 4", i, event.Done, event.Total, i+1)
+		}
+		if event.Package == "" || event.File == "" {
+			t.Errorf("event %d has no package or file: %+v", i, event)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// copiedFile is the provenance of a copied file.
+type copiedFile struct {
+	Package string `json:"package"`          // import path of the source package
+	Source  string `json:"source"`           // source file path
+	Dest    string `json:"dest"`             // destination file path
+	Commit  string `json:"commit,omitempty"` // last git commit of the source file, with -git-provenance
+}
+
+// recordCopied records the provenance of the src file of pkg copied to dst.
+func (c *Copier) recordCopied(pkg *Package, src, dst string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.copiedFiles = append(c.copiedFiles, &copiedFile{
+		Package: pkg.ImportPath,
+		Source:  src,
+		Dest:    dst,
+	})
+}
+
+// fillGitCommits fills the last git commit of each source file of files.
+//
+// It does nothing except a warning if the source tree at src is not a git
+// checkout.
+func (c *Copier) fillGitCommits(ctx context.Context, src string, files []*copiedFile) error {
+	if _, err := gitOutput(ctx, src, "rev-parse", "--is-inside-work-tree"); err != nil {
+		c.warnf("%s is not a git repository, skip the git provenance", src)
+		return nil
+	}
+
+	for _, f := range files {
+		commit, err := gitOutput(ctx, filepath.Dir(f.Source), "log", "-1", "--format=%H", "--", filepath.Base(f.Source))
+		if err != nil {
+			return fmt.Errorf("git log %s: %w", f.Source, err)
+		}
+		f.Commit = commit
+	}
+
+	return nil
+}
+
+func gitOutput(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
+
+// writeProvenance writes the provenance of files to the JSON file at path.
+func (c *Copier) writeProvenance(path string, files []*copiedFile) error {
+	data, err := json.MarshalIndent(files, "", "\t")
+	if err != nil {
+		return fmt.Errorf("marshal provenance: %w", err)
+	}
+	data = append(data, '\n')
+
+	if _, err := c.writeIfChanged(path, data); err != nil {
+		return fmt.Errorf("write %s file: %w", path, err)
+	}
+
+	return nil
+}
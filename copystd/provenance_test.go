@@ -0,0 +1,90 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGitProvenance(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git command not found")
+	}
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go": "package foo\n\nimport \"internal/bar\"\n\nfunc Foo() int { return bar.Bar }\n",
+		"internal/bar/bar.go": "package bar\n\nconst Bar = 1\n",
+	})
+	git := func(args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-c", "user.name=gopher", "-c", "user.email=gopher@example.com", "-c", "commit.gpgsign=false"}, args...)...)
+		cmd.Dir = src
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+
+	provenance := func(t *testing.T) (map[string]string, []string) {
+		fsys := newMemFS()
+		c := testCopier(t, src, fsys, "internal/foo")
+		c.ProvenanceJSON = filepath.Join(c.Dst, "provenance.json")
+		c.GitProvenance = true
+
+		res, err := c.Copy(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data, ok := fsys.file(c.ProvenanceJSON)
+		if !ok {
+			t.Fatal("provenance.json is not written")
+		}
+		var files []*copiedFile
+		if err := json.Unmarshal([]byte(data), &files); err != nil {
+			t.Fatal(err)
+		}
+		commits := make(map[string]string)
+		for _, f := range files {
+			commits[f.Package] = f.Commit
+		}
+		return commits, res.Warnings
+	}
+
+	t.Run("not a repository", func(t *testing.T) {
+		commits, warnings := provenance(t)
+		if commits["internal/foo"] != "" || commits["internal/bar"] != "" {
+			t.Errorf("got commits %v outside of a git repository", commits)
+		}
+		if len(warnings) != 1 || !strings.Contains(warnings[0], "is not a git repository") {
+			t.Errorf("got warnings %q, want the one of the git repository", warnings)
+		}
+	})
+
+	git("init", "-q")
+	git("add", "VERSION", "src/internal/foo", "src/internal/bar")
+	git("commit", "-q", "-m", "initial")
+	first := git("rev-parse", "HEAD")
+	if err := os.WriteFile(filepath.Join(src, "src", "internal", "bar", "bar.go"), []byte("package bar\n\nconst Bar = 2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	git("commit", "-q", "-a", "-m", "update bar")
+	second := git("rev-parse", "HEAD")
+
+	t.Run("repository", func(t *testing.T) {
+		commits, _ := provenance(t)
+		if got := commits["internal/foo"]; got != first {
+			t.Errorf("foo.go: got commit %q, want %q", got, first)
+		}
+		if got := commits["internal/bar"]; got != second {
+			t.Errorf("bar.go: got commit %q, want %q", got, second)
+		}
+	})
+}
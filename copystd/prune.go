@@ -0,0 +1,534 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/imports"
+)
+
+// prunePackage is a copied package whose unreachable declarations are removed
+// with Prune.
+type prunePackage struct {
+	path    string // rewritten import path
+	src     string // source import path
+	name    string
+	decls   map[string][]*pruneDecl // keyed by the declared name
+	methods map[string][]*pruneDecl // keyed by the receiver type name
+	keep    bool                    // whether no declaration is removed
+}
+
+// pruneFile is a copied Go file parsed by prune.
+type pruneFile struct {
+	path    string
+	src     []byte
+	fset    *token.FileSet
+	file    *ast.File
+	pkg     *prunePackage // nil if the file is not of a pruned package
+	imports map[string]*prunePackage
+	root    bool // whether all of its declarations are reachable, such as a test file
+	decls   []*pruneDecl
+}
+
+// pruneDecl is a top-level declaration, or a spec of a grouped var or type
+// declaration.
+type pruneDecl struct {
+	file  *pruneFile
+	node  ast.Node
+	group *ast.GenDecl // grouped declaration of the spec, if any
+	names []string
+	kept  bool
+}
+
+// prune removes the top-level declarations of the copied packages which are
+// unreachable from the exported ones of Packages, or from KeepSymbols, and
+// the files and the packages left empty. It is conservative: the methods of
+// the kept types, the init functions and the declarations with a compiler
+// directive are always kept, and the packages with assembly or cgo files are
+// left as is.
+func (c *Copier) prune() error {
+	pkgs, files, err := c.parsePrune()
+	if err != nil {
+		return err
+	}
+
+	var queue []*pruneDecl
+	mark := func(decls []*pruneDecl) {
+		for _, d := range decls {
+			if !d.kept {
+				d.kept = true
+				queue = append(queue, d)
+			}
+		}
+	}
+
+	for _, f := range files {
+		if f.pkg == nil || f.pkg.keep || f.root {
+			queue = append(queue, &pruneDecl{file: f, node: f.file, kept: true})
+			continue
+		}
+		for _, d := range f.decls {
+			if c.isPruneRoot(d) {
+				mark([]*pruneDecl{d})
+			}
+		}
+		for _, name := range linknamed(f.file) {
+			mark(f.pkg.decls[name])
+		}
+	}
+	if err := c.markKeepSymbols(pkgs, mark); err != nil {
+		return err
+	}
+
+	for len(queue) > 0 {
+		d := queue[0]
+		queue = queue[1:]
+		f := d.file
+		if f.pkg != nil {
+			for _, name := range d.names {
+				mark(f.pkg.methods[name])
+			}
+			if fn, ok := d.node.(*ast.FuncDecl); ok && fn.Recv != nil {
+				mark(f.pkg.decls[recvTypeName(fn)])
+			}
+		}
+		ast.Inspect(d.node, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.SelectorExpr:
+				if x, ok := n.X.(*ast.Ident); ok {
+					if p, ok := f.imports[x.Name]; ok {
+						mark(p.decls[n.Sel.Name])
+						return false
+					}
+				}
+			case *ast.Ident:
+				if f.pkg != nil {
+					mark(f.pkg.decls[n.Name])
+				}
+			}
+			return true
+		})
+	}
+
+	var decls, removed int
+	for _, f := range files {
+		if f.pkg == nil || f.pkg.keep || f.root {
+			continue
+		}
+		n, empty, err := c.pruneFile(f)
+		if err != nil {
+			return err
+		}
+		decls += n
+		if empty {
+			removed++
+		}
+	}
+	c.infof("prune: removed %d declarations and %d files", decls, removed)
+	if c.DryRun {
+		// no directory is created nor removed
+		return nil
+	}
+
+	return c.cleanupEmptyDirs(c.Dst)
+}
+
+// parsePrune parses the copied Go files, and returns the packages to prune
+// keyed by the rewritten import path, and the files sorted by the path.
+func (c *Copier) parsePrune() (map[string]*prunePackage, []*pruneFile, error) {
+	dirs := make(map[string]*prunePackage)
+	pkgs := make(map[string]*prunePackage)
+	for importPath, pkg := range c.copiedPackages {
+		if c.compacted[pkg.ImportPath] != nil {
+			continue
+		}
+		dir, err := filepath.Abs(c.packageDir(pkg))
+		if err != nil {
+			return nil, nil, fmt.Errorf("resolve %s: %w", pkg.ImportPath, err)
+		}
+		p := &prunePackage{
+			path:    importPath,
+			src:     pkg.ImportPath,
+			name:    pkg.Name,
+			decls:   make(map[string][]*pruneDecl),
+			methods: make(map[string][]*pruneDecl),
+			keep:    len(pkg.CgoFiles) > 0 || len(pkg.SFiles) > 0 || len(pkg.CFiles) > 0,
+		}
+		dirs[dir] = p
+		pkgs[importPath] = p
+	}
+
+	paths := make([]string, 0, len(c.writtenFiles))
+	for path := range c.writtenFiles {
+		if strings.HasSuffix(path, ".go") {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	files := make([]*pruneFile, 0, len(paths))
+	for _, path := range paths {
+		src, err := c.FS.ReadFile(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("read %s file: %w", path, err)
+		}
+		f := &pruneFile{path: path, src: src, fset: token.NewFileSet(), imports: make(map[string]*prunePackage)}
+		f.file, err = parser.ParseFile(f.fset, path, src, parser.ParseComments)
+		if err != nil {
+			return nil, nil, fmt.Errorf("parse %s: %w", path, err)
+		}
+		f.pkg = dirs[filepath.Dir(path)]
+		f.root = strings.HasSuffix(path, "_test.go")
+		if f.pkg != nil && f.pkg.name != f.file.Name.Name {
+			// such as a file ignored by the build constraints of another package
+			f.root = true
+		}
+		files = append(files, f)
+	}
+
+	for _, f := range files {
+		for _, spec := range f.file.Imports {
+			importPath, _ := strconv.Unquote(spec.Path.Value)
+			if importPath == "C" && f.pkg != nil {
+				f.pkg.keep = true
+			}
+			p, ok := pkgs[importPath]
+			if !ok {
+				continue
+			}
+			name := p.name
+			if spec.Name != nil {
+				name = spec.Name.Name
+			}
+			switch name {
+			case "_", ".":
+				// the package is imported for the side effects or its names
+				// are referred unqualified
+				p.keep = true
+			default:
+				f.imports[name] = p
+			}
+		}
+		if f.pkg != nil && !f.root {
+			f.decls = pruneDecls(f)
+			for _, d := range f.decls {
+				for _, name := range d.names {
+					f.pkg.decls[name] = append(f.pkg.decls[name], d)
+				}
+				if fn, ok := d.node.(*ast.FuncDecl); ok && fn.Recv != nil {
+					recv := recvTypeName(fn)
+					f.pkg.methods[recv] = append(f.pkg.methods[recv], d)
+				}
+			}
+		}
+	}
+
+	return pkgs, files, nil
+}
+
+// pruneDecls returns the declarations of f, except the imports. A constant
+// declaration is never split, as its specs could depend on iota.
+func pruneDecls(f *pruneFile) []*pruneDecl {
+	var decls []*pruneDecl
+	for _, decl := range f.file.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			d := &pruneDecl{file: f, node: decl}
+			if decl.Recv == nil {
+				d.names = []string{decl.Name.Name}
+			}
+			decls = append(decls, d)
+		case *ast.GenDecl:
+			switch {
+			case decl.Tok == token.IMPORT:
+			case decl.Tok == token.CONST || !decl.Lparen.IsValid():
+				decls = append(decls, &pruneDecl{file: f, node: decl, names: specNames(decl.Specs...)})
+			default:
+				for _, spec := range decl.Specs {
+					decls = append(decls, &pruneDecl{file: f, node: spec, group: decl, names: specNames(spec)})
+				}
+			}
+		}
+	}
+
+	return decls
+}
+
+// specNames returns the names declared by the specs.
+func specNames(specs ...ast.Spec) []string {
+	var names []string
+	for _, spec := range specs {
+		switch spec := spec.(type) {
+		case *ast.ValueSpec:
+			for _, name := range spec.Names {
+				names = append(names, name.Name)
+			}
+		case *ast.TypeSpec:
+			names = append(names, spec.Name.Name)
+		}
+	}
+
+	return names
+}
+
+// recvTypeName returns the name of the receiver type of the method fn.
+func recvTypeName(fn *ast.FuncDecl) string {
+	if len(fn.Recv.List) == 0 {
+		return ""
+	}
+	typ := fn.Recv.List[0].Type
+	for {
+		switch t := typ.(type) {
+		case *ast.StarExpr:
+			typ = t.X
+		case *ast.ParenExpr:
+			typ = t.X
+		case *ast.IndexExpr:
+			typ = t.X
+		case *ast.IndexListExpr:
+			typ = t.X
+		case *ast.Ident:
+			return t.Name
+		default:
+			return ""
+		}
+	}
+}
+
+// isPruneRoot reports whether the declaration d is always kept: an init or a
+// blank declaration, a declaration with a compiler directive or a function
+// without body, or an exported declaration of a package of Packages unless
+// KeepSymbols is given.
+func (c *Copier) isPruneRoot(d *pruneDecl) bool {
+	var doc *ast.CommentGroup
+	switch n := d.node.(type) {
+	case *ast.FuncDecl:
+		if n.Body == nil || (n.Recv == nil && n.Name.Name == "init") {
+			return true
+		}
+		doc = n.Doc
+	case *ast.GenDecl:
+		doc = n.Doc
+	case *ast.ValueSpec:
+		doc = n.Doc
+	case *ast.TypeSpec:
+		doc = n.Doc
+	}
+	if hasDirective(doc) || (d.group != nil && hasDirective(d.group.Doc)) {
+		return true
+	}
+
+	for _, name := range d.names {
+		if name == "_" {
+			return true
+		}
+	}
+	if len(c.KeepSymbols) > 0 || !c.isPruneRootPackage(d.file.pkg.src) {
+		return false
+	}
+	for _, name := range d.names {
+		if ast.IsExported(name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isPruneRootPackage reports whether the source import path is of a package
+// given by Packages or OnlyPackage.
+func (c *Copier) isPruneRootPackage(importPath string) bool {
+	return matchAny(c.Packages, importPath) || importPath == c.OnlyPackage
+}
+
+// hasDirective reports whether the comment group has a //go: directive.
+func hasDirective(doc *ast.CommentGroup) bool {
+	if doc == nil {
+		return false
+	}
+	for _, comment := range doc.List {
+		if strings.HasPrefix(comment.Text, "//go:") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// linknamed returns the local names of the //go:linkname directives of f.
+func linknamed(f *ast.File) []string {
+	var names []string
+	for _, group := range f.Comments {
+		for _, comment := range group.List {
+			if fields := strings.Fields(comment.Text); len(fields) >= 2 && fields[0] == "//go:linkname" {
+				names = append(names, fields[1])
+			}
+		}
+	}
+
+	return names
+}
+
+// markKeepSymbols marks the declarations of KeepSymbols, given as the source
+// import path and the name such as internal/bytealg.IndexByte.
+func (c *Copier) markKeepSymbols(pkgs map[string]*prunePackage, mark func([]*pruneDecl)) error {
+	bySrc := make(map[string]*prunePackage, len(pkgs))
+	for _, p := range pkgs {
+		bySrc[p.src] = p
+	}
+
+	for _, sym := range c.KeepSymbols {
+		slash := strings.LastIndex(sym, "/")
+		dot := strings.Index(sym[slash+1:], ".")
+		if dot < 0 {
+			return fmt.Errorf("-keep-symbols %q: want the import path and the name such as internal/bytealg.IndexByte", sym)
+		}
+		importPath, name := sym[:slash+1+dot], sym[slash+1+dot+1:]
+		p, ok := bySrc[importPath]
+		if !ok {
+			p, ok = pkgs[importPath]
+		}
+		if !ok {
+			c.warnf("prune: %s: %s is not copied", sym, importPath)
+			continue
+		}
+		if len(p.decls[name]) == 0 {
+			c.warnf("prune: %s: %s declares no %s", sym, importPath, name)
+			continue
+		}
+		mark(p.decls[name])
+	}
+
+	return nil
+}
+
+// pruneFile removes the unreachable declarations of f and its unused imports,
+// or f itself if it has no declaration left. It returns the number of the
+// declarations removed, and whether f was removed.
+func (c *Copier) pruneFile(f *pruneFile) (int, bool, error) {
+	type span struct{ start, end int }
+	var spans []span
+	add := func(start, end token.Pos) {
+		spans = append(spans, span{f.fset.Position(start).Offset, f.fset.Position(end).Offset})
+	}
+
+	n, left := 0, 0
+	groups := make(map[*ast.GenDecl][]*pruneDecl)
+	for _, d := range f.decls {
+		if d.group != nil {
+			groups[d.group] = append(groups[d.group], d)
+			continue
+		}
+		if d.kept {
+			left++
+			continue
+		}
+		n++
+		add(declSpan(d.node))
+	}
+	for group, specs := range groups {
+		kept := 0
+		for _, d := range specs {
+			if d.kept {
+				kept++
+			}
+		}
+		n += len(specs) - kept
+		left += kept
+		if kept == 0 {
+			add(declSpan(group))
+			continue
+		}
+		for _, d := range specs {
+			if !d.kept {
+				add(declSpan(d.node))
+			}
+		}
+	}
+	if n == 0 {
+		return 0, false, nil
+	}
+
+	if left == 0 {
+		if err := c.FS.Remove(f.path); err != nil {
+			return 0, false, fmt.Errorf("remove %s file: %w", f.path, err)
+		}
+		c.forgetFile(f.path)
+		c.debugf("prune: remove %s", f.path)
+		return n, true, nil
+	}
+
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start > spans[j].start })
+	src := f.src
+	for _, s := range spans {
+		end := s.end
+		// remove the trailing comment and the newline as well
+		if i := strings.IndexByte(string(src[end:]), '\n'); i >= 0 {
+			end += i + 1
+		} else {
+			end = len(src)
+		}
+		src = append(src[:s.start:s.start], src[end:]...)
+	}
+	data, err := imports.Process(f.path, src, &imports.Options{
+		TabWidth:  8,
+		TabIndent: true,
+		Comments:  true,
+	})
+	if err != nil {
+		return 0, false, fmt.Errorf("process goimports %s: %w", f.path, err)
+	}
+	if _, err := c.writeIfChanged(f.path, data); err != nil {
+		return 0, false, fmt.Errorf("write %s file: %w", f.path, err)
+	}
+	c.debugf("prune: remove %d declarations of %s", n, f.path)
+
+	return n, false, nil
+}
+
+// declSpan returns the span of the declaration node including its doc
+// comment.
+func declSpan(node ast.Node) (token.Pos, token.Pos) {
+	start := node.Pos()
+	switch n := node.(type) {
+	case *ast.FuncDecl:
+		if n.Doc != nil {
+			start = n.Doc.Pos()
+		}
+	case *ast.GenDecl:
+		if n.Doc != nil {
+			start = n.Doc.Pos()
+		}
+	case *ast.ValueSpec:
+		if n.Doc != nil {
+			start = n.Doc.Pos()
+		}
+	case *ast.TypeSpec:
+		if n.Doc != nil {
+			start = n.Doc.Pos()
+		}
+	}
+
+	return start, node.End()
+}
+
+// forgetFile drops the removed file from the files written by the run.
+func (c *Copier) forgetFile(path string) {
+	delete(c.writtenFiles, path)
+	copied := c.copiedFiles[:0]
+	for _, f := range c.copiedFiles {
+		if abs, err := filepath.Abs(f.Dest); err != nil || abs != path {
+			copied = append(copied, f)
+		}
+	}
+	c.copiedFiles = copied
+}
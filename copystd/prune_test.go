@@ -0,0 +1,114 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPrune(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go":    "package foo\n\nimport \"internal/bar\"\n\nfunc Foo() int { return bar.Used() }\n",
+		"internal/bar/bar.go":    "package bar\n\nfunc Used() int { return helper() }\n\nfunc helper() int { return 1 }\n\nfunc Unused() int { return 2 }\n",
+		"internal/bar/unused.go": "package bar\n\nfunc AlsoUnused() {}\n",
+	})
+	wantBar := "package bar\n\nfunc Used() int { return helper() }\n\nfunc helper() int { return 1 }\n"
+
+	t.Run("run", func(t *testing.T) {
+		fsys := newMemFS()
+		c := testCopier(t, src, fsys, "internal/foo")
+		c.Prune = true
+		c.NoTests = true
+
+		if err := c.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		if got, want := fsys.paths(c.Dst), []string{"bar/bar.go", "foo/foo.go"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("copied files: got %q, want %q", got, want)
+		}
+		if bar, _ := fsys.file(filepath.Join(c.Dst, "bar", "bar.go")); bar != wantBar {
+			t.Errorf("got bar.go\n%s\nwant\n%s", bar, wantBar)
+		}
+	})
+
+	t.Run("check", func(t *testing.T) {
+		// the copy without -prune is up to date, so the pruned declarations
+		// and file are the changes
+		fsys := newMemFS()
+		c := testCopier(t, src, fsys, "internal/foo")
+		c.NoTests = true
+		if err := c.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		c.Prune = true
+
+		changed, changes, err := c.Check(context.Background(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []FileChange{
+			{Path: filepath.Join(c.Dst, "bar", "bar.go"), Package: "internal/bar", Deleted: 2},
+			{Path: filepath.Join(c.Dst, "bar", "unused.go"), Package: "internal/bar", Removed: true, Deleted: 3},
+		}
+		if !changed || !reflect.DeepEqual(changes, want) {
+			t.Errorf("got changes %+v, want %+v", changes, want)
+		}
+		if got, want := fsys.paths(c.Dst), []string{"bar/bar.go", "bar/unused.go", "foo/foo.go"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("files after the check: got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		fsys := newMemFS()
+		c := testCopier(t, src, fsys, "internal/foo")
+		c.Prune = true
+		c.NoTests = true
+		c.DryRun = true
+		var stdout strings.Builder
+		c.Stdout = &stdout
+
+		if err := c.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		if want := "prune: removed 2 declarations and 1 files"; !strings.Contains(stdout.String(), want) {
+			t.Errorf("got output\n%s\nwant %q", &stdout, want)
+		}
+		if paths := fsys.paths(c.Dst); len(paths) > 0 {
+			t.Errorf("files are written: %q", paths)
+		}
+		if want := filepath.Join(c.Dst, "bar", "bar.go") + " (new)"; !strings.Contains(stdout.String(), want) {
+			t.Errorf("got output\n%s\nwant %q", &stdout, want)
+		}
+	})
+
+	t.Run("dry run over a copy", func(t *testing.T) {
+		fsys := newMemFS()
+		c := testCopier(t, src, fsys, "internal/foo")
+		c.NoTests = true
+		if err := c.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		c.Prune = true
+		c.DryRun = true
+		var stdout strings.Builder
+		c.Stdout = &stdout
+
+		if err := c.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		if want := filepath.Join(c.Dst, "bar", "bar.go") + " (overwrite)"; !strings.Contains(stdout.String(), want) {
+			t.Errorf("got output\n%s\nwant %q", &stdout, want)
+		}
+		if bar, _ := fsys.file(filepath.Join(c.Dst, "bar", "bar.go")); bar == wantBar {
+			t.Error("bar.go is pruned by the dry run")
+		}
+	})
+}
@@ -0,0 +1,105 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+)
+
+// renameReceivers renames the receivers of the methods of the types in the
+// Go source body to the names of repl, keyed by the type name, and updates
+// the references to the receivers in the method bodies.
+//
+// A method whose body already uses the new name is left as is, since the
+// rename would change the meaning of the body.
+func (c *Copier) renameReceivers(filename, body string, repl map[string]string) (string, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, body, parser.ParseComments)
+	if err != nil {
+		return "", fmt.Errorf("parse %s: %w", filename, err)
+	}
+
+	changed := false
+	for _, decl := range f.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Recv == nil || len(fn.Recv.List) == 0 || len(fn.Recv.List[0].Names) == 0 {
+			continue
+		}
+		recv := fn.Recv.List[0].Names[0]
+		name, ok := repl[receiverTypeName(fn.Recv.List[0].Type)]
+		if !ok || recv.Name == name || recv.Name == "_" {
+			continue
+		}
+		if usesName(fn, name) {
+			c.warnf("%s: receiver %s of %s is not renamed to %s, which is used in the method", fset.Position(recv.Pos()), recv.Name, fn.Name.Name, name)
+			continue
+		}
+
+		obj := recv.Obj
+		recv.Name = name
+		if fn.Body != nil && obj != nil {
+			ast.Inspect(fn.Body, func(n ast.Node) bool {
+				if ident, ok := n.(*ast.Ident); ok && ident.Obj == obj {
+					ident.Name = name
+				}
+				return true
+			})
+		}
+		changed = true
+	}
+	if !changed {
+		return body, nil
+	}
+
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, f); err != nil {
+		return "", fmt.Errorf("format %s: %w", filename, err)
+	}
+
+	return buf.String(), nil
+}
+
+// receiverTypeName returns the type name of the receiver type expression, such
+// as T for *T or T[K].
+func receiverTypeName(expr ast.Expr) string {
+	for {
+		switch e := expr.(type) {
+		case *ast.StarExpr:
+			expr = e.X
+		case *ast.ParenExpr:
+			expr = e.X
+		case *ast.IndexExpr:
+			expr = e.X
+		case *ast.IndexListExpr:
+			expr = e.X
+		case *ast.Ident:
+			return e.Name
+		default:
+			return ""
+		}
+	}
+}
+
+// usesName reports whether the identifier name appears in the fn except its
+// receiver.
+func usesName(fn *ast.FuncDecl, name string) bool {
+	used := false
+	check := func(n ast.Node) bool {
+		if ident, ok := n.(*ast.Ident); ok && ident.Name == name {
+			used = true
+		}
+		return !used
+	}
+	ast.Inspect(fn.Type, check)
+	if fn.Body != nil {
+		ast.Inspect(fn.Body, check)
+	}
+
+	return used
+}
@@ -0,0 +1,70 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestRenameReceiver(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go": `package foo
+
+type Set[K comparable] struct{ m map[K]bool }
+
+func (s *Set[K]) Add(k K) { s.m[k] = true }
+
+func (set Set[K]) Has(k K) bool {
+	if set.m == nil {
+		return false
+	}
+	return set.m[k]
+}
+
+func (t Set[K]) Len() int { r := len(t.m); return r }
+
+// Clone keeps the receiver, as r is used in the body.
+func (s Set[K]) Clone() (r Set[K]) { r.m = s.m; return r }
+
+type Other struct{}
+
+func (s Other) Foo() Other { return s }
+`,
+	})
+	fsys := newMemFS()
+	c := testCopier(t, src, fsys, "internal/foo")
+	c.RenameReceiver = map[string]string{"Set": "r"}
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	const want = `package foo
+
+type Set[K comparable] struct{ m map[K]bool }
+
+func (r *Set[K]) Add(k K) { r.m[k] = true }
+
+func (r Set[K]) Has(k K) bool {
+	if r.m == nil {
+		return false
+	}
+	return r.m[k]
+}
+
+func (t Set[K]) Len() int { r := len(t.m); return r }
+
+// Clone keeps the receiver, as r is used in the body.
+func (s Set[K]) Clone() (r Set[K]) { r.m = s.m; return r }
+
+type Other struct{}
+
+func (s Other) Foo() Other { return s }
+`
+	if got, _ := fsys.file(filepath.Join(c.Dst, "foo", "foo.go")); got != want {
+		t.Errorf("got foo.go\n%s\nwant\n%s", got, want)
+	}
+}
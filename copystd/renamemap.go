@@ -0,0 +1,87 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/token"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// loadRenameMap reads the package rename map at path, which has a rename in
+// old-path=new-name form per line. The empty lines and the lines beginning
+// with '#' are skipped.
+func (c *Copier) loadRenameMap(path string) (map[string]string, error) {
+	data, err := c.FS.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read %s file: %w", path, err)
+	}
+
+	renames := make(map[string]string)
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		oldPath, newName, ok := strings.Cut(line, "=")
+		oldPath, newName = strings.TrimSpace(oldPath), strings.TrimSpace(newName)
+		if !ok || oldPath == "" || !token.IsIdentifier(newName) {
+			return nil, fmt.Errorf("%s:%d: invalid rename %q: must be old-path=new-name form", path, n, line)
+		}
+		if _, ok := renames[oldPath]; ok {
+			return nil, fmt.Errorf("%s:%d: duplicate rename of %s", path, n, oldPath)
+		}
+		renames[oldPath] = newName
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("scan %s file: %w", path, err)
+	}
+
+	return renames, nil
+}
+
+// renamedPath returns the rewritten import path of the importPath package
+// with the last element replaced by the new name of the rename map, or
+// newPath as is if the package is not renamed.
+func (c *Copier) renamedPath(importPath, newPath string) string {
+	name, ok := c.renames[importPath]
+	if !ok {
+		return newPath
+	}
+
+	return path.Join(path.Dir(newPath), name)
+}
+
+// packageName returns the package name of the copied package of the original
+// importPath.
+func (c *Copier) packageName(importPath string) string {
+	if pkg, ok := c.copiedPackages[c.rewriteImportPath(importPath)]; ok && pkg.Name != "" {
+		return pkg.Name
+	}
+
+	return path.Base(importPath)
+}
+
+// packageRename returns the new package name of the file of pkg by the rename
+// map. The external test file is renamed to the name of RewriteXTestName if
+// given, which is independent of the rename map, with the _test suffix.
+func (c *Copier) packageRename(pkg *Package, file string) (string, bool) {
+	name, ok := c.renames[pkg.ImportPath]
+	if !contains(pkg.XTestGoFiles, filepath.Base(file)) {
+		return name, ok
+	}
+	if xname, xok := c.RewriteXTestName[pkg.ImportPath]; xok {
+		name, ok = xname, true
+	}
+	if !ok {
+		return "", false
+	}
+
+	return name + "_test", true
+}
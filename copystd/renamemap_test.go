@@ -0,0 +1,153 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRenameMap(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go":      "package foo\n\nimport (\n\t\"internal/bar\"\n\t\"internal/baz\"\n)\n\nvar _, _ = bar.Bar, baz.Baz\n",
+		"internal/bar/bar.go":      "package bar\n\nconst Bar = 1\n",
+		"internal/baz/baz.go":      "package baz\n\nconst Baz = 1\n",
+		"internal/baz/baz_test.go": "package baz_test\n",
+	})
+	renameMap := filepath.Join(t.TempDir(), "renames")
+	data := "# the renames\ninternal/bar = newbar\n\ninternal/baz=newbaz\n"
+	if err := os.WriteFile(renameMap, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fsys := newMemFS()
+	c := testCopier(t, src, fsys, "internal/foo")
+	c.RenameMap = renameMap
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"foo/foo.go", "newbar/bar.go", "newbaz/baz.go", "newbaz/baz_test.go"}
+	if got := fsys.paths(c.Dst); !reflect.DeepEqual(got, want) {
+		t.Errorf("copied files: got %q, want %q", got, want)
+	}
+	for name, want := range map[string]string{
+		"foo/foo.go":         "package foo\n\nimport (\n\tbar \"example.com/m/newbar\"\n\tbaz \"example.com/m/newbaz\"\n)\n\nvar _, _ = bar.Bar, baz.Baz\n",
+		"newbar/bar.go":      "package newbar\n\nconst Bar = 1\n",
+		"newbaz/baz_test.go": "package newbaz_test\n",
+	} {
+		if got, _ := fsys.file(filepath.Join(c.Dst, filepath.FromSlash(name))); got != want {
+			t.Errorf("got %s\n%s\nwant\n%s", name, got, want)
+		}
+	}
+}
+
+func TestLoadRenameMap(t *testing.T) {
+	tests := []struct {
+		data    string
+		want    map[string]string
+		wantErr string
+	}{
+		{
+			data: "internal/bar=newbar\n# comment\n\n  internal/baz = newbaz  \n",
+			want: map[string]string{"internal/bar": "newbar", "internal/baz": "newbaz"},
+		},
+		{
+			data:    "internal/bar=new-bar\n",
+			wantErr: `:1: invalid rename "internal/bar=new-bar": must be old-path=new-name form`,
+		},
+		{
+			data:    "internal/bar=a\ninternal/bar=b\n",
+			wantErr: ":2: duplicate rename of internal/bar",
+		},
+	}
+	for _, tt := range tests {
+		name := filepath.Join(t.TempDir(), "renames")
+		if err := os.WriteFile(name, []byte(tt.data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		c := &Copier{FS: newMemFS()}
+
+		got, err := c.loadRenameMap(name)
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != name+tt.wantErr {
+				t.Errorf("%q: got error %v, want %q", tt.data, err, name+tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got %v, want %v", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestRewriteXTestName(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go":      "package foo\n\nconst Foo = 1\n",
+		"internal/foo/foo_test.go": "package foo_test\n\nimport \"internal/foo\"\n\nvar _ = foo.Foo\n",
+	})
+	renameMap := filepath.Join(t.TempDir(), "renames")
+	if err := os.WriteFile(renameMap, []byte("internal/foo=newfoo\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		renameMap string
+		xtestName map[string]string
+		wantDir   string
+		wantFoo   string
+		wantXTest string
+	}{
+		{
+			name:      "rename",
+			renameMap: renameMap,
+			wantDir:   "newfoo",
+			wantFoo:   "package newfoo\n",
+			wantXTest: "package newfoo_test\n\nimport foo \"example.com/m/newfoo\"\n",
+		},
+		{
+			name:      "override",
+			renameMap: renameMap,
+			xtestName: map[string]string{"internal/foo": "other"},
+			wantDir:   "newfoo",
+			wantFoo:   "package newfoo\n",
+			wantXTest: "package other_test\n\nimport foo \"example.com/m/newfoo\"\n",
+		},
+		{
+			name:      "xtest only",
+			xtestName: map[string]string{"internal/foo": "other"},
+			wantDir:   "foo",
+			wantFoo:   "package foo\n",
+			wantXTest: "package other_test\n\nimport \"example.com/m/foo\"\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys := newMemFS()
+			c := testCopier(t, src, fsys, "internal/foo")
+			c.RenameMap = tt.renameMap
+			c.RewriteXTestName = tt.xtestName
+
+			if err := c.Run(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			dir := filepath.Join(c.Dst, tt.wantDir)
+			if foo, _ := fsys.file(filepath.Join(dir, "foo.go")); !strings.HasPrefix(foo, tt.wantFoo) {
+				t.Errorf("got foo.go\n%s\nwant the prefix\n%s", foo, tt.wantFoo)
+			}
+			if xtest, _ := fsys.file(filepath.Join(dir, "foo_test.go")); !strings.HasPrefix(xtest, tt.wantXTest) {
+				t.Errorf("got foo_test.go\n%s\nwant the prefix\n%s", xtest, tt.wantXTest)
+			}
+		})
+	}
+}
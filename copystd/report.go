@@ -0,0 +1,66 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// packageSize is the number of files and bytes written for a package.
+type packageSize struct {
+	ImportPath string
+	Files      int
+	Bytes      int
+}
+
+// sizeReport accumulates the written sizes of each copied package.
+type sizeReport map[string]*packageSize
+
+// add records the written file of n bytes for the importPath package.
+func (r sizeReport) add(importPath string, n int) {
+	size, ok := r[importPath]
+	if !ok {
+		size = &packageSize{ImportPath: importPath}
+		r[importPath] = size
+	}
+	size.Files++
+	size.Bytes += n
+}
+
+// addSize records the written file of n bytes for the importPath package to
+// the sizes of the run.
+func (c *Copier) addSize(importPath string, n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sizes.add(importPath, n)
+}
+
+// sorted returns the package sizes sorted by descending bytes.
+func (r sizeReport) sorted() []*packageSize {
+	list := make([]*packageSize, 0, len(r))
+	for _, size := range r {
+		list = append(list, size)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Bytes != list[j].Bytes {
+			return list[i].Bytes > list[j].Bytes
+		}
+		return list[i].ImportPath < list[j].ImportPath
+	})
+
+	return list
+}
+
+// print prints the package sizes to w.
+func (r sizeReport) print(w io.Writer) {
+	var files, bytes int
+	for _, size := range r.sorted() {
+		fmt.Fprintf(w, "%10d bytes %5d files  %s\n", size.Bytes, size.Files, size.ImportPath)
+		files += size.Files
+		bytes += size.Bytes
+	}
+	fmt.Fprintf(w, "%10d bytes %5d files  total\n", bytes, files)
+}
@@ -0,0 +1,57 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSizes(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go": "package foo\n\nimport \"internal/bar\"\n\nfunc Foo() int { return bar.Bar }\n",
+		"internal/bar/bar.go": "package bar\n\nconst Bar = 1\n",
+		"internal/bar/doc.go": "// Package bar has the constants of all the bars, and the doc comment for the size.\npackage bar\n",
+	})
+	fsys := newMemFS()
+	c := testCopier(t, src, fsys, "internal/foo")
+	c.Sizes = true
+	var stdout bytes.Buffer
+	c.Stdout = &stdout
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// the sizes of the written files of each package
+	type size struct{ files, bytes int }
+	sizes := make(map[string]*size)
+	for _, name := range fsys.paths(c.Dst) {
+		data, _ := fsys.file(filepath.Join(c.Dst, filepath.FromSlash(name)))
+		importPath := "internal/" + path.Dir(name)
+		if sizes[importPath] == nil {
+			sizes[importPath] = new(size)
+		}
+		sizes[importPath].files++
+		sizes[importPath].bytes += len(data)
+	}
+	bar, foo := sizes["internal/bar"], sizes["internal/foo"]
+	if bar == nil || foo == nil || bar.bytes <= foo.bytes {
+		t.Fatalf("unexpected written files %q", fsys.paths(c.Dst))
+	}
+
+	// descending by bytes
+	want := fmt.Sprintf("%10d bytes %5d files  internal/bar\n", bar.bytes, bar.files) +
+		fmt.Sprintf("%10d bytes %5d files  internal/foo\n", foo.bytes, foo.files) +
+		fmt.Sprintf("%10d bytes %5d files  total\n", bar.bytes+foo.bytes, bar.files+foo.files)
+	// followed by the summary line
+	if got := stdout.String(); !strings.HasPrefix(got, want) {
+		t.Errorf("got -sizes report\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/semver"
+)
+
+// addExternalImport records the import path left in the rewritten files if it
+// is neither std nor of the module, to be required by the module of Dst.
+func (c *Copier) addExternalImport(importPath string) {
+	if isStdImport(importPath) || importPath == c.Module || strings.HasPrefix(importPath, c.Module+"/") {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.externalImports[importPath] = true
+}
+
+// unresolvedImports returns the sorted external imports whose module version
+// is unknown, that is, which are not of the vendored modules.
+func (c *Copier) unresolvedImports() []string {
+	var imps []string
+	for imp := range c.externalImports {
+		if !hasModulePrefix(imp, c.vendorRequires) {
+			imps = append(imps, imp)
+		}
+	}
+	sort.Strings(imps)
+
+	return imps
+}
+
+// hasModulePrefix reports whether the import path is of any of the modules.
+func hasModulePrefix(importPath string, modules map[string]*vendorRequire) bool {
+	for mod := range modules {
+		if importPath == mod || strings.HasPrefix(importPath, mod+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// reportUnresolvedImports reports the external imports left in the copied
+// files whose module version go-copystd does not know.
+func (c *Copier) reportUnresolvedImports() {
+	for _, imp := range c.unresolvedImports() {
+		c.infof("require: no version is known for %s imported by the copied files, run: go get %s", imp, imp)
+	}
+}
+
+// writeGoModRequires adds the requirements of the vendored modules imported by
+// the copied files to the go.mod governing Dst, unless already required at
+// the version or newer. go.mod is left as is if the version of any external
+// import is unknown, and the go get commands to run are printed instead.
+func (c *Copier) writeGoModRequires() error {
+	root, ok := findModuleRoot(c.Dst)
+	if !ok {
+		return fmt.Errorf("-write-gomod: %s is in no module (use -init-module to create go.mod)", c.Dst)
+	}
+	path := filepath.Join(root, "go.mod")
+	data, err := c.FS.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read go.mod: %w", err)
+	}
+	f, err := modfile.Parse(path, data, nil)
+	if err != nil {
+		return fmt.Errorf("parse go.mod: %w", err)
+	}
+
+	required := make(map[string]*vendorRequire)
+	for _, r := range f.Require {
+		required[r.Mod.Path] = &vendorRequire{Path: r.Mod.Path, Version: r.Mod.Version}
+	}
+
+	var unknown []string
+	for _, imp := range c.unresolvedImports() {
+		if !hasModulePrefix(imp, required) {
+			unknown = append(unknown, imp)
+		}
+	}
+	var missing []*vendorRequire
+	for _, req := range c.sortedVendorRequires() {
+		if r, ok := required[req.Path]; !ok || semver.Compare(r.Version, req.Version) < 0 {
+			missing = append(missing, req)
+		}
+	}
+
+	if len(unknown) > 0 {
+		var cmds []string
+		for _, req := range missing {
+			cmds = append(cmds, "go get "+req.Path+"@"+req.Version)
+		}
+		for _, imp := range unknown {
+			cmds = append(cmds, "go get "+imp)
+		}
+		c.warnf("-write-gomod: %s is left as is since no version is known for %s; run in %s:\n\t%s",
+			path, strings.Join(unknown, ", "), root, strings.Join(cmds, "\n\t"))
+		return nil
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	for _, req := range missing {
+		if err := f.AddRequire(req.Path, req.Version); err != nil {
+			return fmt.Errorf("add require directive: %w", err)
+		}
+		c.infof("go.mod: require %s %s", req.Path, req.Version)
+	}
+	f.Cleanup()
+	data, err = f.Format()
+	if err != nil {
+		return fmt.Errorf("format go.mod: %w", err)
+	}
+	if _, err := c.writeIfChanged(path, data); err != nil {
+		return fmt.Errorf("write go.mod: %w", err)
+	}
+
+	return nil
+}
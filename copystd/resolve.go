@@ -0,0 +1,142 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// resolveDeps returns the packages to copy along with the listed roots, that
+// is, the transitive closure of the cmd and internal imports of the roots.
+//
+// The closure is computed with a worklist in the breadth-first order. The
+// visited set is keyed by the import path and shared across the roots of the
+// run, so that each package is listed and resolved exactly once. Only the
+// imports of the copied packages are followed, since the other std packages
+// are importable as is along with their own dependencies.
+func (c *Copier) resolveDeps(ctx context.Context, roots []*Package, visited map[string]bool) ([]*Package, error) {
+	for _, root := range roots {
+		visited[root.ImportPath] = true
+	}
+
+	var pkgs []*Package
+	var unclassified []string // by -strict-imports
+	queue := append([]*Package(nil), roots...)
+	for len(queue) > 0 {
+		pkg := queue[0]
+		queue = queue[1:]
+
+		var imps []string
+		for _, imp := range pkg.Imports {
+			imp = trimTestVariant(imp)
+			if isMetaPackage(imp) {
+				// go list would list the whole pattern
+				if !visited[imp] {
+					visited[imp] = true
+					c.warnf("ignore: %s imports %q, which is a package pattern rather than a package", pkg.ImportPath, imp)
+				}
+				continue
+			}
+			if !visited[imp] {
+				visited[imp] = true
+				imps = append(imps, imp)
+			}
+		}
+		if len(imps) == 0 {
+			continue
+		}
+		sort.Strings(imps)
+
+		depPkgs, err := c.listPackages(ctx, c.Src, imps...)
+		if err != nil {
+			return nil, fmt.Errorf("list packages: %w", err)
+		}
+		for _, depPkg := range depPkgs {
+			if strings.HasSuffix(depPkg.ImportPath, ".test") {
+				// the synthesized test main package of -test
+				continue
+			}
+
+			imp := depPkg.ImportPath
+			switch {
+			case isPseudoPackage(depPkg):
+				// nothing to copy nor to report
+
+			case c.isExcludedTest(depPkg):
+				// the imports of the excluded test files are not followed
+
+			case matchAny(c.IgnorePrefix, imp):
+				if !isTestVariant(depPkg) {
+					c.ignoref(imp, "%s is excluded by -exclude or -ignore-prefix", imp)
+				}
+
+			case isMissing(depPkg) && isInternalImport(imp):
+				// go list could not tell whether it is std, so fall back to the path
+				if isTestVariant(depPkg) {
+					continue
+				}
+				if err := c.handleMissing(depPkg); err != nil {
+					return nil, err
+				}
+
+			case isVendored(imp) && !c.CopyVendor && c.srcModule == "":
+				// imported by the canonical path from the module of Dst
+				if !isTestVariant(depPkg) {
+					if err := c.requireVendored(depPkg); err != nil {
+						return nil, err
+					}
+				}
+
+			case c.needsCopy(depPkg) && c.outsideResolveRoot(depPkg):
+				if !isTestVariant(depPkg) {
+					c.ignoref(imp, "%s is outside -resolve-root", imp)
+				}
+
+			case c.needsCopy(depPkg):
+				// the test variants are followed for the imports of the
+				// test files with DeepTestDeps, but copied along with the
+				// package; the test imports of the roots are always followed
+				if !isTestVariant(depPkg) {
+					pkgs = append(pkgs, depPkg)
+				} else if !c.DeepTestDeps {
+					continue
+				}
+				queue = append(queue, depPkg)
+
+			case depPkg.DepOnly, isTestVariant(depPkg):
+				// the indirect dependency which is importable as is
+
+			default:
+				if len(c.AllowImport) > 0 && !depPkg.Standard && !isStdImport(imp) && !matchAny(c.AllowImport, imp) {
+					return nil, fmt.Errorf("%s imports %s which is neither std nor allowed by -allow-import", pkg.ImportPath, imp)
+				}
+				if c.StrictImports && !depPkg.Standard && !matchAny(c.AllowImport, imp) {
+					unclassified = append(unclassified, pkg.ImportPath+" imports "+imp)
+					continue
+				}
+				c.ignoref(imp, "%s", imp)
+			}
+		}
+	}
+
+	if len(unclassified) > 0 {
+		return nil, fmt.Errorf("unclassified imports, neither std, copied, -allow-import nor -ignore-prefix:\n\t%s", strings.Join(unclassified, "\n\t"))
+	}
+
+	return pkgs, nil
+}
+
+// outsideResolveRoot reports whether the directory of pkg is outside
+// ResolveRoot, which limits the packages to copy.
+func (c *Copier) outsideResolveRoot(pkg *Package) bool {
+	if c.resolveRoot == "" || pkg.Dir == "" {
+		return false
+	}
+	inside, err := isWithin(c.resolveRoot, pkg.Dir)
+
+	return err == nil && !inside
+}
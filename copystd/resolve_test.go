@@ -0,0 +1,241 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAllowImport(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go": "package foo\n\nimport (\n\t\"fmt\"\n\n\t\"example.org/ext\"\n)\n\nvar _, _ = fmt.Sprint, ext.X\n",
+	})
+
+	tests := []struct {
+		name        string
+		allowImport []string
+		wantErr     string
+	}{
+		{name: "none"},
+		{name: "allowed", allowImport: []string{"example.org/..."}},
+		{name: "exact", allowImport: []string{"example.org/ext"}},
+		{
+			name:        "unlisted",
+			allowImport: []string{"example.org/other/..."},
+			wantErr:     "internal/foo imports example.org/ext which is neither std nor allowed by -allow-import",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := testCopier(t, src, newMemFS(), "internal/foo")
+			c.AllowImport = tt.allowImport
+
+			err := c.Run(context.Background())
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestResolveTest(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go":           "package foo\n\nfunc Foo() int { return 1 }\n",
+		"internal/foo/foo_test.go":      "package foo\n\nimport (\n\t\"internal/testhelper\"\n\t\"testing\"\n)\n\nfunc TestFoo(t *testing.T) { testhelper.Check(t, Foo()) }\n",
+		"internal/testhelper/helper.go": "package testhelper\n\nimport (\n\t\"internal/dep\"\n\t\"testing\"\n)\n\nfunc Check(t *testing.T, n int) { _ = dep.Dep }\n",
+		"internal/dep/dep.go":           "package dep\n\nconst Dep = 1\n",
+	})
+	// the test variants are listed by -test
+	buildTestGoroot(t, src)
+
+	for _, test := range []bool{false, true} {
+		want := []string{"foo/foo.go", "foo/foo_test.go"}
+		if test {
+			want = []string{"dep/dep.go", "foo/foo.go", "foo/foo_test.go", "testhelper/helper.go"}
+		}
+		fsys := newMemFS()
+		c := testCopier(t, src, fsys, "internal/foo")
+		c.Test = test
+
+		if err := c.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := fsys.paths(c.Dst); !reflect.DeepEqual(got, want) {
+			t.Errorf("-test=%t: copied files: got %q, want %q", test, got, want)
+		}
+	}
+}
+
+func TestIgnorePrefix(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go":       "package foo\n\nimport (\n\t\"internal/bar\"\n\t\"internal/sys/unix\"\n)\n\nvar _, _ = bar.Bar, unix.Unix\n",
+		"internal/bar/bar.go":       "package bar\n\nconst Bar = 1\n",
+		"internal/sys/unix/unix.go": "package unix\n\nconst Unix = 1\n",
+	})
+	fsys := newMemFS()
+	c := testCopier(t, src, fsys, "internal/foo")
+	c.IgnorePrefix = []string{"internal/sys/..."}
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := fsys.paths(c.Dst), []string{"bar/bar.go", "foo/foo.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("copied files: got %q, want %q", got, want)
+	}
+	foo, _ := fsys.file(filepath.Join(c.Dst, "foo", "foo.go"))
+	for _, want := range []string{`"example.com/m/bar"`, `"internal/sys/unix"`} {
+		if !strings.Contains(foo, want) {
+			t.Errorf("foo.go does not import %s:\n%s", want, foo)
+		}
+	}
+}
+
+func TestStrictImports(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go": "package foo\n\nimport (\n\t\"fmt\"\n\n\t\"example.org/ext\"\n\t\"example.org/ignored\"\n)\n\nvar _, _, _ = fmt.Sprint, ext.X, ignored.X\n",
+	})
+
+	tests := []struct {
+		name        string
+		allowImport []string
+		wantErr     string
+	}{
+		{
+			name:    "unclassified",
+			wantErr: "unclassified imports, neither std, copied, -allow-import nor -ignore-prefix:\n\tinternal/foo imports example.org/ext",
+		},
+		{name: "allowed", allowImport: []string{"example.org/ext"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys := newMemFS()
+			c := testCopier(t, src, fsys, "internal/foo")
+			c.StrictImports = true
+			c.AllowImport = tt.allowImport
+			c.IgnorePrefix = []string{"example.org/ignored"}
+
+			err := c.Run(context.Background())
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got error %v, want %q", err, tt.wantErr)
+			}
+			if strings.Contains(err.Error(), "example.org/ignored") {
+				t.Errorf("the ignored import is reported: %v", err)
+			}
+			if paths := fsys.paths(c.Dst); len(paths) > 0 {
+				t.Errorf("files are written: %q", paths)
+			}
+		})
+	}
+}
+
+func TestResolveRoot(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo/foo.go": "package foo\n\nimport (\n\t\"internal/bar\"\n\t\"internal/foo/sub\"\n)\n\nvar _, _ = bar.Bar, sub.Sub\n",
+		"internal/foo/sub/sub.go": "package sub\n\nconst Sub = 1\n",
+		"internal/bar/bar.go":     "package bar\n\nconst Bar = 1\n",
+	})
+	fsys := newMemFS()
+	c := testCopier(t, src, fsys, "internal/foo/foo")
+	c.ResolveRoot = "internal/foo"
+	var stdout strings.Builder
+	c.Stdout = &stdout
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := fsys.paths(c.Dst), []string{"foo/foo/foo.go", "foo/sub/sub.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("copied files: got %q, want %q", got, want)
+	}
+	if want := "internal/bar is outside -resolve-root"; !strings.Contains(stdout.String(), want) {
+		t.Errorf("got\n%s\nwant %q", &stdout, want)
+	}
+}
+
+func TestDeepTestDeps(t *testing.T) {
+	// the test only imports of the dependency a chain b, and then c
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go":  "package foo\n\nimport \"internal/a\"\n\nvar _ = a.A\n",
+		"internal/a/a.go":      "package a\n\nconst A = 1\n",
+		"internal/a/a_test.go": "package a\n\nimport (\n\t\"internal/b\"\n\t\"testing\"\n)\n\nfunc TestA(t *testing.T) { _ = b.B }\n",
+		"internal/b/b.go":      "package b\n\nconst B = 1\n",
+		"internal/b/b_test.go": "package b\n\nimport (\n\t\"internal/c\"\n\t\"testing\"\n)\n\nfunc TestB(t *testing.T) { _ = c.C }\n",
+		"internal/c/c.go":      "package c\n\nconst C = 1\n",
+	})
+	buildTestGoroot(t, src)
+
+	for _, deep := range []bool{false, true} {
+		want := []string{"a/a.go", "a/a_test.go", "foo/foo.go"}
+		if deep {
+			want = []string{"a/a.go", "a/a_test.go", "b/b.go", "b/b_test.go", "c/c.go", "foo/foo.go"}
+		}
+		fsys := newMemFS()
+		c := testCopier(t, src, fsys, "internal/foo")
+		c.Test = true
+		c.DeepTestDeps = deep
+
+		if err := c.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := fsys.paths(c.Dst); !reflect.DeepEqual(got, want) {
+			t.Errorf("-deep-test-deps=%t: copied files: got %q, want %q", deep, got, want)
+		}
+	}
+}
+
+func TestResolveDedup(t *testing.T) {
+	// both roots import shared and fmt, and deep is only reachable through
+	// shared
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go":       "package foo\n\nimport (\n\t\"fmt\"\n\t\"internal/shared\"\n)\n\nvar _, _ = fmt.Sprint, shared.Shared\n",
+		"internal/bar/bar.go":       "package bar\n\nimport (\n\t\"fmt\"\n\t\"internal/shared\"\n)\n\nvar _, _ = fmt.Sprint, shared.Shared\n",
+		"internal/shared/shared.go": "package shared\n\nimport (\n\t\"fmt\"\n\t\"internal/deep\"\n)\n\nvar Shared = fmt.Sprint(deep.Deep)\n",
+		"internal/deep/deep.go":     "package deep\n\nconst Deep = 1\n",
+	})
+	fsys := newMemFS()
+	c := testCopier(t, src, fsys, "internal/foo", "internal/bar")
+	var stdout strings.Builder
+	c.Stdout = &stdout
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := fsys.paths(c.Dst), []string{"bar/bar.go", "deep/deep.go", "foo/foo.go", "shared/shared.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("copied files: got %q, want %q", got, want)
+	}
+	ignored := make(map[string]int)
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		if strings.HasPrefix(line, "ignore: ") {
+			ignored[strings.TrimPrefix(line, "ignore: ")]++
+		}
+	}
+	if n := ignored["fmt"]; n != 1 {
+		t.Errorf("got %d ignore lines of fmt, want 1\n%s", n, &stdout)
+	}
+	for imp, n := range ignored {
+		if n > 1 {
+			t.Errorf("got %d ignore lines of %s, want 1", n, imp)
+		}
+	}
+}
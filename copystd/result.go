@@ -0,0 +1,55 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"context"
+	"sort"
+)
+
+// CopiedFile is a file copied by Copy.
+type CopiedFile struct {
+	Package string // import path of the source package
+	Src     string // source file path
+	Dst     string // destination file path
+}
+
+// Result is the outcome of Copy.
+type Result struct {
+	Copied   []CopiedFile // sorted by Dst
+	Skipped  []string     // source files skipped by the options, and destination files left as is by Update
+	Warnings []string     // warnings printed by the run, regardless of LogLevel
+}
+
+// Copy copies the packages as Run does, and returns the files copied and
+// skipped and the warnings of the run. The result so far is returned along
+// with the error, if any.
+func (c *Copier) Copy(ctx context.Context) (*Result, error) {
+	r := *c
+	r.init()
+	err := r.run(ctx)
+
+	return r.result(), err
+}
+
+// result returns the Result of the run.
+func (c *Copier) result() *Result {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	res := &Result{
+		Skipped: append([]string(nil), c.skipped...),
+	}
+	for _, f := range c.copiedFiles {
+		res.Copied = append(res.Copied, CopiedFile{Package: f.Package, Src: f.Source, Dst: f.Dest})
+	}
+	sort.Slice(res.Copied, func(i, j int) bool { return res.Copied[i].Dst < res.Copied[j].Dst })
+	sort.Strings(res.Skipped)
+
+	c.logMu.Lock()
+	res.Warnings = append([]string(nil), c.warnings...)
+	c.logMu.Unlock()
+
+	return res
+}
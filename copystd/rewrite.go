@@ -0,0 +1,188 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// list of Copier.Layout values.
+const (
+	LayoutFlatten  = "flatten"  // drop the leading cmd and the internal path elements
+	LayoutPreserve = "preserve" // keep the path elements relative to the source root
+)
+
+// layoutElems returns the path elements of the package under the module by
+// Layout from the ones relative to the source root.
+func (c *Copier) layoutElems(elems []string) []string {
+	if c.Layout == LayoutPreserve {
+		return elems
+	}
+
+	if c.srcModule == "" && len(elems) > 0 && elems[0] == "cmd" {
+		elems = elems[1:]
+	}
+	kept := make([]string, 0, len(elems))
+	for _, elem := range elems {
+		if elem != "internal" {
+			kept = append(kept, elem)
+		}
+	}
+
+	return kept
+}
+
+// rewriteImports rewrites the cmd and internal import paths of the import
+// declarations of the Go source body to the module. Only the packages in the
+// copy set, that is, the copied and the stubbed ones, are rewritten, and the
+// others, such as the ones left by -on-missing=leave, are kept as is. The
+// imports of IgnorePrefix are rewritten by ExcludeMap if mapped.
+//
+// Only the import path literals are replaced in place, so any other part of
+// body, such as the string literals and the comments which merely resemble
+// the import paths, is left byte for byte.
+func (c *Copier) rewriteImports(filename, body string) (string, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, body, parser.ImportsOnly|parser.ParseComments)
+	if err != nil {
+		return "", fmt.Errorf("parse %s: %w", filename, err)
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, spec := range f.Imports {
+		imp, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			return "", fmt.Errorf("unquote import path %s: %w", spec.Path.Value, err)
+		}
+		if vendored, ok := c.vendored[imp]; ok {
+			// the vendored package is imported by its canonical path
+			imp = vendored
+		}
+		newPath, excluded := c.mapExcluded(imp)
+		switch {
+		case excluded && newPath == imp:
+			c.addExcludedRef(imp, filename)
+			continue
+		case excluded:
+			c.addExternalImport(newPath)
+		default:
+			newPath = c.rewriteImportPath(imp)
+			if newPath == imp {
+				c.addExternalImport(imp)
+				continue
+			}
+			if !c.inCopySet(imp, newPath) {
+				c.debugf("keep: %s imports %s, which is not copied", filename, imp)
+				continue
+			}
+		}
+
+		start := fset.Position(spec.Path.Pos()).Offset
+		b.WriteString(body[last:start])
+		if path.Base(newPath) != path.Base(imp) && spec.Name == nil {
+			// the references keep the original package name of the renamed
+			// or rewritten last element
+			b.WriteString(c.packageName(imp) + " ")
+		}
+		b.WriteString(strconv.Quote(newPath))
+		last = start + len(spec.Path.Value)
+	}
+	if last == 0 {
+		return body, nil
+	}
+	b.WriteString(body[last:])
+
+	return b.String(), nil
+}
+
+// inCopySet reports whether the package of importPath, rewritten to newPath,
+// is copied or stubbed by the run.
+func (c *Copier) inCopySet(importPath, newPath string) bool {
+	if _, ok := c.copiedPackages[newPath]; ok {
+		return true
+	}
+
+	return c.stubbed[importPath]
+}
+
+// rewriteImportPath rewrites the cmd or internal import path to the module by
+// the first matching rewrite rule, or by default laying out the path elements
+// by Layout as the destination directory does. Any other import path,
+// including the ones under -ignore-prefix and the bare "cmd" unless a rule
+// matches it, is returned as is.
+func (c *Copier) rewriteImportPath(importPath string) string {
+	if !c.isCopiedPath(importPath) || matchAny(c.IgnorePrefix, importPath) {
+		return importPath
+	}
+
+	if rel, ok := c.matchRewrite(importPath); ok {
+		return c.renamedPath(importPath, path.Join(c.Module, rel))
+	}
+	if canonical, ok := vendorPath(importPath); ok && c.srcModule == "" {
+		return c.renamedPath(importPath, path.Join(c.Module, vendorDstPath(canonical)))
+	}
+
+	elems := strings.Split(importPath, "/")
+	if c.srcModule != "" {
+		elems = strings.Split(strings.TrimPrefix(importPath, c.srcModule+"/"), "/")
+	}
+	kept := c.layoutElems(elems)
+	if len(kept) == 0 || (c.srcModule == "" && (importPath == "cmd" || importPath == "internal")) {
+		// a bare "cmd" or "internal" is not a copied package, and would
+		// otherwise be rewritten to the module root
+		return importPath
+	}
+	rel := c.trimModulePrefix(importPath, path.Join(kept...))
+
+	return c.renamedPath(importPath, path.Join(c.Module, rel))
+}
+
+// trimModulePrefix trims the module path prefixes of rel, the rewritten path
+// of importPath relative to the module, which would otherwise double the
+// prefix such as mymod/mymod/foo, for instance by a rewrite rule to the full
+// import path or by copying from a tree already rewritten to the module.
+func (c *Copier) trimModulePrefix(importPath, rel string) string {
+	trimmed := rel
+	for trimmed == c.Module || strings.HasPrefix(trimmed, c.Module+"/") {
+		trimmed = strings.TrimPrefix(strings.TrimPrefix(trimmed, c.Module), "/")
+	}
+	if trimmed == rel {
+		return rel
+	}
+	if trimmed == "" {
+		trimmed = "."
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.doublePrefixed[importPath] {
+		c.doublePrefixed[importPath] = true
+		c.warnf("%s is rewritten to %s with the module prefix doubled, use %s instead", importPath, path.Join(c.Module, rel), path.Join(c.Module, trimmed))
+	}
+
+	return trimmed
+}
+
+// isCopiedPath reports whether the import path is a cmd package or a std
+// package under an internal directory, or with -module-source, an internal
+// package of the module, which is copied to the module.
+func (c *Copier) isCopiedPath(importPath string) bool {
+	if c.srcModule != "" {
+		return c.isModuleInternal(importPath)
+	}
+	if !isStdImport(importPath) {
+		return false
+	}
+	if _, ok := vendorPath(importPath); ok {
+		return c.CopyVendor
+	}
+
+	return isInternalImport(importPath)
+}
@@ -0,0 +1,167 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRewriteGenericInstantiation(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go": `package foo
+
+import "internal/generic"
+
+var set generic.Set[int]
+
+type pairs = generic.Map[string, []int]
+
+func Keys(m pairs) []string { return generic.Keys[string, []int](m) }
+
+func Len() int { return generic.Len(set) }
+`,
+		"internal/generic/generic.go": `package generic
+
+type Set[K comparable] map[K]struct{}
+
+type Map[K comparable, V any] map[K]V
+
+func Keys[K comparable, V any](m map[K]V) []K { return nil }
+
+func Len[K comparable](s Set[K]) int { return len(s) }
+`,
+	})
+	fsys := newMemFS()
+	c := testCopier(t, src, fsys, "internal/foo")
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := fsys.paths(c.Dst), []string{"foo/foo.go", "generic/generic.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("copied files: got %q, want %q", got, want)
+	}
+	const want = `package foo
+
+import "example.com/m/generic"
+
+var set generic.Set[int]
+
+type pairs = generic.Map[string, []int]
+
+func Keys(m pairs) []string { return generic.Keys[string, []int](m) }
+
+func Len() int { return generic.Len(set) }
+`
+	if got, _ := fsys.file(filepath.Join(c.Dst, "foo", "foo.go")); got != want {
+		t.Errorf("got foo.go\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestRewriteImportsOnly(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go": `package foo
+
+import (
+	"internal/bar"
+)
+
+// Path is the import path of "internal/bar".
+const Path = "internal/bar"
+
+var internal = bar.Bar
+`,
+		"internal/bar/bar.go": "package bar\n\nconst Bar = 1\n",
+	})
+	fsys := newMemFS()
+	c := testCopier(t, src, fsys, "internal/foo")
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	const want = `package foo
+
+import (
+	"example.com/m/bar"
+)
+
+// Path is the import path of "internal/bar".
+const Path = "internal/bar"
+
+var internal = bar.Bar
+`
+	if got, _ := fsys.file(filepath.Join(c.Dst, "foo", "foo.go")); got != want {
+		t.Errorf("got foo.go\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestDoublePrefix(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go": "package foo\n\nimport \"internal/bar\"\n\nfunc Foo() int { return bar.Bar }\n",
+		"internal/bar/bar.go": "package bar\n\nconst Bar = 1\n",
+	})
+	fsys := newMemFS()
+	c := testCopier(t, src, fsys, "internal/foo")
+	// the rule is given the full import path rather than the one relative to
+	// the module
+	c.Rewrite = []string{"internal/bar=example.com/m/lib/bar"}
+	var stderr strings.Builder
+	c.Stderr = &stderr
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := fsys.paths(c.Dst), []string{"foo/foo.go", "lib/bar/bar.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("copied files: got %q, want %q", got, want)
+	}
+	foo, _ := fsys.file(filepath.Join(c.Dst, "foo", "foo.go"))
+	if !strings.Contains(foo, `import "example.com/m/lib/bar"`) {
+		t.Errorf("foo.go does not import the copied bar:\n%s", foo)
+	}
+	want := "internal/bar is rewritten to example.com/m/example.com/m/lib/bar with the module prefix doubled, use example.com/m/lib/bar instead"
+	if got := stderr.String(); strings.Count(got, want) != 1 {
+		t.Errorf("got warnings\n%s\nwant once %q", got, want)
+	}
+}
+
+func TestBareCmdImport(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go": "package foo\n\nimport (\n\t_ \"cmd\"\n\t\"internal/bar\"\n)\n\nvar _ = bar.Bar\n",
+		"internal/bar/bar.go": "package bar\n\nconst Bar = 1\n",
+	})
+	fsys := newMemFS()
+	c := testCopier(t, src, fsys, "internal/foo")
+	var stderr strings.Builder
+	c.Stderr = &stderr
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// "cmd" is a pattern, which is left as is rather than rewritten to the
+	// module root
+	foo, _ := fsys.file(filepath.Join(c.Dst, "foo", "foo.go"))
+	if want := "import (\n\t_ \"cmd\"\n\n\t\"example.com/m/bar\"\n)\n"; !strings.Contains(foo, want) {
+		t.Errorf("got foo.go\n%s\nwant\n%s", foo, want)
+	}
+	if want := `internal/foo imports "cmd", which is a package pattern rather than a package`; !strings.Contains(stderr.String(), want) {
+		t.Errorf("got warnings\n%s\nwant %q", &stderr, want)
+	}
+	c.init()
+	for imp, want := range map[string]string{
+		"cmd":         "cmd",
+		"internal":    "internal",
+		"cmd/compile": "example.com/m/compile",
+	} {
+		if got := c.rewriteImportPath(imp); got != want {
+			t.Errorf("rewriteImportPath(%q): got %q, want %q", imp, got, want)
+		}
+	}
+}
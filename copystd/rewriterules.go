@@ -0,0 +1,97 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// rewriteRule rewrites the import path prefix from to the path to relative
+// to the module.
+type rewriteRule struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Exact bool   `json:"-"` // whether only the package of From is rewritten, by Map
+}
+
+// parseRewriteRule parses the rewrite rule in from=to form.
+func parseRewriteRule(s string) (rewriteRule, error) {
+	from, to, ok := strings.Cut(s, "=")
+	rule := rewriteRule{From: from, To: to}
+	if !ok {
+		return rule, fmt.Errorf("invalid rewrite rule %q: must be from=to form", s)
+	}
+
+	return rule, rule.validate()
+}
+
+// validate reports whether the rule is the clean relative paths.
+func (r rewriteRule) validate() error {
+	if r.From == "" || path.Clean(r.From) != r.From || path.IsAbs(r.From) {
+		return fmt.Errorf("invalid rewrite rule %s=%s: from must be a clean import path", r.From, r.To)
+	}
+	if r.To == "" || path.Clean(r.To) != r.To || path.IsAbs(r.To) || r.To == ".." || strings.HasPrefix(r.To, "../") {
+		return fmt.Errorf("invalid rewrite rule %s=%s: to must be a clean relative path within the module, or . for the module root", r.From, r.To)
+	}
+
+	return nil
+}
+
+// loadRewriteFile reads the JSON array of the rewrite rules at path, such as
+//
+//	[{"from": "internal/race", "to": "runtime/race"}]
+func (c *Copier) loadRewriteFile(path string) ([]rewriteRule, error) {
+	data, err := c.FS.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read %s file: %w", path, err)
+	}
+
+	var rules []rewriteRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", path, err)
+	}
+	for _, rule := range rules {
+		if err := rule.validate(); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	return rules, nil
+}
+
+// matchRewrite returns the path relative to the module of importPath
+// rewritten by the first rule whose from is importPath or, unless the rule is
+// exact, its path prefix. It reports false if no rule matches.
+func (c *Copier) matchRewrite(importPath string) (string, bool) {
+	for _, rule := range c.rewriteRules {
+		if importPath == rule.From {
+			return c.trimModulePrefix(importPath, rule.To), true
+		}
+		if rule.Exact {
+			continue
+		}
+		if rest := strings.TrimPrefix(importPath, rule.From+"/"); rest != importPath {
+			return c.trimModulePrefix(importPath, path.Join(rule.To, rest)), true
+		}
+	}
+
+	return "", false
+}
+
+// reportUnusedMaps warns of the Map rules whose package is not copied, which
+// could be stale.
+func (c *Copier) reportUnusedMaps() {
+	copied := make(map[string]bool)
+	for _, pkg := range c.copiedPackages {
+		copied[pkg.ImportPath] = true
+	}
+	for _, rule := range c.rewriteRules {
+		if rule.Exact && !copied[rule.From] {
+			c.warnf("-map %s=%s: %s is not copied", rule.From, rule.To, rule.From)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// copyScript records the planned operations as a shell script for -emit-script.
+//
+// A nil *copyScript records nothing.
+type copyScript struct {
+	mu   sync.Mutex
+	buf  bytes.Buffer
+	dirs map[string]bool
+}
+
+func newCopyScript() *copyScript {
+	s := &copyScript{
+		dirs: make(map[string]bool),
+	}
+	s.buf.WriteString("#!/bin/sh\n")
+	s.buf.WriteString("# Generated by go-copystd -emit-script.\n")
+	s.buf.WriteString("set -eu\n")
+
+	return s
+}
+
+// mkdir records the creation of the dir once. s.mu must be held.
+func (s *copyScript) mkdir(dir string) {
+	if s.dirs[dir] {
+		return
+	}
+	s.dirs[dir] = true
+	fmt.Fprintf(&s.buf, "\nmkdir -p %s\n", shellQuote(dir))
+}
+
+// copyFile records the copy of the src file to dst.
+//
+// The file is copied verbatim only if the transformation did not change it,
+// so the formatting by goimports is not reflected in the script. Otherwise
+// it notes the rewrite instead of the command.
+func (s *copyScript) copyFile(src, dst string, verbatim bool) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mkdir(filepath.Dir(dst))
+	if verbatim {
+		fmt.Fprintf(&s.buf, "cp %s %s\n", shellQuote(src), shellQuote(dst))
+		return
+	}
+	fmt.Fprintf(&s.buf, "# rewrite: %s -> %s\n", src, dst)
+}
+
+// link records the symbolic link of dst to the src file.
+func (s *copyScript) link(src, dst string) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mkdir(filepath.Dir(dst))
+	fmt.Fprintf(&s.buf, "ln -sf %s %s\n", shellQuote(src), shellQuote(dst))
+}
+
+// generate records the generation of the dst file which has no source file.
+func (s *copyScript) generate(dst, what string) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mkdir(filepath.Dir(dst))
+	fmt.Fprintf(&s.buf, "# generate %s: %s\n", what, dst)
+}
+
+// write writes the recorded script to path on fsys.
+func (s *copyScript) write(fsys FileSystem, path string) error {
+	if err := fsys.WriteFile(path, s.buf.Bytes(), 0o755); err != nil {
+		return fmt.Errorf("write script: %w", err)
+	}
+
+	return nil
+}
+
+// shellQuote quotes s for the POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,45 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEmitScript(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go": "package foo\n\nimport \"internal/bar\"\n\nfunc Foo() int { return bar.Bar }\n",
+		"internal/bar/bar.go": "package bar\n\nconst Bar = 1\n",
+	})
+	fsys := newMemFS()
+	c := testCopier(t, src, fsys, "internal/foo")
+	c.EmitScript = filepath.Join(t.TempDir(), "copy.sh")
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if paths := fsys.paths(c.Dst); len(paths) > 0 {
+		t.Errorf("files are written: %q", paths)
+	}
+	script, ok := fsys.file(c.EmitScript)
+	if !ok {
+		t.Fatal("the script is not written")
+	}
+	pkgDir := filepath.Join(src, "src", "internal")
+	for _, want := range []string{
+		"#!/bin/sh\n",
+		"\nmkdir -p " + shellQuote(filepath.Join(c.Dst, "bar")) + "\n",
+		"\ncp " + shellQuote(filepath.Join(pkgDir, "bar", "bar.go")) + " " + shellQuote(filepath.Join(c.Dst, "bar", "bar.go")) + "\n",
+		"\nmkdir -p " + shellQuote(filepath.Join(c.Dst, "foo")) + "\n",
+		"\n# rewrite: " + filepath.Join(pkgDir, "foo", "foo.go") + " -> " + filepath.Join(c.Dst, "foo", "foo.go") + "\n",
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("the script does not have %q:\n%s", want, script)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// rootDocSource generates the doc.go of the package name in the module root,
+// which documents the source Go version and the copied packages.
+func rootDocSource(name, version string, packages []string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n\n", DefaultGeneratedMarker)
+	fmt.Fprintf(&b, "// Package %s holds the packages copied from the %s source tree by go-copystd.\n", name, version)
+	if len(packages) > 0 {
+		b.WriteString("//\n// The copied packages are:\n//\n")
+		for _, pkg := range packages {
+			fmt.Fprintf(&b, "//\t%s\n", pkg)
+		}
+	}
+	fmt.Fprintf(&b, "package %s\n", name)
+
+	return b.String()
+}
+
+// writeRootDoc writes the doc.go of the module root to Dst with Init. The
+// existing doc.go is left as is unless -force is given.
+func (c *Copier) writeRootDoc(ctx context.Context) error {
+	path := filepath.Join(c.Dst, "doc.go")
+	if !c.Force {
+		if _, err := c.FS.ReadFile(path); err == nil {
+			c.warnf("%s exists, skip the doc.go of -init (use -force to overwrite)", path)
+			return nil
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("read doc.go: %w", err)
+		}
+	}
+
+	version, err := c.sourceGoVersion(ctx)
+	if err != nil {
+		return fmt.Errorf("discover source Go version: %w", err)
+	}
+	packages := make([]string, 0, len(c.copiedPackages))
+	for importPath := range c.copiedPackages {
+		packages = append(packages, importPath)
+	}
+	sort.Strings(packages)
+
+	if c.script != nil {
+		c.script.generate(path, "doc.go")
+		return nil
+	}
+	if _, err := c.writeFile(c.Dst, "doc.go", rootDocSource(stampPackageName(c.Module), version, packages)); err != nil {
+		return fmt.Errorf("write doc.go: %w", err)
+	}
+
+	return nil
+}
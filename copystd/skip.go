@@ -0,0 +1,95 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// skipReason returns the option skipping the source file with data, or "" if
+// the file is not skipped. The hard-coded zbootstrap.go is skipped by
+// skipFile instead.
+func (c *Copier) skipReason(file, data string) string {
+	rel, err := c.srcRel(file)
+	if err != nil {
+		rel = file
+	}
+	rel = filepath.ToSlash(rel)
+	for _, pattern := range c.Skip {
+		name := rel
+		if !strings.Contains(pattern, "/") {
+			name = path.Base(rel)
+		}
+		if matchGlob(pattern, name) {
+			return "-skip"
+		}
+	}
+
+	if c.SkipGenerated && isGoFile(file) && hasGeneratedHeader(data) {
+		return "-skip-generated"
+	}
+
+	return ""
+}
+
+// validateSkip reports whether the Skip patterns are valid.
+func (c *Copier) validateSkip() error {
+	for _, pattern := range c.Skip {
+		for _, elem := range strings.Split(pattern, "/") {
+			if _, err := path.Match(elem, ""); err != nil {
+				return fmt.Errorf("invalid -skip value %q: %w", pattern, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// matchGlob reports whether the slash separated name matches the pattern of
+// the path.Match elements, where the ** element matches zero or more
+// elements.
+func matchGlob(pattern, name string) bool {
+	return matchGlobElems(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchGlobElems(pattern, name []string) bool {
+	if len(pattern) == 0 {
+		return len(name) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(name); i++ {
+			if matchGlobElems(pattern[1:], name[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(name) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(pattern[0], name[0]); !ok {
+		return false
+	}
+
+	return matchGlobElems(pattern[1:], name[1:])
+}
+
+// hasGeneratedHeader reports whether the Go source data has a line of the
+// generated code convention before the package clause.
+func hasGeneratedHeader(data string) bool {
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "package ") {
+			break
+		}
+		if generatedRe.MatchString(line) {
+			return true
+		}
+	}
+
+	return false
+}
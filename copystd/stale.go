@@ -0,0 +1,140 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// digestFS wraps a FileSystem to read from it and record the digests of the
+// written files instead of writing them, for CheckStale.
+type digestFS struct {
+	FileSystem
+
+	algo string
+	mu   sync.Mutex
+	sums map[string]string // keyed by the file path
+}
+
+var _ FileSystem = (*digestFS)(nil)
+
+func (f *digestFS) WriteFile(name string, data []byte, perm os.FileMode) error {
+	h := newHash(f.algo)
+	h.Write(data)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sums[name] = hex.EncodeToString(h.Sum(nil))
+
+	return nil
+}
+
+// digest returns the digest of the file written to name, or of the existing
+// one, which is left as is if the copy has the same content.
+func (f *digestFS) digest(name string) (string, error) {
+	f.mu.Lock()
+	sum, ok := f.sums[name]
+	f.mu.Unlock()
+	if ok {
+		return sum, nil
+	}
+
+	data, err := f.FileSystem.ReadFile(name)
+	if err != nil {
+		return "", fmt.Errorf("read %s file: %w", name, err)
+	}
+	h := newHash(f.algo)
+	h.Write(data)
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (*digestFS) MkdirAll(path string, perm os.FileMode) error { return nil }
+
+func (*digestFS) Remove(name string) error { return nil }
+
+func (*digestFS) Symlink(oldname, newname string) error { return nil }
+
+// CheckStale re-resolves the packages, or Packages if nil, against Src and
+// compares the files a copy would write with the digests of the manifest
+// previously written by Manifest in ManifestFormat. It returns the sorted
+// import paths of the packages whose files changed upstream since then,
+// including the files added or removed, without writing anything. A removed
+// file outside of the copied packages is reported by its manifest path.
+func (c *Copier) CheckStale(ctx context.Context, packages []string) ([]string, error) {
+	if c.Manifest == "" {
+		return nil, errors.New("no manifest to check against: give -manifest")
+	}
+
+	r := *c
+	if packages != nil {
+		r.Packages = packages
+	}
+	r.DryRun = true
+	r.EmitScript = ""
+	r.init()
+	entries, err := r.readManifest(r.Manifest, r.ManifestFormat)
+	if err != nil {
+		return nil, err
+	}
+	fsys := &digestFS{FileSystem: r.FS, algo: r.HashAlgo, sums: make(map[string]string)}
+	r.FS = fsys
+	r.checking = true
+
+	if err := r.run(ctx); err != nil {
+		return nil, err
+	}
+
+	recorded := make(map[string]string, len(entries))
+	for _, e := range entries {
+		sum := e.digest(r.HashAlgo)
+		if sum == "" {
+			return nil, fmt.Errorf("%s has no %s digest of %s: give the -hash-algo it was written with", r.Manifest, r.HashAlgo, e.Path)
+		}
+		recorded[e.Path] = sum
+	}
+
+	stale := make(map[string]bool)
+	dirs := make(map[string]string) // package import paths keyed by the destination directory
+	for _, f := range r.copiedFiles {
+		rel, err := filepath.Rel(r.Dst, f.Dest)
+		if err != nil {
+			return nil, fmt.Errorf("relative path of %s: %w", f.Dest, err)
+		}
+		rel = filepath.ToSlash(rel)
+		dirs[path.Dir(rel)] = f.Package
+		sum, err := fsys.digest(f.Dest)
+		if err != nil {
+			return nil, err
+		}
+		if recordedSum, ok := recorded[rel]; !ok || recordedSum != sum {
+			stale[f.Package] = true
+		}
+		delete(recorded, rel)
+	}
+	for rel := range recorded {
+		// the file is removed upstream, or its package is no longer copied
+		if pkg, ok := dirs[path.Dir(rel)]; ok {
+			stale[pkg] = true
+		} else {
+			stale[rel] = true
+		}
+	}
+
+	list := make([]string, 0, len(stale))
+	for pkg := range stale {
+		list = append(list, pkg)
+	}
+	sort.Strings(list)
+
+	return list, nil
+}
@@ -0,0 +1,60 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCheckStale(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go": "package foo\n\nimport (\n\t\"internal/bar\"\n\t\"internal/baz\"\n)\n\nvar _, _ = bar.Bar, baz.Baz\n",
+		"internal/bar/bar.go": "package bar\n\nconst Bar = 1\n",
+		"internal/baz/baz.go": "package baz\n\nconst Baz = 1\n",
+	})
+	fsys := newMemFS()
+	c := testCopier(t, src, fsys, "internal/foo")
+	c.Manifest = filepath.Join(t.TempDir(), "manifest.json")
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	stale, err := c.CheckStale(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stale) > 0 {
+		t.Errorf("up to date: got stale %q", stale)
+	}
+
+	// bar changes and baz gets a file upstream
+	srcDir := filepath.Join(src, "src", "internal")
+	for name, data := range map[string]string{
+		"bar/bar.go": "package bar\n\nconst Bar = 2\n",
+		"baz/new.go": "package baz\n",
+	} {
+		if err := os.WriteFile(filepath.Join(srcDir, filepath.FromSlash(name)), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	before, _ := fsys.file(c.Manifest)
+
+	stale, err = c.CheckStale(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"internal/bar", "internal/baz"}; !reflect.DeepEqual(stale, want) {
+		t.Errorf("got stale %q, want %q", stale, want)
+	}
+	if got := fsys.paths(c.Dst); !reflect.DeepEqual(got, []string{"bar/bar.go", "baz/baz.go", "foo/foo.go"}) {
+		t.Errorf("CheckStale writes the files: %q", got)
+	}
+	if after, _ := fsys.file(c.Manifest); after != before {
+		t.Errorf("CheckStale writes the manifest:\n%s", after)
+	}
+}
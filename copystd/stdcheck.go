@@ -0,0 +1,72 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"strings"
+)
+
+// loadStdList reads the std package list at path, which is the output of
+// 'go list std' on the target toolchain.
+func (c *Copier) loadStdList(path string) (map[string]bool, error) {
+	data, err := c.FS.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read %s file: %w", path, err)
+	}
+
+	std := make(map[string]bool)
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		std[line] = true
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("scan %s file: %w", path, err)
+	}
+
+	return std, nil
+}
+
+// checkAllowedStd reports the std imports of the copied Go file which are not
+// in the std package list of the target Go, that is, the packages introduced
+// in a newer Go. It is a warning or, if -strict is given, an error.
+func (c *Copier) checkAllowedStd(file, body string, std map[string]bool) error {
+	f, err := parser.ParseFile(token.NewFileSet(), file, body, parser.ImportsOnly)
+	if err != nil {
+		return fmt.Errorf("parse %s: %w", file, err)
+	}
+
+	var missing []string
+	for _, spec := range f.Imports {
+		imp, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			return fmt.Errorf("unquote import path %s: %w", spec.Path.Value, err)
+		}
+		if imp == "C" || !isStdImport(imp) || std[imp] || strings.HasPrefix(imp, c.Module+"/") {
+			continue
+		}
+		missing = append(missing, imp)
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	msg := fmt.Sprintf("%s imports %s which is not in the target std", file, strings.Join(missing, ", "))
+	if c.Strict {
+		return errors.New(msg)
+	}
+	c.warnf("%s", msg)
+
+	return nil
+}
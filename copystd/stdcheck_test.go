@@ -0,0 +1,49 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAllowedStd(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go": "package foo\n\nimport (\n\t\"fmt\"\n\t\"slices\"\n\n\t\"internal/bar\"\n)\n\nvar _, _, _ = fmt.Sprint, slices.Max[[]int], bar.Bar\n",
+		"internal/bar/bar.go": "package bar\n\nconst Bar = 1\n",
+	})
+	// go list std of the target Go, which has no slices
+	fsys := newMemFS()
+	std := filepath.Join(t.TempDir(), "std.txt")
+	if err := fsys.WriteFile(std, []byte("# go1.20\nfmt\nsort\n\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	const want = "imports slices which is not in the target std"
+
+	t.Run("warn", func(t *testing.T) {
+		c := testCopier(t, src, fsys, "internal/foo")
+		c.AllowedStd = std
+
+		res, err := c.Copy(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(res.Warnings) != 1 || !strings.Contains(res.Warnings[0], filepath.Join("foo", "foo.go")+" "+want) {
+			t.Errorf("got warnings %q, want the one of slices imported by foo.go", res.Warnings)
+		}
+	})
+
+	t.Run("strict", func(t *testing.T) {
+		c := testCopier(t, src, fsys, "internal/foo")
+		c.AllowedStd = std
+		c.Strict = true
+
+		if err := c.Run(context.Background()); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("got error %v, want %q", err, want)
+		}
+	})
+}
@@ -0,0 +1,322 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// list of Copier.OnMissing policies.
+const (
+	OnMissingError = "error"
+	OnMissingStub  = "stub"
+	OnMissingLeave = "leave"
+)
+
+// isMissing reports whether the pkg could not be resolved to be copied.
+func isMissing(pkg *Package) bool {
+	return pkg.Dir == "" || (pkg.Error != nil && len(pkg.GoFiles) == 0)
+}
+
+// handleMissing handles the unresolved pkg according to the -on-missing policy.
+func (c *Copier) handleMissing(pkg *Package) error {
+	reason := "no package directory"
+	if pkg.Error != nil {
+		reason = pkg.Error.Err
+	}
+
+	switch c.OnMissing {
+	case OnMissingError:
+		return fmt.Errorf("unresolved import %s: %s", pkg.ImportPath, reason)
+
+	case OnMissingStub:
+		body, err := c.stubSource(pkg)
+		if err != nil {
+			return fmt.Errorf("generate %s stub: %w", pkg.ImportPath, err)
+		}
+
+		if err := c.checkCaseCollision(c.rewriteImportPath(pkg.ImportPath)); err != nil {
+			return err
+		}
+
+		// written along with the copied packages by writeStubs, so that
+		// nothing is written while resolving, such as by -list-external-deps
+		dstPath := c.packageDir(&Package{
+			ImportPath: pkg.ImportPath,
+			Dir:        filepath.Join(c.gorootSrc, filepath.FromSlash(pkg.ImportPath)),
+		})
+		c.stubbed[pkg.ImportPath] = true
+		c.stubs = append(c.stubs, &missingStub{importPath: pkg.ImportPath, dir: dstPath, body: body})
+
+	default:
+		c.warnf("%s is unresolved (%s), leave the import", pkg.ImportPath, reason)
+	}
+
+	return nil
+}
+
+// missingStub is the stub package of an unresolved import to be written.
+type missingStub struct {
+	importPath string
+	dir        string // destination directory
+	body       []byte
+}
+
+// writeStubs writes the stubs recorded by handleMissing since the last call.
+func (c *Copier) writeStubs() error {
+	stubs := c.stubs
+	c.stubs = nil
+	for _, stub := range stubs {
+		c.infof("stub: %s -> %s", stub.importPath, stub.dir)
+		if c.script != nil {
+			c.script.generate(filepath.Join(stub.dir, "stub.go"), "stub of "+stub.importPath)
+			continue
+		}
+
+		data, err := c.rewriteImports("stub.go", string(stub.body))
+		if err != nil {
+			return fmt.Errorf("rewrite %s stub imports: %w", stub.importPath, err)
+		}
+		if _, err := c.writeFile(stub.dir, "stub.go", data); err != nil {
+			return fmt.Errorf("write %s stub: %w", stub.importPath, err)
+		}
+	}
+
+	return nil
+}
+
+// stubSource generates the stub package source of pkg.
+//
+// If the source files of pkg are available, the stub declares the exported
+// API of pkg which is obtained by type checking them, with the function bodies
+// replaced by panics. Otherwise, the stub is an empty package.
+func (c *Copier) stubSource(pkg *Package) ([]byte, error) {
+	name := pkg.Name
+	if name == "" {
+		name = path.Base(pkg.ImportPath)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Package %s is a stub of %s generated by go-copystd.\n", name, pkg.ImportPath)
+	fmt.Fprintf(&buf, "package %s\n", name)
+
+	tpkg := c.typeCheck(pkg)
+	if tpkg == nil {
+		return buf.Bytes(), nil
+	}
+
+	imports := make(map[string]bool)
+	var invalid bool
+	qualifier := func(p *types.Package) string {
+		if p == tpkg {
+			return ""
+		}
+		imports[p.Path()] = true
+		return p.Name()
+	}
+	// typeString sets invalid if any of the types since it was reset refers
+	// to the unexported types of the package, which are not declared in the
+	// stub
+	typeString := func(typ types.Type) string {
+		invalid = invalid || refsUnexported(typ, tpkg)
+		return types.TypeString(typ, qualifier)
+	}
+
+	var decls bytes.Buffer
+	scope := tpkg.Scope()
+	for _, name := range scope.Names() {
+		obj := scope.Lookup(name)
+		if !obj.Exported() {
+			continue
+		}
+		invalid = false
+
+		switch obj := obj.(type) {
+		case *types.Const:
+			typ := typeString(obj.Type())
+			if b, ok := obj.Type().(*types.Basic); (ok && b.Info()&types.IsUntyped != 0) || invalid {
+				fmt.Fprintf(&decls, "\nconst %s = %s\n", obj.Name(), obj.Val().ExactString())
+				continue
+			}
+			fmt.Fprintf(&decls, "\nconst %s %s = %s\n", obj.Name(), typ, obj.Val().ExactString())
+
+		case *types.Var:
+			typ := typeString(obj.Type())
+			if invalid {
+				typ = "interface{}"
+			}
+			fmt.Fprintf(&decls, "\nvar %s %s\n", obj.Name(), typ)
+
+		case *types.Func:
+			sig := typeString(obj.Type())
+			if invalid {
+				continue
+			}
+			fmt.Fprintf(&decls, "\nfunc %s%s { panic(%q) }\n", obj.Name(), strings.TrimPrefix(sig, "func"), "stub")
+
+		case *types.TypeName:
+			underlying := typeString(obj.Type().Underlying())
+			if invalid {
+				underlying = "struct{}"
+				if _, ok := obj.Type().Underlying().(*types.Interface); ok {
+					underlying = "interface{}"
+				}
+			}
+			if obj.IsAlias() {
+				fmt.Fprintf(&decls, "\ntype %s = %s\n", obj.Name(), underlying)
+				continue
+			}
+
+			named, ok := obj.Type().(*types.Named)
+			if !ok {
+				fmt.Fprintf(&decls, "\ntype %s %s\n", obj.Name(), underlying)
+				continue
+			}
+			invalid = false
+			tparams := typeParamList(named.TypeParams(), typeString)
+			if invalid {
+				tparams = typeParamList(named.TypeParams(), func(types.Type) string { return "any" })
+			}
+			fmt.Fprintf(&decls, "\ntype %s%s %s\n", obj.Name(), tparams, underlying)
+
+			if _, ok := named.Underlying().(*types.Interface); ok {
+				continue
+			}
+			for i := 0; i < named.NumMethods(); i++ {
+				m := named.Method(i)
+				if !m.Exported() {
+					continue
+				}
+				sig := m.Type().(*types.Signature)
+				invalid = false
+				recv := typeString(sig.Recv().Type())
+				params := typeString(types.NewSignature(nil, sig.Params(), sig.Results(), sig.Variadic()))
+				if invalid {
+					continue
+				}
+				fmt.Fprintf(&decls, "\nfunc (%s) %s%s { panic(%q) }\n", recv, m.Name(), strings.TrimPrefix(params, "func"), "stub")
+			}
+		}
+	}
+
+	if len(imports) > 0 {
+		paths := make([]string, 0, len(imports))
+		for p := range imports {
+			paths = append(paths, p)
+		}
+		sort.Strings(paths)
+
+		buf.WriteString("\nimport (\n")
+		for _, p := range paths {
+			fmt.Fprintf(&buf, "\t%q\n", p)
+		}
+		buf.WriteString(")\n")
+	}
+	buf.Write(decls.Bytes())
+
+	return buf.Bytes(), nil
+}
+
+// typeParamList returns the type parameter list of the generic type, such as
+// "[K comparable, V any]", or "" if tparams is empty.
+func typeParamList(tparams *types.TypeParamList, typeString func(types.Type) string) string {
+	if tparams.Len() == 0 {
+		return ""
+	}
+
+	list := make([]string, tparams.Len())
+	for i := 0; i < tparams.Len(); i++ {
+		tparam := tparams.At(i)
+		list[i] = tparam.Obj().Name() + " " + typeString(tparam.Constraint())
+	}
+
+	return "[" + strings.Join(list, ", ") + "]"
+}
+
+// typeCheck type checks the Go files of pkg, or returns nil if there are no
+// Go files to check.
+//
+// The type errors are ignored so that a partially valid package still
+// provides its declarations.
+func (c *Copier) typeCheck(pkg *Package) *types.Package {
+	if pkg.Dir == "" || len(pkg.GoFiles) == 0 {
+		return nil
+	}
+
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, name := range pkg.GoFiles {
+		src, err := c.FS.ReadFile(filepath.Join(pkg.Dir, name))
+		if err != nil {
+			continue
+		}
+		f, err := parser.ParseFile(fset, filepath.Join(pkg.Dir, name), src, 0)
+		if err != nil {
+			continue
+		}
+		files = append(files, f)
+	}
+	if len(files) == 0 {
+		return nil
+	}
+
+	conf := types.Config{
+		Importer: importer.ForCompiler(fset, "source", nil),
+		Error:    func(error) {},
+	}
+	tpkg, _ := conf.Check(pkg.ImportPath, fset, files, nil)
+
+	return tpkg
+}
+
+// refsUnexported reports whether typ refers to an unexported named type of pkg.
+func refsUnexported(typ types.Type, pkg *types.Package) bool {
+	switch t := typ.(type) {
+	case *types.Named:
+		obj := t.Obj()
+		return obj.Pkg() == pkg && !obj.Exported()
+	case *types.Pointer:
+		return refsUnexported(t.Elem(), pkg)
+	case *types.Slice:
+		return refsUnexported(t.Elem(), pkg)
+	case *types.Array:
+		return refsUnexported(t.Elem(), pkg)
+	case *types.Chan:
+		return refsUnexported(t.Elem(), pkg)
+	case *types.Map:
+		return refsUnexported(t.Key(), pkg) || refsUnexported(t.Elem(), pkg)
+	case *types.Tuple:
+		for i := 0; i < t.Len(); i++ {
+			if refsUnexported(t.At(i).Type(), pkg) {
+				return true
+			}
+		}
+	case *types.Signature:
+		return refsUnexported(t.Params(), pkg) || refsUnexported(t.Results(), pkg)
+	case *types.Struct:
+		for i := 0; i < t.NumFields(); i++ {
+			if refsUnexported(t.Field(i).Type(), pkg) {
+				return true
+			}
+		}
+	case *types.Interface:
+		for i := 0; i < t.NumMethods(); i++ {
+			if refsUnexported(t.Method(i).Type(), pkg) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,137 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOnMissing(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go": "package foo\n\nimport \"internal/missing\"\n\nvar _ = missing.X\n",
+	})
+
+	tests := []struct {
+		onMissing string
+		wantErr   string
+		wantStub  bool
+		wantWarn  string
+		wantFoo   string
+	}{
+		{
+			onMissing: OnMissingError,
+			wantErr:   "unresolved import internal/missing",
+		},
+		{
+			onMissing: OnMissingStub,
+			wantStub:  true,
+			wantFoo:   `import "example.com/m/missing"`,
+		},
+		{
+			onMissing: OnMissingLeave,
+			wantWarn:  "internal/missing is unresolved",
+			wantFoo:   `import "internal/missing"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.onMissing, func(t *testing.T) {
+			fsys := newMemFS()
+			c := testCopier(t, src, fsys, "internal/foo")
+			c.OnMissing = tt.onMissing
+			var stderr bytes.Buffer
+			c.Stderr = &stderr
+
+			err := c.Run(context.Background())
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				if paths := fsys.paths(c.Dst); len(paths) > 0 {
+					t.Errorf("files are written: %q", paths)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			stub, ok := fsys.file(filepath.Join(c.Dst, "missing", "stub.go"))
+			if ok != tt.wantStub {
+				t.Errorf("stub.go written: got %t, want %t", ok, tt.wantStub)
+			}
+			if ok && !strings.Contains(stub, "package missing") {
+				t.Errorf("stub.go is not of package missing:\n%s", stub)
+			}
+			if !strings.Contains(stderr.String(), tt.wantWarn) {
+				t.Errorf("no warning %q in\n%s", tt.wantWarn, &stderr)
+			}
+			if foo, _ := fsys.file(filepath.Join(c.Dst, "foo", "foo.go")); !strings.Contains(foo, tt.wantFoo) {
+				t.Errorf("foo.go does not have %s:\n%s", tt.wantFoo, foo)
+			}
+		})
+	}
+}
+
+func TestOnMissingStubListExternalDeps(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go": "package foo\n\nimport \"internal/missing\"\n\nvar _ = missing.X\n",
+	})
+	fsys := newMemFS()
+	c := testCopier(t, src, fsys, "internal/foo")
+	c.OnMissing = OnMissingStub
+	c.ListExternalDeps = true
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if paths := fsys.paths(c.Dst); len(paths) > 0 {
+		t.Errorf("-list-external-deps writes %q", paths)
+	}
+}
+
+func TestStubSourceUnexported(t *testing.T) {
+	dir := t.TempDir()
+	const src = `package foo
+
+type hidden interface{ m() }
+
+type Set[K hidden] struct{ k K }
+
+func (Set[K]) Len() int { return 0 }
+
+func (Set[K]) Get(k hidden) int { return 0 }
+
+func New(h hidden) Set[hidden] { return Set[hidden]{} }
+`
+	if err := os.WriteFile(filepath.Join(dir, "foo.go"), []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c := &Copier{}
+	c.init()
+
+	got, err := c.stubSource(&Package{ImportPath: "internal/foo", Name: "foo", Dir: dir, GoFiles: []string{"foo.go"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		"type Set[K any] struct{k K}",
+		"func (Set[K]) Len() int",
+	} {
+		if !bytes.Contains(got, []byte(want)) {
+			t.Errorf("stub does not have %q:\n%s", want, got)
+		}
+	}
+	for _, unwanted := range []string{"hidden", "Get", "New"} {
+		if bytes.Contains(got, []byte(unwanted)) {
+			t.Errorf("stub has %q referring to the unexported type:\n%s", unwanted, got)
+		}
+	}
+}
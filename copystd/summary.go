@@ -0,0 +1,92 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// markFailed records the package at importPath whose copy failed under
+// KeepGoing for SummaryTable.
+func (c *Copier) markFailed(importPath string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.failed[importPath] = true
+}
+
+// printSummaryTable prints the copied packages to w as a table aligned by
+// text/tabwriter, one row per package sorted by the import path.
+func (c *Copier) printSummaryTable(w io.Writer) error {
+	packages := make([]string, 0, len(c.copiedPackages))
+	for _, pkg := range c.copiedPackages {
+		packages = append(packages, pkg.ImportPath)
+	}
+	sort.Strings(packages)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PACKAGE\tFILES\tBYTES\tSTATUS")
+	var files, bytes int
+	for _, importPath := range packages {
+		status := "copied"
+		switch {
+		case c.failed[importPath]:
+			status = "failed"
+		case c.DryRun:
+			status = "dry-run"
+		}
+		var size packageSize
+		if s, ok := c.sizes[importPath]; ok {
+			size = *s
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s\n", importPath, size.Files, size.Bytes, status)
+		files += size.Files
+		bytes += size.Bytes
+	}
+	fmt.Fprintf(tw, "total\t%d\t%d\t\n", files, bytes)
+
+	return tw.Flush()
+}
+
+// copyError is the error of copying a package, or a file of it.
+type copyError struct {
+	Package string // import path of the package
+	File    string // source file path, or "" for the package
+	Err     error
+}
+
+func (e *copyError) Error() string {
+	if e.File == "" {
+		return e.Package + ": " + e.Err.Error()
+	}
+
+	return e.Package + ": " + e.File + ": " + e.Err.Error()
+}
+
+func (e *copyError) Unwrap() error { return e.Err }
+
+// printErrorSummary prints the errors collected by keepGoing to w as a table
+// aligned by text/tabwriter, one row per error.
+func (c *Copier) printErrorSummary(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PACKAGE\tFILE\tERROR")
+	for _, err := range c.errs {
+		pkg, file, msg := "-", "-", err.Error()
+		var e *copyError
+		if errors.As(err, &e) {
+			pkg, msg = e.Package, e.Err.Error()
+			if e.File != "" {
+				file = e.File
+			}
+		}
+		// the table cells are single lines
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", pkg, file, strings.Join(strings.Fields(msg), " "))
+	}
+
+	return tw.Flush()
+}
@@ -0,0 +1,90 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestKeepGoing(t *testing.T) {
+	// the replaced constraint of bar is invalid
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go": "package foo\n\nfunc Foo() {}\n",
+		"internal/bar/bar.go": "//go:build !plan9\n\npackage bar\n",
+	})
+
+	for _, keepGoing := range []bool{false, true} {
+		fsys := newMemFS()
+		c := testCopier(t, src, fsys, "internal/bar", "internal/foo")
+		c.ReplaceBuildTag = map[string]string{"plan9": "plan9 &&"}
+		c.ValidateBuildTags = true
+		c.KeepGoing = keepGoing
+
+		err := c.Run(context.Background())
+		var copyErr *copyError
+		if !errors.As(err, &copyErr) || copyErr.Package != "internal/bar" {
+			t.Errorf("keep going %t: got error %v, want the error of internal/bar", keepGoing, err)
+		}
+		if !keepGoing {
+			continue
+		}
+		if got, want := fsys.paths(c.Dst), []string{"foo/foo.go"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("copied files: got %q, want %q", got, want)
+		}
+	}
+}
+
+func TestSummaryTable(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go":     "package foo\n\nimport \"internal/barbazqux\"\n\nfunc Foo() int { return barbazqux.Bar }\n",
+		"internal/barbazqux/a.go": "package barbazqux\n\nconst Bar = 1\n",
+		"internal/barbazqux/b.go": "package barbazqux\n",
+	})
+	c := testCopier(t, src, newMemFS(), "internal/foo")
+	c.SummaryTable = true
+	c.LogLevel = LogWarn
+	var stdout strings.Builder
+	c.Stdout = &stdout
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(stdout.String(), "\n"), "\n")
+	var rows [][]string
+	var columns []int
+	for i, line := range lines {
+		// the column starts follow the padding of two spaces at least
+		var starts []int
+		for _, loc := range columnRe.FindAllStringIndex(line, -1) {
+			starts = append(starts, loc[1])
+		}
+		if i == 0 {
+			columns = starts
+		} else if !reflect.DeepEqual(starts, columns[:len(starts)]) {
+			t.Errorf("row %q is not aligned to the header %q", line, lines[0])
+		}
+		rows = append(rows, strings.Fields(line))
+	}
+	if len(rows) != 4 {
+		t.Fatalf("got table\n%s\nwant the header, a row per package and the total", &stdout)
+	}
+	want := [][]string{
+		{"PACKAGE", "FILES", "BYTES", "STATUS"},
+		{"internal/barbazqux", "2", rows[1][2], "copied"},
+		{"internal/foo", "1", rows[2][2], "copied"},
+		{"total", "3", rows[3][2]},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("got table\n%s\nwant one row per package and the total", &stdout)
+	}
+}
+
+// columnRe matches the padding before the column of the summary table.
+var columnRe = regexp.MustCompile(`\S {2,}`)
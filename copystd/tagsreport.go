@@ -0,0 +1,263 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"context"
+	"fmt"
+	"go/build/constraint"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// fileTags is the build constraint of a copied file.
+type fileTags struct {
+	file string          // destination file path
+	test bool            // whether the file is a test file
+	expr constraint.Expr // build constraint, nil if unconstrained
+}
+
+// tagsReport maps the import path of the copied package to the build
+// constraints of its files, reported by -tags-report.
+type tagsReport map[string][]*fileTags
+
+// add records the build constraint of the copied file of pkg whose Go source
+// is body.
+func (r tagsReport) add(pkg *Package, file, body string) error {
+	ft, err := parseFileTags(file, body)
+	if err != nil {
+		return err
+	}
+	r[pkg.ImportPath] = append(r[pkg.ImportPath], ft)
+
+	return nil
+}
+
+// parseFileTags parses the build constraint of the file whose Go source is
+// body.
+func parseFileTags(file, body string) (*fileTags, error) {
+	ft := &fileTags{file: file, test: isTestFile(file)}
+
+	var plusExprs []constraint.Expr
+	for _, line := range strings.Split(body, "\n") {
+		text := strings.TrimSpace(line)
+		if strings.HasPrefix(text, "package ") {
+			break
+		}
+		if !constraint.IsGoBuild(text) && !constraint.IsPlusBuild(text) {
+			continue
+		}
+		expr, err := constraint.Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("parse build constraint of %s: %w", file, err)
+		}
+		if constraint.IsGoBuild(text) {
+			ft.expr = expr
+			plusExprs = nil
+			break
+		}
+		plusExprs = append(plusExprs, expr)
+	}
+	// the // +build lines are ANDed
+	for _, expr := range plusExprs {
+		if ft.expr == nil {
+			ft.expr = expr
+			continue
+		}
+		ft.expr = &constraint.AndExpr{X: ft.expr, Y: expr}
+	}
+
+	return ft, nil
+}
+
+// supports reports whether every package of r has any non-test file built for
+// the port, out of the ports.
+func (r tagsReport) supports(goos, goarch string, ports []string) bool {
+	for _, files := range r {
+		ok := false
+		for _, ft := range files {
+			if !ft.test && matchPort(ft, goos, goarch, ports) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// print prints the build constraints of the files and the GOOS/GOARCH ports
+// supported by the whole copied set.
+func (r tagsReport) print(w io.Writer, ports []string) {
+	pkgs := make([]string, 0, len(r))
+	for pkg := range r {
+		pkgs = append(pkgs, pkg)
+	}
+	sort.Strings(pkgs)
+
+	for _, pkg := range pkgs {
+		fmt.Fprintf(w, "%s\n", pkg)
+		for _, ft := range r[pkg] {
+			expr := "(none)"
+			if ft.expr != nil {
+				expr = ft.expr.String()
+			}
+			fmt.Fprintf(w, "\t%s: %s\n", ft.file, expr)
+		}
+	}
+
+	var supported []string
+	for _, port := range ports {
+		goos, goarch, _ := strings.Cut(port, "/")
+		if r.supports(goos, goarch, ports) {
+			supported = append(supported, port)
+		}
+	}
+	fmt.Fprintf(w, "supported ports: %s\n", strings.Join(supported, " "))
+}
+
+// unixOS is the set of GOOS values satisfying the "unix" build tag.
+var unixOS = map[string]bool{
+	"aix": true, "android": true, "darwin": true, "dragonfly": true, "freebsd": true, "hurd": true,
+	"illumos": true, "ios": true, "linux": true, "netbsd": true, "openbsd": true, "solaris": true,
+}
+
+// portTag returns the function reporting whether the tag is satisfied on the
+// port.
+//
+// The release tags and "gc" are satisfied, and any other tag such as "cgo"
+// is not.
+func portTag(goos, goarch string) func(string) bool {
+	return func(tag string) bool {
+		switch {
+		case tag == goos, tag == goarch, tag == "gc", strings.HasPrefix(tag, "go1."):
+			return true
+		case tag == "unix":
+			return unixOS[goos]
+		case tag == "linux":
+			return goos == "android"
+		case tag == "solaris":
+			return goos == "illumos"
+		case tag == "darwin":
+			return goos == "ios"
+		}
+		return false
+	}
+}
+
+// isPortTag reports whether the tag is decided by the port or the toolchain,
+// out of the ports.
+func isPortTag(tag string, ports []string) bool {
+	switch {
+	case tag == "unix", tag == "gc", tag == "gccgo", strings.HasPrefix(tag, "go1."):
+		return true
+	}
+
+	return knownOS(tag, ports) || knownArch(tag, ports)
+}
+
+// matchPort reports whether the file is built for the port, by its build
+// constraint and the _GOOS_GOARCH suffix of its name.
+func matchPort(ft *fileTags, goos, goarch string, ports []string) bool {
+	return matchTags(ft, portTag(goos, goarch), ports)
+}
+
+// mayMatchPort reports whether the file could be built for the port with
+// some set of the tags not decided by the port, such as "cgo" or "purego".
+func mayMatchPort(ft *fileTags, goos, goarch string, ports []string) bool {
+	var free []string
+	if ft.expr != nil {
+		ft.expr.Eval(func(tag string) bool {
+			if !isPortTag(tag, ports) && !contains(free, tag) {
+				free = append(free, tag)
+			}
+			return true
+		})
+	}
+	if len(free) > 16 {
+		// too many to try
+		return true
+	}
+
+	port := portTag(goos, goarch)
+	for set := 0; set < 1<<len(free); set++ {
+		ok := func(tag string) bool {
+			for i, t := range free {
+				if t == tag {
+					return set&(1<<i) != 0
+				}
+			}
+			return port(tag)
+		}
+		if matchTags(ft, ok, ports) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchTags reports whether the file is built with the tags satisfied by ok,
+// by its build constraint and the _GOOS_GOARCH suffix of its name.
+func matchTags(ft *fileTags, ok func(string) bool, ports []string) bool {
+	if ft.expr != nil && !ft.expr.Eval(ok) {
+		return false
+	}
+
+	name := strings.TrimSuffix(strings.TrimSuffix(filepath.Base(ft.file), ".go"), "_test")
+	elems := strings.Split(name, "_")
+	if n := len(elems); n >= 3 && knownOS(elems[n-2], ports) && knownArch(elems[n-1], ports) {
+		return ok(elems[n-2]) && ok(elems[n-1])
+	}
+	if n := len(elems); n >= 2 {
+		switch last := elems[n-1]; {
+		case knownOS(last, ports), knownArch(last, ports):
+			return ok(last)
+		}
+	}
+
+	return true
+}
+
+func knownOS(s string, ports []string) bool {
+	for _, port := range ports {
+		if goos, _, _ := strings.Cut(port, "/"); goos == s {
+			return true
+		}
+	}
+
+	return s == "hurd" || s == "zos" || s == "nacl"
+}
+
+func knownArch(s string, ports []string) bool {
+	for _, port := range ports {
+		if _, goarch, _ := strings.Cut(port, "/"); goarch == s {
+			return true
+		}
+	}
+
+	// the architectures go/build knows without a port
+	switch s {
+	case "amd64p32", "armbe", "arm64be", "mips64p32", "mips64p32le", "ppc", "riscv", "s390", "sparc", "sparc64":
+		return true
+	}
+
+	return false
+}
+
+// distPorts returns the GOOS/GOARCH ports supported by the go command.
+func distPorts(ctx context.Context) ([]string, error) {
+	out, err := exec.CommandContext(ctx, "go", "tool", "dist", "list").Output()
+	if err != nil {
+		return nil, fmt.Errorf("go tool dist list: %w", err)
+	}
+
+	return strings.Fields(string(out)), nil
+}
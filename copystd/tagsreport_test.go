@@ -0,0 +1,47 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTagsReport(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/a.go": "//go:build linux\n\npackage foo\n",
+		"internal/foo/b.go": "//go:build windows\n\npackage foo\n",
+	})
+	c := testCopier(t, src, newMemFS(), "internal/foo")
+	c.TagsReport = true
+	c.AllFiles = true
+	var stdout strings.Builder
+	c.Stdout = &stdout
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	out := stdout.String()
+	for _, want := range []string{
+		"\t" + filepath.Join(c.Dst, "foo", "a.go") + ": linux\n",
+		"\t" + filepath.Join(c.Dst, "foo", "b.go") + ": windows\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("the constraint %q is not reported:\n%s", want, out)
+		}
+	}
+	_, ports, ok := strings.Cut(out, "supported ports: ")
+	if !ok {
+		t.Fatalf("the supported ports are not reported:\n%s", out)
+	}
+	ports, _, _ = strings.Cut(ports, "\n")
+	supported := strings.Fields(ports)
+	for port, want := range map[string]bool{"linux/amd64": true, "windows/amd64": true, "darwin/amd64": false} {
+		if got := contains(supported, port); got != want {
+			t.Errorf("%s is supported: got %t, want %t", port, got, want)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// copyPackageAssets copies the testdata directory and the embedded files of
+// pkg verbatim next to its copied Go files, unless linked by linkAssets.
+func (c *Copier) copyPackageAssets(pkg *Package) error {
+	dir := c.packageDir(pkg)
+	m := c.compacted[pkg.ImportPath]
+	if m != nil {
+		dir = c.packageDir(m.into)
+	}
+
+	done := make(map[string]bool)
+	if !c.NoTests && !c.NoTestdata && m == nil {
+		if err := c.copyTestdata(pkg, filepath.Join(pkg.Dir, "testdata"), filepath.Join(dir, "testdata"), done); err != nil {
+			return fmt.Errorf("copy testdata: %w", err)
+		}
+	}
+	if c.SymlinkAssets {
+		return nil
+	}
+
+	embeds := c.packageEmbeds(pkg)
+	var copied []string
+	for _, embed := range embeds {
+		for _, name := range embed.files {
+			rel := relocateEmbedPath(filepath.ToSlash(name), c.RewriteEmbedPattern)
+			copied = append(copied, rel)
+			src := filepath.Join(pkg.Dir, name)
+			if done[src] {
+				continue
+			}
+			done[src] = true
+			dst := filepath.Join(embed.dir(dir), filepath.FromSlash(rel))
+			if err := c.copyAsset(pkg, src, filepath.Dir(dst), filepath.Base(dst)); err != nil {
+				return fmt.Errorf("copy embedded file: %w", err)
+			}
+		}
+	}
+
+	for _, embed := range embeds {
+		for _, pattern := range embed.patterns {
+			relocated := rewriteEmbedPattern(pattern, c.RewriteEmbedPattern)
+			if !matchEmbedPattern(relocated, copied) {
+				c.warnf("%s: //go:embed %s matches no copied file", pkg.ImportPath, relocated)
+			}
+		}
+	}
+
+	return nil
+}
+
+// packageEmbed is the //go:embed patterns of the files of a package and the
+// files matched by them.
+type packageEmbed struct {
+	patterns []string
+	files    []string
+	xtest    bool // whether embedded by XTestGoFiles
+}
+
+// dir returns the destination directory of the embedded files given the one
+// of the package, which is the sibling directory of the external tests with
+// XTestDir.
+func (e packageEmbed) dir(pkgDir string) string {
+	if e.xtest {
+		return pkgDir + "_test"
+	}
+
+	return pkgDir
+}
+
+// packageEmbeds returns the embeds of pkg which are copied, excluding the
+// ones of the test files excluded by NoTests and NoXTests.
+func (c *Copier) packageEmbeds(pkg *Package) []packageEmbed {
+	embeds := []packageEmbed{{patterns: pkg.EmbedPatterns, files: pkg.EmbedFiles}}
+	if !c.NoTests {
+		embeds = append(embeds, packageEmbed{patterns: pkg.TestEmbedPatterns, files: pkg.TestEmbedFiles})
+	}
+	if !c.NoTests && !c.NoXTests {
+		embeds = append(embeds, packageEmbed{patterns: pkg.XTestEmbedPatterns, files: pkg.XTestEmbedFiles, xtest: c.XTestDir})
+	}
+
+	return embeds
+}
+
+// matchEmbedPattern reports whether the //go:embed pattern matches any of the
+// slash separated files or their parent directories.
+func matchEmbedPattern(pattern string, files []string) bool {
+	pattern = trimEmbedPrefix(pattern)
+	for _, file := range files {
+		for p := file; p != "." && p != "/"; p = path.Dir(p) {
+			if ok, _ := path.Match(pattern, p); ok {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// trimEmbedPrefix unquotes the pattern and trims its all: prefix.
+func trimEmbedPrefix(pattern string) string {
+	if s, err := strconv.Unquote(pattern); err == nil {
+		pattern = s
+	}
+
+	return strings.TrimPrefix(pattern, "all:")
+}
+
+// copyTestdata copies the files under the src testdata directory of pkg to
+// dst recursively, recording the copied source files to done. It does
+// nothing if pkg has no testdata directory.
+func (c *Copier) copyTestdata(pkg *Package, src, dst string, done map[string]bool) error {
+	entries, err := c.FS.ReadDir(src)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("read %s directory: %w", src, err)
+	}
+
+	for _, entry := range entries {
+		file := filepath.Join(src, entry.Name())
+		if entry.IsDir() {
+			if err := c.copyTestdata(pkg, file, filepath.Join(dst, entry.Name()), done); err != nil {
+				return err
+			}
+			continue
+		}
+		done[file] = true
+		if err := c.copyAsset(pkg, file, dst, entry.Name()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// copyAsset copies the src file of pkg, such as a testdata or an embedded
+// file, verbatim to the name file in dir.
+func (c *Copier) copyAsset(pkg *Package, src, dir, name string) error {
+	start := time.Now()
+	data, err := c.readFile(src)
+	if err != nil {
+		return err
+	}
+	dst := filepath.Join(dir, name)
+
+	fc := &fileCopy{src: src, dir: dir, name: name, body: data, raw: data, verbatim: true}
+	if c.CopyMode == CopyBoth {
+		if err := c.writeVerbatimCopy(fc); err != nil {
+			return err
+		}
+	}
+	if err := c.claimDst(src, dst, data); err != nil {
+		return err
+	}
+
+	if c.script != nil {
+		c.script.copyFile(src, dst, true)
+		return nil
+	}
+	n, err := c.writeVerbatim(dir, name, data)
+	if err != nil {
+		return fmt.Errorf("write file: %w", err)
+	}
+	c.addSize(pkg.ImportPath, n)
+	c.recordCopied(pkg, src, dst)
+	c.printDryRun(src, dst)
+	c.logCopy(src, dst, time.Since(start))
+
+	return nil
+}
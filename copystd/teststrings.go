@@ -0,0 +1,131 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"sort"
+	"strings"
+)
+
+// isTestFile reports whether the file is a Go test file.
+func isTestFile(file string) bool {
+	return strings.HasSuffix(file, "_test.go")
+}
+
+// rewriteTestStrings rewrites the import paths of the copied packages which
+// appear in the string literals of the Go test source body, such as the
+// package paths passed to go list or compared to the reflected type names.
+//
+// The import declarations are rewritten by rewriteImports, so they are left
+// as is. A path is only rewritten as a whole path element sequence, so that
+// "internal/foo" does not match "internal/foobar".
+func (c *Copier) rewriteTestStrings(filename, body string) (string, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, body, parser.ParseComments)
+	if err != nil {
+		return "", fmt.Errorf("parse %s: %w", filename, err)
+	}
+
+	importPaths := make(map[*ast.BasicLit]bool)
+	for _, spec := range f.Imports {
+		importPaths[spec.Path] = true
+	}
+
+	var lits []*ast.BasicLit
+	ast.Inspect(f, func(n ast.Node) bool {
+		if lit, ok := n.(*ast.BasicLit); ok && lit.Kind == token.STRING && !importPaths[lit] {
+			lits = append(lits, lit)
+		}
+		return true
+	})
+
+	repl := c.copiedPathReplacements()
+	var b strings.Builder
+	last := 0
+	for _, lit := range lits {
+		value := replacePathElems(lit.Value, repl)
+		if value == lit.Value {
+			continue
+		}
+		start := fset.Position(lit.Pos()).Offset
+		b.WriteString(body[last:start])
+		b.WriteString(value)
+		last = start + len(lit.Value)
+		c.infof("rewrite: %s: %s -> %s", fset.Position(lit.Pos()), lit.Value, value)
+	}
+	if last == 0 {
+		return body, nil
+	}
+	b.WriteString(body[last:])
+
+	return b.String(), nil
+}
+
+// pathReplacement is the replacement of the import path old to new.
+type pathReplacement struct {
+	old, new string
+}
+
+// copiedPathReplacements returns the replacements of the original import paths
+// of the copied packages to the rewritten ones, the longest path first.
+func (c *Copier) copiedPathReplacements() []pathReplacement {
+	var repl []pathReplacement
+	for newPath, pkg := range c.copiedPackages {
+		if pkg.ImportPath != newPath {
+			repl = append(repl, pathReplacement{old: pkg.ImportPath, new: newPath})
+		}
+	}
+	sort.Slice(repl, func(i, j int) bool {
+		if len(repl[i].old) != len(repl[j].old) {
+			return len(repl[i].old) > len(repl[j].old)
+		}
+		return repl[i].old < repl[j].old
+	})
+
+	return repl
+}
+
+// replacePathElems replaces the occurrences of the import paths in s which are
+// delimited by the non-path characters or a slash after the path.
+func replacePathElems(s string, repl []pathReplacement) string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		if i == 0 || !isPathChar(s[i-1]) {
+			if r, ok := matchPathAt(s, i, repl); ok {
+				b.WriteString(r.new)
+				i += len(r.old)
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+		i++
+	}
+
+	return b.String()
+}
+
+// matchPathAt returns the replacement whose path appears at s[i:].
+func matchPathAt(s string, i int, repl []pathReplacement) (pathReplacement, bool) {
+	for _, r := range repl {
+		if !strings.HasPrefix(s[i:], r.old) {
+			continue
+		}
+		end := i + len(r.old)
+		if end == len(s) || s[end] == '/' || !isPathChar(s[end]) {
+			return r, true
+		}
+	}
+
+	return pathReplacement{}, false
+}
+
+// isPathChar reports whether c may appear in an import path.
+func isPathChar(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '_' || c == '-' || c == '.' || c == '/' || c == '~' || c == '+'
+}
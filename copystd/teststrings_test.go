@@ -0,0 +1,41 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRewriteTestdataPaths(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go":      "package foo\n\nconst Path = \"internal/foo\"\n",
+		"internal/foo/foo_test.go": "package foo\n\nimport \"testing\"\n\nfunc TestFoo(t *testing.T) {\n\t_ = \"internal/foo/testdata/golden.txt\"\n\t_ = \"internal/foobar\"\n}\n",
+	})
+
+	for _, rewrite := range []bool{false, true} {
+		fsys := newMemFS()
+		c := testCopier(t, src, fsys, "internal/foo")
+		c.RewriteTestdataPaths = rewrite
+
+		if err := c.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		want := `"internal/foo/testdata/golden.txt"`
+		if rewrite {
+			want = `"example.com/m/foo/testdata/golden.txt"`
+		}
+		test, _ := fsys.file(filepath.Join(c.Dst, "foo", "foo_test.go"))
+		if !strings.Contains(test, want) || !strings.Contains(test, `"internal/foobar"`) {
+			t.Errorf("-rewrite-relative-testdata-paths=%t: foo_test.go does not have %s and the unrelated path as is:\n%s", rewrite, want, test)
+		}
+		// the non-test files are left as is
+		if foo, _ := fsys.file(filepath.Join(c.Dst, "foo", "foo.go")); !strings.Contains(foo, `"internal/foo"`) {
+			t.Errorf("-rewrite-relative-testdata-paths=%t: the string of foo.go is rewritten:\n%s", rewrite, foo)
+		}
+	}
+}
@@ -1,7 +1,7 @@
 // Copyright 2021 The go-copystd Authors
 // SPDX-License-Identifier: BSD-3-Clause
 
-package main
+package copystd
 
 import "time"
 
@@ -62,6 +62,14 @@ type Package struct {
 	TestGoFiles     []string // _test.go files in package
 	XTestGoFiles    []string // _test.go files outside package
 
+	// Embedded files
+	EmbedPatterns      []string // //go:embed patterns
+	EmbedFiles         []string // files matched by EmbedPatterns
+	TestEmbedPatterns  []string // //go:embed patterns in TestGoFiles
+	TestEmbedFiles     []string // files matched by TestEmbedPatterns
+	XTestEmbedPatterns []string // //go:embed patterns in XTestGoFiles
+	XTestEmbedFiles    []string // files matched by XTestEmbedPatterns
+
 	// Cgo directives
 	CgoCFLAGS    []string // cgo: flags for C compiler
 	CgoCPPFLAGS  []string // cgo: flags for C preprocessor
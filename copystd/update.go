@@ -0,0 +1,121 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+)
+
+// list of the states of the files written with Update.
+const (
+	updateAdded      = "added"
+	updateUpdated    = "updated"
+	updateSkipped    = "skipped"
+	updateConflicted = "conflicted"
+)
+
+// updateReport is the destination files written with Update keyed by the
+// state.
+type updateReport map[string][]string
+
+// loadUpdateManifest loads the entries of the Manifest written by the previous
+// run, keyed by the path relative to Dst, to detect the local modifications
+// with Update. No entry is loaded if the Manifest does not exist yet.
+func (c *Copier) loadUpdateManifest() error {
+	entries, err := c.readManifest(c.Manifest, c.ManifestFormat)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		if e.digest(c.HashAlgo) == "" {
+			return fmt.Errorf("%s has no %s digest of %s: give the -hash-algo it was written with", c.Manifest, c.HashAlgo, e.Path)
+		}
+		c.recorded[e.Path] = e
+	}
+
+	return nil
+}
+
+// updateState returns the state of writing data to filename with Update. The
+// existing file is conflicted if its digest differs from the recorded one,
+// that is, it was modified locally, unless Force is given.
+func (c *Copier) updateState(filename string, data []byte) (string, error) {
+	old, err := c.FS.ReadFile(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return updateAdded, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("read %s file: %w", filename, err)
+	}
+	if bytes.Equal(old, data) {
+		return updateSkipped, nil
+	}
+
+	e, ok := c.recorded[c.manifestPath(filename)]
+	if !ok || c.Force {
+		return updateUpdated, nil
+	}
+	h := newHash(c.HashAlgo)
+	h.Write(old)
+	if hex.EncodeToString(h.Sum(nil)) != e.digest(c.HashAlgo) {
+		return updateConflicted, nil
+	}
+
+	return updateUpdated, nil
+}
+
+// manifestPath returns the slash separated path of filename relative to Dst
+// recorded by the manifest.
+func (c *Copier) manifestPath(filename string) string {
+	rel, err := filepath.Rel(c.Dst, filename)
+	if err != nil {
+		return filename
+	}
+
+	return filepath.ToSlash(rel)
+}
+
+// addUpdate records filename in the state.
+func (c *Copier) addUpdate(state, filename string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.updates[state] = append(c.updates[state], filename)
+}
+
+// keepConflicted replaces the manifest entries of the conflicted files, which
+// are left as modified locally, with the recorded ones, so that they are
+// still detected by the next run.
+func (c *Copier) keepConflicted(entries []*manifestEntry) {
+	conflicted := make(map[string]bool)
+	for _, filename := range c.updates[updateConflicted] {
+		conflicted[c.manifestPath(filename)] = true
+	}
+	for i, e := range entries {
+		if conflicted[e.Path] {
+			entries[i] = c.recorded[e.Path]
+		}
+	}
+}
+
+// conflictErr prints the number of the files of each state, and returns the
+// error of the conflicted files if any.
+func (c *Copier) conflictErr() error {
+	r := c.updates
+	c.infof("update: %d added, %d updated, %d skipped, %d conflicted",
+		len(r[updateAdded]), len(r[updateUpdated]), len(r[updateSkipped]), len(r[updateConflicted]))
+	if len(r[updateConflicted]) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("-update: %d files modified locally are not overwritten (use -force to overwrite)", len(r[updateConflicted]))
+}
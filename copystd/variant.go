@@ -0,0 +1,156 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/build/constraint"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"strings"
+)
+
+// List of Prefer.
+const (
+	PreferAsm  = "asm"  // keep the assembly implementations
+	PreferPure = "pure" // keep the pure Go fallbacks selected by the purego build tag
+)
+
+// puregoTag is the build tag which selects the pure Go fallbacks of the
+// packages providing the assembly implementations.
+const puregoTag = "purego"
+
+// selectVariant drops the files of pkg which belong to the implementation
+// variant not preferred by Prefer, that is, the ignored Go files gated by the
+// purego build tag. With PreferPure the assembly files are also dropped
+// unless the Go files still declare the functions implemented in assembly.
+func (c *Copier) selectVariant(pkg *Package) error {
+	var ignored []string
+	for _, name := range pkg.IgnoredGoFiles {
+		gated, err := c.hasBuildTag(filepath.Join(pkg.Dir, name), puregoTag)
+		if err != nil {
+			return err
+		}
+		if !gated {
+			ignored = append(ignored, name)
+		}
+	}
+	pkg.IgnoredGoFiles = ignored
+
+	if c.Prefer != PreferPure || len(pkg.SFiles) == 0 {
+		return nil
+	}
+
+	funcs, err := c.asmFuncs(pkg)
+	if err != nil {
+		return err
+	}
+	if len(funcs) > 0 {
+		msg := fmt.Sprintf("%s has no pure Go variant of %s, keep the assembly", pkg.ImportPath, strings.Join(funcs, ", "))
+		if c.Strict {
+			return errors.New(msg)
+		}
+		c.warnf("%s", msg)
+		return nil
+	}
+	pkg.SFiles = nil
+
+	return nil
+}
+
+// dropAsm drops the assembly, C, header and cgo files of pkg with NoAsm. The
+// Go files still declaring the functions implemented in assembly no longer
+// build, which is reported, or aborts with Strict.
+func (c *Copier) dropAsm(pkg *Package) error {
+	pkg.CgoFiles = nil
+	pkg.CFiles = nil
+	pkg.HFiles = nil
+	if len(pkg.SFiles) == 0 {
+		return nil
+	}
+	pkg.SFiles = nil
+
+	funcs, err := c.asmFuncs(pkg)
+	if err != nil {
+		return err
+	}
+	if len(funcs) > 0 {
+		msg := fmt.Sprintf("%s declares %s implemented in the assembly dropped by -no-asm", pkg.ImportPath, strings.Join(funcs, ", "))
+		if c.Strict {
+			return errors.New(msg)
+		}
+		c.warnf("%s", msg)
+	}
+
+	return nil
+}
+
+// hasBuildTag reports whether the build constraint of the Go file refers to
+// the tag.
+func (c *Copier) hasBuildTag(file, tag string) (bool, error) {
+	data, err := c.readFile(file)
+	if err != nil {
+		return false, err
+	}
+
+	for _, line := range strings.Split(data, "\n") {
+		text := strings.TrimSpace(line)
+		if strings.HasPrefix(text, "package ") {
+			break
+		}
+		if !constraint.IsGoBuild(text) && !constraint.IsPlusBuild(text) {
+			continue
+		}
+		expr, err := constraint.Parse(text)
+		if err != nil {
+			return false, fmt.Errorf("parse build constraint %q of %s: %w", text, file, err)
+		}
+		found := false
+		expr.Eval(func(t string) bool {
+			found = found || t == tag
+			return true
+		})
+		if found {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// asmFuncs returns the names of the functions declared without body by the
+// non-test Go files of pkg, which are implemented in assembly unless pulled
+// by //go:linkname.
+func (c *Copier) asmFuncs(pkg *Package) ([]string, error) {
+	var funcs []string
+	for _, name := range append(append([]string{}, pkg.GoFiles...), pkg.CgoFiles...) {
+		file := filepath.Join(pkg.Dir, name)
+		data, err := c.readFile(file)
+		if err != nil {
+			return nil, err
+		}
+		f, err := parser.ParseFile(token.NewFileSet(), file, data, parser.ParseComments|parser.SkipObjectResolution)
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %w", file, err)
+		}
+		linked := make(map[string]bool)
+		for _, cg := range f.Comments {
+			for _, comment := range cg.List {
+				if fields := strings.Fields(comment.Text); len(fields) >= 2 && fields[0] == "//go:linkname" {
+					linked[fields[1]] = true
+				}
+			}
+		}
+		for _, decl := range f.Decls {
+			if fn, ok := decl.(*ast.FuncDecl); ok && fn.Body == nil && !linked[fn.Name.Name] {
+				funcs = append(funcs, fn.Name.Name)
+			}
+		}
+	}
+
+	return funcs, nil
+}
@@ -0,0 +1,44 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestPrefer(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go":      "package foo\n\nfunc Sum() int { return sum() }\n",
+		"internal/foo/sum_asm.go":  "//go:build !purego\n\npackage foo\n\nfunc sum() int\n",
+		"internal/foo/sum_asm.s":   "//go:build !purego\n\n#include \"textflag.h\"\n\nTEXT ·sum(SB),NOSPLIT,$0-8\n\tMOVQ $1, ret+0(FP)\n\tRET\n",
+		"internal/foo/sum_pure.go": "//go:build purego\n\npackage foo\n\nfunc sum() int { return 1 }\n",
+	})
+
+	tests := []struct {
+		prefer string
+		want   []string
+	}{
+		{prefer: PreferAsm, want: []string{"foo/foo.go", "foo/sum_asm.go", "foo/sum_asm.s"}},
+		{prefer: PreferPure, want: []string{"foo/foo.go", "foo/sum_pure.go"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.prefer, func(t *testing.T) {
+			fsys := newMemFS()
+			c := testCopier(t, src, fsys, "internal/foo")
+			c.Prefer = tt.prefer
+			// the ignored files of the other variant are dropped as well
+			c.AllFiles = true
+
+			if err := c.Run(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := fsys.paths(c.Dst); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("copied files: got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/mod/semver"
+)
+
+// vendorPath returns the canonical import path of the package vendored by
+// the std or cmd vendor directory of the source tree, such as
+// golang.org/x/net/idna of vendor/golang.org/x/net/idna, and reports whether
+// importPath is vendored.
+func vendorPath(importPath string) (string, bool) {
+	for _, prefix := range [...]string{"vendor/", "cmd/vendor/"} {
+		if rest, ok := strings.CutPrefix(importPath, prefix); ok {
+			return rest, true
+		}
+	}
+
+	return "", false
+}
+
+// isVendored reports whether the import path is of a vendored package.
+func isVendored(importPath string) bool {
+	_, ok := vendorPath(importPath)
+
+	return ok
+}
+
+// vendorDstPath returns the path relative to the module the vendored package
+// of the canonical import path is copied to with CopyVendor, such as x/net/idna
+// of golang.org/x/net/idna.
+func vendorDstPath(canonical string) string {
+	return strings.TrimPrefix(canonical, "golang.org/")
+}
+
+// vendorRequire is the module of the vendored packages imported by the copied
+// packages, which the module of Dst requires unless CopyVendor is given.
+type vendorRequire struct {
+	Path     string
+	Version  string
+	Packages []string // canonical import paths of the imported packages
+}
+
+// requireVendored records the module of the vendored pkg to be required.
+func (c *Copier) requireVendored(pkg *Package) error {
+	canonical, _ := vendorPath(pkg.ImportPath)
+	dir := filepath.Join(c.gorootSrc, "vendor")
+	if strings.HasPrefix(pkg.ImportPath, "cmd/") {
+		dir = filepath.Join(c.gorootSrc, "cmd", "vendor")
+	}
+	mods, err := c.vendorModules(dir)
+	if err != nil {
+		return err
+	}
+
+	modPath := ""
+	for p := range mods {
+		if (canonical == p || strings.HasPrefix(canonical, p+"/")) && len(p) > len(modPath) {
+			modPath = p
+		}
+	}
+	if modPath == "" {
+		return fmt.Errorf("%s is vendored by no module of %s", canonical, filepath.Join(dir, "modules.txt"))
+	}
+
+	req, ok := c.vendorRequires[modPath]
+	if !ok {
+		req = &vendorRequire{Path: modPath, Version: mods[modPath]}
+		c.vendorRequires[modPath] = req
+	}
+	// the std and cmd vendor directories could vendor the different versions
+	if semver.Compare(mods[modPath], req.Version) > 0 {
+		req.Version = mods[modPath]
+	}
+	if !contains(req.Packages, canonical) {
+		req.Packages = append(req.Packages, canonical)
+	}
+
+	return nil
+}
+
+// vendorModules returns the versions of the modules listed by modules.txt of
+// the vendor directory dir keyed by the module path.
+func (c *Copier) vendorModules(dir string) (map[string]string, error) {
+	if mods, ok := c.vendorMods[dir]; ok {
+		return mods, nil
+	}
+
+	file := filepath.Join(dir, "modules.txt")
+	data, err := c.FS.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("read %s file: %w", file, err)
+	}
+
+	mods := make(map[string]string)
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		// # golang.org/x/net v0.0.0-20211015210444-4f30a5c0130f
+		if fields := strings.Fields(sc.Text()); len(fields) == 3 && fields[0] == "#" {
+			mods[fields[1]] = fields[2]
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("scan %s: %w", file, err)
+	}
+	c.vendorMods[dir] = mods
+
+	return mods, nil
+}
+
+// sortedVendorRequires returns the modules to require sorted by the path.
+func (c *Copier) sortedVendorRequires() []*vendorRequire {
+	reqs := make([]*vendorRequire, 0, len(c.vendorRequires))
+	for _, req := range c.vendorRequires {
+		sort.Strings(req.Packages)
+		reqs = append(reqs, req)
+	}
+	sort.Slice(reqs, func(i, j int) bool { return reqs[i].Path < reqs[j].Path })
+
+	return reqs
+}
+
+// reportVendorRequires reports the modules the module of Dst requires for the
+// vendored packages imported by the copied packages.
+func (c *Copier) reportVendorRequires() {
+	for _, req := range c.sortedVendorRequires() {
+		c.infof("vendor: require %s %s in go.mod for %s (or use -copy-vendor)", req.Path, req.Version, strings.Join(req.Packages, ", "))
+	}
+}
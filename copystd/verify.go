@@ -0,0 +1,180 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// verifyNoTestOnlyDepsLeak verifies that the imports of the non-test files of
+// the copied pkgs are satisfied within the copied packages, so that no
+// production file depends on a package which is only pulled in by tests, or
+// not copied at all.
+func (c *Copier) verifyNoTestOnlyDepsLeak(pkgs []*Package) error {
+	copied := make(map[string]bool)
+	for _, pkg := range pkgs {
+		copied[pkg.ImportPath] = true
+	}
+
+	var leaks []string
+	for _, pkg := range pkgs {
+		for _, name := range pkg.GoFiles {
+			file := filepath.Join(pkg.Dir, name)
+			src, err := c.FS.ReadFile(file)
+			if err != nil {
+				return fmt.Errorf("read %s file: %w", file, err)
+			}
+			f, err := parser.ParseFile(token.NewFileSet(), file, src, parser.ImportsOnly)
+			if err != nil {
+				return fmt.Errorf("parse %s: %w", file, err)
+			}
+
+			for _, spec := range f.Imports {
+				imp, err := strconv.Unquote(spec.Path.Value)
+				if err != nil {
+					return fmt.Errorf("unquote import path %s: %w", spec.Path.Value, err)
+				}
+				if !isInternalImport(imp) || copied[imp] || matchAny(c.IgnorePrefix, imp) {
+					continue
+				}
+				leaks = append(leaks, fmt.Sprintf("%s: imports %s which is not copied", file, imp))
+			}
+		}
+	}
+
+	if len(leaks) > 0 {
+		sort.Strings(leaks)
+		return errors.New("non-test files import packages outside of the copied set:\n\t" + strings.Join(leaks, "\n\t"))
+	}
+
+	return nil
+}
+
+// verifyBuild verifies that the copied tree compiles by running 'go build
+// ./...', and 'go vet ./...' with VerifyVet, in dir within its module. The
+// verification is skipped with a warning if dir is in no module. The output
+// of the go command is attributed to the source packages of the copies.
+func (c *Copier) verifyBuild(ctx context.Context, dir string) error {
+	if _, ok := findModuleRoot(dir); !ok {
+		c.warnf("verify: %s is in no module, skip (use -init-module to create go.mod)", dir)
+		return nil
+	}
+
+	args := [][]string{{"build", "./..."}}
+	if c.VerifyVet {
+		args = append(args, []string{"vet", "./..."})
+	}
+
+	for _, arg := range args {
+		cmd := exec.CommandContext(ctx, "go", arg...)
+		cmd.Env = append(os.Environ(), c.Env...)
+		cmd.Dir = dir
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("verify go %s in %s: %w\n%s", strings.Join(arg, " "), dir, err, c.attributeOutput(dir, bytes.TrimSpace(stderr.Bytes())))
+		}
+	}
+
+	return nil
+}
+
+// findModuleRoot returns the directory of the go.mod file of dir or of its
+// nearest parent, and reports whether it is found.
+func findModuleRoot(dir string) (string, bool) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", false
+	}
+	for {
+		if fi, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil && !fi.IsDir() {
+			return dir, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+// attributeOutput appends the import path of the source package to each
+// line of the output of the go command run in dir which names a copied
+// package, by the "# import/path" or "package import/path" heading, or its
+// file, by the file:line position.
+func (c *Copier) attributeOutput(dir string, out []byte) string {
+	dirs := make(map[string]string) // source import paths keyed by the absolute destination directory
+	for _, f := range c.copiedFiles {
+		if abs, err := filepath.Abs(filepath.Dir(f.Dest)); err == nil {
+			dirs[abs] = f.Package
+		}
+	}
+
+	lines := strings.Split(string(out), "\n")
+	for i, line := range lines {
+		heading, ok := strings.CutPrefix(line, "# ")
+		if !ok {
+			heading, ok = strings.CutPrefix(line, "package ")
+		}
+		if ok {
+			if pkg, ok := c.copiedPackages[heading]; ok {
+				lines[i] += " (copied from " + pkg.ImportPath + ")"
+			}
+			continue
+		}
+		file, _, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if !ok || !strings.HasSuffix(file, ".go") {
+			continue
+		}
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(dir, file)
+		}
+		if abs, err := filepath.Abs(filepath.Dir(file)); err == nil && dirs[abs] != "" {
+			lines[i] += " (copied from " + dirs[abs] + ")"
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// verifyGofmt verifies that every Go file written by the run is formatted as
+// gofmt does, which a transformation after goimports could break.
+func (c *Copier) verifyGofmt() error {
+	var unformatted []string
+	for file := range c.writtenFiles {
+		if !strings.HasSuffix(file, ".go") {
+			continue
+		}
+		data, err := c.FS.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("read %s file: %w", file, err)
+		}
+		formatted, err := format.Source(data)
+		if err != nil {
+			return fmt.Errorf("format %s: %w", file, err)
+		}
+		if !bytes.Equal(formatted, data) {
+			unformatted = append(unformatted, file)
+		}
+	}
+
+	if len(unformatted) > 0 {
+		sort.Strings(unformatted)
+		return fmt.Errorf("copied Go files are not gofmt-ed:\n\t%s", strings.Join(unformatted, "\n\t"))
+	}
+
+	return nil
+}
@@ -0,0 +1,84 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVerifyNoTestOnlyDepsLeak(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo/foo.go":      "package foo\n\nimport \"internal/foo/footest\"\n\nvar _ = footest.Helper\n",
+		"internal/foo/footest/help.go": "package footest\n\nconst Helper = 1\n",
+		"internal/bar/bar.go":          "package bar\n\nconst Bar = 1\n",
+		"internal/bar/bar_test.go":     "package bar\n\nimport (\n\t\"internal/foo/footest\"\n\t\"testing\"\n)\n\nfunc TestBar(t *testing.T) { _ = footest.Helper }\n",
+	})
+
+	t.Run("leak", func(t *testing.T) {
+		// the helper is not copied, being outside of -resolve-root
+		c := testCopier(t, src, newMemFS(), "internal/foo/foo")
+		c.ResolveRoot = "internal/foo/foo"
+		c.VerifyNoTestOnlyDepsLeak = true
+
+		err := c.Run(context.Background())
+		if err == nil || !strings.Contains(err.Error(), "foo.go: imports internal/foo/footest which is not copied") {
+			t.Errorf("got error %v, want the leak of internal/foo/footest", err)
+		}
+	})
+
+	t.Run("test only", func(t *testing.T) {
+		c := testCopier(t, src, newMemFS(), "internal/bar")
+		c.NoTests = true
+		c.VerifyNoTestOnlyDepsLeak = true
+
+		if err := c.Run(context.Background()); err != nil {
+			t.Errorf("the import of the excluded test file is reported: %v", err)
+		}
+	})
+}
+
+// unformatFS is a memFS which writes the file named unformat indented with
+// spaces, as a transform breaking the gofmt output would.
+type unformatFS struct {
+	*memFS
+	unformat string
+}
+
+func (m *unformatFS) WriteFile(name string, data []byte, perm os.FileMode) error {
+	if filepath.Base(name) == m.unformat {
+		data = []byte(strings.ReplaceAll(string(data), "\t", "    "))
+	}
+
+	return m.memFS.WriteFile(name, data, perm)
+}
+
+func TestVerifyGofmt(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go": "package foo\n\nimport \"internal/bar\"\n\nfunc Foo() int {\n\treturn bar.Bar\n}\n",
+		"internal/bar/bar.go": "package bar\n\nfunc Bar() int {\n\treturn 1\n}\n",
+		"internal/bar/bar.s":  "\tRET\n",
+	})
+
+	for _, unformat := range []string{"", "bar.s", "foo.go"} {
+		fsys := &unformatFS{memFS: newMemFS(), unformat: unformat}
+		c := testCopier(t, src, fsys, "internal/foo")
+		c.VerifyGofmt = true
+
+		err := c.Run(context.Background())
+		if unformat != "foo.go" {
+			if err != nil {
+				t.Errorf("%q unformatted: %v", unformat, err)
+			}
+			continue
+		}
+		want := "copied Go files are not gofmt-ed:\n\t" + filepath.Join(c.Dst, "foo", "foo.go")
+		if err == nil || !strings.HasSuffix(err.Error(), want) {
+			t.Errorf("got error %v, want %q", err, want)
+		}
+	}
+}
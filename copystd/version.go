@@ -0,0 +1,124 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// sourceGoVersion discovers the Go version of the source tree Src, such as
+// "go1.17.2".
+//
+// The version is read from the VERSION file of the source tree if exists,
+// otherwise it is reported by the go command against the source tree.
+func (c *Copier) sourceGoVersion(ctx context.Context) (string, error) {
+	src := c.Src
+	data, err := c.FS.ReadFile(filepath.Join(src, "VERSION"))
+	if err == nil {
+		line, _, _ := bufio.NewReader(bytes.NewReader(data)).ReadLine()
+		if version := strings.TrimSpace(string(line)); strings.HasPrefix(version, "go") {
+			return version, nil
+		}
+	}
+
+	cmd := exec.CommandContext(ctx, "go", "env", "GOVERSION")
+	cmd.Env = append(os.Environ(), "GOROOT="+src)
+	cmd.Dir = src
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("go env GOVERSION: %w", err)
+	}
+	version := strings.TrimSpace(string(out))
+	if version == "" {
+		return "", fmt.Errorf("could not discover the Go version of %s", src)
+	}
+
+	return version, nil
+}
+
+// isBuiltTree reports whether the Go source tree at src is built, that is,
+// it has the pkg/tool directory of its compiler, unlike an extracted source
+// tarball.
+func isBuiltTree(src string) bool {
+	fi, err := os.Stat(filepath.Join(src, "pkg", "tool"))
+
+	return err == nil && fi.IsDir()
+}
+
+// matchGoVersion reports whether the Go version such as "go1.22.3" is of the
+// required version prefix such as "1.22" or "go1.22", matching the whole
+// version numbers so that 1.2 does not match go1.22.
+func matchGoVersion(version, required string) bool {
+	v := strings.TrimPrefix(version, "go")
+	r := strings.TrimPrefix(required, "go")
+	if !strings.HasPrefix(v, r) {
+		return false
+	}
+	rest := v[len(r):]
+
+	return rest == "" || rest[0] < '0' || '9' < rest[0]
+}
+
+// stampPackageName returns the package name of the version stamp file in the
+// destination root, which is derived from the last element of the module path.
+func stampPackageName(module string) string {
+	name := sanitizeIdent(strings.ToLower(path.Base(module)))
+	if name == "" || ('0' <= name[0] && name[0] <= '9') {
+		return "version"
+	}
+
+	return name
+}
+
+// stampSource generates the Go source of the package name which declares the
+// source Go version and the time of the copy.
+func stampSource(name, version string, t time.Time) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n\n", DefaultGeneratedMarker)
+	fmt.Fprintf(&b, "package %s\n\n", name)
+	b.WriteString("const (\n")
+	b.WriteString("\t// GoVersion is the Go version of the source tree the packages are copied from.\n")
+	fmt.Fprintf(&b, "\tGoVersion = %q\n\n", version)
+	b.WriteString("\t// CopiedAt is the time the packages are first copied from GoVersion, in RFC 3339 format.\n")
+	fmt.Fprintf(&b, "\tCopiedAt = %q\n", t.UTC().Format(time.RFC3339))
+	b.WriteString(")\n")
+
+	return b.String()
+}
+
+var (
+	stampVersionRe  = regexp.MustCompile(`(?m)^\s*GoVersion\s*=\s*"([^"]*)"`)
+	stampCopiedAtRe = regexp.MustCompile(`(?m)^\s*CopiedAt\s*=\s*"([^"]*)"`)
+)
+
+// stampTime returns the time of the copy of the source Go version for the
+// version stamp, which is the CopiedAt of the existing stamp in Dst if it is
+// of the same version, so that the stamp is left as is until the version
+// changes, and the time of a rerun, such as of Check, does not change it.
+func (c *Copier) stampTime(version string) time.Time {
+	data, err := c.FS.ReadFile(filepath.Join(c.Dst, "version.go"))
+	if err != nil {
+		return time.Now()
+	}
+	v, at := stampVersionRe.FindSubmatch(data), stampCopiedAtRe.FindSubmatch(data)
+	if v == nil || at == nil || string(v[1]) != version {
+		return time.Now()
+	}
+	t, err := time.Parse(time.RFC3339, string(at[1]))
+	if err != nil {
+		return time.Now()
+	}
+
+	return t
+}
@@ -0,0 +1,182 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"context"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestSourceGoVersionFS(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go": "package foo\n",
+	})
+	// the VERSION of the FileSystem overlays the one of the host
+	fsys := newMemFS()
+	if err := fsys.WriteFile(filepath.Join(src, "VERSION"), []byte("go1.30.1\ntime 2030-01-01T00:00:00Z\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c := testCopier(t, src, fsys)
+	c.init()
+
+	version, err := c.sourceGoVersion(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != "go1.30.1" {
+		t.Errorf("got %s, want go1.30.1 of the FileSystem", version)
+	}
+}
+
+func TestVersionDir(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go": "package foo\n\nimport \"internal/bar\"\n\nfunc Foo() int { return bar.Bar }\n",
+		"internal/bar/bar.go": "package bar\n\nconst Bar = 1\n",
+	})
+	fsys := newMemFS()
+	c := testCopier(t, src, fsys, "internal/foo")
+	c.VersionDir = true
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := filepath.Join(c.Dst, testGoVersion)
+	if got, want := fsys.paths(c.Dst), []string{testGoVersion + "/bar/bar.go", testGoVersion + "/foo/foo.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("copied files: got %q, want %q", got, want)
+	}
+	foo, _ := fsys.file(filepath.Join(dst, "foo", "foo.go"))
+	if want := `import "example.com/m/` + testGoVersion + `/bar"`; !strings.Contains(foo, want) {
+		t.Errorf("foo.go does not have %s:\n%s", want, foo)
+	}
+}
+
+func TestStampVersion(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go": "package foo\n\nfunc Foo() {}\n",
+	})
+	fsys := newMemFS()
+	c := testCopier(t, src, fsys, "internal/foo")
+	c.StampVersion = true
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	data, ok := fsys.file(filepath.Join(c.Dst, "version.go"))
+	if !ok {
+		t.Fatal("version.go is not written")
+	}
+	f, err := parser.ParseFile(token.NewFileSet(), "version.go", data, 0)
+	if err != nil {
+		t.Fatalf("version.go does not parse: %v\n%s", err, data)
+	}
+	if f.Name.Name != "m" {
+		t.Errorf("got package %s, want the last element of the module path", f.Name.Name)
+	}
+	var version string
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.CONST {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			spec := spec.(*ast.ValueSpec)
+			if spec.Names[0].Name == "GoVersion" {
+				version, _ = strconv.Unquote(spec.Values[0].(*ast.BasicLit).Value)
+			}
+		}
+	}
+	if version != testGoVersion {
+		t.Errorf("got GoVersion %q, want %q\n%s", version, testGoVersion, data)
+	}
+}
+
+func TestRequireGoVersion(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go": "package foo\n",
+	})
+
+	// the source is go1.21.3
+	for required, ok := range map[string]bool{
+		"1.21":     true,
+		"go1.21":   true,
+		"1.21.3":   true,
+		"1.2":      false,
+		"1.22":     false,
+		"go1.21.4": false,
+	} {
+		fsys := newMemFS()
+		c := testCopier(t, src, fsys, "internal/foo")
+		c.RequireGoVersion = required
+
+		err := c.Run(context.Background())
+		if ok {
+			if err != nil {
+				t.Errorf("%s: %v", required, err)
+			}
+			continue
+		}
+		want := "source " + src + " is " + testGoVersion + ", not of -require-go-version " + required
+		if err == nil || err.Error() != want {
+			t.Errorf("%s: got error %v, want %q", required, err, want)
+		}
+		if paths := fsys.paths(c.Dst); len(paths) > 0 {
+			t.Errorf("%s: files are written: %q", required, paths)
+		}
+	}
+}
+
+func TestStampVersionCheck(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go": "package foo\n\nfunc Foo() {}\n",
+	})
+	fsys := newMemFS()
+	c := testCopier(t, src, fsys, "internal/foo")
+	c.StampVersion = true
+	c.GenerateCommand = []string{"go-copystd", "-module", "example.com/m", "-package", "internal/foo"}
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// the stamp of the same version keeps its time
+	stamp := filepath.Join(c.Dst, "version.go")
+	old := "package m\n\nconst (\n\tGoVersion = \"" + testGoVersion + "\"\n\n\tCopiedAt = \"2020-01-02T03:04:05Z\"\n)\n"
+	if err := fsys.WriteFile(stamp, []byte(old), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := fsys.file(stamp)
+	if !strings.Contains(data, `CopiedAt = "2020-01-02T03:04:05Z"`) {
+		t.Errorf("the time of the stamp is changed:\n%s", data)
+	}
+
+	changed, changes, err := c.Check(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed {
+		t.Errorf("the rerun drifts: %+v", changes)
+	}
+
+	// a new version is stamped with the time of the copy
+	if err := fsys.WriteFile(stamp, []byte(strings.Replace(data, testGoVersion, "go1.20", 1)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := fsys.file(stamp); strings.Contains(data, "2020-01-02T03:04:05Z") {
+		t.Errorf("the time of the previous version is kept:\n%s", data)
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"path"
+	"path/filepath"
+	"strconv"
+)
+
+// rewriteXTestImport rewrites the import of the package under test by the
+// external test file of pkg to the copied package, so that the test runs
+// against the copy. The imports of the cmd and internal packages are
+// rewritten by rewriteImports already, but the one of a std package copied
+// as a root, such as strconv, is left importing the std one otherwise.
+func (c *Copier) rewriteXTestImport(pkg *Package, file, body string) (string, error) {
+	if !contains(pkg.XTestGoFiles, filepath.Base(file)) || c.rewriteImportPath(pkg.ImportPath) != pkg.ImportPath {
+		return body, nil
+	}
+	rel, err := filepath.Rel(c.Dst, c.packageDir(pkg))
+	if err != nil {
+		return "", fmt.Errorf("resolve %s: %w", pkg.ImportPath, err)
+	}
+	newPath := path.Join(c.Module, filepath.ToSlash(rel))
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, file, body, parser.ImportsOnly|parser.ParseComments)
+	if err != nil {
+		return "", fmt.Errorf("parse %s: %w", file, err)
+	}
+	for _, spec := range f.Imports {
+		if imp, err := strconv.Unquote(spec.Path.Value); err != nil || imp != pkg.ImportPath {
+			continue
+		}
+		lit := strconv.Quote(newPath)
+		if path.Base(newPath) != pkg.Name && spec.Name == nil {
+			lit = pkg.Name + " " + lit
+		}
+		start := fset.Position(spec.Path.Pos()).Offset
+		c.debugf("xtest: %s imports %s as %s", file, pkg.ImportPath, newPath)
+		return body[:start] + lit + body[start+len(spec.Path.Value):], nil
+	}
+
+	return body, nil
+}
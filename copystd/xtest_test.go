@@ -0,0 +1,79 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestXTestDir(t *testing.T) {
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go":      "package foo\n\nimport \"internal/bar\"\n\nfunc Foo() int { return bar.Bar }\n",
+		"internal/foo/foo_test.go": "package foo\n\nimport \"testing\"\n\nfunc TestFoo(t *testing.T) {}\n",
+		"internal/foo/x_test.go":   "package foo_test\n\nimport (\n\t\"internal/foo\"\n\t\"testing\"\n)\n\nfunc TestX(t *testing.T) { _ = foo.Foo() }\n",
+		"internal/bar/bar.go":      "package bar\n\nconst Bar = 1\n",
+	})
+	fsys := newMemFS()
+	c := testCopier(t, src, fsys, "internal/foo")
+	c.XTestDir = true
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// the internal test file stays with the package
+	if got, want := fsys.paths(c.Dst), []string{"bar/bar.go", "foo/foo.go", "foo/foo_test.go", "foo_test/x_test.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("copied files: got %q, want %q", got, want)
+	}
+	x, _ := fsys.file(filepath.Join(c.Dst, "foo_test", "x_test.go"))
+	if !strings.HasPrefix(x, "package foo_test\n") || !strings.Contains(x, "\"example.com/m/foo\"") {
+		t.Errorf("x_test.go does not test the copied package:\n%s", x)
+	}
+}
+
+func TestXTestRun(t *testing.T) {
+	// foo ships both the internal and the external tests, which pass only
+	// against the copied foo and bar
+	src := testGoroot(t, map[string]string{
+		"internal/foo/foo.go":      "package foo\n\nimport \"internal/bar\"\n\nfunc Foo() int { return bar.Bar + 1 }\n",
+		"internal/foo/foo_test.go": "package foo\n\nimport \"testing\"\n\nfunc TestFoo(t *testing.T) {\n\tif Foo() != 42 {\n\t\tt.Fatal(Foo())\n\t}\n}\n",
+		"internal/foo/x_test.go":   "package foo_test\n\nimport (\n\t\"internal/bar\"\n\t\"internal/foo\"\n\t\"testing\"\n)\n\nfunc TestX(t *testing.T) {\n\tif foo.Foo() != bar.Bar+1 {\n\t\tt.Fatal(foo.Foo())\n\t}\n}\n",
+		"internal/bar/bar.go":      "package bar\n\nconst Bar = 41\n",
+	})
+	c := testCopier(t, src, osFS{}, "internal/foo")
+	c.GoMod = true
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	x, err := os.ReadFile(filepath.Join(c.Dst, "foo", "x_test.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"package foo_test\n", `"example.com/m/bar"`, `"example.com/m/foo"`} {
+		if !strings.Contains(string(x), want) {
+			t.Errorf("x_test.go lacks %s:\n%s", want, x)
+		}
+	}
+
+	cmd := exec.Command("go", "test", "-v", "./...")
+	cmd.Dir = c.Dst
+	cmd.Env = append(os.Environ(), "GOFLAGS=", "GOWORK=off", "GO111MODULE=on", "GOTOOLCHAIN=local")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("go test of the copy: %v\n%s", err, out)
+	}
+	for _, want := range []string{"--- PASS: TestFoo", "--- PASS: TestX", "ok  \texample.com/m/foo"} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("go test output lacks %q:\n%s", want, out)
+		}
+	}
+}
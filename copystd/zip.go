@@ -0,0 +1,110 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"archive/zip"
+	"fmt"
+	"go/build"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// extractZip extracts the Go source archive to a temporary directory and
+// returns the root directory of the Go tree, and whether the archive has the
+// tools of the host platform built, unlike a source tarball.
+//
+// The official release archives have a single top-level "go" directory, in
+// which case the root is that directory. The caller must call cleanup to
+// remove the extracted files.
+func extractZip(path string) (root string, built bool, cleanup func(), err error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return "", false, nil, fmt.Errorf("open %s zip: %w", path, err)
+	}
+	defer zr.Close()
+
+	tmpDir, err := os.MkdirTemp("", "go-copystd-src-")
+	if err != nil {
+		return "", false, nil, fmt.Errorf("create temp dir: %w", err)
+	}
+	cleanup = func() { os.RemoveAll(tmpDir) }
+	defer func() {
+		if err != nil {
+			cleanup()
+		}
+	}()
+
+	topDirs := make(map[string]bool)
+	for _, f := range zr.File {
+		name := filepath.FromSlash(f.Name)
+		dst := filepath.Join(tmpDir, name)
+		if !strings.HasPrefix(dst, tmpDir+string(filepath.Separator)) {
+			return "", false, nil, fmt.Errorf("invalid file path in zip: %s", f.Name)
+		}
+		topDirs[strings.SplitN(f.Name, "/", 2)[0]] = true
+
+		if f.FileInfo().IsDir() {
+			if err := os.MkdirAll(dst, 0o755); err != nil {
+				return "", false, nil, err
+			}
+			continue
+		}
+
+		if err := extractZipFile(f, dst); err != nil {
+			return "", false, nil, err
+		}
+	}
+
+	root = tmpDir
+	if len(topDirs) == 1 {
+		for dir := range topDirs {
+			if fi, err := os.Stat(filepath.Join(tmpDir, dir)); err == nil && fi.IsDir() {
+				root = filepath.Join(tmpDir, dir)
+			}
+		}
+	}
+
+	// the archive is an unbuilt source tree, borrow the host toolchain's tools
+	// so that go list can run against it, which makes the tree look built to
+	// isBuiltTree afterwards
+	toolDir := filepath.Join(root, "pkg", "tool", filepath.Base(build.ToolDir))
+	_, statErr := os.Stat(toolDir)
+	built = statErr == nil
+	if os.IsNotExist(statErr) {
+		if err := os.MkdirAll(filepath.Dir(toolDir), 0o755); err != nil {
+			return "", false, nil, err
+		}
+		if err := os.Symlink(build.ToolDir, toolDir); err != nil {
+			return "", false, nil, fmt.Errorf("link tool dir: %w", err)
+		}
+	}
+
+	return root, built, cleanup, nil
+}
+
+func extractZipFile(f *zip.File, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("open %s in zip: %w", f.Name, err)
+	}
+	defer rc.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode().Perm()|0o200)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, rc); err != nil {
+		out.Close()
+		return fmt.Errorf("extract %s: %w", f.Name, err)
+	}
+
+	return out.Close()
+}
@@ -0,0 +1,92 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package copystd
+
+import (
+	"archive/zip"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testZip writes the zip archive of the files keyed by the slash separated
+// path, and returns its path.
+func testZip(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	name := filepath.Join(t.TempDir(), "go.zip")
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	for path, data := range files {
+		w, err := zw.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return name
+}
+
+func TestRunSrcZip(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command not found")
+	}
+	archive := testZip(t, map[string]string{
+		"go/VERSION":                 testGoVersion + "\n",
+		"go/src/go.mod":              "module std\n\ngo 1.21\n",
+		"go/src/internal/foo/foo.go": "package foo\n\nimport \"internal/bar\"\n\nfunc Foo() int { return bar.Bar }\n",
+		"go/src/internal/bar/bar.go": "package bar\n\nconst Bar = 1\n",
+	})
+	fsys := newMemFS()
+	c := testCopier(t, "", fsys, "internal/foo")
+	c.SrcZip = archive
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := fsys.paths(c.Dst), []string{"bar/bar.go", "foo/foo.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("copied files: got %q, want %q", got, want)
+	}
+	foo, _ := fsys.file(filepath.Join(c.Dst, "foo", "foo.go"))
+	if !strings.Contains(foo, `import "example.com/m/bar"`) {
+		t.Errorf("foo.go does not import the copied bar:\n%s", foo)
+	}
+}
+
+func TestSrcZipUnbuilt(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command not found")
+	}
+	archive := testZip(t, map[string]string{
+		"go/VERSION":                 testGoVersion + "\n",
+		"go/src/go.mod":              "module std\n\ngo 1.21\n",
+		"go/src/internal/foo/foo.go": "package foo\n",
+	})
+	// the tools of the host linked in the extracted tree are not of the tree
+	c := testCopier(t, "", newMemFS(), "internal/foo")
+	c.SrcZip = archive
+	c.Test = true
+
+	err := c.Run(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "-test requires") || !strings.Contains(err.Error(), "to be built") {
+		t.Errorf("got error %v, want the one of the unbuilt tree", err)
+	}
+}
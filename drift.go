@@ -0,0 +1,61 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/zchee/go-copystd/copystd"
+)
+
+// exitDrift is the exit code of -check when -dst differs from the copy.
+const exitDrift = 3
+
+// errDrift is returned by -check when -dst differs from the copy.
+var errDrift = errors.New("-check: -dst differs from the copy of -src")
+
+// printDrift prints the changes of -check grouped by the source package, the
+// generated files such as go.mod last, with the numbers of the lines added
+// and deleted if stat is true.
+func printDrift(w io.Writer, changes []copystd.FileChange, stat bool) {
+	byPkg := make(map[string][]copystd.FileChange)
+	var pkgs []string
+	for _, change := range changes {
+		if _, ok := byPkg[change.Package]; !ok {
+			pkgs = append(pkgs, change.Package)
+		}
+		byPkg[change.Package] = append(byPkg[change.Package], change)
+	}
+	sort.Slice(pkgs, func(i, j int) bool {
+		if (pkgs[i] == "") != (pkgs[j] == "") {
+			return pkgs[j] == ""
+		}
+		return pkgs[i] < pkgs[j]
+	})
+
+	for _, pkg := range pkgs {
+		heading := pkg
+		if heading == "" {
+			heading = "(generated)"
+		}
+		fmt.Fprintf(w, "%s:\n", heading)
+		for _, change := range byPkg[pkg] {
+			state := "content changed"
+			switch {
+			case change.New:
+				state = "added upstream"
+			case change.Removed:
+				state = "removed upstream"
+			}
+			if stat {
+				fmt.Fprintf(w, "\t%s: %s (+%d -%d)\n", state, change.Path, change.Added, change.Deleted)
+			} else {
+				fmt.Fprintf(w, "\t%s: %s\n", state, change.Path)
+			}
+		}
+	}
+}
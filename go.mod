@@ -2,10 +2,13 @@ module github.com/zchee/go-copystd
 
 go 1.17
 
-require golang.org/x/tools v0.1.8-0.20211007211504-c5188f24a678
+require (
+	golang.org/x/mod v0.4.2
+	golang.org/x/sync v0.1.0
+	golang.org/x/tools v0.1.8-0.20211007211504-c5188f24a678
+)
 
 require (
-	golang.org/x/mod v0.4.2 // indirect
 	golang.org/x/sys v0.0.0-20210809222454-d867a43fc93e // indirect
 	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1 // indirect
 )
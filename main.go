@@ -5,21 +5,25 @@
 package main
 
 import (
-	"bytes"
+	"bufio"
 	"context"
-	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
+	"os/signal"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
+	"time"
 
-	"golang.org/x/tools/imports"
+	"github.com/zchee/go-copystd/copystd"
 )
 
+// stringsFlag is a repeatable flag.Value of comma separated strings.
 type stringsFlag []string
 
 func (s *stringsFlag) String() string {
@@ -27,218 +31,781 @@ func (s *stringsFlag) String() string {
 }
 
 func (s *stringsFlag) Set(value string) error {
-	if len(*s) > 0 {
-		return errors.New("flag already set")
-	}
 	for _, str := range strings.Split(value, ",") {
-		*s = append(*s, str)
+		if str = strings.TrimSpace(str); str != "" {
+			*s = append(*s, str)
+		}
 	}
 
 	return nil
 }
 
-var (
-	flagPackages stringsFlag
-	flagModule   string
-	flagSrc      string
-	flagDist     string
-)
-
-var gorootSrc = filepath.Join(runtime.GOROOT(), "src")
+// readPackagesFile reads the newline separated import paths of the file at
+// path, or of stdin if path is "-". The blank lines and the lines beginning
+// with '#' are skipped.
+func readPackagesFile(path string) ([]string, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("open packages file: %w", err)
+		}
+		defer f.Close()
+		r = f
+	}
 
-func main() {
-	if err := run(); err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+	var pkgs []string
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		pkgs = append(pkgs, line)
 	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("read packages file: %w", err)
+	}
+
+	return pkgs, nil
 }
 
-func run() error {
-	flag.Var(&flagPackages, "package", "comma separated copy stdlib packages")
-	flag.StringVar(&flagModule, "module", "", "module import path")
-	flag.StringVar(&flagSrc, "src", runtime.GOROOT(), "src directory")
-	flag.StringVar(&flagDist, "dst", ".", "dist directory")
-	flag.Parse()
+// uniq returns list without the duplicated elements, keeping the first ones.
+func uniq(list []string) []string {
+	seen := make(map[string]bool)
+	var res []string
+	for _, s := range list {
+		if !seen[s] {
+			seen[s] = true
+			res = append(res, s)
+		}
+	}
 
-	imports.LocalPrefix = flagModule
+	return res
+}
 
-	ctx := context.Background()
-	for _, pkg := range flagPackages {
-		listPkgs, err := listPackages(ctx, flagSrc, pkg)
-		if err != nil {
-			return fmt.Errorf("list packages: %w", err)
-		}
+// generatedOmitFlags are the flags generateCommand drops: -dst, which go
+// generate runs in, and the flags of how the command runs rather than what it
+// copies, so that gen.go is the same whichever of them is given, such as
+// -check comparing the copy with gen.go.
+var generatedOmitFlags = map[string]bool{
+	"dst":                true,
+	"check":              true,
+	"check-diffstat":     true,
+	"check-stale":        true,
+	"dry-run":            true,
+	"output":             true,
+	"emit-script":        true,
+	"init-config":        true,
+	"list-external-deps": true,
+	"progress-json":      true,
+	"v":                  true,
+	"quiet":              true,
+	"q":                  true,
+}
 
-		var packages []*Package
-		for _, listPkg := range listPkgs {
-			if _, err := os.Stat(listPkg.Dir); err != nil && os.IsNotExist(err) {
-				if listPkg.Dir != "" {
-					fmt.Printf("[WARN]: %s is not exists, continue\n", listPkg.Dir)
-				}
-				continue
-			}
+// generatedPathFlags are the flags of the files and the directories relative
+// to the working directory, which generateCommand rebases onto -dst.
+var generatedPathFlags = map[string]bool{
+	"src":             true,
+	"src-zip":         true,
+	"verbatim-dst":    true,
+	"gocache":         true,
+	"packages-file":   true,
+	"config":          true,
+	"license":         true,
+	"rename-map":      true,
+	"rewrite-file":    true,
+	"allowed-std":     true,
+	"manifest":        true,
+	"provenance-json": true,
+	"overlay":         true,
+	"package-alias":   true,
+}
 
-			packages = append(packages, listPkg)
-			for _, imp := range listPkg.Imports {
-				switch {
-				case strings.Contains(imp, "cmd"), strings.Contains(imp, "internal"):
-					subPkgs, err := listPackages(ctx, flagSrc, imp)
-					if err != nil {
-						return fmt.Errorf("list packages: %w", err)
-					}
-					packages = append(packages, subPkgs...)
-
-				default:
-					fmt.Printf("ignore: %s\n", imp)
-				}
-			}
+// generateCommand returns the go-copystd command line of the args parsed by
+// fs to be run by go generate in the destination dst, that is, without the
+// flags of generatedOmitFlags and with the relative paths of
+// generatedPathFlags rebased onto dst.
+func generateCommand(fs *flag.FlagSet, args []string, dst string) ([]string, error) {
+	cmd := []string{"go-copystd"}
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--" {
+			return append(cmd, args[i:]...), nil
 		}
-
-		for _, p := range packages {
-			subPkgs, err := listPackages(ctx, flagSrc, p.Dir)
+		if !strings.HasPrefix(args[i], "-") {
+			cmd = append(cmd, args[i])
+			continue
+		}
+		nameValue := strings.SplitN(strings.TrimLeft(args[i], "-"), "=", 2)
+		name := nameValue[0]
+		switch {
+		case generatedOmitFlags[name]:
+			if len(nameValue) == 1 && !isBoolFlag(fs, name) {
+				i++ // the value of the flag
+			}
+		case generatedPathFlags[name] && len(nameValue) == 2:
+			value, err := rebasePath(nameValue[1], dst)
 			if err != nil {
-				return fmt.Errorf("list packages: %w", err)
+				return nil, err
 			}
-
-			for _, subPkg := range subPkgs {
-				if err := copyInternal(subPkg); err != nil {
-					return fmt.Errorf("copy internal: %w", err)
-				}
+			cmd = append(cmd, args[i][:len(args[i])-len(nameValue[1])]+value)
+		case generatedPathFlags[name] && i+1 < len(args):
+			value, err := rebasePath(args[i+1], dst)
+			if err != nil {
+				return nil, err
 			}
+			cmd = append(cmd, args[i], value)
+			i++
+		default:
+			cmd = append(cmd, args[i])
 		}
 	}
 
-	return nil
+	return cmd, nil
 }
 
-// listPackages is a wrapper for 'go list -json -e', which can take arbitrary
-// environment variables and arguments as input. The working directory can be
-// fed by adding $PWD to env; otherwise, it will default to the current
-// directory.
-//
-// Since -e is used, the returned error will only be non-nil if a JSON result
-// could not be obtained. Such examples are if the Go command is not installed,
-// or if invalid flags are used as arguments.
-//
-// Errors encountered when loading packages will be returned for each package,
-// in the form of PackageError. See 'go help list'.
-func listPackages(ctx context.Context, src string, args ...string) (pkgs []*Package, finalErr error) {
-	goArgs := append([]string{"list", "-json", "-e"}, args...)
-	cmd := exec.CommandContext(ctx, "go", goArgs...)
-	cmd.Env = append(os.Environ(), []string{"PWD=" + src}...)
-	cmd.Dir = src
-
-	stdout, err := cmd.StdoutPipe()
+// rebasePath returns the path relative to the working directory as relative
+// to dir instead. The absolute path and the empty one are returned as is.
+func rebasePath(path, dir string) (string, error) {
+	if path == "" || filepath.IsAbs(path) {
+		return path, nil
+	}
+	abs, err := filepath.Abs(path)
 	if err != nil {
-		return nil, fmt.Errorf("create StdoutPipe: %w", err)
+		return "", err
 	}
-	var stderrBuf bytes.Buffer
-	cmd.Stderr = &stderrBuf
-	defer func() {
-		if finalErr != nil && stderrBuf.Len() > 0 {
-			// TODO: wrap? but the format is backwards, given that
-			// stderr is likely multi-line
-			finalErr = fmt.Errorf("%w\n%s", finalErr, stderrBuf.Bytes())
-		}
-	}()
-
-	if err := cmd.Start(); err != nil {
-		return nil, fmt.Errorf("start cmd: %w", err)
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(absDir, abs)
+	if err != nil {
+		// such as on another volume
+		return abs, nil
 	}
 
-	dec := json.NewDecoder(stdout)
-	for dec.More() {
-		var pkg Package
-		if err := dec.Decode(&pkg); err != nil {
-			return nil, fmt.Errorf("decode json: %w", err)
-		}
-		pkgs = append(pkgs, &pkg)
+	return rel, nil
+}
+
+// isBoolFlag reports whether the flag name of fs is a boolean flag, which
+// takes no separate value.
+func isBoolFlag(fs *flag.FlagSet, name string) bool {
+	f := fs.Lookup(name)
+	if f == nil {
+		return false
 	}
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+
+	return ok && b.IsBoolFlag()
+}
 
-	if err := cmd.Wait(); err != nil {
-		return nil, fmt.Errorf("wait cmd: %w", err)
+// manifestPath returns the path of the manifest of -manifest, which is
+// copystd.lock in the destination dst by default, or "" if noManifest is true.
+func manifestPath(dst, manifest string, noManifest bool) (string, error) {
+	switch {
+	case noManifest && manifest != "":
+		return "", errors.New("-manifest and -no-manifest are mutually exclusive")
+	case noManifest:
+		return "", nil
+	case manifest == "":
+		return filepath.Join(dst, copystd.DefaultManifest), nil
 	}
 
-	return pkgs, nil
+	return manifest, nil
 }
 
-func copyInternal(pkg *Package) error {
-	files := sourceFiles(pkg)
-	for _, file := range files {
-		if file == "zbootstrap.go" { // zbootstrap.go is created by bootstrap
-			continue
+// headerEnabled reports whether the copied Go files are marked by -header,
+// which is the default unless disabled by -no-header or -mark-generated=false.
+// Giving -header along with either of them is an error.
+func headerEnabled(fs *flag.FlagSet, markGenerated, noHeader bool) (bool, error) {
+	var header string
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "header" || f.Name == "generated-marker" {
+			header = f.Name
 		}
+	})
 
-		dir, filename := filepath.Split(file)
-		dir = strings.TrimPrefix(dir, gorootSrc)
-		dir = strings.ReplaceAll(dir, "cmd", "")
-		dir = strings.ReplaceAll(dir, "internal", "")
+	switch {
+	case noHeader && header != "":
+		return false, fmt.Errorf("-%s and -no-header are mutually exclusive", header)
+	case !markGenerated && header != "":
+		return false, fmt.Errorf("-%s requires -mark-generated, which is disabled", header)
+	}
 
-		dstPath := filepath.Join(flagDist, dir)
-		fmt.Printf("dstPath: %s\n", dstPath)
+	return markGenerated && !noHeader, nil
+}
 
-		data, err := readFile(file)
-		if err != nil {
-			return err
-		}
+// listFlag is a repeatable flag.Value of strings.
+type listFlag []string
 
-		if err := writeFile(dstPath, filename, data); err != nil {
-			return fmt.Errorf("write file: %w", err)
-		}
-	}
+func (l *listFlag) String() string {
+	return fmt.Sprint(*l)
+}
+
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
 
 	return nil
 }
 
-func sourceFiles(pkg *Package) (files []string) {
-	fileLists := [...][]string{
-		pkg.GoFiles,
-		pkg.TestGoFiles,
-		pkg.XTestGoFiles,
-		pkg.IgnoredGoFiles,
-	}
+// mapFlag is a repeatable flag.Value of "old=new" pairs.
+type mapFlag map[string]string
 
-	for _, fileList := range fileLists {
-		for _, file := range fileList {
-			files = append(files, filepath.Join(pkg.Dir, file))
-		}
+func (m mapFlag) String() string {
+	return fmt.Sprint(map[string]string(m))
+}
+
+func (m mapFlag) Set(value string) error {
+	i := strings.Index(value, "=")
+	if i <= 0 || i == len(value)-1 {
+		return fmt.Errorf("invalid mapping %q: must be old=new form", value)
 	}
+	m[value[:i]] = value[i+1:]
+
+	return nil
+}
+
+// fileModeFlag is a flag.Value of the octal file mode.
+type fileModeFlag os.FileMode
 
-	return files
+func (m *fileModeFlag) String() string {
+	return fmt.Sprintf("%#o", os.FileMode(*m))
 }
 
-func readFile(path string) (string, error) {
-	data, err := os.ReadFile(path)
+func (m *fileModeFlag) Set(value string) error {
+	mode, err := strconv.ParseUint(value, 8, 32)
 	if err != nil {
-		return "", fmt.Errorf("read %s file: %w", path, err)
+		return fmt.Errorf("invalid octal file mode %q: %w", value, err)
 	}
+	if os.FileMode(mode)&^os.ModePerm != 0 {
+		return fmt.Errorf("invalid file mode %q: must be permission bits", value)
+	}
+	*m = fileModeFlag(mode)
 
-	body := string(data)
-	body = strings.ReplaceAll(body, `"cmd`, `"`+flagModule)
-	body = strings.ReplaceAll(body, `"internal`, `"`+flagModule)
-	body = strings.ReplaceAll(body, `/internal`, ``)
+	return nil
+}
+
+// list of -output values.
+const (
+	outputFiles = "files"
+	outputPatch = "patch"
+)
 
-	return body, nil
+var (
+	flagPackages                 stringsFlag
+	flagPackagesFile             string
+	flagModule                   string
+	flagSrc                      string
+	flagSrcZip                   string
+	flagRequireGoVersion         string
+	flagModuleSource             string
+	flagDist                     string
+	flagCopyMode                 string
+	flagVerbatimDst              string
+	flagCopyDocGo                bool
+	flagNormalizeImportsOrder    bool
+	flagPreserveImportComments   bool
+	flagOnMissing                string
+	flagOnCollision              string
+	flagProgressJSON             bool
+	flagRenameFile               = make(mapFlag)
+	flagVerifyNoTestOnlyDepsLeak bool
+	flagVerify                   bool
+	flagVerifyVet                bool
+	flagMarkGenerated            bool
+	flagNoHeader                 bool
+	flagGeneratedMarker          string
+	flagVerifyGenerated          bool
+	flagVerifyGofmt              bool
+	flagReplaceBuildTag                       = make(mapFlag)
+	flagDirMode                  fileModeFlag = 0o755
+	flagGoCache                  string
+	flagIsolate                  bool
+	flagSizes                    bool
+	flagSummaryTable             bool
+	flagMeasureRewriteImpact     bool
+	flagAllowDangerous           bool
+	flagAllowOverwrite           bool
+	flagImportComment            string
+	flagLayout                   string
+	flagAsmIndent                string
+	flagDstFileSuffix            string
+	flagAllowImport              listFlag
+	flagCompactOutput            bool
+	flagCompactMaxFiles          int
+	flagCompactMaxBytes          int
+	flagStrict                   bool
+	flagSkipContent              *regexp.Regexp
+	flagAmalgamate               bool
+	flagValidateNoDuplicateDecls bool
+	flagCheckLicenseHeaders      bool
+	flagLicense                  string
+	flagTest                     bool
+	flagDeepTestDeps             bool
+	flagNoTests                  bool
+	flagNoXTests                 bool
+	flagXTestDir                 bool
+	flagNoTestdata               bool
+	flagPrefer                   string
+	flagNoAsm                    bool
+	flagCopyVendor               bool
+	flagAllFiles                 bool
+	flagResolveRoot              string
+	flagFollowLinkname           bool
+	flagJobs                     int
+	flagPlatforms                stringsFlag
+	flagGOOS                     stringsFlag
+	flagGOARCH                   stringsFlag
+	flagCleanupEmpty             bool
+	flagDryRun                   bool
+	flagOutput                   string
+	flagListExternalDeps         bool
+	flagFailFast                 bool
+	flagKeepGoing                bool
+	flagEnv                      listFlag
+	flagOnlyPackage              string
+	flagFromGoMod                bool
+	flagValidateBuildTags        bool
+	flagVersionDir               bool
+	flagProvenanceJSON           string
+	flagGitProvenance            bool
+	flagResolveAliasCollisions   bool
+	flagMaxFileSize              int64
+	flagSkip                     stringsFlag
+	flagSkipGenerated            bool
+	flagEmitScript               string
+	flagRewriteTestdataPaths     bool
+	flagIgnorePrefix             listFlag
+	flagExclude                  stringsFlag
+	flagExcludeMap               = make(mapFlag)
+	flagStrictImports            bool
+	flagOrphans                  bool
+	flagTimeoutTotal             time.Duration
+	flagStripDirective           listFlag
+	flagStripLinkname            bool
+	flagPrune                    bool
+	flagKeepSymbols              stringsFlag
+	flagManifest                 string
+	flagNoManifest               bool
+	flagCheckStale               bool
+	flagCheck                    bool
+	flagCheckDiffstat            bool
+	flagPackageAlias             string
+	flagOverlay                  string
+	flagManifestFormat           string
+	flagHashAlgo                 string
+	flagStampVersion             bool
+	flagEmitGenerate             bool
+	flagAllowedStd               string
+	flagRenameReceiver           = make(mapFlag)
+	flagRenameMap                string
+	flagRewriteXTestName         = make(mapFlag)
+	flagMap                      stringsFlag
+	flagRewrite                  listFlag
+	flagRewriteFile              string
+	flagSymlinkAssets            bool
+	flagRewriteEmbedPattern      = make(mapFlag)
+	flagTagsReport               bool
+	flagAudit                    bool
+	flagFailOnLinkname           bool
+	flagGoMod                    bool
+	flagInitModule               bool
+	flagInit                     bool
+	flagForce                    bool
+	flagUpdate                   bool
+	flagTidy                     bool
+	flagWriteGoMod               bool
+	flagDowngradeTo              string
+	flagVerbose                  bool
+	flagQuiet                    bool
+	flagLog                      string
+	flagConfig                   string
+	flagInitConfig               string
+)
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		if errors.Is(err, errDrift) {
+			os.Exit(exitDrift)
+		}
+		os.Exit(1)
+	}
 }
 
-func writeFile(dir, name, body string) error {
-	if err := os.MkdirAll(dir, 0o755); err != nil {
+func run() error {
+	flag.Var(&flagPackages, "package", "comma separated stdlib packages or patterns such as cmd/compile/internal/... to copy, each expanded package being a root (repeatable)")
+	flag.StringVar(&flagPackagesFile, "packages-file", "", "file of the newline separated packages to copy along with -package, or - for stdin")
+	flag.StringVar(&flagModule, "module", "", "module import path")
+	flag.StringVar(&flagSrc, "src", runtime.GOROOT(), "src directory")
+	flag.StringVar(&flagRequireGoVersion, "require-go-version", "", "abort unless the Go version of the source tree is of the version prefix such as 1.22")
+	flag.StringVar(&flagSrcZip, "src-zip", "", "zip archive of the Go source tree used instead of -src")
+	flag.StringVar(&flagModuleSource, "module-source", "", "copy the internal packages of the module in path@version form resolved from the module cache instead of the std ones of -src")
+	flag.StringVar(&flagDist, "dst", ".", "dist directory")
+	flag.StringVar(&flagCopyMode, "copy-mode", copystd.CopyRewrite, "rewrite the imports of the copied files, copy them verbatim for archival, or both into -dst and -verbatim-dst respectively")
+	flag.StringVar(&flagVerbatimDst, "verbatim-dst", "", "directory of the verbatim copy with -copy-mode both")
+	flag.BoolVar(&flagCopyDocGo, "copy-doc-go", true, "copy doc.go files even if filtered out, unless excluded by -skip")
+	flag.StringVar(&flagOnMissing, "on-missing", copystd.OnMissingLeave, "policy for unresolved internal imports: error, stub or leave")
+	flag.StringVar(&flagOnCollision, "on-collision", copystd.OnCollisionError, "policy for the packages flattened to the same directory such as internal/trace and cmd/trace: error, or suffix to copy the latter to trace_cmd")
+	flag.BoolVar(&flagProgressJSON, "progress-json", false, "emit newline delimited JSON progress events to stderr")
+	flag.Var(flagRenameFile, "rename-file", "rename the destination file of the old base name or source path to new, in old=new form (repeatable)")
+	flag.BoolVar(&flagVerify, "verify", false, "run go build ./... in -dst after copying and fail if the copied tree does not compile, reporting the source package of each failure; skipped with a warning if -dst is in no module")
+	flag.BoolVar(&flagVerifyVet, "verify-vet", false, "also run go vet ./... in -dst with -verify")
+	flag.BoolVar(&flagVerifyNoTestOnlyDepsLeak, "verify-no-test-only-deps-leak", false, "verify the non-test files only import the copied packages")
+	flag.BoolVar(&flagMarkGenerated, "mark-generated", true, "mark the copied Go files as generated code by the -header line")
+	flag.BoolVar(&flagNoHeader, "no-header", false, "copy the Go files without the -header line, same as -mark-generated=false")
+	flag.StringVar(&flagGeneratedMarker, "generated-marker", copystd.DefaultHeader, "template of the marker line inserted after the copyright block by -mark-generated, with the {{.SrcPath}}, {{.GoVersion}} and {{.Module}} fields")
+	flag.StringVar(&flagGeneratedMarker, "header", copystd.DefaultHeader, "alias of -generated-marker")
+	flag.BoolVar(&flagVerifyGofmt, "verify-gofmt", false, "fail if any copied Go file would be changed by gofmt")
+	flag.BoolVar(&flagVerifyGenerated, "verify-generated", false, "fail if any copied Go file lacks the -generated-marker line, such as with -no-header")
+	flag.Var(flagReplaceBuildTag, "replace-build-tag", "replace the build tag in the build constraint lines, in old=new form (repeatable)")
+	flag.Var(&flagDirMode, "dir-mode", "octal permission bits of the created directories")
+	flag.StringVar(&flagGoCache, "gocache", "", "GOCACHE directory used by go list")
+	flag.BoolVar(&flagIsolate, "isolate", false, "use a temporary GOCACHE unless -gocache is given")
+	flag.BoolVar(&flagSizes, "sizes", false, "report the number of files and bytes of each copied package")
+	flag.BoolVar(&flagSummaryTable, "summary-table", false, "print the copied packages as a table of the files, bytes and status at the end")
+	flag.BoolVar(&flagMeasureRewriteImpact, "measure-rewrite-impact", false, "report the number of the import lines, the linknames and the comments changed by the rewrite and the files unchanged beyond formatting")
+	flag.BoolVar(&flagAllowDangerous, "allow-dangerous", false, "allow -dst to be within -src")
+	flag.BoolVar(&flagAllowOverwrite, "allow-overwrite", false, "let the last source file win when two source files are copied to the same destination file")
+	flag.StringVar(&flagDstFileSuffix, "dst-file-suffix", "", "append the suffix such as _v121 to the base name of the copied Go files, before their _GOOS, _GOARCH and _test suffixes")
+	flag.StringVar(&flagAsmIndent, "canonicalize-whitespace-in-asm", "", "normalize the indentation of the assembly files to tab or space, leaving the instructions and operands as is")
+	flag.StringVar(&flagLayout, "layout", copystd.LayoutFlatten, "destination layout of the packages: flatten drops the leading cmd and the internal path elements, preserve keeps them, such as <dst>/cmd/compile/internal/syntax")
+	flag.StringVar(&flagImportComment, "import-comment", copystd.ImportCommentKeep, "handling of the canonical import comments: keep, rewrite or strip")
+	flag.Var(&flagAllowImport, "allow-import", "allow the non-std import path or path/... pattern to be left uncopied; any other non-std import is an error (repeatable)")
+	flag.BoolVar(&flagCompactOutput, "compact-output", false, "merge small packages imported by a single package into the importer")
+	flag.IntVar(&flagCompactMaxFiles, "compact-max-files", 2, "maximum number of Go files of the package merged by -compact-output")
+	flag.IntVar(&flagCompactMaxBytes, "compact-max-bytes", 8192, "maximum total bytes of the package merged by -compact-output")
+	flag.BoolVar(&flagStrict, "strict", false, "abort instead of warning on the incomplete packages and the failed checks")
+	flag.Func("skip-content", "skip the files whose content matches the regexp", func(value string) (err error) {
+		flagSkipContent, err = regexp.Compile(value)
+		return err
+	})
+	flag.BoolVar(&flagAmalgamate, "amalgamate", false, "concatenate the non-test Go files of each package into a single <package>.go")
+	flag.BoolVar(&flagValidateNoDuplicateDecls, "validate-no-duplicate-decls", false, "with -amalgamate, fail before writing if the files declare the same top-level name, such as the files for the different -platforms")
+	flag.BoolVar(&flagCheckLicenseHeaders, "check-license-headers", false, "warn, or with -strict fail, if a copied Go file has no license header")
+	flag.IntVar(&flagJobs, "j", runtime.NumCPU(), "number of packages copied concurrently, 1 to copy serially and print the messages in a stable order")
+	flag.IntVar(&flagJobs, "parallel", runtime.NumCPU(), "alias of -j")
+	flag.IntVar(&flagJobs, "jobs", runtime.NumCPU(), "alias of -j")
+	flag.BoolVar(&flagFollowLinkname, "follow-linkname", false, "also copy the internal packages referenced by the //go:linkname directives of the copied packages")
+	flag.StringVar(&flagLicense, "license", "", "file of the license header prepended to each copied Go file after the build constraints, keeping the original header")
+	flag.BoolVar(&flagTest, "test", false, "resolve with go list -test -compiled to follow the dependencies of the test variants")
+	flag.BoolVar(&flagDeepTestDeps, "deep-test-deps", false, "with -test, also follow the test imports of the dependencies transitively, not only the ones of the -package")
+	flag.BoolVar(&flagNoTests, "no-tests", false, "exclude the _test.go files from the copy and do not follow their imports with -test")
+	flag.StringVar(&flagResolveRoot, "resolve-root", "", "limit the packages to copy to the ones under the source directory, relative to the src directory of the source tree unless absolute; the others are ignored")
+	flag.BoolVar(&flagAllFiles, "all-files", false, "copy all the Go files ignored by the build constraints, even the ones no target platform of -goos, -goarch or -platforms can build")
+	flag.BoolVar(&flagAllFiles, "all-platforms", false, "alias of -all-files")
+	flag.StringVar(&flagPrefer, "prefer", "", "implementation variant kept for the packages gated by the purego build tag: asm or pure, which also drops the assembly files not needed by the Go files")
+	flag.BoolVar(&flagCopyVendor, "copy-vendor", false, "copy the packages vendored by the source tree, such as golang.org/x/net/idna, under <module>/x instead of reporting the modules to require, which -gomod and -init-module add")
+	flag.BoolVar(&flagNoAsm, "no-asm", false, "drop the assembly, C, header and cgo files to copy the pure Go subset; the Go files declaring the assembly functions no longer build")
+	flag.BoolVar(&flagNoXTests, "no-xtests", false, "exclude the external _test package files from the copy and do not follow their imports with -test")
+	flag.BoolVar(&flagXTestDir, "xtest-dir", false, "copy the external _test package files into the sibling <package>_test directory; the ones using export_test.go or the relative testdata paths no longer build")
+	flag.BoolVar(&flagNoTestdata, "no-testdata", false, "do not copy the testdata directories of the packages, which -no-tests implies")
+	flag.Var(&flagPlatforms, "platforms", "comma separated GOOS/GOARCH platforms whose union of the files is copied, reporting the platforms of each file (repeatable)")
+	flag.Var(&flagGOOS, "goos", "comma separated GOOS to copy the files for along with -goarch, defaults to the host GOOS if only -goarch is given (repeatable)")
+	flag.Var(&flagGOARCH, "goarch", "comma separated GOARCH to copy the files for along with -goos, defaults to the host GOARCH if only -goos is given (repeatable)")
+	flag.BoolVar(&flagCleanupEmpty, "cleanup-empty", false, "remove the empty directories under -dst after copying")
+	flag.BoolVar(&flagListExternalDeps, "list-external-deps", false, "resolve the packages to copy and print their imports outside of them across the whole closure, copying nothing")
+	flag.BoolVar(&flagDryRun, "dry-run", false, "print the source, the destination and whether it is new or overwritten for each file and the totals without writing anything, failing if the plan is empty or a package failed to load")
+	flag.StringVar(&flagOutput, "output", outputFiles, "files to write the copy, or patch to write nothing but print the changes to the existing -dst as a unified diff to apply with git apply --directory=<dst>, failing if any")
+	flag.BoolVar(&flagFailFast, "fail-fast", true, "abort the run at the first error of a package")
+	flag.BoolVar(&flagKeepGoing, "keep-going", false, "continue past the errors of each package and report them all at the end, the same as -fail-fast=false")
+	flag.Var(&flagEnv, "env", "environment variable forwarded to go list, in KEY=VALUE form (repeatable)")
+	flag.BoolVar(&flagFromGoMod, "from-gomod", false, "also copy the packages the module in the -dst directory imports, by their std import paths or by the import paths they are rewritten to")
+	flag.StringVar(&flagOnlyPackage, "only-package", "", "re-copy only the package without resolving its dependencies, instead of -package")
+	flag.BoolVar(&flagValidateBuildTags, "validate-build-tags", false, "validate the syntax of the build constraints of the copied files")
+	flag.BoolVar(&flagVersionDir, "version-dir", false, "copy under <dst>/<goversion> and import as <module>/<goversion> by the source Go version")
+	flag.StringVar(&flagProvenanceJSON, "provenance-json", "", "write the provenance of each copied file to the JSON file")
+	flag.BoolVar(&flagGitProvenance, "git-provenance", false, "record the last git commit of each source file in -provenance-json")
+	flag.BoolVar(&flagResolveAliasCollisions, "resolve-alias-collisions", false, "alias the imports whose package names collide after the rewrite")
+	flag.Var(&flagSkip, "skip", "comma separated glob patterns of the files to skip, matched against the base name, or the path relative to the source root such as **/mkbuiltin.go if with a slash (repeatable)")
+	flag.BoolVar(&flagSkipGenerated, "skip-generated", false, "skip the files having the \"Code generated ... DO NOT EDIT.\" header")
+	flag.Int64Var(&flagMaxFileSize, "max-file-size", 0, "skip the files larger than the bytes, or abort with -strict (0 means no limit)")
+	flag.StringVar(&flagEmitScript, "emit-script", "", "write the shell script of the planned operations to the file instead of copying")
+	flag.BoolVar(&flagRewriteTestdataPaths, "rewrite-relative-testdata-paths", false, "rewrite the import paths of the copied packages in the string literals of the test files")
+	flag.Var(&flagIgnorePrefix, "ignore-prefix", "never copy nor rewrite the imports of the path or path/... pattern even if internal (repeatable)")
+	flag.Var(&flagExclude, "exclude", "comma separated import paths or path/... patterns to prune from the packages to copy along with their dependencies, as -ignore-prefix")
+	flag.Var(flagExcludeMap, "exclude-map", "rewrite the imports of the excluded package, or of the packages under it, in old=new form (repeatable)")
+	flag.BoolVar(&flagStrictImports, "strict-imports", false, "abort on the imports which are neither std, copied, allowed by -allow-import nor under -ignore-prefix")
+	flag.BoolVar(&flagOrphans, "orphans", false, "report the Go files under -dst which are not written by the run")
+	flag.DurationVar(&flagTimeoutTotal, "timeout-total", 0, "abort the whole run after the duration (0 means no timeout)")
+	flag.BoolVar(&flagStripLinkname, "strip-linkname", false, "remove the //go:linkname directives from the copied files along with the function declarations without body they pull, warning about the ones the package has no fallback of")
+	flag.BoolVar(&flagPrune, "prune", false, "remove the top-level declarations unreachable from the exported ones of the -package packages, or from -keep-symbols, along with the files and the packages left empty, keeping the methods of the kept types, init and the declarations with a directive")
+	flag.Var(&flagKeepSymbols, "keep-symbols", "comma separated `import/path.Name` roots of -prune instead of the exported declarations of the -package packages (repeatable)")
+	flag.Var(&flagStripDirective, "strip-directive", "remove the directive comment lines of the name such as go:debug from the copied files (repeatable)")
+	flag.BoolVar(&flagCheckStale, "check-stale", false, "write nothing but report the packages whose files changed in -src since the -manifest was written, failing if any")
+	flag.BoolVar(&flagCheck, "check", false, "write nothing but compare the copy with -dst, reporting the files added, removed and changed upstream by package and exiting with 3 if any")
+	flag.BoolVar(&flagCheckDiffstat, "check-diffstat", false, "print the numbers of the lines added and deleted of each file with -check")
+	flag.StringVar(&flagOverlay, "overlay", "", "write the go build -overlay JSON replacing the source files with the copied files to the file")
+	flag.StringVar(&flagPackageAlias, "package-alias", "", "write the recommended import aliases of the copied packages, disambiguating the ones sharing a name, to the JSON file")
+	flag.StringVar(&flagManifest, "manifest", "", "write the source Go version and the path, size, digest and source of each copied file to the file, reporting the files new, changed or removed since the previous one (default "+copystd.DefaultManifest+" in -dst)")
+	flag.BoolVar(&flagNoManifest, "no-manifest", false, "write no -manifest")
+	flag.StringVar(&flagHashAlgo, "hash-algo", copystd.HashSHA256, "digest algorithm of -manifest: sha256, sha384 or sha512")
+	flag.StringVar(&flagManifestFormat, "manifest-format", copystd.ManifestJSON, "format of -manifest: json or csv")
+	flag.BoolVar(&flagEmitGenerate, "emit-generate", false, "generate gen.go in -dst with the go:generate directive of the command line, so that go generate in -dst reproduces the copy")
+	flag.BoolVar(&flagStampVersion, "stamp-version", false, "generate version.go in -dst declaring the source Go version and the copy time")
+	flag.StringVar(&flagAllowedStd, "allowed-std", "", "file of the 'go list std' output of the target Go to check the std imports against")
+	flag.Var(flagRenameReceiver, "rename-receiver", "rename the method receivers of the type to name, in type=name form (repeatable)")
+	flag.Var(&flagMap, "map", "comma separated destinations of the packages in import-path=path form, path relative to -module, for both the imports and the destination directory of the package only, winning over -rewrite (repeatable)")
+	flag.Var(&flagRewrite, "rewrite", "rewrite the import path prefix to the path relative to -module, in from=to form, for both the imports and the destination directories; the first matching rule wins over the default rewrite (repeatable)")
+	flag.StringVar(&flagRewriteFile, "rewrite-file", "", `JSON file of the -rewrite rules such as [{"from": "internal/race", "to": "runtime/race"}], applied after the -rewrite flags`)
+	flag.Var(flagRewriteXTestName, "rewrite-xtest-name", "rename the external test package of the import path to name_test, in path=name form, overriding -rename-map (repeatable)")
+	flag.StringVar(&flagRenameMap, "rename-map", "", "file of the package renames in old-path=new-name form per line, applied to the package clauses, the directories and the imports")
+	flag.BoolVar(&flagSymlinkAssets, "symlink-assets", false, "symlink the non-Go source files such as .s and .h to the source instead of copying them")
+	flag.Var(flagRewriteEmbedPattern, "rewrite-embed-pattern", "relocate the copied or linked embedded files under old to new and rewrite the //go:embed patterns, in old=new form (repeatable)")
+	flag.BoolVar(&flagAudit, "audit", false, "report the copied Go files importing unsafe or using //go:linkname and the other compiler directives restricted to the std, such as //go:cgo_import_dynamic, along with the reason")
+	flag.BoolVar(&flagFailOnLinkname, "fail-on-linkname", false, "report as -audit and fail if any copied Go file uses //go:linkname or the other compiler directives restricted to the std")
+	flag.BoolVar(&flagTagsReport, "tags-report", false, "report the build constraints of the copied files and the GOOS/GOARCH ports the copied set supports")
+	flag.BoolVar(&flagGoMod, "gomod", false, "generate go.mod of -module in -dst with the go directive of the source Go version")
+	flag.BoolVar(&flagInit, "init", false, "create -dst as a ready to build module: go.mod as -init-module unless -gomod, and doc.go of the module root listing the copied packages")
+	flag.BoolVar(&flagInitModule, "init-module", false, "generate go.mod of -module in -dst with the go directive of the go command unless go.mod exists")
+	flag.BoolVar(&flagForce, "force", false, "overwrite the existing go.mod with -init-module, and the locally modified files with -update")
+	flag.BoolVar(&flagUpdate, "update", false, "skip the files unchanged by the copy and, failing at the end, the ones modified locally since -manifest was written")
+	flag.BoolVar(&flagWriteGoMod, "write-gomod", false, "add the requirements of the vendored modules imported by the copied files, at the versions of vendor/modules.txt, to the go.mod governing -dst, or print the go get commands to run if the version of any import is unknown")
+	flag.BoolVar(&flagTidy, "tidy", false, "run go mod tidy in -dst after copying")
+	flag.StringVar(&flagDowngradeTo, "downgrade-to", "", "report the language features newer than the Go version such as 1.20 used by the copied files")
+	flag.BoolVar(&flagNormalizeImportsOrder, "normalize-imports-order", false, "sort imports into std, external and local groups regardless of goimports version")
+	flag.BoolVar(&flagPreserveImportComments, "preserve-import-comments", false, "keep the import block comments not attached to an import, such as the group headings, re-attached to the following import with -normalize-imports-order")
+	flag.BoolVar(&flagVerbose, "v", false, "print the debug messages such as the destination and the time to copy each file")
+	flag.BoolVar(&flagQuiet, "quiet", false, "print only the errors")
+	flag.BoolVar(&flagQuiet, "q", false, "alias of -quiet")
+	flag.StringVar(&flagLog, "log", copystd.LogText, "format of the messages: text prints the warnings and the errors to stderr, json prints a JSON object per event such as {\"action\":\"copy\"} to stdout")
+	flag.StringVar(&flagConfig, "config", "", "JSON file of the flag values keyed by the flag name, such as {\"package\": [\"internal/goarch\"], \"dry-run\": true}, overridden by the command line and the environment variables")
+	flag.StringVar(&flagInitConfig, "init-config", "", "write the flags given on the command line and by -config to the JSON file for -config instead of copying")
+	flag.Parse()
+	if err := setFlagsFromEnv(flag.CommandLine); err != nil {
 		return err
 	}
+	if flagConfig != "" {
+		if err := setFlagsFromConfig(flag.CommandLine, flagConfig); err != nil {
+			return err
+		}
+	}
+	if flagInitConfig != "" {
+		return writeConfig(flag.CommandLine, flagInitConfig)
+	}
+	if flagVerbose && flagQuiet {
+		return errors.New("-v and -quiet are mutually exclusive")
+	}
 
-	imports.LocalPrefix = flagModule
-	data, err := imports.Process(name, []byte(body), &imports.Options{
-		TabWidth:  8,
-		TabIndent: true,
-		Comments:  true,
-	})
+	manifest, err := manifestPath(flagDist, flagManifest, flagNoManifest)
 	if err != nil {
-		return fmt.Errorf("process goimports: %w", err)
+		return err
+	}
+	markGenerated, err := headerEnabled(flag.CommandLine, flagMarkGenerated, flagNoHeader)
+	if err != nil {
+		return err
 	}
 
-	filename := filepath.Join(dir, name)
-	if err := os.WriteFile(filename, data, 0644); err != nil {
-		return fmt.Errorf("write %s file: %w", filename, err)
+	logLevel := copystd.LogInfo
+	switch {
+	case flagVerbose:
+		logLevel = copystd.LogDebug
+	case flagQuiet:
+		logLevel = copystd.LogError
+	case flagCheck:
+		// only the report is printed on success
+		logLevel = copystd.LogWarn
+	}
+
+	packages := []string(flagPackages)
+	if flagPackagesFile != "" {
+		pkgs, err := readPackagesFile(flagPackagesFile)
+		if err != nil {
+			return err
+		}
+		packages = append(packages, pkgs...)
+	}
+
+	var generate []string
+	if flagEmitGenerate {
+		if flagPackagesFile == "-" {
+			return errors.New("-emit-generate cannot be used with -packages-file -, which go generate cannot reproduce")
+		}
+		cmd, err := generateCommand(flag.CommandLine, os.Args[1:], flagDist)
+		if err != nil {
+			return fmt.Errorf("-emit-generate: %w", err)
+		}
+		generate = cmd
+	}
+
+	var progress io.Writer
+	if flagProgressJSON {
+		progress = os.Stderr
+	}
+
+	c := &copystd.Copier{
+		Packages:                 uniq(packages),
+		OnlyPackage:              flagOnlyPackage,
+		FromGoMod:                flagFromGoMod,
+		Module:                   flagModule,
+		Src:                      flagSrc,
+		SrcZip:                   flagSrcZip,
+		RequireGoVersion:         flagRequireGoVersion,
+		ModuleSource:             flagModuleSource,
+		Dst:                      flagDist,
+		CopyMode:                 flagCopyMode,
+		VerbatimDst:              flagVerbatimDst,
+		Env:                      flagEnv,
+		GoCache:                  flagGoCache,
+		Isolate:                  flagIsolate,
+		Test:                     flagTest,
+		DeepTestDeps:             flagDeepTestDeps,
+		NoTests:                  flagNoTests,
+		NoXTests:                 flagNoXTests,
+		XTestDir:                 flagXTestDir,
+		NoTestdata:               flagNoTestdata,
+		Prefer:                   flagPrefer,
+		NoAsm:                    flagNoAsm,
+		CopyVendor:               flagCopyVendor,
+		AllFiles:                 flagAllFiles,
+		ResolveRoot:              flagResolveRoot,
+		FollowLinkname:           flagFollowLinkname,
+		Jobs:                     flagJobs,
+		Platforms:                flagPlatforms,
+		GOOS:                     flagGOOS,
+		GOARCH:                   flagGOARCH,
+		Timeout:                  flagTimeoutTotal,
+		CopyDocGo:                flagCopyDocGo,
+		OnMissing:                flagOnMissing,
+		OnCollision:              flagOnCollision,
+		RenameFile:               flagRenameFile,
+		ReplaceBuildTag:          flagReplaceBuildTag,
+		DirMode:                  os.FileMode(flagDirMode),
+		AllowDangerous:           flagAllowDangerous,
+		AllowOverwrite:           flagAllowOverwrite,
+		ImportComment:            flagImportComment,
+		Layout:                   flagLayout,
+		AsmIndent:                flagAsmIndent,
+		DstFileSuffix:            flagDstFileSuffix,
+		AllowImport:              flagAllowImport,
+		IgnorePrefix:             append(flagIgnorePrefix, flagExclude...),
+		ExcludeMap:               flagExcludeMap,
+		StrictImports:            flagStrictImports,
+		Strict:                   flagStrict,
+		SkipContent:              flagSkipContent,
+		MaxFileSize:              flagMaxFileSize,
+		Skip:                     flagSkip,
+		SkipGenerated:            flagSkipGenerated,
+		StripDirective:           flagStripDirective,
+		StripLinkname:            flagStripLinkname,
+		Prune:                    flagPrune,
+		KeepSymbols:              flagKeepSymbols,
+		RenameReceiver:           flagRenameReceiver,
+		RenameMap:                flagRenameMap,
+		RewriteXTestName:         flagRewriteXTestName,
+		Map:                      flagMap,
+		Rewrite:                  flagRewrite,
+		RewriteFile:              flagRewriteFile,
+		RewriteEmbedPattern:      flagRewriteEmbedPattern,
+		SymlinkAssets:            flagSymlinkAssets,
+		NormalizeImportsOrder:    flagNormalizeImportsOrder,
+		PreserveImportComments:   flagPreserveImportComments,
+		MarkGenerated:            markGenerated,
+		GeneratedMarker:          flagGeneratedMarker,
+		VerifyGenerated:          flagVerifyGenerated,
+		VerifyGofmt:              flagVerifyGofmt,
+		CompactOutput:            flagCompactOutput,
+		CompactMaxFiles:          flagCompactMaxFiles,
+		CompactMaxBytes:          flagCompactMaxBytes,
+		Amalgamate:               flagAmalgamate,
+		ValidateNoDuplicateDecls: flagValidateNoDuplicateDecls,
+		ResolveAliasCollisions:   flagResolveAliasCollisions,
+		RewriteTestdataPaths:     flagRewriteTestdataPaths,
+		VersionDir:               flagVersionDir,
+		StampVersion:             flagStampVersion,
+		GenerateCommand:          generate,
+		GoMod:                    flagGoMod,
+		InitModule:               flagInitModule,
+		Init:                     flagInit,
+		Force:                    flagForce,
+		Update:                   flagUpdate,
+		Tidy:                     flagTidy,
+		WriteGoMod:               flagWriteGoMod,
+		CheckLicenseHeaders:      flagCheckLicenseHeaders,
+		License:                  flagLicense,
+		ValidateBuildTags:        flagValidateBuildTags,
+		VerifyNoTestOnlyDepsLeak: flagVerifyNoTestOnlyDepsLeak,
+		VerifyBuild:              flagVerify,
+		VerifyVet:                flagVerifyVet,
+		AllowedStd:               flagAllowedStd,
+		DowngradeTo:              flagDowngradeTo,
+		Progress:                 progress,
+		EmitScript:               flagEmitScript,
+		ProvenanceJSON:           flagProvenanceJSON,
+		GitProvenance:            flagGitProvenance,
+		Manifest:                 manifest,
+		PackageAlias:             flagPackageAlias,
+		Overlay:                  flagOverlay,
+		ManifestFormat:           flagManifestFormat,
+		HashAlgo:                 flagHashAlgo,
+		Sizes:                    flagSizes,
+		SummaryTable:             flagSummaryTable,
+		MeasureRewriteImpact:     flagMeasureRewriteImpact,
+		TagsReport:               flagTagsReport,
+		Audit:                    flagAudit,
+		FailOnLinkname:           flagFailOnLinkname,
+		Orphans:                  flagOrphans,
+		CleanupEmpty:             flagCleanupEmpty,
+		DryRun:                   flagDryRun,
+		ListExternalDeps:         flagListExternalDeps,
+		KeepGoing:                flagKeepGoing || !flagFailFast,
+		LogLevel:                 logLevel,
+		LogFormat:                flagLog,
+	}
+
+	// Ctrl-C cancels the running go commands and the copy of the packages
+	// not started yet, leaving the packages copied so far under -dst
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	switch flagOutput {
+	case outputFiles:
+	case outputPatch:
+		changed, err := c.Patch(ctx, os.Stdout, nil)
+		if err != nil {
+			return err
+		}
+		if changed {
+			return errors.New("-output=patch: the copy differs from -dst")
+		}
+		return nil
+	default:
+		return fmt.Errorf("invalid -output value: %q", flagOutput)
+	}
+
+	if flagCheck {
+		changed, changes, err := c.Check(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if !changed {
+			fmt.Println("up to date")
+			return nil
+		}
+		printDrift(os.Stdout, changes, flagCheckDiffstat)
+		return errDrift
+	}
+
+	if flagCheckStale {
+		stale, err := c.CheckStale(ctx, nil)
+		if err != nil {
+			return err
+		}
+		for _, pkg := range stale {
+			fmt.Printf("stale: %s\n", pkg)
+		}
+		if len(stale) > 0 {
+			return fmt.Errorf("%d packages are stale against -src", len(stale))
+		}
+		return nil
+	}
+
+	if err := c.Run(ctx); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("interrupted, the copy under %s is incomplete: %w", flagDist, err)
+		}
+		return err
 	}
 
 	return nil
@@ -0,0 +1,324 @@
+// Copyright 2021 The go-copystd Authors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSetFlagsFromEnv(t *testing.T) {
+	t.Setenv("COPYSTD_PACKAGE", "internal/foo,internal/bar")
+	t.Setenv("COPYSTD_MODULE", "example.com/env")
+	t.Setenv("COPYSTD_DST", "env")
+	t.Setenv("COPYSTD_DRY_RUN", "true")
+
+	var (
+		packages stringsFlag
+		module   string
+		dst      string
+		dryRun   bool
+	)
+	fs := flag.NewFlagSet("go-copystd", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.Var(&packages, "package", "")
+	fs.StringVar(&module, "module", "", "")
+	fs.StringVar(&dst, "dst", "", "")
+	fs.BoolVar(&dryRun, "dry-run", false, "")
+	if err := fs.Parse([]string{"-dst", "cli", "-module=example.com/cli"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := setFlagsFromEnv(fs); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := (stringsFlag{"internal/foo", "internal/bar"}); !reflect.DeepEqual(packages, want) {
+		t.Errorf("-package: got %q, want %q of COPYSTD_PACKAGE", packages, want)
+	}
+	if !dryRun {
+		t.Error("-dry-run: got false, want true of COPYSTD_DRY_RUN")
+	}
+	// the command line wins
+	if module != "example.com/cli" {
+		t.Errorf("-module: got %q, want %q of the command line", module, "example.com/cli")
+	}
+	if dst != "cli" {
+		t.Errorf("-dst: got %q, want %q of the command line", dst, "cli")
+	}
+
+	t.Setenv("COPYSTD_DRY_RUN", "maybe")
+	fs = flag.NewFlagSet("go-copystd", flag.ContinueOnError)
+	fs.BoolVar(&dryRun, "dry-run", false, "")
+	if err := setFlagsFromEnv(fs); err == nil || !strings.Contains(err.Error(), `invalid COPYSTD_DRY_RUN value "maybe"`) {
+		t.Errorf("got error %v, want the one of COPYSTD_DRY_RUN", err)
+	}
+}
+
+func TestSetFlagsFromConfig(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "copystd.json")
+	data := `{"package": ["internal/foo", "internal/bar"], "module": "example.com/config", "dry-run": true, "jobs": 2}`
+	if err := os.WriteFile(config, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		packages stringsFlag
+		module   string
+		dryRun   bool
+		jobs     int
+	)
+	fs := flag.NewFlagSet("go-copystd", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.Var(&packages, "package", "")
+	fs.StringVar(&module, "module", "", "")
+	fs.BoolVar(&dryRun, "dry-run", false, "")
+	fs.IntVar(&jobs, "jobs", 0, "")
+	if err := fs.Parse([]string{"-module=example.com/cli"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := setFlagsFromConfig(fs, config); err != nil {
+		t.Fatal(err)
+	}
+
+	// the packages given only by the config are copied
+	if want := (stringsFlag{"internal/foo", "internal/bar"}); !reflect.DeepEqual(packages, want) {
+		t.Errorf("-package: got %q, want %q of the config", packages, want)
+	}
+	if !dryRun || jobs != 2 {
+		t.Errorf("-dry-run, -jobs: got %t, %d, want true, 2 of the config", dryRun, jobs)
+	}
+	if module != "example.com/cli" {
+		t.Errorf("-module: got %q, want %q of the command line", module, "example.com/cli")
+	}
+
+	if err := os.WriteFile(config, []byte(`{"no-such-flag": true}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := setFlagsFromConfig(fs, config); err == nil || !strings.Contains(err.Error(), `unknown key "no-such-flag"`) {
+		t.Errorf("got error %v, want the unknown key", err)
+	}
+}
+
+func TestStringsFlag(t *testing.T) {
+	tests := []struct {
+		values []string
+		want   stringsFlag
+	}{
+		{values: []string{"a, b ,"}, want: stringsFlag{"a", "b"}},
+		{values: []string{" a, ,b "}, want: stringsFlag{"a", "b"}},
+		{values: []string{"a", " b,c"}, want: stringsFlag{"a", "b", "c"}},
+		{values: []string{" , ", ""}, want: nil},
+	}
+	for _, tt := range tests {
+		var s stringsFlag
+		for _, value := range tt.values {
+			if err := s.Set(value); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if !reflect.DeepEqual(s, tt.want) {
+			t.Errorf("%q: got %q, want %q", tt.values, s, tt.want)
+		}
+	}
+}
+
+func TestGenerateCommand(t *testing.T) {
+	fs := flag.NewFlagSet("go-copystd", flag.ContinueOnError)
+	fs.String("module", "", "")
+	fs.String("src", "", "")
+	fs.String("dst", "", "")
+	fs.String("config", "", "")
+	fs.String("license", "", "")
+	fs.Var(new(stringsFlag), "package", "")
+	fs.Bool("check", false, "")
+	fs.Bool("dry-run", false, "")
+	fs.String("output", "", "")
+	fs.Bool("v", false, "")
+
+	tests := []struct {
+		args []string
+		dst  string
+		want []string
+	}{
+		{
+			args: []string{"-module", "example.com/m", "-src=/go", "-dst", "internal/std", "-package", "internal/foo, internal/bar", "-dst=other"},
+			want: []string{"go-copystd", "-module", "example.com/m", "-src=/go", "-package", "internal/foo, internal/bar"},
+		},
+		{
+			// the same command line whichever of the mode flags are given
+			args: []string{"-check", "-module", "example.com/m", "--output", "patch", "-dry-run=true", "-v", "-package", "internal/foo"},
+			want: []string{"go-copystd", "-module", "example.com/m", "-package", "internal/foo"},
+		},
+		{
+			args: []string{"-module=example.com/m", "-output=patch", "--", "-check"},
+			want: []string{"go-copystd", "-module=example.com/m", "--", "-check"},
+		},
+		{
+			// the relative paths are of the destination go generate runs in
+			args: []string{"-src", "go", "-config=copystd.json", "--license", "internal/std/LICENSE", "-dst", "internal/std"},
+			dst:  "internal/std",
+			want: []string{"go-copystd", "-src", filepath.Join("..", "..", "go"), "-config=" + filepath.Join("..", "..", "copystd.json"), "--license", "LICENSE"},
+		},
+	}
+	for _, tt := range tests {
+		got, err := generateCommand(fs, tt.args, tt.dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestManifestPath(t *testing.T) {
+	tests := []struct {
+		manifest   string
+		noManifest bool
+		want       string
+		wantErr    bool
+	}{
+		{want: filepath.Join("internal", "std", "copystd.lock")},
+		{manifest: "std.json", want: "std.json"},
+		{noManifest: true, want: ""},
+		{manifest: "std.json", noManifest: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := manifestPath(filepath.Join("internal", "std"), tt.manifest, tt.noManifest)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("-manifest %q -no-manifest=%t: got error %v, want error %t", tt.manifest, tt.noManifest, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("-manifest %q -no-manifest=%t: got %q, want %q", tt.manifest, tt.noManifest, got, tt.want)
+		}
+	}
+}
+
+func TestHeaderEnabled(t *testing.T) {
+	tests := []struct {
+		args    []string
+		want    bool
+		wantErr string
+	}{
+		{args: nil, want: true},
+		{args: []string{"-header", "Code generated by mytool. DO NOT EDIT."}, want: true},
+		{args: []string{"-no-header"}, want: false},
+		{args: []string{"-mark-generated=false"}, want: false},
+		{args: []string{"-no-header", "-header", "x"}, wantErr: "-header and -no-header are mutually exclusive"},
+		{args: []string{"-mark-generated=false", "-generated-marker", "x"}, wantErr: "-generated-marker requires -mark-generated, which is disabled"},
+	}
+	for _, tt := range tests {
+		var (
+			markGenerated bool
+			noHeader      bool
+			header        string
+		)
+		fs := flag.NewFlagSet("go-copystd", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		fs.BoolVar(&markGenerated, "mark-generated", true, "")
+		fs.BoolVar(&noHeader, "no-header", false, "")
+		fs.StringVar(&header, "generated-marker", "", "")
+		fs.StringVar(&header, "header", "", "")
+		if err := fs.Parse(tt.args); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := headerEnabled(fs, markGenerated, noHeader)
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("%q: got error %v, want %q", tt.args, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tt.args, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%q: got %t, want %t", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestEmitGenerateRun(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command not found")
+	}
+
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "bin")
+	if out, err := exec.Command("go", "build", "-o", filepath.Join(bin, "go-copystd"), ".").CombinedOutput(); err != nil {
+		t.Fatalf("build go-copystd: %v\n%s", err, out)
+	}
+	path := "PATH=" + bin + string(filepath.ListSeparator) + os.Getenv("PATH")
+
+	for _, tt := range []struct {
+		name    string
+		args    []string
+		fooPath string // of the copied foo.go relative to -dst
+	}{
+		{name: "dst", fooPath: "foo/foo.go"},
+		{name: "version dir", args: []string{"-version-dir"}, fooPath: "go1.21.3/foo/foo.go"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			// the paths of the flags are relative to the working directory
+			work := t.TempDir()
+			files := map[string]string{
+				"go/VERSION":                 "go1.21.3\n",
+				"go/src/go.mod":              "module std\n\ngo 1.21\n",
+				"go/src/internal/foo/foo.go": "package foo\n\nfunc Foo() {}\n",
+				"LICENSE.tmpl":               "Copyright The Authors.\n",
+				"out/std/go.mod":             "module example.com/m\n\ngo 1.17\n",
+			}
+			for name, data := range files {
+				filename := filepath.Join(work, filepath.FromSlash(name))
+				if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(filename, []byte(data), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			run := func(dir string, args ...string) {
+				t.Helper()
+				cmd := exec.Command(args[0], args[1:]...)
+				cmd.Dir = dir
+				cmd.Env = append(os.Environ(), path)
+				if out, err := cmd.CombinedOutput(); err != nil {
+					t.Fatalf("%q: %v\n%s", args, err, out)
+				}
+			}
+
+			args := []string{filepath.Join(bin, "go-copystd"), "-module", "example.com/m", "-src", "go", "-dst", "out/std", "-package", "internal/foo", "-license", "LICENSE.tmpl", "-no-manifest", "-emit-generate"}
+			run(work, append(args, tt.args...)...)
+			dst := filepath.Join(work, "out", "std")
+			foo := filepath.Join(dst, filepath.FromSlash(tt.fooPath))
+			want, err := os.ReadFile(foo)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Remove(foo); err != nil {
+				t.Fatal(err)
+			}
+
+			run(dst, "go", "generate", ".")
+			got, err := os.ReadFile(foo)
+			if err != nil {
+				t.Fatalf("go generate does not copy foo.go: %v", err)
+			}
+			if string(got) != string(want) {
+				t.Errorf("got foo.go by go generate\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}